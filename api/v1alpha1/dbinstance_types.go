@@ -200,7 +200,12 @@ func (dbin *DbInstance) ConvertTo(dstRaw conversion.Hub) error {
 	dst.Spec.AdminUserSecret = v1beta1.NamespacedName(dbin.Spec.AdminUserSecret)
 	dst.Spec.Backup = v1beta1.DbInstanceBackup(dbin.Spec.Backup)
 	if dbin.Spec.DbInstanceSource.Generic != nil {
-		dst.Spec.DbInstanceSource.Generic = (*v1beta1.GenericInstance)(dbin.Spec.DbInstanceSource.Generic)
+		dst.Spec.DbInstanceSource.Generic = &v1beta1.GenericInstance{
+			Host:       dbin.Spec.DbInstanceSource.Generic.Host,
+			Port:       dbin.Spec.DbInstanceSource.Generic.Port,
+			PublicIP:   dbin.Spec.DbInstanceSource.Generic.PublicIP,
+			BackupHost: dbin.Spec.DbInstanceSource.Generic.BackupHost,
+		}
 	} else if dbin.Spec.DbInstanceSource.Google != nil {
 
 		dst.Spec.DbInstanceSource.Google.APIEndpoint = dbin.Spec.DbInstanceSource.Google.APIEndpoint
@@ -210,7 +215,10 @@ func (dbin *DbInstance) ConvertTo(dstRaw conversion.Hub) error {
 	}
 	dst.Spec.Engine = dbin.Spec.Engine
 	dst.Spec.Monitoring = v1beta1.DbInstanceMonitoring(dbin.Spec.Monitoring)
-	dst.Spec.SSLConnection = v1beta1.DbInstanceSSLConnection(dbin.Spec.SSLConnection)
+	dst.Spec.SSLConnection = v1beta1.DbInstanceSSLConnection{
+		Enabled:    dbin.Spec.SSLConnection.Enabled,
+		SkipVerify: dbin.Spec.SSLConnection.SkipVerify,
+	}
 	return nil
 }
 
@@ -221,7 +229,16 @@ func (dst *DbInstance) ConvertFrom(srcRaw conversion.Hub) error {
 	dst.Spec.AdminUserSecret = NamespacedName(dbin.Spec.AdminUserSecret)
 	dst.Spec.Backup = DbInstanceBackup(dbin.Spec.Backup)
 	if dbin.Spec.DbInstanceSource.Generic != nil {
-		dst.Spec.DbInstanceSource.Generic = (*GenericInstance)(dbin.Spec.DbInstanceSource.Generic)
+		dst.Spec.DbInstanceSource.Generic = &GenericInstance{
+			Host:       dbin.Spec.DbInstanceSource.Generic.Host,
+			Port:       dbin.Spec.DbInstanceSource.Generic.Port,
+			PublicIP:   dbin.Spec.DbInstanceSource.Generic.PublicIP,
+			BackupHost: dbin.Spec.DbInstanceSource.Generic.BackupHost,
+		}
+		// v1alpha1 has a single host, the first one of a multi-host instance is used
+		if dst.Spec.DbInstanceSource.Generic.Host == "" && len(dbin.Spec.DbInstanceSource.Generic.Hosts) > 0 {
+			dst.Spec.DbInstanceSource.Generic.Host = dbin.Spec.DbInstanceSource.Generic.Hosts[0]
+		}
 	} else if dbin.Spec.DbInstanceSource.Google != nil {
 
 		dst.Spec.DbInstanceSource.Google.APIEndpoint = dbin.Spec.DbInstanceSource.Google.APIEndpoint
@@ -231,6 +248,10 @@ func (dst *DbInstance) ConvertFrom(srcRaw conversion.Hub) error {
 	}
 	dst.Spec.Engine = dbin.Spec.Engine
 	dst.Spec.Monitoring = DbInstanceMonitoring(dbin.Spec.Monitoring)
-	dst.Spec.SSLConnection = DbInstanceSSLConnection(dbin.Spec.SSLConnection)
+	// certificates of the ssl connection don't exist in v1alpha1
+	dst.Spec.SSLConnection = DbInstanceSSLConnection{
+		Enabled:    dbin.Spec.SSLConnection.Enabled,
+		SkipVerify: dbin.Spec.SSLConnection.SkipVerify,
+	}
 	return nil
 }
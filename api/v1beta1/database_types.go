@@ -18,7 +18,10 @@ package v1beta1
 
 import (
 	"errors"
+	"strings"
 
+	"github.com/kloeckner-i/db-operator/pkg/utils/naming"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -33,6 +36,58 @@ type DatabaseSpec struct {
 	SecretsTemplates  map[string]string `json:"secretsTemplates,omitempty"`
 	Postgres          Postgres          `json:"postgres,omitempty"`
 	Cleanup           bool              `json:"cleanup,omitempty"`
+	// DataSource references a Database whose content is copied into this one on creation
+	DataSource *DatabaseDataSource `json:"dataSource,omitempty"`
+	// Adopt takes over an existing database and user instead of creating new ones
+	Adopt *DatabaseAdoption `json:"adopt,omitempty"`
+	// DatabaseName overrides the generated name of the database on the server
+	DatabaseName string `json:"databaseName,omitempty"`
+	// UserName overrides the generated name of the user on the server
+	UserName string `json:"userName,omitempty"`
+	// Pooler puts a connection pooler in front of a database on a generic instance,
+	// PgBouncer for postgres and ProxySQL for mysql
+	Pooler *DatabasePooler `json:"pooler,omitempty"`
+	// IAMAuth authenticates the user of a database on a google instance with a service account instead of a password
+	IAMAuth *DatabaseIAMAuth `json:"iamAuth,omitempty"`
+}
+
+// DatabaseIAMAuth defines the service account the user of a database authenticates with.
+// The user is created as Cloud SQL iam user and granted privileges on the database, the cloud proxy of the
+// database logs in with the credentials of the service account.
+type DatabaseIAMAuth struct {
+	// ServiceAccount is the email of the google service account, e.g. app@project.iam.gserviceaccount.com
+	ServiceAccount string `json:"serviceAccount"`
+	// CredentialsSecret is a secret in the namespace of the Database with the key of the service account in credentials.json
+	CredentialsSecret string `json:"credentialsSecret"`
+}
+
+// DatabasePooler defines the connection pool of a database
+type DatabasePooler struct {
+	// PoolMode is only used by PgBouncer, ProxySQL multiplexes connections on its own. Defaults to transaction.
+	// +kubebuilder:validation:Enum=session;transaction;statement
+	// +optional
+	PoolMode string `json:"poolMode,omitempty"`
+	// PoolSize is the number of connections to the server. Defaults to 20.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	PoolSize int32 `json:"poolSize,omitempty"`
+}
+
+// DatabaseAdoption defines an existing database and user which are taken over by the operator
+// without altering them. The credentials secret is created from these values.
+type DatabaseAdoption struct {
+	DatabaseName string `json:"databaseName"`
+	UserName     string `json:"userName"`
+	// PasswordSecretRef selects the current password of the user from a secret in the namespace of the Database
+	PasswordSecretRef corev1.SecretKeySelector `json:"passwordSecretRef"`
+}
+
+// DatabaseDataSource references an existing Database to clone from.
+// If the source lives in another namespace, a DbCloneGrant in the source namespace must allow it.
+type DatabaseDataSource struct {
+	// Namespace of the source Database, defaults to the namespace of the new Database
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
 }
 
 // Postgres struct should be used to provide resource that only applicable to postgres
@@ -55,8 +110,19 @@ type DatabaseStatus struct {
 	ProxyStatus           DatabaseProxyStatus `json:"proxyStatus,omitempty"`
 	DatabaseName          string              `json:"database"`
 	UserName              string              `json:"user"`
+	// ClonedFrom is set to <namespace>/<name> of the data source once its content has been copied
+	ClonedFrom string `json:"clonedFrom,omitempty"`
+	// Operation is the pending operation of the backend api started for database and user,
+	// it's continued by the next reconcile
+	Operation string `json:"operation,omitempty"`
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
+// DatabaseConditionOwnershipConflict is true when the database or the user on the server
+// is owned by another Database resource, possibly in another cluster
+const DatabaseConditionOwnershipConflict = "OwnershipConflict"
+
 // DatabaseProxyStatus defines whether proxy for database is enabled or not
 // if so, provide information
 type DatabaseProxyStatus struct {
@@ -146,4 +212,56 @@ func (db *Database) InstanceAccessSecretName() string {
 	return "dbin-" + db.Spec.Instance + "-access-secret"
 }
 
+// DataSourceKey returns namespace and name of the Database referenced in spec.dataSource
+func (db *Database) DataSourceKey() (NamespacedName, error) {
+	if db.Spec.DataSource == nil {
+		return NamespacedName{}, errors.New("data source is not defined")
+	}
+	namespace := db.Spec.DataSource.Namespace
+	if namespace == "" {
+		namespace = db.Namespace
+	}
+	return NamespacedName{Namespace: namespace, Name: db.Spec.DataSource.Name}, nil
+}
+
+// ServerNames returns the names of the database and the user on the server.
+// Names of an adopted database are used as they are once they pass the engine rules, otherwise overrides
+// from the spec take precedence over names generated from the naming rules.
+func (db *Database) ServerNames(rules naming.Rules, engine string) (string, string, error) {
+	if db.Spec.Adopt != nil {
+		if err := naming.Validate(engine, false, db.Spec.Adopt.DatabaseName); err != nil {
+			return "", "", err
+		}
+		if err := naming.Validate(engine, true, db.Spec.Adopt.UserName); err != nil {
+			return "", "", err
+		}
+		return db.Spec.Adopt.DatabaseName, db.Spec.Adopt.UserName, nil
+	}
+
+	dbName, err := rules.DatabaseName(db.Namespace, db.Name, db.Spec.DatabaseName, engine)
+	if err != nil {
+		return "", "", err
+	}
+	if db.Spec.IAMAuth != nil {
+		return dbName, db.IAMUserName(engine), nil
+	}
+	dbUser, err := rules.UserName(db.Namespace, db.Name, db.Spec.UserName, engine)
+	if err != nil {
+		return "", "", err
+	}
+	return dbName, dbUser, nil
+}
+
+// IAMUserName returns the name Cloud SQL gives the user of the iam service account,
+// postgres users are named by the email without the .gserviceaccount.com suffix, mysql users by the part before the @
+func (db *Database) IAMUserName(engine string) string {
+	if db.Spec.IAMAuth == nil {
+		return ""
+	}
+	if engine == "mysql" {
+		return strings.SplitN(db.Spec.IAMAuth.ServiceAccount, "@", 2)[0]
+	}
+	return strings.TrimSuffix(db.Spec.IAMAuth.ServiceAccount, ".gserviceaccount.com")
+}
+
 func (db *Database) Hub() {}
@@ -17,8 +17,18 @@
 package v1beta1
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+
+	"github.com/kloeckner-i/db-operator/pkg/utils/naming"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 )
@@ -26,7 +36,15 @@ import (
 // log is for logging in this package.
 var databaselog = logf.Log.WithName("database-resource")
 
+// DatabaseNamingRules are used to detect databases which map to the same names on the server.
+// It must be set to the naming rules of the operator config before the webhook is served.
+var DatabaseNamingRules naming.Rules
+
+// databaseReader is used to look up other databases on the same instance
+var databaseReader client.Reader
+
 func (r *Database) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	databaseReader = mgr.GetAPIReader()
 	return ctrl.NewWebhookManagedBy(mgr).
 		For(r).
 		Complete()
@@ -54,16 +72,51 @@ var _ webhook.Validator = &Database{}
 func (r *Database) ValidateCreate() error {
 	databaselog.Info("validate create", "name", r.Name)
 
-	// TODO(user): fill in your validation logic upon object creation.
-	return nil
+	if err := r.validateAdoption(); err != nil {
+		return err
+	}
+	if err := r.validateDataSource(); err != nil {
+		return err
+	}
+	if err := r.validateDataSourceInstances(); err != nil {
+		return err
+	}
+	if err := r.validateIAMAuth(); err != nil {
+		return err
+	}
+	return r.validateServerNames()
 }
 
 // ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
 func (r *Database) ValidateUpdate(old runtime.Object) error {
 	databaselog.Info("validate update", "name", r.Name)
 
-	// TODO(user): fill in your validation logic upon object update.
-	return nil
+	oldDatabase, ok := old.(*Database)
+	if !ok {
+		return errors.New("old object is not a database")
+	}
+	if !reflect.DeepEqual(oldDatabase.Spec.DataSource, r.Spec.DataSource) {
+		return errors.New("spec.dataSource is immutable")
+	}
+	if oldDatabase.Spec.DatabaseName != r.Spec.DatabaseName || oldDatabase.Spec.UserName != r.Spec.UserName {
+		return errors.New("spec.databaseName and spec.userName are immutable")
+	}
+	if oldDatabase.Spec.Adopt != nil && r.Spec.Adopt != nil &&
+		(oldDatabase.Spec.Adopt.DatabaseName != r.Spec.Adopt.DatabaseName || oldDatabase.Spec.Adopt.UserName != r.Spec.Adopt.UserName) {
+		return errors.New("spec.adopt.databaseName and spec.adopt.userName are immutable")
+	}
+	if (oldDatabase.Spec.IAMAuth == nil) != (r.Spec.IAMAuth == nil) ||
+		(r.Spec.IAMAuth != nil && oldDatabase.Spec.IAMAuth.ServiceAccount != r.Spec.IAMAuth.ServiceAccount) {
+		return errors.New("spec.iamAuth can not be added or removed and its service account is immutable")
+	}
+	if err := r.validateIAMAuth(); err != nil {
+		return err
+	}
+
+	if err := r.validateAdoption(); err != nil {
+		return err
+	}
+	return r.validateDataSource()
 }
 
 // ValidateDelete implements webhook.Validator so a webhook will be registered for the type
@@ -73,3 +126,149 @@ func (r *Database) ValidateDelete() error {
 	// TODO(user): fill in your validation logic upon object deletion.
 	return nil
 }
+
+func (r *Database) validateDataSource() error {
+	if r.Spec.DataSource == nil {
+		return nil
+	}
+	if r.Spec.DataSource.Name == "" {
+		return errors.New("spec.dataSource.name must be set")
+	}
+	source, _ := r.DataSourceKey()
+	if source.Namespace == r.Namespace && source.Name == r.Name {
+		return errors.New("database can not be cloned from itself")
+	}
+	return nil
+}
+
+// validateDataSourceInstances rejects copies from or into google instances managed through the admin api,
+// the reader of the data source and the masking rules need sql which the api can't run
+func (r *Database) validateDataSourceInstances() error {
+	if r.Spec.DataSource == nil || databaseReader == nil {
+		return nil
+	}
+
+	ctx := context.Background()
+	instances := []string{r.Spec.Instance}
+	key, err := r.DataSourceKey()
+	if err != nil {
+		return err
+	}
+	source := &Database{}
+	err = databaseReader.Get(ctx, key.ToKubernetesType(), source)
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return err
+	}
+	if err == nil {
+		instances = append(instances, source.Spec.Instance)
+	}
+
+	for _, name := range instances {
+		dbin := &DbInstance{}
+		err := databaseReader.Get(ctx, types.NamespacedName{Name: name}, dbin)
+		if err != nil {
+			if k8serrors.IsNotFound(err) {
+				// the instance may be created later, the copy fails in the controller then
+				continue
+			}
+			return err
+		}
+		if dbin.Spec.Google != nil && dbin.Spec.Google.AdminAPI {
+			return fmt.Errorf("spec.dataSource is not supported on instance %s, it's managed through the admin api", name)
+		}
+	}
+	return nil
+}
+
+func (r *Database) validateAdoption() error {
+	if r.Spec.Adopt == nil {
+		return nil
+	}
+	if r.Spec.DataSource != nil {
+		return errors.New("spec.adopt and spec.dataSource can not be used together")
+	}
+	if r.Spec.DatabaseName != "" || r.Spec.UserName != "" {
+		return errors.New("spec.adopt can not be used together with spec.databaseName or spec.userName")
+	}
+	if r.Spec.Adopt.DatabaseName == "" || r.Spec.Adopt.UserName == "" {
+		return errors.New("spec.adopt.databaseName and spec.adopt.userName must be set")
+	}
+	if r.Spec.Adopt.PasswordSecretRef.Name == "" || r.Spec.Adopt.PasswordSecretRef.Key == "" {
+		return errors.New("spec.adopt.passwordSecretRef name and key must be set")
+	}
+	return nil
+}
+
+var googleServiceAccountPattern = regexp.MustCompile(`^[a-z][a-z0-9-]{4,28}[a-z0-9]@[a-z0-9.:-]+\.iam\.gserviceaccount\.com$`)
+
+func (r *Database) validateIAMAuth() error {
+	if r.Spec.IAMAuth == nil {
+		return nil
+	}
+	if !googleServiceAccountPattern.MatchString(r.Spec.IAMAuth.ServiceAccount) {
+		return fmt.Errorf("spec.iamAuth.serviceAccount %s is not the email of a google service account", r.Spec.IAMAuth.ServiceAccount)
+	}
+	if r.Spec.IAMAuth.CredentialsSecret == "" {
+		return errors.New("spec.iamAuth.credentialsSecret must be set")
+	}
+	if r.Spec.Adopt != nil || r.Spec.UserName != "" {
+		return errors.New("spec.iamAuth can not be used together with spec.adopt or spec.userName, the user is named after the service account")
+	}
+	// poolers, backups and clones log in with the password of the user
+	if r.Spec.Pooler != nil || r.Spec.Backup.Enable || r.Spec.DataSource != nil {
+		return errors.New("spec.iamAuth can not be used together with spec.pooler, spec.backup or spec.dataSource")
+	}
+	return nil
+}
+
+// validateServerNames checks the database and user names against the engine rules
+// and makes sure no other database on the same instance maps to the same names
+func (r *Database) validateServerNames() error {
+	if databaseReader == nil {
+		return nil
+	}
+
+	ctx := context.Background()
+	dbin := &DbInstance{}
+	err := databaseReader.Get(ctx, types.NamespacedName{Name: r.Spec.Instance}, dbin)
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			// the instance may be created later, names are validated by the controller then
+			return nil
+		}
+		return err
+	}
+	engine := dbin.Spec.Engine
+	if r.Spec.IAMAuth != nil && (dbin.Spec.Google == nil || dbin.Spec.Google.AdminAPI) {
+		return errors.New("spec.iamAuth is only supported on google instances which aren't managed through the admin api")
+	}
+
+	dbName, dbUser, err := r.ServerNames(DatabaseNamingRules, engine)
+	if err != nil {
+		return err
+	}
+
+	dbList := &DatabaseList{}
+	if err := databaseReader.List(ctx, dbList); err != nil {
+		return err
+	}
+	for _, other := range dbList.Items {
+		if other.Spec.Instance != r.Spec.Instance || (other.Namespace == r.Namespace && other.Name == r.Name) {
+			continue
+		}
+		otherName, otherUser := other.Status.DatabaseName, other.Status.UserName
+		if otherName == "" || otherUser == "" {
+			otherName, otherUser, err = other.ServerNames(DatabaseNamingRules, engine)
+			if err != nil {
+				continue
+			}
+		}
+		if otherName == dbName {
+			return fmt.Errorf("database name %s is already used by database %s/%s", dbName, other.Namespace, other.Name)
+		}
+		if otherUser == dbUser {
+			return fmt.Errorf("user name %s is already used by database %s/%s", dbUser, other.Namespace, other.Name)
+		}
+	}
+	return nil
+}
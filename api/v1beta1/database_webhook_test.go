@@ -0,0 +1,147 @@
+/*
+ * Copyright 2021 kloeckner.i GmbH
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package v1beta1
+
+import (
+	"testing"
+
+	"github.com/kloeckner-i/db-operator/pkg/utils/naming"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newNamingTestDatabase(namespace, name string) *Database {
+	return &Database{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec:       DatabaseSpec{Instance: "test-instance", SecretName: name + "-credentials"},
+	}
+}
+
+func TestValidateServerNames(t *testing.T) {
+	scheme := runtime.NewScheme()
+	assert.NoError(t, AddToScheme(scheme))
+
+	instance := &DbInstance{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-instance"},
+		Spec:       DbInstanceSpec{Engine: "postgres"},
+	}
+	existing := newNamingTestDatabase("team-a", "app")
+	renamed := newNamingTestDatabase("team-b", "legacy")
+	renamed.Status.DatabaseName = "legacy_db"
+	renamed.Status.UserName = "legacy_user"
+
+	defer func() {
+		databaseReader = nil
+		DatabaseNamingRules = naming.Rules{}
+	}()
+	databaseReader = fake.NewClientBuilder().WithScheme(scheme).WithObjects(instance, existing, renamed).Build()
+
+	assert.NoError(t, newNamingTestDatabase("team-b", "app").validateServerNames())
+	assert.NoError(t, existing.validateServerNames())
+
+	clash := newNamingTestDatabase("team-c", "other")
+	clash.Spec.DatabaseName = "team-a-app"
+	assert.Error(t, clash.validateServerNames())
+
+	clash.Spec.DatabaseName = ""
+	clash.Spec.UserName = "legacy_user"
+	assert.Error(t, clash.validateServerNames())
+
+	// names without namespace clash between namespaces
+	DatabaseNamingRules = naming.Rules{Template: "{{ .Name }}"}
+	assert.Error(t, newNamingTestDatabase("team-b", "app").validateServerNames())
+
+	invalid := newNamingTestDatabase("team-c", "other")
+	invalid.Spec.DatabaseName = "bad\"name"
+	assert.Error(t, invalid.validateServerNames())
+
+	// adopted names are taken as they are, but they have to pass the engine rules
+	adopted := newNamingTestDatabase("team-c", "adopted")
+	adopted.Spec.Adopt = &DatabaseAdoption{DatabaseName: "legacy", UserName: "legacy_owner"}
+	assert.NoError(t, adopted.validateServerNames())
+	adopted.Spec.Adopt.DatabaseName = `x"; DROP DATABASE "other`
+	assert.Error(t, adopted.validateServerNames())
+	adopted.Spec.Adopt.DatabaseName = "legacy"
+	adopted.Spec.Adopt.UserName = `x"; DROP ROLE "other`
+	assert.Error(t, adopted.validateServerNames())
+}
+
+func TestValidateIAMAuth(t *testing.T) {
+	dbcr := newNamingTestDatabase("team-a", "app")
+	dbcr.Spec.IAMAuth = &DatabaseIAMAuth{ServiceAccount: "app-user@my-project.iam.gserviceaccount.com", CredentialsSecret: "app-sa"}
+	assert.NoError(t, dbcr.validateIAMAuth())
+
+	_, user, err := dbcr.ServerNames(naming.Rules{}, "postgres")
+	assert.NoError(t, err)
+	assert.Equal(t, "app-user@my-project.iam", user)
+	_, user, err = dbcr.ServerNames(naming.Rules{}, "mysql")
+	assert.NoError(t, err)
+	assert.Equal(t, "app-user", user)
+
+	dbcr.Spec.IAMAuth.ServiceAccount = "app-user@example.com"
+	assert.Error(t, dbcr.validateIAMAuth(), "not a service account")
+	dbcr.Spec.IAMAuth.ServiceAccount = "app-user@my-project.iam.gserviceaccount.com"
+
+	dbcr.Spec.UserName = "app"
+	assert.Error(t, dbcr.validateIAMAuth(), "user is named after the service account")
+	dbcr.Spec.UserName = ""
+
+	dbcr.Spec.IAMAuth.CredentialsSecret = ""
+	assert.Error(t, dbcr.validateIAMAuth(), "credentials secret is required")
+	dbcr.Spec.IAMAuth.CredentialsSecret = "app-sa"
+
+	updated := dbcr.DeepCopy()
+	updated.Spec.IAMAuth.ServiceAccount = "other-user@my-project.iam.gserviceaccount.com"
+	assert.Error(t, updated.ValidateUpdate(dbcr), "service account is immutable")
+	updated.Spec.IAMAuth = nil
+	assert.Error(t, updated.ValidateUpdate(dbcr), "iam auth can't be removed")
+}
+
+func TestValidateDataSourceInstances(t *testing.T) {
+	scheme := runtime.NewScheme()
+	assert.NoError(t, AddToScheme(scheme))
+
+	sql := &DbInstance{
+		ObjectMeta: metav1.ObjectMeta{Name: "sql"},
+		Spec:       DbInstanceSpec{Engine: "postgres", DbInstanceSource: DbInstanceSource{Google: &GoogleInstance{InstanceName: "sql"}}},
+	}
+	api := &DbInstance{
+		ObjectMeta: metav1.ObjectMeta{Name: "api"},
+		Spec:       DbInstanceSpec{Engine: "postgres", DbInstanceSource: DbInstanceSource{Google: &GoogleInstance{InstanceName: "api", AdminAPI: true}}},
+	}
+	source := newNamingTestDatabase("team-a", "app")
+	source.Spec.Instance = "sql"
+	apiSource := newNamingTestDatabase("team-a", "api-app")
+	apiSource.Spec.Instance = "api"
+
+	defer func() { databaseReader = nil }()
+	databaseReader = fake.NewClientBuilder().WithScheme(scheme).WithObjects(sql, api, source, apiSource).Build()
+
+	clone := newNamingTestDatabase("team-a", "clone")
+	clone.Spec.Instance = "sql"
+	clone.Spec.DataSource = &DatabaseDataSource{Name: "app"}
+	assert.NoError(t, clone.validateDataSourceInstances())
+
+	clone.Spec.Instance = "api"
+	assert.Error(t, clone.validateDataSourceInstances(), "copies into admin api instances aren't supported")
+
+	clone.Spec.Instance = "sql"
+	clone.Spec.DataSource.Name = "api-app"
+	assert.Error(t, clone.validateDataSourceInstances(), "copies from admin api instances aren't supported")
+}
@@ -0,0 +1,77 @@
+/*
+ * Copyright 2021 kloeckner.i GmbH
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DbCloneGrantSpec defines which Databases of the namespace can be cloned and from where
+type DbCloneGrantSpec struct {
+	// Namespaces allowed to clone Databases of this namespace
+	Namespaces []string `json:"namespaces"`
+	// Databases that can be cloned, all Databases of the namespace if empty
+	Databases []string `json:"databases,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:shortName=dbcg
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`,description="time since creation of resource"
+// DbCloneGrant allows Databases from other namespaces to use Databases of its namespace as data source
+type DbCloneGrant struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec DbCloneGrantSpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// DbCloneGrantList contains a list of DbCloneGrant
+type DbCloneGrantList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []DbCloneGrant `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&DbCloneGrant{}, &DbCloneGrantList{})
+}
+
+// Allows returns true if the grant permits a Database in the given namespace to clone the named Database
+func (g *DbCloneGrant) Allows(namespace, database string) bool {
+	allowedNamespace := false
+	for _, ns := range g.Spec.Namespaces {
+		if ns == namespace {
+			allowedNamespace = true
+			break
+		}
+	}
+	if !allowedNamespace {
+		return false
+	}
+
+	if len(g.Spec.Databases) == 0 {
+		return true
+	}
+	for _, db := range g.Spec.Databases {
+		if db == database {
+			return true
+		}
+	}
+	return false
+}
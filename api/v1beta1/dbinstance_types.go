@@ -19,7 +19,10 @@ package v1beta1
 import (
 	"errors"
 
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
@@ -27,19 +30,81 @@ import (
 // DbInstanceSpec defines the desired state of DbInstance
 type DbInstanceSpec struct {
 	// Important: Run "make generate" to regenerate code after modifying this file
-	Engine           string                  `json:"engine"`
-	AdminUserSecret  NamespacedName          `json:"adminSecretRef"`
-	Backup           DbInstanceBackup        `json:"backup,omitempty"`
-	Monitoring       DbInstanceMonitoring    `json:"monitoring,omitempty"`
-	SSLConnection    DbInstanceSSLConnection `json:"sslConnection,omitempty"`
+	Engine          string                  `json:"engine"`
+	AdminUserSecret NamespacedName          `json:"adminSecretRef"`
+	Backup          DbInstanceBackup        `json:"backup,omitempty"`
+	Monitoring      DbInstanceMonitoring    `json:"monitoring,omitempty"`
+	SSLConnection   DbInstanceSSLConnection `json:"sslConnection,omitempty"`
+	// ReadReplicas are read-only servers replicating the instance,
+	// the first healthy one is exposed to databases as read-only endpoint
+	// +optional
+	ReadReplicas []ReadReplica `json:"readReplicas,omitempty"`
+	// Executor runs the queries against the server in jobs instead of the operator pod,
+	// it's used when only pods in some namespaces or on some nodes can reach the server
+	// +optional
+	Executor         *DbInstanceExecutor `json:"executor,omitempty"`
 	DbInstanceSource `json:",inline"`
 }
 
+// DbInstanceExecutor defines where the jobs running the queries against the server are scheduled
+type DbInstanceExecutor struct {
+	Namespace          string              `json:"namespace"`
+	ServiceAccountName string              `json:"serviceAccountName,omitempty"`
+	NodeSelector       map[string]string   `json:"nodeSelector,omitempty"`
+	Tolerations        []corev1.Toleration `json:"tolerations,omitempty"`
+}
+
 // DbInstanceSource represents the source of a instance.
 // Only one of its members may be specified.
+// A new member must be added to backendSources too, its backend type selects the backend
+// the operator registered by that name. Backends without a member of their own are selected by Custom.
 type DbInstanceSource struct {
 	Google  *GoogleInstance  `json:"google,omitempty" protobuf:"bytes,1,opt,name=google"`
 	Generic *GenericInstance `json:"generic,omitempty" protobuf:"bytes,2,opt,name=generic"`
+	Percona *PerconaCluster  `json:"percona,omitempty" protobuf:"bytes,3,opt,name=percona"`
+	Aws     *AwsInstance     `json:"aws,omitempty" protobuf:"bytes,4,opt,name=aws"`
+	Azure   *AzureInstance   `json:"azure,omitempty" protobuf:"bytes,5,opt,name=azure"`
+	Custom  *CustomInstance  `json:"custom,omitempty" protobuf:"bytes,6,opt,name=custom"`
+}
+
+// CustomInstance is used for backends registered by the operator without a member of DbInstanceSource,
+// the backend reads its settings from Config or the configmap
+type CustomInstance struct {
+	// Type is the name the backend is registered by
+	Type string `json:"type"`
+	// Config is passed to the backend as is
+	// +optional
+	// +kubebuilder:pruning:PreserveUnknownFields
+	Config *runtime.RawExtension `json:"config,omitempty"`
+	// ConfigmapName refers to a configmap read by the backend, the instance is updated when it changes
+	// +optional
+	ConfigmapName NamespacedName `json:"configmapRef,omitempty"`
+}
+
+// backendSources maps the backend types to the members of DbInstanceSource defining them
+var backendSources = []struct {
+	backend string
+	defined func(source *DbInstanceSource) bool
+}{
+	{"google", func(source *DbInstanceSource) bool { return source.Google != nil }},
+	{"generic", func(source *DbInstanceSource) bool { return source.Generic != nil }},
+	{"percona", func(source *DbInstanceSource) bool { return source.Percona != nil }},
+	{"aws", func(source *DbInstanceSource) bool { return source.Aws != nil }},
+	{"azure", func(source *DbInstanceSource) bool { return source.Azure != nil }},
+}
+
+// definedBackends returns the backend types of all members which are defined
+func (source *DbInstanceSource) definedBackends() []string {
+	backends := []string{}
+	for _, s := range backendSources {
+		if s.defined(source) {
+			backends = append(backends, s.backend)
+		}
+	}
+	if source.Custom != nil {
+		backends = append(backends, source.Custom.Type)
+	}
+	return backends
 }
 
 // DbInstanceStatus defines the observed state of DbInstance
@@ -49,15 +114,230 @@ type DbInstanceStatus struct {
 	Status    bool              `json:"status"`
 	Info      map[string]string `json:"info,omitempty"`
 	Checksums map[string]string `json:"checksums,omitempty"`
+	// ReadReplicas is the health of the read replicas in the order of the spec
+	ReadReplicas []ReadReplicaStatus `json:"readReplicas,omitempty"`
+	// Operation is the pending operation of the backend changing the server,
+	// it's polled on the next reconciles until it's done
+	Operation string `json:"operation,omitempty"`
+	// MasterInstance is the DbInstance this instance replicates
+	MasterInstance string `json:"masterInstance,omitempty"`
+	// PromotedFrom is the DbInstance this instance replicated before it was promoted
+	PromotedFrom string `json:"promotedFrom,omitempty"`
+	// Replicas are the DbInstances replicating this instance
+	Replicas []string `json:"replicas,omitempty"`
+	// ClonedFrom is the DbInstance this instance was cloned from
+	ClonedFrom string `json:"clonedFrom,omitempty"`
+	// BackupRuns are the most recent backups of a google instance, the newest first
+	BackupRuns []GoogleBackupRunStatus `json:"backupRuns,omitempty"`
+	// BackupOperation is the pending on-demand backup run of a google instance,
+	// it's polled apart from the operation changing the server
+	BackupOperation string `json:"backupOperation,omitempty"`
+	// BackupRunsListedAt is the time the backup runs were last listed
+	BackupRunsListedAt *metav1.Time `json:"backupRunsListedAt,omitempty"`
+	// RestoredBackupRun is the id of the backup run the instance was restored from
+	RestoredBackupRun int64 `json:"restoredBackupRun,omitempty"`
+	// AccessSecretChecksum is the checksum of the google credentials last copied to the namespaces of the databases
+	AccessSecretChecksum string `json:"accessSecretChecksum,omitempty"`
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// DbInstanceConditionDeletionBlocked is true while the deletion of the instance is refused,
+// because databases or replicas still use it, or fails, e.g. because of its final backup
+const DbInstanceConditionDeletionBlocked = "DeletionBlocked"
+
+// GoogleBackupRunStatus is a backup run of a Cloud SQL instance
+type GoogleBackupRunStatus struct {
+	ID int64 `json:"id"`
+	// Type is AUTOMATED or ON_DEMAND
+	Type   string `json:"type"`
+	Status string `json:"status"`
+	// EnqueuedTime and EndTime are RFC 3339 timestamps
+	EnqueuedTime string `json:"enqueuedTime,omitempty"`
+	EndTime      string `json:"endTime,omitempty"`
+}
+
+// ReadReplica defines a read-only server replicating the instance.
+// Only one of its members may be specified.
+type ReadReplica struct {
+	Generic *GenericReplica `json:"generic,omitempty"`
+	Google  *GoogleReplica  `json:"google,omitempty"`
+}
+
+// GenericReplica is a replica reachable by address and port
+type GenericReplica struct {
+	Host string `json:"host"`
+	Port uint16 `json:"port"`
+}
+
+// GoogleReplica is a Cloud SQL read replica of the google instance,
+// it's reached directly by its private or public ip address
+type GoogleReplica struct {
+	InstanceName string `json:"instance"`
+}
+
+// ReadReplicaStatus defines the observed state of a read replica
+type ReadReplicaStatus struct {
+	// Name is the host of a generic replica or the instance name of a google replica
+	Name    string `json:"name"`
+	Host    string `json:"host,omitempty"`
+	Port    string `json:"port,omitempty"`
+	Healthy bool   `json:"healthy"`
+	Message string `json:"message,omitempty"`
 }
 
 // GoogleInstance is used when instance type is Google Cloud SQL
 // and describes necessary informations to use google API to create sql instances
 type GoogleInstance struct {
-	InstanceName  string         `json:"instance"`
+	InstanceName string `json:"instance"`
+	// ConfigmapName refers to a configmap whose "config" key contains the DatabaseInstance of the Cloud SQL admin API as json,
+	// it's optional if settings are defined
+	ConfigmapName NamespacedName `json:"configmapRef,omitempty"`
+	// Settings of the Cloud SQL instance, they take precedence over the config of the configmap
+	Settings     *GoogleInstanceSettings `json:"settings,omitempty"`
+	APIEndpoint  string                  `json:"apiEndpoint,omitempty"`
+	ClientSecret NamespacedName          `json:"clientSecretRef,omitempty"`
+	// AdminAPI manages databases and users with the Cloud SQL admin api instead of sql statements,
+	// the operator doesn't need a network path to the instance then
+	AdminAPI bool `json:"adminAPI,omitempty"`
+	// DeletionPolicy decides what happens to the Cloud SQL instance when the DbInstance is deleted,
+	// Retain keeps it running and Delete removes it. Defaults to Retain.
+	// +kubebuilder:validation:Enum=Retain;Delete
+	// +optional
+	DeletionPolicy string `json:"deletionPolicy,omitempty"`
+	// FinalBackup exports the databases before the instance is deleted, backups of Cloud SQL are removed with the instance
+	FinalBackup *GoogleFinalBackup `json:"finalBackup,omitempty"`
+	// MasterInstanceName is the name of a google DbInstance the instance is created as read replica of,
+	// it's ignored once the replica is promoted and can be removed afterwards
+	MasterInstanceName string `json:"masterInstanceName,omitempty"`
+	// CloneOf creates the instance as clone of another google DbInstance
+	CloneOf *GoogleClone `json:"cloneOf,omitempty"`
+	// RestoreFrom restores a backup run of another google DbInstance into the instance after it's created
+	RestoreFrom *GoogleRestore `json:"restoreFrom,omitempty"`
+	// BackupRuns starts on-demand backups on a schedule, in addition to the automated daily backups
+	BackupRuns *GoogleBackupRuns `json:"backupRuns,omitempty"`
+	// ManageClientCert issues a client certificate through the Cloud SQL admin api,
+	// it's stored in the client cert secret of the ssl connection together with the server CA
+	ManageClientCert bool `json:"manageClientCert,omitempty"`
+}
+
+// GoogleRestore defines the backup run a new Cloud SQL instance is restored from
+type GoogleRestore struct {
+	// Instance is the name of the google DbInstance the backup run belongs to
+	Instance string `json:"instance"`
+	// BackupRunID is the id of the backup run, it's listed in the status of the source instance
+	BackupRunID int64 `json:"backupRunId"`
+}
+
+// GoogleBackupRuns defines the schedule of on-demand backups of a Cloud SQL instance
+type GoogleBackupRuns struct {
+	// Interval is the time between on-demand backups, e.g. 6h
+	Interval metav1.Duration `json:"interval"`
+}
+
+// GoogleClone defines the source of a cloned Cloud SQL instance
+type GoogleClone struct {
+	// Instance is the name of the google DbInstance which is cloned
+	Instance string `json:"instance"`
+	// PointInTime is the RFC 3339 timestamp the source is cloned at, it requires point in time recovery of the source.
+	// The current state is cloned if it's empty.
+	PointInTime string `json:"pointInTime,omitempty"`
+}
+
+// Deletion policies of google instances
+const (
+	GoogleDeletionPolicyRetain = "Retain"
+	GoogleDeletionPolicyDelete = "Delete"
+)
+
+// GoogleFinalBackup defines where the databases of a deleted Cloud SQL instance are exported to
+type GoogleFinalBackup struct {
+	// Bucket is the name of the gcs bucket the sql dumps are written to,
+	// the service account of the Cloud SQL instance needs write access to it
+	Bucket string `json:"bucket"`
+}
+
+// GoogleInstanceSettings are the settings of a Cloud SQL instance,
+// fields which are not defined are taken from the configmap of the instance or the defaults of Cloud SQL
+type GoogleInstanceSettings struct {
+	// Tier is the machine type of the instance, e.g. db-custom-2-7680
+	Tier string `json:"tier,omitempty"`
+	// Region can't be changed after the instance is created
+	Region string `json:"region,omitempty"`
+	// DatabaseVersion e.g. POSTGRES_14 or MYSQL_8_0 must match the engine of the instance
+	DatabaseVersion string `json:"databaseVersion,omitempty"`
+	DiskSizeGB      int64  `json:"diskSizeGb,omitempty"`
+	DiskAutoresize  *bool  `json:"diskAutoresize,omitempty"`
+	// DiskAutoresizeLimitGB is the maximum size the disk is increased to, 0 means no limit
+	DiskAutoresizeLimitGB int64 `json:"diskAutoresizeLimitGb,omitempty"`
+	// Flags are the database flags of the instance by name
+	Flags             map[string]string        `json:"flags,omitempty"`
+	Backup            *GoogleBackup            `json:"backup,omitempty"`
+	MaintenanceWindow *GoogleMaintenanceWindow `json:"maintenanceWindow,omitempty"`
+	// AuthorizedNetworks are allowed to connect to the public ip of the instance
+	AuthorizedNetworks []GoogleAuthorizedNetwork `json:"authorizedNetworks,omitempty"`
+	// PrivateNetwork is the VPC network the instance gets a private ip in, e.g. projects/my-project/global/networks/default
+	PrivateNetwork string `json:"privateNetwork,omitempty"`
+	// PublicIP assigns a public ip to the instance, it must be disabled explicitly for instances with a private network only
+	PublicIP *bool `json:"publicIp,omitempty"`
+}
+
+// GoogleBackup configures the automated backups of a Cloud SQL instance
+type GoogleBackup struct {
+	Enabled bool `json:"enabled"`
+	// StartTime is the start of the daily backup window in UTC, HH:MM
+	StartTime       string `json:"startTime,omitempty"`
+	RetainedBackups int64  `json:"retainedBackups,omitempty"`
+	// PointInTimeRecovery keeps the transaction logs to clone the instance at any point in time
+	PointInTimeRecovery bool `json:"pointInTimeRecovery,omitempty"`
+}
+
+// GoogleMaintenanceWindow is the weekly hour Cloud SQL may restart the instance for maintenance
+type GoogleMaintenanceWindow struct {
+	// Day of the week, 1 is monday and 7 is sunday
+	Day int64 `json:"day"`
+	// Hour of the day in UTC, 0 to 23
+	Hour int64 `json:"hour"`
+}
+
+// GoogleAuthorizedNetwork is a network allowed to connect to the public ip of a Cloud SQL instance
+type GoogleAuthorizedNetwork struct {
+	Name string `json:"name,omitempty"`
+	// Value is an ip address or a network in cidr notation
+	Value string `json:"value"`
+}
+
+// AwsInstance is used when instance type is AWS RDS
+// and describes necessary informations to use the rds API to create db instances
+type AwsInstance struct {
+	InstanceIdentifier string `json:"instance"`
+	Region             string `json:"region"`
+	// ConfigmapName refers to a configmap whose "config" key contains the parameters of CreateDBInstance as json
 	ConfigmapName NamespacedName `json:"configmapRef"`
 	APIEndpoint   string         `json:"apiEndpoint,omitempty"`
-	ClientSecret  NamespacedName `json:"clientSecretRef,omitempty"`
+	// IAMAuth connects as admin user with iam auth tokens instead of the password of the admin secret
+	IAMAuth bool `json:"iamAuth,omitempty"`
+}
+
+// AzureInstance is used when instance type is Azure Database flexible server
+// and describes necessary informations to use the azure resource manager to create servers
+type AzureInstance struct {
+	ServerName string `json:"server"`
+	// SubscriptionID defaults to the AZURE_SUBSCRIPTION_ID of the operator
+	SubscriptionID string `json:"subscriptionID,omitempty"`
+	ResourceGroup  string `json:"resourceGroup"`
+	// ConfigmapName refers to a configmap whose "config" key contains the flexible server resource as json
+	ConfigmapName NamespacedName `json:"configmapRef"`
+	// FirewallRules replace all firewall rules of the server
+	FirewallRules []AzureFirewallRule `json:"firewallRules,omitempty"`
+	APIEndpoint   string              `json:"apiEndpoint,omitempty"`
+}
+
+// AzureFirewallRule allows connections to an azure server from a range of ip addresses
+type AzureFirewallRule struct {
+	Name           string `json:"name"`
+	StartIPAddress string `json:"startIpAddress"`
+	EndIPAddress   string `json:"endIpAddress"`
 }
 
 // BackendServer defines backend database server
@@ -68,17 +348,72 @@ type BackendServer struct {
 	ReadOnly      bool   `json:"readonly,omitempty"`
 }
 
+// PerconaCluster is used when instance type is a mysql cluster, e.g. percona xtradb cluster.
+// Databases are managed through the first writable server, clients connect through a proxy
+// which routes writes to the writable servers and spreads reads across the read-only ones.
+type PerconaCluster struct {
+	// +kubebuilder:validation:MinItems=1
+	ServerList []BackendServer `json:"servers"`
+}
+
 // GenericInstance is used when instance type is generic
 // and describes necessary informations to use instance
 // generic instance can be any backend, it must be reachable by described address and port
 type GenericInstance struct {
-	Host     string `json:"host"`
-	Port     uint16 `json:"port"`
+	Host string `json:"host,omitempty"`
+	// Hosts of a primary-secondary setup, e.g. patroni or mysql replication,
+	// the operator connects to the primary and follows it on failover.
+	// Only one of Host and Hosts may be specified.
+	Hosts []string `json:"hosts,omitempty"`
+	// Port is required with Host and Hosts
+	Port     uint16 `json:"port,omitempty"`
 	PublicIP string `json:"publicIp,omitempty"`
 	// BackupHost address will be used for dumping database for backup
 	// Usually secondary address for primary-secondary setup or cluster lb address
 	// If it's not defined, above Host will be used as backup host address.
 	BackupHost string `json:"backupHost,omitempty"`
+	// Provision deploys the database server in the cluster instead of using an existing one,
+	// Host and Hosts must not be defined
+	// +optional
+	Provision *GenericProvision `json:"provision,omitempty"`
+	// ServiceRef references a service of a database server running in the cluster,
+	// it's resolved to the address of the service instead of using Host and Port
+	// +optional
+	ServiceRef *ServiceReference `json:"serviceRef,omitempty"`
+	// SSHTunnel is a jump host the database server is reached through
+	// +optional
+	SSHTunnel *SSHTunnel `json:"sshTunnel,omitempty"`
+}
+
+// SSHTunnel defines a jump host the database server is reached through.
+// The private key is read from the key "ssh-privatekey" of the secret,
+// the host keys of the jump host from the optional key "known_hosts".
+type SSHTunnel struct {
+	Host string `json:"host"`
+	// Port of the ssh server, 22 if not defined
+	Port             uint16         `json:"port,omitempty"`
+	User             string         `json:"user"`
+	PrivateKeySecret NamespacedName `json:"privateKeySecretRef"`
+	// SkipHostKeyVerify accepts any host key of the jump host if the secret has no known_hosts
+	SkipHostKeyVerify bool `json:"skipHostKeyVerify,omitempty"`
+}
+
+// ServiceReference references a port of a kubernetes service
+type ServiceReference struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// Port is the name of the service port, it can be omitted if the service has a single port
+	Port string `json:"port,omitempty"`
+}
+
+// GenericProvision defines a database server deployed by the operator, meant for development and test clusters.
+// The server is deployed in the namespace of the admin secret, which is generated if it doesn't exist.
+type GenericProvision struct {
+	// StorageSize of the persistent volume, 1Gi if not defined
+	StorageSize      resource.Quantity `json:"storageSize,omitempty"`
+	StorageClassName string            `json:"storageClassName,omitempty"`
+	// Retain keeps the server and its data when the DbInstance is deleted
+	Retain bool `json:"retain,omitempty"`
 }
 
 // DbInstanceBackup defines name of google bucket to use for storing database dumps for backup when backup is enabled
@@ -96,6 +431,12 @@ type DbInstanceSSLConnection struct {
 	Enabled bool `json:"enabled"`
 	// SkipVerity use SSL connection, but don't check against a CA
 	SkipVerify bool `json:"skip-verify"`
+	// CASecret refers to a secret whose ca.crt key contains the CA bundle the server certificate is verified with,
+	// the system roots are used if it's not defined
+	CASecret *NamespacedName `json:"caSecretRef,omitempty"`
+	// ClientCertSecret refers to a tls secret with the client certificate connections authenticate with,
+	// its ca.crt key is used as CA bundle if no CA secret is defined
+	ClientCertSecret *NamespacedName `json:"clientCertSecretRef,omitempty"`
 }
 
 //+kubebuilder:object:root=true
@@ -140,24 +481,55 @@ func (dbin *DbInstance) ValidateEngine() error {
 // returns error when more than one backend types are defined
 // or when no backend type is defined
 func (dbin *DbInstance) ValidateBackend() error {
-	source := dbin.Spec.DbInstanceSource
+	numSources := len(dbin.Spec.DbInstanceSource.definedBackends())
 
-	if (source.Google == nil) && (source.Generic == nil) {
+	if numSources == 0 {
 		return errors.New("no instance type defined")
 	}
 
-	numSources := 0
+	if numSources > 1 {
+		return errors.New("may not specify more than 1 instance type")
+	}
 
-	if source.Google != nil {
-		numSources++
+	if err := dbin.validateReadReplicas(); err != nil {
+		return err
 	}
 
-	if source.Generic != nil {
-		numSources++
+	if dbin.Spec.Custom != nil {
+		if dbin.Spec.Custom.Type == "" {
+			return errors.New("type of custom instance must be defined")
+		}
+		for _, s := range backendSources {
+			if s.backend == dbin.Spec.Custom.Type {
+				return errors.New("custom instance can't select backend " + s.backend + ", it has a member of its own")
+			}
+		}
 	}
 
-	if numSources > 1 {
-		return errors.New("may not specify more than 1 instance type")
+	if dbin.Spec.Percona != nil {
+		if dbin.Spec.Engine != "mysql" {
+			return errors.New("percona cluster is only supported for mysql")
+		}
+		if _, err := dbin.Spec.Percona.WritableServer(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (dbin *DbInstance) validateReadReplicas() error {
+	for _, replica := range dbin.Spec.ReadReplicas {
+		if (replica.Generic == nil) == (replica.Google == nil) {
+			return errors.New("read replica must define exactly one of generic or google")
+		}
+		if replica.Google != nil && dbin.Spec.Google == nil {
+			return errors.New("google read replicas are only supported for google instances")
+		}
+	}
+
+	if len(dbin.Spec.ReadReplicas) > 0 && dbin.Spec.Percona != nil {
+		return errors.New("read replicas are not supported for percona clusters, use readonly servers instead")
 	}
 
 	return nil
@@ -171,17 +543,49 @@ func (dbin *DbInstance) GetBackendType() (string, error) {
 		return "", err
 	}
 
-	source := dbin.Spec.DbInstanceSource
+	if backends := dbin.Spec.DbInstanceSource.definedBackends(); len(backends) > 0 {
+		return backends[0], nil
+	}
+
+	return "", errors.New("no backend type defined")
+}
+
+// WritableServer returns the first server which is not read-only
+func (pc *PerconaCluster) WritableServer() (BackendServer, error) {
+	for _, server := range pc.ServerList {
+		if !server.ReadOnly {
+			return server, nil
+		}
+	}
+	return BackendServer{}, errors.New("percona cluster has no writable server")
+}
 
-	if source.Google != nil {
-		return "google", nil
+// GetSSHTunnel returns the ssh tunnel of a generic instance, nil if the instance is reached directly
+func (dbin *DbInstance) GetSSHTunnel() *SSHTunnel {
+	if dbin.Spec.Generic == nil {
+		return nil
 	}
+	return dbin.Spec.Generic.SSHTunnel
+}
 
-	if source.Generic != nil {
-		return "generic", nil
+// ReadOnlyEndpoint returns the address of the first healthy read replica
+// and false when no replica is healthy
+func (dbin *DbInstance) ReadOnlyEndpoint() (string, string, bool) {
+	for _, replica := range dbin.Status.ReadReplicas {
+		if replica.Healthy {
+			return replica.Host, replica.Port, true
+		}
 	}
+	return "", "", false
+}
 
-	return "", errors.New("no backend type defined")
+// GoogleMasterInstance returns the name of the DbInstance a google read replica replicates,
+// empty if the instance isn't a replica or was promoted
+func (dbin *DbInstance) GoogleMasterInstance() string {
+	if dbin.Spec.Google == nil || dbin.Spec.Google.MasterInstanceName == dbin.Status.PromotedFrom {
+		return ""
+	}
+	return dbin.Spec.Google.MasterInstanceName
 }
 
 // IsMonitoringEnabled returns boolean value if monitoring is enabled for the instance
@@ -0,0 +1,388 @@
+/*
+ * Copyright 2021 kloeckner.i GmbH
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package v1beta1
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestValidateBackendReadReplicas(t *testing.T) {
+	dbin := &DbInstance{
+		Spec: DbInstanceSpec{
+			Engine: "postgres",
+			DbInstanceSource: DbInstanceSource{
+				Generic: &GenericInstance{Host: "postgres", Port: 5432},
+			},
+			ReadReplicas: []ReadReplica{
+				{Generic: &GenericReplica{Host: "postgres-ro", Port: 5432}},
+			},
+		},
+	}
+	assert.NoError(t, dbin.ValidateBackend())
+
+	dbin.Spec.ReadReplicas = append(dbin.Spec.ReadReplicas, ReadReplica{Google: &GoogleReplica{InstanceName: "replica"}})
+	assert.Error(t, dbin.ValidateBackend(), "google replicas need a google instance")
+
+	dbin.Spec.ReadReplicas = []ReadReplica{{}}
+	assert.Error(t, dbin.ValidateBackend(), "replica type must be defined")
+}
+
+func TestReadOnlyEndpoint(t *testing.T) {
+	dbin := &DbInstance{}
+	_, _, found := dbin.ReadOnlyEndpoint()
+	assert.False(t, found)
+
+	dbin.Status.ReadReplicas = []ReadReplicaStatus{
+		{Name: "replica-1", Healthy: false, Message: "instance is not ready"},
+		{Name: "replica-2", Host: "10.0.0.2", Port: "5432", Healthy: true},
+	}
+	host, port, found := dbin.ReadOnlyEndpoint()
+	assert.True(t, found)
+	assert.Equal(t, "10.0.0.2", host)
+	assert.Equal(t, "5432", port)
+}
+
+func TestValidateGenericHosts(t *testing.T) {
+	dbin := &DbInstance{
+		Spec: DbInstanceSpec{
+			Engine: "postgres",
+			DbInstanceSource: DbInstanceSource{
+				Generic: &GenericInstance{Hosts: []string{"postgres-0", "postgres-1"}, Port: 5432},
+			},
+		},
+	}
+	assert.NoError(t, dbin.ValidateCreate())
+
+	dbin.Spec.Generic.Host = "postgres"
+	assert.Error(t, dbin.ValidateCreate(), "host and hosts can't be used together")
+
+	dbin.Spec.Generic.Host = ""
+	dbin.Spec.Generic.Hosts = nil
+	assert.Error(t, dbin.ValidateCreate(), "host or hosts must be defined")
+
+	dbin.Spec.Generic.Provision = &GenericProvision{}
+	assert.Error(t, dbin.ValidateCreate(), "namespace of the admin secret is required for provisioning")
+
+	dbin.Spec.AdminUserSecret = NamespacedName{Namespace: "databases", Name: "admin"}
+	assert.NoError(t, dbin.ValidateCreate())
+
+	dbin.Spec.Generic.Host = "postgres"
+	assert.Error(t, dbin.ValidateCreate(), "host can't be used with provisioning")
+}
+
+func TestValidateGenericServiceRef(t *testing.T) {
+	dbin := &DbInstance{
+		Spec: DbInstanceSpec{
+			Engine: "postgres",
+			DbInstanceSource: DbInstanceSource{
+				Generic: &GenericInstance{
+					ServiceRef: &ServiceReference{Namespace: "databases", Name: "postgres", Port: "postgres"},
+				},
+			},
+		},
+	}
+	assert.NoError(t, dbin.ValidateCreate())
+
+	dbin.Spec.Generic.Host = "postgres"
+	assert.Error(t, dbin.ValidateCreate(), "host can't be used with a service reference")
+
+	dbin.Spec.Generic.Host = ""
+	dbin.Spec.Generic.ServiceRef.Namespace = ""
+	assert.Error(t, dbin.ValidateCreate(), "namespace of the service is required")
+}
+
+func TestValidateGenericSSHTunnel(t *testing.T) {
+	dbin := &DbInstance{
+		Spec: DbInstanceSpec{
+			Engine: "postgres",
+			DbInstanceSource: DbInstanceSource{
+				Generic: &GenericInstance{
+					Host: "10.0.0.5",
+					Port: 5432,
+					SSHTunnel: &SSHTunnel{
+						Host:             "bastion.example.com",
+						User:             "tunnel",
+						PrivateKeySecret: NamespacedName{Namespace: "db-operator", Name: "bastion-key"},
+					},
+				},
+			},
+		},
+	}
+	assert.NoError(t, dbin.ValidateCreate())
+
+	dbin.Spec.Generic.SSHTunnel.PrivateKeySecret.Name = ""
+	assert.Error(t, dbin.ValidateCreate(), "private key secret is required")
+
+	dbin.Spec.Generic.SSHTunnel.PrivateKeySecret.Name = "bastion-key"
+	dbin.Spec.Generic.Host = ""
+	dbin.Spec.Generic.Port = 0
+	dbin.Spec.Generic.ServiceRef = &ServiceReference{Namespace: "databases", Name: "postgres"}
+	assert.Error(t, dbin.ValidateCreate(), "services in the cluster can't be reached through a tunnel")
+}
+
+func TestValidateExecutor(t *testing.T) {
+	dbin := &DbInstance{
+		Spec: DbInstanceSpec{
+			Engine: "postgres",
+			DbInstanceSource: DbInstanceSource{
+				Generic: &GenericInstance{Host: "postgres", Port: 5432},
+			},
+			Executor: &DbInstanceExecutor{Namespace: "databases"},
+		},
+	}
+	assert.NoError(t, dbin.ValidateCreate())
+
+	dbin.Spec.Executor.Namespace = ""
+	assert.Error(t, dbin.ValidateCreate(), "namespace of the executor is required")
+}
+
+func TestValidateSSLConnection(t *testing.T) {
+	dbin := &DbInstance{
+		Spec: DbInstanceSpec{
+			Engine: "postgres",
+			DbInstanceSource: DbInstanceSource{
+				Generic: &GenericInstance{Host: "postgres", Port: 5432},
+			},
+			SSLConnection: DbInstanceSSLConnection{
+				CASecret:         &NamespacedName{Namespace: "db-operator", Name: "postgres-ca"},
+				ClientCertSecret: &NamespacedName{Namespace: "db-operator", Name: "postgres-client"},
+			},
+		},
+	}
+	assert.Error(t, dbin.ValidateCreate(), "certificates require ssl")
+
+	dbin.Spec.SSLConnection.Enabled = true
+	assert.NoError(t, dbin.ValidateCreate())
+
+	dbin.Spec.SSLConnection.CASecret.Namespace = ""
+	assert.Error(t, dbin.ValidateCreate(), "namespace of the secret is required")
+	dbin.Spec.SSLConnection.CASecret = nil
+
+	dbin.Spec.Generic = nil
+	dbin.Spec.Google = &GoogleInstance{
+		InstanceName:     "postgres",
+		ConfigmapName:    NamespacedName{Namespace: "db-operator", Name: "postgres-gsql"},
+		ManageClientCert: true,
+	}
+	assert.NoError(t, dbin.ValidateCreate())
+	dbin.Spec.SSLConnection.ClientCertSecret = nil
+	assert.Error(t, dbin.ValidateCreate(), "managed client certificate is stored in the client cert secret")
+}
+
+func TestValidateAws(t *testing.T) {
+	dbin := &DbInstance{
+		Spec: DbInstanceSpec{
+			Engine: "postgres",
+			DbInstanceSource: DbInstanceSource{
+				Aws: &AwsInstance{
+					InstanceIdentifier: "postgres",
+					Region:             "eu-central-1",
+					ConfigmapName:      NamespacedName{Namespace: "db-operator", Name: "postgres-rds"},
+				},
+			},
+		},
+	}
+	assert.NoError(t, dbin.ValidateCreate())
+	backend, err := dbin.GetBackendType()
+	assert.NoError(t, err)
+	assert.Equal(t, "aws", backend)
+
+	dbin.Spec.Aws.IAMAuth = true
+	assert.Error(t, dbin.ValidateCreate(), "iam auth tokens are only accepted over ssl")
+
+	dbin.Spec.SSLConnection.Enabled = true
+	assert.NoError(t, dbin.ValidateCreate())
+
+	dbin.Spec.Aws.Region = ""
+	assert.Error(t, dbin.ValidateCreate(), "region is required")
+
+	dbin.Spec.Aws.Region = "eu-central-1"
+	dbin.Spec.Generic = &GenericInstance{Host: "postgres", Port: 5432}
+	assert.Error(t, dbin.ValidateCreate(), "only one backend may be defined")
+}
+
+func TestValidateAzure(t *testing.T) {
+	dbin := &DbInstance{
+		Spec: DbInstanceSpec{
+			Engine: "postgres",
+			DbInstanceSource: DbInstanceSource{
+				Azure: &AzureInstance{
+					ServerName:    "postgres",
+					ResourceGroup: "databases",
+					ConfigmapName: NamespacedName{Namespace: "db-operator", Name: "postgres-azure"},
+					FirewallRules: []AzureFirewallRule{
+						{Name: "cluster", StartIPAddress: "10.1.0.0", EndIPAddress: "10.1.255.255"},
+					},
+				},
+			},
+		},
+	}
+	assert.NoError(t, dbin.ValidateCreate())
+	backend, err := dbin.GetBackendType()
+	assert.NoError(t, err)
+	assert.Equal(t, "azure", backend)
+
+	dbin.Spec.Azure.FirewallRules = append(dbin.Spec.Azure.FirewallRules, AzureFirewallRule{Name: "cluster", StartIPAddress: "10.2.0.1", EndIPAddress: "10.2.0.1"})
+	assert.Error(t, dbin.ValidateCreate(), "rule names must be unique")
+
+	dbin.Spec.Azure.FirewallRules = []AzureFirewallRule{{Name: "office", StartIPAddress: "office"}}
+	assert.Error(t, dbin.ValidateCreate(), "rules need ip addresses")
+
+	dbin.Spec.Azure.FirewallRules = nil
+	dbin.Spec.Azure.ResourceGroup = ""
+	assert.Error(t, dbin.ValidateCreate(), "resource group is required")
+}
+
+func TestValidateCustom(t *testing.T) {
+	dbin := &DbInstance{
+		Spec: DbInstanceSpec{
+			Engine: "postgres",
+			DbInstanceSource: DbInstanceSource{
+				Custom: &CustomInstance{
+					Type:   "ovh",
+					Config: &runtime.RawExtension{Raw: []byte(`{"plan": "essential"}`)},
+				},
+			},
+		},
+	}
+	assert.NoError(t, dbin.ValidateCreate())
+	backend, err := dbin.GetBackendType()
+	assert.NoError(t, err)
+	assert.Equal(t, "ovh", backend)
+
+	dbin.Spec.Custom.Type = "google"
+	assert.Error(t, dbin.ValidateCreate(), "built-in backends are selected by their members")
+
+	dbin.Spec.Custom.Type = ""
+	assert.Error(t, dbin.ValidateCreate(), "type is required")
+}
+
+func TestValidateGoogle(t *testing.T) {
+	dbin := &DbInstance{
+		Spec: DbInstanceSpec{
+			Engine: "postgres",
+			DbInstanceSource: DbInstanceSource{
+				Google: &GoogleInstance{InstanceName: "postgres"},
+			},
+		},
+	}
+	assert.Error(t, dbin.ValidateCreate(), "configmap or settings are required")
+
+	dbin.Spec.Google.ConfigmapName = NamespacedName{Namespace: "db-operator", Name: "postgres-gsql"}
+	assert.NoError(t, dbin.ValidateCreate())
+
+	dbin.Spec.Google.FinalBackup = &GoogleFinalBackup{Bucket: "final-backups"}
+	assert.Error(t, dbin.ValidateCreate(), "final backup requires the deletion policy Delete")
+	dbin.Spec.Google.DeletionPolicy = GoogleDeletionPolicyDelete
+	assert.NoError(t, dbin.ValidateCreate())
+	dbin.Spec.Google.FinalBackup.Bucket = "gs://final-backups/postgres"
+	assert.Error(t, dbin.ValidateCreate(), "bucket is a name, not an uri")
+	dbin.Spec.Google.FinalBackup = nil
+
+	replica := dbin.DeepCopy()
+	replica.Name = "postgres-replica"
+	replica.Spec.Google.MasterInstanceName = "postgres"
+	assert.NoError(t, replica.ValidateCreate())
+	replica.Spec.Google.CloneOf = &GoogleClone{Instance: "postgres"}
+	assert.Error(t, replica.ValidateCreate(), "replica can't be a clone")
+	replica.Spec.Google.CloneOf = nil
+
+	assert.Equal(t, "postgres", replica.GoogleMasterInstance())
+	promoted := replica.DeepCopy()
+	promoted.Status.PromotedFrom = "postgres"
+	assert.Empty(t, promoted.GoogleMasterInstance(), "promoted replica is standalone")
+	promoted.Spec.Google.MasterInstanceName = ""
+	assert.NoError(t, promoted.ValidateUpdate(replica), "master is removed after promotion")
+	assert.Error(t, replica.ValidateUpdate(promoted), "master can't be added")
+
+	clone := dbin.DeepCopy()
+	clone.Name = "postgres-clone"
+	clone.Spec.Google.CloneOf = &GoogleClone{Instance: "postgres", PointInTime: "2022-06-01T10:00:00Z"}
+	assert.NoError(t, clone.ValidateCreate())
+	changed := clone.DeepCopy()
+	changed.Spec.Google.CloneOf.PointInTime = ""
+	assert.Error(t, changed.ValidateUpdate(clone), "clone source is immutable")
+	clone.Spec.Google.CloneOf.PointInTime = "yesterday"
+	assert.Error(t, clone.ValidateCreate(), "point in time must be RFC 3339")
+
+	restored := dbin.DeepCopy()
+	restored.Name = "postgres-restored"
+	restored.Spec.Google.RestoreFrom = &GoogleRestore{Instance: "postgres", BackupRunID: 1654077600000}
+	assert.NoError(t, restored.ValidateCreate())
+	changed = restored.DeepCopy()
+	changed.Spec.Google.RestoreFrom.BackupRunID = 1654164000000
+	assert.Error(t, changed.ValidateUpdate(restored), "restored backup run is immutable")
+	restored.Spec.Google.CloneOf = &GoogleClone{Instance: "postgres"}
+	assert.Error(t, restored.ValidateCreate(), "restored instance can't be a clone")
+	restored.Spec.Google.CloneOf = nil
+	restored.Spec.Google.RestoreFrom.BackupRunID = 0
+	assert.Error(t, restored.ValidateCreate(), "backup run id is required")
+
+	dbin.Spec.Google.BackupRuns = &GoogleBackupRuns{Interval: metav1.Duration{Duration: 10 * time.Minute}}
+	assert.Error(t, dbin.ValidateCreate(), "backup runs must not be more frequent than hourly")
+	dbin.Spec.Google.BackupRuns.Interval.Duration = 6 * time.Hour
+	assert.NoError(t, dbin.ValidateCreate())
+
+	dbin.Spec.Google.ConfigmapName = NamespacedName{}
+	dbin.Spec.Google.Settings = &GoogleInstanceSettings{
+		Tier:               "db-custom-1-3840",
+		DatabaseVersion:    "POSTGRES_14",
+		DiskSizeGB:         20,
+		Backup:             &GoogleBackup{Enabled: true, StartTime: "03:00"},
+		MaintenanceWindow:  &GoogleMaintenanceWindow{Day: 7, Hour: 3},
+		AuthorizedNetworks: []GoogleAuthorizedNetwork{{Name: "office", Value: "192.0.2.0/24"}, {Value: "198.51.100.7"}},
+	}
+	assert.NoError(t, dbin.ValidateCreate())
+
+	settings := dbin.Spec.Google.Settings
+	settings.DatabaseVersion = "MYSQL_8_0"
+	assert.Error(t, dbin.ValidateCreate(), "database version must match the engine")
+	settings.DatabaseVersion = "POSTGRES_14"
+
+	settings.Backup.PointInTimeRecovery = true
+	assert.NoError(t, dbin.ValidateCreate())
+	settings.Backup.Enabled = false
+	assert.Error(t, dbin.ValidateCreate(), "point in time recovery requires backups")
+	settings.Backup.Enabled = true
+
+	settings.Backup.StartTime = "3am"
+	assert.Error(t, dbin.ValidateCreate(), "backup start time must be HH:MM")
+	settings.Backup.StartTime = "03:00"
+
+	settings.MaintenanceWindow.Day = 0
+	assert.Error(t, dbin.ValidateCreate(), "maintenance day must be 1 to 7")
+	settings.MaintenanceWindow.Day = 7
+
+	settings.AuthorizedNetworks[1].Value = "office"
+	assert.Error(t, dbin.ValidateCreate(), "authorized networks must be addresses")
+	settings.AuthorizedNetworks = nil
+
+	publicIP := false
+	settings.PublicIP = &publicIP
+	assert.Error(t, dbin.ValidateCreate(), "instance without public ip needs a private network")
+
+	settings.PrivateNetwork = "default"
+	assert.Error(t, dbin.ValidateCreate(), "private network must be a resource name")
+
+	settings.PrivateNetwork = "projects/test-project/global/networks/default"
+	assert.NoError(t, dbin.ValidateCreate())
+}
@@ -17,6 +17,14 @@
 package v1beta1
 
 import (
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
@@ -54,15 +62,300 @@ var _ webhook.Validator = &DbInstance{}
 func (r *DbInstance) ValidateCreate() error {
 	dbinstancelog.Info("validate create", "name", r.Name)
 
-	// TODO(user): fill in your validation logic upon object creation.
-	return nil
+	if err := r.ValidateBackend(); err != nil {
+		return err
+	}
+	if err := r.validateExecutor(); err != nil {
+		return err
+	}
+	if err := r.validateSSLConnection(); err != nil {
+		return err
+	}
+	if err := r.validateGoogle(); err != nil {
+		return err
+	}
+	if err := r.validateAws(); err != nil {
+		return err
+	}
+	if err := r.validateAzure(); err != nil {
+		return err
+	}
+	return r.validateGenericHosts()
 }
 
 // ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
 func (r *DbInstance) ValidateUpdate(old runtime.Object) error {
 	dbinstancelog.Info("validate update", "name", r.Name)
 
-	// TODO(user): fill in your validation logic upon object update.
+	if err := r.ValidateBackend(); err != nil {
+		return err
+	}
+	if err := r.validateExecutor(); err != nil {
+		return err
+	}
+	if err := r.validateSSLConnection(); err != nil {
+		return err
+	}
+	if err := r.validateGoogle(); err != nil {
+		return err
+	}
+	if oldInstance, ok := old.(*DbInstance); ok {
+		if err := r.validateGoogleUpdate(oldInstance); err != nil {
+			return err
+		}
+	}
+	if err := r.validateAws(); err != nil {
+		return err
+	}
+	if err := r.validateAzure(); err != nil {
+		return err
+	}
+	return r.validateGenericHosts()
+}
+
+// validateSSLConnection makes sure the certificates are only referenced for ssl connections
+func (r *DbInstance) validateSSLConnection() error {
+	ssl := r.Spec.SSLConnection
+	for _, ref := range []*NamespacedName{ssl.CASecret, ssl.ClientCertSecret} {
+		if ref == nil {
+			continue
+		}
+		if !ssl.Enabled {
+			return errors.New("certificates of the ssl connection require ssl to be enabled")
+		}
+		if ref.Namespace == "" || ref.Name == "" {
+			return errors.New("namespace and name of the certificate secrets must be defined")
+		}
+	}
+	if r.Spec.Google != nil && r.Spec.Google.ManageClientCert && ssl.ClientCertSecret == nil {
+		return errors.New("managed client certificate of google instance requires a client cert secret")
+	}
+	return nil
+}
+
+// validateGoogleUpdate makes sure the source of a google instance isn't changed,
+// the master instance is only removed when the replica is promoted
+func (r *DbInstance) validateGoogleUpdate(old *DbInstance) error {
+	if r.Spec.Google == nil || old.Spec.Google == nil {
+		return nil
+	}
+	if !reflect.DeepEqual(r.Spec.Google.CloneOf, old.Spec.Google.CloneOf) {
+		return errors.New("clone source of google instance is immutable")
+	}
+	if !reflect.DeepEqual(r.Spec.Google.RestoreFrom, old.Spec.Google.RestoreFrom) {
+		return errors.New("restored backup run of google instance is immutable")
+	}
+	if master := r.Spec.Google.MasterInstanceName; master != "" && master != old.Spec.Google.MasterInstanceName {
+		return errors.New("master instance of google instance can't be added or changed")
+	}
+	return nil
+}
+
+func (r *DbInstance) validateGenericHosts() error {
+	if r.Spec.Generic == nil {
+		return nil
+	}
+	if err := r.validateSSHTunnel(); err != nil {
+		return err
+	}
+	if r.Spec.Generic.ServiceRef != nil {
+		if r.Spec.Generic.Host != "" || len(r.Spec.Generic.Hosts) > 0 || r.Spec.Generic.Provision != nil {
+			return errors.New("host, hosts and provision can't be defined for a generic instance with a service reference")
+		}
+		if r.Spec.Generic.ServiceRef.Namespace == "" || r.Spec.Generic.ServiceRef.Name == "" {
+			return errors.New("namespace and name of the service reference must be defined")
+		}
+		return nil
+	}
+	if r.Spec.Generic.Provision != nil {
+		if r.Spec.Generic.Host != "" || len(r.Spec.Generic.Hosts) > 0 {
+			return errors.New("host and hosts can't be defined for a provisioned generic instance")
+		}
+		if r.Spec.AdminUserSecret.Namespace == "" {
+			return errors.New("namespace of the admin secret must be defined for a provisioned generic instance")
+		}
+		return nil
+	}
+	if (r.Spec.Generic.Host == "") == (len(r.Spec.Generic.Hosts) == 0) {
+		return errors.New("generic instance must define exactly one of host or hosts")
+	}
+	if r.Spec.Generic.Port == 0 {
+		return errors.New("port of generic instance must be defined")
+	}
+	return nil
+}
+
+func (r *DbInstance) validateExecutor() error {
+	if r.Spec.Executor == nil {
+		return nil
+	}
+	if r.Spec.Google != nil {
+		return errors.New("executor can't be used for google instances")
+	}
+	if r.Spec.Executor.Namespace == "" {
+		return errors.New("namespace of the executor must be defined")
+	}
+	return nil
+}
+
+var (
+	googlePrivateNetworkPattern  = regexp.MustCompile(`^projects/[^/]+/global/networks/[^/]+$`)
+	googleBackupStartTimePattern = regexp.MustCompile(`^([01][0-9]|2[0-3]):[0-5][0-9]$`)
+)
+
+func (r *DbInstance) validateGoogle() error {
+	if r.Spec.Google == nil {
+		return nil
+	}
+	if r.Spec.Google.InstanceName == "" {
+		return errors.New("instance of google instance must be defined")
+	}
+	if r.Spec.Google.MasterInstanceName != "" && r.Spec.Google.CloneOf != nil {
+		return errors.New("google instance can't be a read replica and a clone at the same time")
+	}
+	if r.Spec.Google.MasterInstanceName == r.Name && r.Name != "" {
+		return errors.New("google instance can't replicate itself")
+	}
+	if clone := r.Spec.Google.CloneOf; clone != nil {
+		if clone.Instance == "" || clone.Instance == r.Name {
+			return errors.New("clone of google instance must define another instance as source")
+		}
+		if clone.PointInTime != "" {
+			if _, err := time.Parse(time.RFC3339, clone.PointInTime); err != nil {
+				return fmt.Errorf("point in time %s of google clone must be a RFC 3339 timestamp", clone.PointInTime)
+			}
+		}
+	}
+	if restore := r.Spec.Google.RestoreFrom; restore != nil {
+		if r.Spec.Google.MasterInstanceName != "" || r.Spec.Google.CloneOf != nil {
+			return errors.New("google instance can't be restored from a backup run and be a read replica or a clone")
+		}
+		if restore.Instance == "" || restore.BackupRunID <= 0 {
+			return errors.New("restore of google instance must define the source instance and the id of the backup run")
+		}
+	}
+	if runs := r.Spec.Google.BackupRuns; runs != nil && runs.Interval.Duration < time.Hour {
+		return errors.New("interval of google backup runs must be at least 1h")
+	}
+	if backup := r.Spec.Google.FinalBackup; backup != nil {
+		if r.Spec.Google.DeletionPolicy != GoogleDeletionPolicyDelete {
+			return errors.New("final backup of google instance requires the deletion policy Delete")
+		}
+		if backup.Bucket == "" || strings.Contains(backup.Bucket, "/") {
+			return errors.New("final backup of google instance must define the name of a bucket")
+		}
+	}
+	settings := r.Spec.Google.Settings
+	if settings == nil {
+		// clones keep the settings of their source
+		if r.Spec.Google.ConfigmapName.Name == "" && r.Spec.Google.CloneOf == nil {
+			return errors.New("configmap or settings of google instance must be defined")
+		}
+		return nil
+	}
+
+	if settings.DatabaseVersion != "" && !strings.HasPrefix(settings.DatabaseVersion, strings.ToUpper(r.Spec.Engine)+"_") {
+		return fmt.Errorf("database version %s of google instance doesn't match engine %s", settings.DatabaseVersion, r.Spec.Engine)
+	}
+	if settings.DiskSizeGB != 0 && settings.DiskSizeGB < 10 {
+		return errors.New("disk size of google instance must be at least 10 GB")
+	}
+	if settings.DiskAutoresizeLimitGB != 0 {
+		if settings.DiskAutoresize != nil && !*settings.DiskAutoresize {
+			return errors.New("disk autoresize limit of google instance requires disk autoresize")
+		}
+		if settings.DiskAutoresizeLimitGB < settings.DiskSizeGB {
+			return errors.New("disk autoresize limit of google instance must not be less than the disk size")
+		}
+	}
+	for name := range settings.Flags {
+		if name == "" {
+			return errors.New("flags of google instance must have a name")
+		}
+	}
+	if settings.Backup != nil && settings.Backup.PointInTimeRecovery && !settings.Backup.Enabled {
+		return errors.New("point in time recovery of google instance requires backups")
+	}
+	if settings.Backup != nil && settings.Backup.StartTime != "" && !googleBackupStartTimePattern.MatchString(settings.Backup.StartTime) {
+		return fmt.Errorf("backup start time %s of google instance must be HH:MM", settings.Backup.StartTime)
+	}
+	if window := settings.MaintenanceWindow; window != nil {
+		if window.Day < 1 || window.Day > 7 || window.Hour < 0 || window.Hour > 23 {
+			return errors.New("maintenance window of google instance must define a day from 1 to 7 and an hour from 0 to 23")
+		}
+	}
+	for _, network := range settings.AuthorizedNetworks {
+		if _, _, err := net.ParseCIDR(network.Value); err != nil && net.ParseIP(network.Value) == nil {
+			return fmt.Errorf("authorized network %s of google instance must be an ip address or a cidr", network.Value)
+		}
+	}
+	if settings.PrivateNetwork != "" && !googlePrivateNetworkPattern.MatchString(settings.PrivateNetwork) {
+		return fmt.Errorf("private network %s of google instance must be projects/<project>/global/networks/<network>", settings.PrivateNetwork)
+	}
+	if settings.PublicIP != nil && !*settings.PublicIP {
+		if settings.PrivateNetwork == "" {
+			return errors.New("google instance without public ip needs a private network")
+		}
+		if len(settings.AuthorizedNetworks) > 0 {
+			return errors.New("authorized networks of google instance require a public ip")
+		}
+	}
+	return nil
+}
+
+func (r *DbInstance) validateAws() error {
+	if r.Spec.Aws == nil {
+		return nil
+	}
+	if r.Spec.Aws.InstanceIdentifier == "" || r.Spec.Aws.Region == "" {
+		return errors.New("instance and region of aws instance must be defined")
+	}
+	if r.Spec.Aws.ConfigmapName.Name == "" {
+		return errors.New("configmap of aws instance must be defined")
+	}
+	if r.Spec.Aws.IAMAuth && (!r.Spec.SSLConnection.Enabled || r.Spec.SSLConnection.SkipVerify) {
+		return errors.New("iam authentication of aws instance requires ssl connections with verification")
+	}
+	return nil
+}
+
+func (r *DbInstance) validateAzure() error {
+	if r.Spec.Azure == nil {
+		return nil
+	}
+	if r.Spec.Azure.ServerName == "" || r.Spec.Azure.ResourceGroup == "" {
+		return errors.New("server and resource group of azure instance must be defined")
+	}
+	if r.Spec.Azure.ConfigmapName.Name == "" {
+		return errors.New("configmap of azure instance must be defined")
+	}
+	names := map[string]bool{}
+	for _, rule := range r.Spec.Azure.FirewallRules {
+		if rule.Name == "" || net.ParseIP(rule.StartIPAddress).To4() == nil || net.ParseIP(rule.EndIPAddress).To4() == nil {
+			return fmt.Errorf("firewall rule %s of azure instance must define a name and ipv4 start and end addresses", rule.Name)
+		}
+		if names[rule.Name] {
+			return fmt.Errorf("firewall rule %s of azure instance is defined more than once", rule.Name)
+		}
+		names[rule.Name] = true
+	}
+	return nil
+}
+
+func (r *DbInstance) validateSSHTunnel() error {
+	tunnel := r.Spec.Generic.SSHTunnel
+	if tunnel == nil {
+		return nil
+	}
+	if r.Spec.Generic.ServiceRef != nil || r.Spec.Generic.Provision != nil {
+		return errors.New("ssh tunnel can't be used for a database server in the cluster")
+	}
+	if tunnel.Host == "" || tunnel.User == "" {
+		return errors.New("host and user of the ssh tunnel must be defined")
+	}
+	if tunnel.PrivateKeySecret.Namespace == "" || tunnel.PrivateKeySecret.Name == "" {
+		return errors.New("namespace and name of the private key secret of the ssh tunnel must be defined")
+	}
 	return nil
 }
 
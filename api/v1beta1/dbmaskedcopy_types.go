@@ -0,0 +1,106 @@
+/*
+ * Copyright 2021 kloeckner.i GmbH
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DbMaskedCopySpec defines the desired state of DbMaskedCopy
+type DbMaskedCopySpec struct {
+	// Source is the Database which is copied
+	Source DatabaseDataSource `json:"source"`
+	// Target describes the Database which is created from the source, in the namespace of the DbMaskedCopy
+	Target DbMaskedCopyTarget `json:"target"`
+	// Masking rules are applied in the given order after the copy
+	Masking []MaskedTable `json:"masking"`
+}
+
+// DbMaskedCopyTarget defines the Database created by the DbMaskedCopy
+type DbMaskedCopyTarget struct {
+	Name       string `json:"name"`
+	Instance   string `json:"instance"`
+	SecretName string `json:"secretName"`
+	Cleanup    bool   `json:"cleanup,omitempty"`
+}
+
+// MaskedTable defines how the content of a table is anonymized
+type MaskedTable struct {
+	// Table name, can be qualified by a schema for postgres
+	Table string `json:"table"`
+	// If set to true, all rows of the table are removed
+	Truncate bool           `json:"truncate,omitempty"`
+	Columns  []MaskedColumn `json:"columns,omitempty"`
+}
+
+// MaskedColumn defines how values of a column are anonymized
+type MaskedColumn struct {
+	Name string `json:"name"`
+	// +kubebuilder:validation:Enum=null;hash;fakeEmail;fixed
+	Strategy string `json:"strategy"`
+	// Value is used by the fixed strategy
+	Value string `json:"value,omitempty"`
+}
+
+// DbMaskedCopyStatus defines the observed state of DbMaskedCopy
+type DbMaskedCopyStatus struct {
+	Phase  string `json:"phase"`
+	Status bool   `json:"status"`
+	// Report contains the outcome of every masking rule
+	Report []MaskingReport `json:"report,omitempty"`
+	// MaskedAt is the time when masking rules were applied successfully
+	MaskedAt *metav1.Time `json:"maskedAt,omitempty"`
+}
+
+// MaskingReport describes the outcome of a masking rule
+type MaskingReport struct {
+	Table        string `json:"table"`
+	Column       string `json:"column,omitempty"`
+	Strategy     string `json:"strategy"`
+	RowsAffected int64  `json:"rowsAffected"`
+	Error        string `json:"error,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:shortName=dbmc
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`,description="current phase"
+// +kubebuilder:printcolumn:name="Status",type=boolean,JSONPath=`.status.status`,description="current status"
+// +kubebuilder:printcolumn:name="Source",type=string,JSONPath=`.spec.source.name`,description="source database"
+// +kubebuilder:printcolumn:name="Target",type=string,JSONPath=`.spec.target.name`,description="target database"
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`,description="time since creation of resource"
+// DbMaskedCopy is the Schema for the dbmaskedcopies API
+type DbMaskedCopy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   DbMaskedCopySpec   `json:"spec,omitempty"`
+	Status DbMaskedCopyStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// DbMaskedCopyList contains a list of DbMaskedCopy
+type DbMaskedCopyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []DbMaskedCopy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&DbMaskedCopy{}, &DbMaskedCopyList{})
+}
@@ -22,9 +22,63 @@
 package v1beta1
 
 import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AwsInstance) DeepCopyInto(out *AwsInstance) {
+	*out = *in
+	out.ConfigmapName = in.ConfigmapName
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AwsInstance.
+func (in *AwsInstance) DeepCopy() *AwsInstance {
+	if in == nil {
+		return nil
+	}
+	out := new(AwsInstance)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AzureFirewallRule) DeepCopyInto(out *AzureFirewallRule) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AzureFirewallRule.
+func (in *AzureFirewallRule) DeepCopy() *AzureFirewallRule {
+	if in == nil {
+		return nil
+	}
+	out := new(AzureFirewallRule)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AzureInstance) DeepCopyInto(out *AzureInstance) {
+	*out = *in
+	out.ConfigmapName = in.ConfigmapName
+	if in.FirewallRules != nil {
+		in, out := &in.FirewallRules, &out.FirewallRules
+		*out = make([]AzureFirewallRule, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AzureInstance.
+func (in *AzureInstance) DeepCopy() *AzureInstance {
+	if in == nil {
+		return nil
+	}
+	out := new(AzureInstance)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *BackendServer) DeepCopyInto(out *BackendServer) {
 	*out = *in
@@ -40,6 +94,27 @@ func (in *BackendServer) DeepCopy() *BackendServer {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CustomInstance) DeepCopyInto(out *CustomInstance) {
+	*out = *in
+	if in.Config != nil {
+		in, out := &in.Config, &out.Config
+		*out = new(runtime.RawExtension)
+		(*in).DeepCopyInto(*out)
+	}
+	out.ConfigmapName = in.ConfigmapName
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CustomInstance.
+func (in *CustomInstance) DeepCopy() *CustomInstance {
+	if in == nil {
+		return nil
+	}
+	out := new(CustomInstance)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Database) DeepCopyInto(out *Database) {
 	*out = *in
@@ -67,6 +142,22 @@ func (in *Database) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DatabaseAdoption) DeepCopyInto(out *DatabaseAdoption) {
+	*out = *in
+	in.PasswordSecretRef.DeepCopyInto(&out.PasswordSecretRef)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DatabaseAdoption.
+func (in *DatabaseAdoption) DeepCopy() *DatabaseAdoption {
+	if in == nil {
+		return nil
+	}
+	out := new(DatabaseAdoption)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DatabaseBackup) DeepCopyInto(out *DatabaseBackup) {
 	*out = *in
@@ -82,6 +173,36 @@ func (in *DatabaseBackup) DeepCopy() *DatabaseBackup {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DatabaseDataSource) DeepCopyInto(out *DatabaseDataSource) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DatabaseDataSource.
+func (in *DatabaseDataSource) DeepCopy() *DatabaseDataSource {
+	if in == nil {
+		return nil
+	}
+	out := new(DatabaseDataSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DatabaseIAMAuth) DeepCopyInto(out *DatabaseIAMAuth) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DatabaseIAMAuth.
+func (in *DatabaseIAMAuth) DeepCopy() *DatabaseIAMAuth {
+	if in == nil {
+		return nil
+	}
+	out := new(DatabaseIAMAuth)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DatabaseList) DeepCopyInto(out *DatabaseList) {
 	*out = *in
@@ -114,6 +235,21 @@ func (in *DatabaseList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DatabasePooler) DeepCopyInto(out *DatabasePooler) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DatabasePooler.
+func (in *DatabasePooler) DeepCopy() *DatabasePooler {
+	if in == nil {
+		return nil
+	}
+	out := new(DatabasePooler)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DatabaseProxyStatus) DeepCopyInto(out *DatabaseProxyStatus) {
 	*out = *in
@@ -141,6 +277,26 @@ func (in *DatabaseSpec) DeepCopyInto(out *DatabaseSpec) {
 		}
 	}
 	in.Postgres.DeepCopyInto(&out.Postgres)
+	if in.DataSource != nil {
+		in, out := &in.DataSource, &out.DataSource
+		*out = new(DatabaseDataSource)
+		**out = **in
+	}
+	if in.Adopt != nil {
+		in, out := &in.Adopt, &out.Adopt
+		*out = new(DatabaseAdoption)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Pooler != nil {
+		in, out := &in.Pooler, &out.Pooler
+		*out = new(DatabasePooler)
+		**out = **in
+	}
+	if in.IAMAuth != nil {
+		in, out := &in.IAMAuth, &out.IAMAuth
+		*out = new(DatabaseIAMAuth)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DatabaseSpec.
@@ -162,6 +318,13 @@ func (in *DatabaseStatus) DeepCopyInto(out *DatabaseStatus) {
 		(*in).DeepCopyInto(*out)
 	}
 	out.ProxyStatus = in.ProxyStatus
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DatabaseStatus.
@@ -174,6 +337,89 @@ func (in *DatabaseStatus) DeepCopy() *DatabaseStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DbCloneGrant) DeepCopyInto(out *DbCloneGrant) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DbCloneGrant.
+func (in *DbCloneGrant) DeepCopy() *DbCloneGrant {
+	if in == nil {
+		return nil
+	}
+	out := new(DbCloneGrant)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *DbCloneGrant) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DbCloneGrantList) DeepCopyInto(out *DbCloneGrantList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]DbCloneGrant, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DbCloneGrantList.
+func (in *DbCloneGrantList) DeepCopy() *DbCloneGrantList {
+	if in == nil {
+		return nil
+	}
+	out := new(DbCloneGrantList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *DbCloneGrantList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DbCloneGrantSpec) DeepCopyInto(out *DbCloneGrantSpec) {
+	*out = *in
+	if in.Namespaces != nil {
+		in, out := &in.Namespaces, &out.Namespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Databases != nil {
+		in, out := &in.Databases, &out.Databases
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DbCloneGrantSpec.
+func (in *DbCloneGrantSpec) DeepCopy() *DbCloneGrantSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(DbCloneGrantSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DbInstance) DeepCopyInto(out *DbInstance) {
 	*out = *in
@@ -216,6 +462,35 @@ func (in *DbInstanceBackup) DeepCopy() *DbInstanceBackup {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DbInstanceExecutor) DeepCopyInto(out *DbInstanceExecutor) {
+	*out = *in
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Tolerations != nil {
+		in, out := &in.Tolerations, &out.Tolerations
+		*out = make([]corev1.Toleration, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DbInstanceExecutor.
+func (in *DbInstanceExecutor) DeepCopy() *DbInstanceExecutor {
+	if in == nil {
+		return nil
+	}
+	out := new(DbInstanceExecutor)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DbInstanceList) DeepCopyInto(out *DbInstanceList) {
 	*out = *in
@@ -266,6 +541,16 @@ func (in *DbInstanceMonitoring) DeepCopy() *DbInstanceMonitoring {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DbInstanceSSLConnection) DeepCopyInto(out *DbInstanceSSLConnection) {
 	*out = *in
+	if in.CASecret != nil {
+		in, out := &in.CASecret, &out.CASecret
+		*out = new(NamespacedName)
+		**out = **in
+	}
+	if in.ClientCertSecret != nil {
+		in, out := &in.ClientCertSecret, &out.ClientCertSecret
+		*out = new(NamespacedName)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DbInstanceSSLConnection.
@@ -284,13 +569,33 @@ func (in *DbInstanceSource) DeepCopyInto(out *DbInstanceSource) {
 	if in.Google != nil {
 		in, out := &in.Google, &out.Google
 		*out = new(GoogleInstance)
-		**out = **in
+		(*in).DeepCopyInto(*out)
 	}
 	if in.Generic != nil {
 		in, out := &in.Generic, &out.Generic
 		*out = new(GenericInstance)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Percona != nil {
+		in, out := &in.Percona, &out.Percona
+		*out = new(PerconaCluster)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Aws != nil {
+		in, out := &in.Aws, &out.Aws
+		*out = new(AwsInstance)
 		**out = **in
 	}
+	if in.Azure != nil {
+		in, out := &in.Azure, &out.Azure
+		*out = new(AzureInstance)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Custom != nil {
+		in, out := &in.Custom, &out.Custom
+		*out = new(CustomInstance)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DbInstanceSource.
@@ -309,7 +614,19 @@ func (in *DbInstanceSpec) DeepCopyInto(out *DbInstanceSpec) {
 	out.AdminUserSecret = in.AdminUserSecret
 	out.Backup = in.Backup
 	out.Monitoring = in.Monitoring
-	out.SSLConnection = in.SSLConnection
+	in.SSLConnection.DeepCopyInto(&out.SSLConnection)
+	if in.ReadReplicas != nil {
+		in, out := &in.ReadReplicas, &out.ReadReplicas
+		*out = make([]ReadReplica, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Executor != nil {
+		in, out := &in.Executor, &out.Executor
+		*out = new(DbInstanceExecutor)
+		(*in).DeepCopyInto(*out)
+	}
 	in.DbInstanceSource.DeepCopyInto(&out.DbInstanceSource)
 }
 
@@ -340,6 +657,32 @@ func (in *DbInstanceStatus) DeepCopyInto(out *DbInstanceStatus) {
 			(*out)[key] = val
 		}
 	}
+	if in.ReadReplicas != nil {
+		in, out := &in.ReadReplicas, &out.ReadReplicas
+		*out = make([]ReadReplicaStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.Replicas != nil {
+		in, out := &in.Replicas, &out.Replicas
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.BackupRuns != nil {
+		in, out := &in.BackupRuns, &out.BackupRuns
+		*out = make([]GoogleBackupRunStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.BackupRunsListedAt != nil {
+		in, out := &in.BackupRunsListedAt, &out.BackupRunsListedAt
+		*out = (*in).DeepCopy()
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DbInstanceStatus.
@@ -353,41 +696,472 @@ func (in *DbInstanceStatus) DeepCopy() *DbInstanceStatus {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *GenericInstance) DeepCopyInto(out *GenericInstance) {
+func (in *DbMaskedCopy) DeepCopyInto(out *DbMaskedCopy) {
 	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GenericInstance.
-func (in *GenericInstance) DeepCopy() *GenericInstance {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DbMaskedCopy.
+func (in *DbMaskedCopy) DeepCopy() *DbMaskedCopy {
 	if in == nil {
 		return nil
 	}
-	out := new(GenericInstance)
+	out := new(DbMaskedCopy)
 	in.DeepCopyInto(out)
 	return out
 }
 
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *DbMaskedCopy) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *GoogleInstance) DeepCopyInto(out *GoogleInstance) {
+func (in *DbMaskedCopyList) DeepCopyInto(out *DbMaskedCopyList) {
 	*out = *in
-	out.ConfigmapName = in.ConfigmapName
-	out.ClientSecret = in.ClientSecret
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]DbMaskedCopy, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GoogleInstance.
-func (in *GoogleInstance) DeepCopy() *GoogleInstance {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DbMaskedCopyList.
+func (in *DbMaskedCopyList) DeepCopy() *DbMaskedCopyList {
 	if in == nil {
 		return nil
 	}
-	out := new(GoogleInstance)
+	out := new(DbMaskedCopyList)
 	in.DeepCopyInto(out)
 	return out
 }
 
-// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *NamespacedName) DeepCopyInto(out *NamespacedName) {
-	*out = *in
-}
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *DbMaskedCopyList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DbMaskedCopySpec) DeepCopyInto(out *DbMaskedCopySpec) {
+	*out = *in
+	out.Source = in.Source
+	out.Target = in.Target
+	if in.Masking != nil {
+		in, out := &in.Masking, &out.Masking
+		*out = make([]MaskedTable, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DbMaskedCopySpec.
+func (in *DbMaskedCopySpec) DeepCopy() *DbMaskedCopySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(DbMaskedCopySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DbMaskedCopyStatus) DeepCopyInto(out *DbMaskedCopyStatus) {
+	*out = *in
+	if in.Report != nil {
+		in, out := &in.Report, &out.Report
+		*out = make([]MaskingReport, len(*in))
+		copy(*out, *in)
+	}
+	if in.MaskedAt != nil {
+		in, out := &in.MaskedAt, &out.MaskedAt
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DbMaskedCopyStatus.
+func (in *DbMaskedCopyStatus) DeepCopy() *DbMaskedCopyStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(DbMaskedCopyStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DbMaskedCopyTarget) DeepCopyInto(out *DbMaskedCopyTarget) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DbMaskedCopyTarget.
+func (in *DbMaskedCopyTarget) DeepCopy() *DbMaskedCopyTarget {
+	if in == nil {
+		return nil
+	}
+	out := new(DbMaskedCopyTarget)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GenericInstance) DeepCopyInto(out *GenericInstance) {
+	*out = *in
+	if in.Hosts != nil {
+		in, out := &in.Hosts, &out.Hosts
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Provision != nil {
+		in, out := &in.Provision, &out.Provision
+		*out = new(GenericProvision)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ServiceRef != nil {
+		in, out := &in.ServiceRef, &out.ServiceRef
+		*out = new(ServiceReference)
+		**out = **in
+	}
+	if in.SSHTunnel != nil {
+		in, out := &in.SSHTunnel, &out.SSHTunnel
+		*out = new(SSHTunnel)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GenericInstance.
+func (in *GenericInstance) DeepCopy() *GenericInstance {
+	if in == nil {
+		return nil
+	}
+	out := new(GenericInstance)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GenericProvision) DeepCopyInto(out *GenericProvision) {
+	*out = *in
+	out.StorageSize = in.StorageSize.DeepCopy()
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GenericProvision.
+func (in *GenericProvision) DeepCopy() *GenericProvision {
+	if in == nil {
+		return nil
+	}
+	out := new(GenericProvision)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GenericReplica) DeepCopyInto(out *GenericReplica) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GenericReplica.
+func (in *GenericReplica) DeepCopy() *GenericReplica {
+	if in == nil {
+		return nil
+	}
+	out := new(GenericReplica)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GoogleAuthorizedNetwork) DeepCopyInto(out *GoogleAuthorizedNetwork) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GoogleAuthorizedNetwork.
+func (in *GoogleAuthorizedNetwork) DeepCopy() *GoogleAuthorizedNetwork {
+	if in == nil {
+		return nil
+	}
+	out := new(GoogleAuthorizedNetwork)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GoogleBackup) DeepCopyInto(out *GoogleBackup) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GoogleBackup.
+func (in *GoogleBackup) DeepCopy() *GoogleBackup {
+	if in == nil {
+		return nil
+	}
+	out := new(GoogleBackup)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GoogleBackupRunStatus) DeepCopyInto(out *GoogleBackupRunStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GoogleBackupRunStatus.
+func (in *GoogleBackupRunStatus) DeepCopy() *GoogleBackupRunStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(GoogleBackupRunStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GoogleBackupRuns) DeepCopyInto(out *GoogleBackupRuns) {
+	*out = *in
+	out.Interval = in.Interval
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GoogleBackupRuns.
+func (in *GoogleBackupRuns) DeepCopy() *GoogleBackupRuns {
+	if in == nil {
+		return nil
+	}
+	out := new(GoogleBackupRuns)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GoogleClone) DeepCopyInto(out *GoogleClone) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GoogleClone.
+func (in *GoogleClone) DeepCopy() *GoogleClone {
+	if in == nil {
+		return nil
+	}
+	out := new(GoogleClone)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GoogleFinalBackup) DeepCopyInto(out *GoogleFinalBackup) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GoogleFinalBackup.
+func (in *GoogleFinalBackup) DeepCopy() *GoogleFinalBackup {
+	if in == nil {
+		return nil
+	}
+	out := new(GoogleFinalBackup)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GoogleInstance) DeepCopyInto(out *GoogleInstance) {
+	*out = *in
+	out.ConfigmapName = in.ConfigmapName
+	if in.Settings != nil {
+		in, out := &in.Settings, &out.Settings
+		*out = new(GoogleInstanceSettings)
+		(*in).DeepCopyInto(*out)
+	}
+	out.ClientSecret = in.ClientSecret
+	if in.FinalBackup != nil {
+		in, out := &in.FinalBackup, &out.FinalBackup
+		*out = new(GoogleFinalBackup)
+		**out = **in
+	}
+	if in.CloneOf != nil {
+		in, out := &in.CloneOf, &out.CloneOf
+		*out = new(GoogleClone)
+		**out = **in
+	}
+	if in.RestoreFrom != nil {
+		in, out := &in.RestoreFrom, &out.RestoreFrom
+		*out = new(GoogleRestore)
+		**out = **in
+	}
+	if in.BackupRuns != nil {
+		in, out := &in.BackupRuns, &out.BackupRuns
+		*out = new(GoogleBackupRuns)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GoogleInstance.
+func (in *GoogleInstance) DeepCopy() *GoogleInstance {
+	if in == nil {
+		return nil
+	}
+	out := new(GoogleInstance)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GoogleInstanceSettings) DeepCopyInto(out *GoogleInstanceSettings) {
+	*out = *in
+	if in.DiskAutoresize != nil {
+		in, out := &in.DiskAutoresize, &out.DiskAutoresize
+		*out = new(bool)
+		**out = **in
+	}
+	if in.Flags != nil {
+		in, out := &in.Flags, &out.Flags
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Backup != nil {
+		in, out := &in.Backup, &out.Backup
+		*out = new(GoogleBackup)
+		**out = **in
+	}
+	if in.MaintenanceWindow != nil {
+		in, out := &in.MaintenanceWindow, &out.MaintenanceWindow
+		*out = new(GoogleMaintenanceWindow)
+		**out = **in
+	}
+	if in.AuthorizedNetworks != nil {
+		in, out := &in.AuthorizedNetworks, &out.AuthorizedNetworks
+		*out = make([]GoogleAuthorizedNetwork, len(*in))
+		copy(*out, *in)
+	}
+	if in.PublicIP != nil {
+		in, out := &in.PublicIP, &out.PublicIP
+		*out = new(bool)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GoogleInstanceSettings.
+func (in *GoogleInstanceSettings) DeepCopy() *GoogleInstanceSettings {
+	if in == nil {
+		return nil
+	}
+	out := new(GoogleInstanceSettings)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GoogleMaintenanceWindow) DeepCopyInto(out *GoogleMaintenanceWindow) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GoogleMaintenanceWindow.
+func (in *GoogleMaintenanceWindow) DeepCopy() *GoogleMaintenanceWindow {
+	if in == nil {
+		return nil
+	}
+	out := new(GoogleMaintenanceWindow)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GoogleReplica) DeepCopyInto(out *GoogleReplica) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GoogleReplica.
+func (in *GoogleReplica) DeepCopy() *GoogleReplica {
+	if in == nil {
+		return nil
+	}
+	out := new(GoogleReplica)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GoogleRestore) DeepCopyInto(out *GoogleRestore) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GoogleRestore.
+func (in *GoogleRestore) DeepCopy() *GoogleRestore {
+	if in == nil {
+		return nil
+	}
+	out := new(GoogleRestore)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MaskedColumn) DeepCopyInto(out *MaskedColumn) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MaskedColumn.
+func (in *MaskedColumn) DeepCopy() *MaskedColumn {
+	if in == nil {
+		return nil
+	}
+	out := new(MaskedColumn)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MaskedTable) DeepCopyInto(out *MaskedTable) {
+	*out = *in
+	if in.Columns != nil {
+		in, out := &in.Columns, &out.Columns
+		*out = make([]MaskedColumn, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MaskedTable.
+func (in *MaskedTable) DeepCopy() *MaskedTable {
+	if in == nil {
+		return nil
+	}
+	out := new(MaskedTable)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MaskingReport) DeepCopyInto(out *MaskingReport) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MaskingReport.
+func (in *MaskingReport) DeepCopy() *MaskingReport {
+	if in == nil {
+		return nil
+	}
+	out := new(MaskingReport)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NamespacedName) DeepCopyInto(out *NamespacedName) {
+	*out = *in
+}
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NamespacedName.
 func (in *NamespacedName) DeepCopy() *NamespacedName {
@@ -399,6 +1173,26 @@ func (in *NamespacedName) DeepCopy() *NamespacedName {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PerconaCluster) DeepCopyInto(out *PerconaCluster) {
+	*out = *in
+	if in.ServerList != nil {
+		in, out := &in.ServerList, &out.ServerList
+		*out = make([]BackendServer, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PerconaCluster.
+func (in *PerconaCluster) DeepCopy() *PerconaCluster {
+	if in == nil {
+		return nil
+	}
+	out := new(PerconaCluster)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Postgres) DeepCopyInto(out *Postgres) {
 	*out = *in
@@ -423,3 +1217,74 @@ func (in *Postgres) DeepCopy() *Postgres {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReadReplica) DeepCopyInto(out *ReadReplica) {
+	*out = *in
+	if in.Generic != nil {
+		in, out := &in.Generic, &out.Generic
+		*out = new(GenericReplica)
+		**out = **in
+	}
+	if in.Google != nil {
+		in, out := &in.Google, &out.Google
+		*out = new(GoogleReplica)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReadReplica.
+func (in *ReadReplica) DeepCopy() *ReadReplica {
+	if in == nil {
+		return nil
+	}
+	out := new(ReadReplica)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReadReplicaStatus) DeepCopyInto(out *ReadReplicaStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReadReplicaStatus.
+func (in *ReadReplicaStatus) DeepCopy() *ReadReplicaStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ReadReplicaStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SSHTunnel) DeepCopyInto(out *SSHTunnel) {
+	*out = *in
+	out.PrivateKeySecret = in.PrivateKeySecret
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SSHTunnel.
+func (in *SSHTunnel) DeepCopy() *SSHTunnel {
+	if in == nil {
+		return nil
+	}
+	out := new(SSHTunnel)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServiceReference) DeepCopyInto(out *ServiceReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceReference.
+func (in *ServiceReference) DeepCopy() *ServiceReference {
+	if in == nil {
+		return nil
+	}
+	out := new(ServiceReference)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -21,8 +21,10 @@ import (
 	"fmt"
 
 	kciv1beta1 "github.com/kloeckner-i/db-operator/api/v1beta1"
+	"github.com/kloeckner-i/db-operator/pkg/backend"
 	"github.com/kloeckner-i/db-operator/pkg/config"
 	"github.com/kloeckner-i/db-operator/pkg/utils/kci"
+	"github.com/kloeckner-i/db-operator/pkg/utils/sshtunnel"
 	"github.com/sirupsen/logrus"
 	batchv1 "k8s.io/api/batch/v1"
 	batchv1beta1 "k8s.io/api/batch/v1beta1"
@@ -94,6 +96,34 @@ func buildJobTemplate(conf *config.Config, dbcr *kciv1beta1.Database) (batchv1be
 		return batchv1beta1.JobTemplateSpec{}, errors.New("unknown engine type")
 	}
 
+	containers := []v1.Container{backupContainer}
+	podVolumes := volumes(dbcr)
+	if tunnel := instance.GetSSHTunnel(); tunnel != nil {
+		host, err := getBackupHost(dbcr)
+		if err != nil {
+			return batchv1beta1.JobTemplateSpec{}, err
+		}
+		// the port is forwarded to the same port number on localhost
+		sidecar := sshtunnel.Sidecar{
+			Image:             conf.Instances.Generic.SSHTunnel.Image,
+			Host:              tunnel.Host,
+			Port:              tunnel.Port,
+			User:              tunnel.User,
+			SkipHostKeyVerify: tunnel.SkipHostKeyVerify,
+			SecretName:        sshtunnel.SecretName(dbcr.Name),
+			ServerHost:        host,
+			ServerPort:        instance.Status.Info["DB_PORT"],
+			LocalPort:         instance.Status.Info["DB_PORT"],
+			Once:              true,
+		}
+		container, err := sidecar.Container()
+		if err != nil {
+			return batchv1beta1.JobTemplateSpec{}, err
+		}
+		containers = append(containers, container)
+		podVolumes = append(podVolumes, sidecar.Volume())
+	}
+
 	return batchv1beta1.JobTemplateSpec{
 		ObjectMeta: metav1.ObjectMeta{
 			Labels: kci.BaseLabelBuilder(),
@@ -106,10 +136,10 @@ func buildJobTemplate(conf *config.Config, dbcr *kciv1beta1.Database) (batchv1be
 					Labels: kci.BaseLabelBuilder(),
 				},
 				Spec: v1.PodSpec{
-					Containers:    []v1.Container{backupContainer},
+					Containers:    containers,
 					NodeSelector:  conf.Backup.NodeSelector,
 					RestartPolicy: v1.RestartPolicyNever,
-					Volumes:       volumes(dbcr),
+					Volumes:       podVolumes,
 				},
 			},
 		},
@@ -225,6 +255,10 @@ func postgresEnvVars(conf *config.Config, dbcr *kciv1beta1.Database) ([]v1.EnvVa
 	if err != nil {
 		return []v1.EnvVar{}, fmt.Errorf("can not build postgres backup job environment variables - %s", err)
 	}
+	if instance.GetSSHTunnel() != nil {
+		// the port is forwarded by the tunnel sidecar
+		host = sshtunnel.LocalHost
+	}
 
 	port := instance.Status.Info["DB_PORT"]
 
@@ -274,6 +308,10 @@ func mysqlEnvVars(dbcr *kciv1beta1.Database) ([]v1.EnvVar, error) {
 	if err != nil {
 		return []v1.EnvVar{}, fmt.Errorf("can not build mysql backup job environment variables - %s", err)
 	}
+	if instance.GetSSHTunnel() != nil {
+		// the port is forwarded by the tunnel sidecar
+		host = sshtunnel.LocalHost
+	}
 	port := instance.Status.Info["DB_PORT"]
 
 	return []v1.EnvVar{
@@ -309,28 +347,14 @@ func mysqlEnvVars(dbcr *kciv1beta1.Database) ([]v1.EnvVar, error) {
 }
 
 func getBackupHost(dbcr *kciv1beta1.Database) (string, error) {
-	host := ""
-
 	instance, err := dbcr.GetInstanceRef()
 	if err != nil {
-		return host, err
+		return "", err
 	}
 
-	backend, err := dbcr.GetBackendType()
+	b, err := backend.For(instance)
 	if err != nil {
-		return host, err
-	}
-
-	switch backend {
-	case "google":
-		host = "db-" + dbcr.Name + "-svc" // cloud proxy service name
-		return host, nil
-	case "generic":
-		if instance.Spec.Generic.BackupHost != "" {
-			return instance.Spec.Generic.BackupHost, nil
-		}
-		return instance.Spec.Generic.Host, nil
-	default:
-		return host, errors.New("unknown backend type")
+		return "", err
 	}
+	return b.Backup.BackupHost(dbcr, instance)
 }
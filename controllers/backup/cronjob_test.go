@@ -27,6 +27,8 @@ import (
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	_ "github.com/kloeckner-i/db-operator/pkg/backend/all"
 )
 
 func TestGCSBackupCronGsql(t *testing.T) {
@@ -146,3 +148,40 @@ func TestGetResourceRequirements(t *testing.T) {
 	result := getResourceRequirements(&conf)
 	assert.Equal(t, expected, result)
 }
+
+func TestGCSBackupCronGenericSSHTunnel(t *testing.T) {
+	ownership := []metav1.OwnerReference{}
+	dbcr := &kciv1beta1.Database{}
+	dbcr.Namespace = "TestNS"
+	dbcr.Name = "TestDB"
+	instance := &kciv1beta1.DbInstance{}
+	instance.Status.Info = map[string]string{"DB_CONN": "10.0.0.5", "DB_PORT": "5432"}
+	instance.Spec.Engine = "postgres"
+	instance.Spec.Generic = &kciv1beta1.GenericInstance{
+		Host: "10.0.0.5",
+		Port: 5432,
+		SSHTunnel: &kciv1beta1.SSHTunnel{
+			Host:             "bastion.example.com",
+			User:             "tunnel",
+			PrivateKeySecret: kciv1beta1.NamespacedName{Namespace: "db-operator", Name: "bastion-key"},
+		},
+	}
+	dbcr.Status.InstanceRef = instance
+	dbcr.Spec.Backup.Cron = "* * * * *"
+
+	os.Setenv("CONFIG_PATH", "./test/backup_config.yaml")
+	conf := config.LoadConfig()
+
+	cronjob, err := GCSBackupCron(&conf, dbcr, ownership)
+	assert.NoError(t, err)
+
+	podSpec := cronjob.Spec.JobTemplate.Spec.Template.Spec
+	assert.Len(t, podSpec.Containers, 2)
+	assert.Contains(t, podSpec.Containers[0].Env, v1.EnvVar{Name: "DB_HOST", Value: "127.0.0.1"})
+
+	tunnel := podSpec.Containers[1]
+	assert.Equal(t, "sshclientimage:latest", tunnel.Image)
+	assert.Contains(t, tunnel.Env, v1.EnvVar{Name: "DB_HOST", Value: "10.0.0.5"})
+	assert.Contains(t, tunnel.Env, v1.EnvVar{Name: "SSH_PORT", Value: "22"})
+	assert.Equal(t, "TestDB-ssh-tunnel", podSpec.Volumes[len(podSpec.Volumes)-1].Secret.SecretName)
+}
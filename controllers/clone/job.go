@@ -0,0 +1,201 @@
+/*
+ * Copyright 2021 kloeckner.i GmbH
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package clone
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+
+	kciv1beta1 "github.com/kloeckner-i/db-operator/api/v1beta1"
+	"github.com/kloeckner-i/db-operator/pkg/backend"
+	"github.com/kloeckner-i/db-operator/pkg/config"
+	"github.com/kloeckner-i/db-operator/pkg/utils/database"
+	"github.com/kloeckner-i/db-operator/pkg/utils/kci"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	postgresCloneScript = `set -o pipefail
+PGPASSWORD="${SOURCE_PASSWORD}" pg_dump --no-owner --no-privileges -h "${SOURCE_HOST}" -p "${SOURCE_PORT}" -U "${SOURCE_USER}" "${SOURCE_DB}" \
+  | PGPASSWORD="${TARGET_PASSWORD}" psql -v ON_ERROR_STOP=1 -h "${TARGET_HOST}" -p "${TARGET_PORT}" -U "${TARGET_USER}" "${TARGET_DB}"`
+	mysqlCloneScript = `set -o pipefail
+mysqldump --single-transaction -h "${SOURCE_HOST}" -P "${SOURCE_PORT}" -u "${SOURCE_USER}" -p"${SOURCE_PASSWORD}" "${SOURCE_DB}" \
+  | mysql -h "${TARGET_HOST}" -P "${TARGET_PORT}" -u "${TARGET_USER}" -p"${TARGET_PASSWORD}" "${TARGET_DB}"`
+
+	sourceKeyDB       = "DB"
+	sourceKeyUser     = "USER"
+	sourceKeyPassword = "PASSWORD"
+)
+
+// SourceSecretName returns the name of the secret holding the credentials of the data source.
+// Secrets can't be referenced across namespaces, so the credentials are copied next to the clone job.
+func SourceSecretName(dbcr *kciv1beta1.Database) string {
+	return dbcr.Name + "-clone-source"
+}
+
+// ReaderName returns the name of the temporary user the job reads the data source with
+func ReaderName(dbcr *kciv1beta1.Database) string {
+	hash := sha256.Sum256([]byte(dbcr.Namespace + "/" + dbcr.Name))
+	return "clone_" + hex.EncodeToString(hash[:8])
+}
+
+// ReaderCredentials returns the credentials of the reader stored in the source secret
+func ReaderCredentials(secret *v1.Secret) database.ReaderCredentials {
+	return database.ReaderCredentials{
+		Username: string(secret.Data[sourceKeyUser]),
+		Password: string(secret.Data[sourceKeyPassword]),
+	}
+}
+
+// JobName returns the name of the job copying the data source of dbcr
+func JobName(dbcr *kciv1beta1.Database) string {
+	return dbcr.Namespace + "-" + dbcr.Name + "-clone"
+}
+
+// SourceSecret builds kubernetes secret object
+// containing the credentials of the data source which are used by the clone job
+func SourceSecret(dbcr *kciv1beta1.Database, name, user, password string, ownership []metav1.OwnerReference) *v1.Secret {
+	data := map[string][]byte{
+		sourceKeyDB:       []byte(name),
+		sourceKeyUser:     []byte(user),
+		sourceKeyPassword: []byte(password),
+	}
+	return kci.SecretBuilder(SourceSecretName(dbcr), dbcr.Namespace, data, ownership)
+}
+
+// DumpRestoreJob builds kubernetes job object
+// which dumps the data source of dbcr and restores the dump into the database of dbcr,
+// the credentials of dbcr are read from the target secret
+func DumpRestoreJob(conf *config.Config, dbcr, source *kciv1beta1.Database, targetSecret string, ownership []metav1.OwnerReference) (*batchv1.Job, error) {
+	activeDeadlineSeconds := conf.Clone.ActiveDeadlineSeconds
+	backoffLimit := int32(3)
+
+	engine, err := dbcr.GetEngineType()
+	if err != nil {
+		return nil, err
+	}
+
+	var image, script string
+	var targetKeys []string
+	switch engine {
+	case "postgres":
+		image = conf.Clone.Postgres.Image
+		script = postgresCloneScript
+		targetKeys = []string{"POSTGRES_DB", "POSTGRES_USER", "POSTGRES_PASSWORD"}
+	case "mysql":
+		image = conf.Clone.Mysql.Image
+		script = mysqlCloneScript
+		targetKeys = []string{"DB", "USER", "PASSWORD"}
+	default:
+		return nil, errors.New("unknown engine type")
+	}
+
+	sourceHost, sourcePort, err := databaseAddress(source)
+	if err != nil {
+		return nil, err
+	}
+	targetHost, targetPort, err := databaseAddress(dbcr)
+	if err != nil {
+		return nil, err
+	}
+
+	env := []v1.EnvVar{
+		{Name: "SOURCE_HOST", Value: sourceHost},
+		{Name: "SOURCE_PORT", Value: sourcePort},
+		secretEnvVar("SOURCE_DB", SourceSecretName(dbcr), sourceKeyDB),
+		secretEnvVar("SOURCE_USER", SourceSecretName(dbcr), sourceKeyUser),
+		secretEnvVar("SOURCE_PASSWORD", SourceSecretName(dbcr), sourceKeyPassword),
+		{Name: "TARGET_HOST", Value: targetHost},
+		{Name: "TARGET_PORT", Value: targetPort},
+		secretEnvVar("TARGET_DB", targetSecret, targetKeys[0]),
+		secretEnvVar("TARGET_USER", targetSecret, targetKeys[1]),
+		secretEnvVar("TARGET_PASSWORD", targetSecret, targetKeys[2]),
+	}
+
+	jobSpec := batchv1.JobSpec{
+		BackoffLimit: &backoffLimit,
+		Template: v1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{
+				Labels: kci.BaseLabelBuilder(),
+			},
+			Spec: v1.PodSpec{
+				Containers: []v1.Container{
+					{
+						Name:    engine + "-clone",
+						Image:   image,
+						Command: []string{"/bin/sh", "-c", script},
+						Env:     env,
+					},
+				},
+				NodeSelector:  conf.Clone.NodeSelector,
+				RestartPolicy: v1.RestartPolicyNever,
+			},
+		},
+	}
+	if activeDeadlineSeconds > 0 {
+		jobSpec.ActiveDeadlineSeconds = &activeDeadlineSeconds
+	}
+
+	return &batchv1.Job{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Job",
+			APIVersion: "batch/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            JobName(dbcr),
+			Namespace:       dbcr.Namespace,
+			Labels:          kci.BaseLabelBuilder(),
+			OwnerReferences: ownership,
+		},
+		Spec: jobSpec,
+	}, nil
+}
+
+// databaseAddress returns host and port to reach the database from inside the cluster
+func databaseAddress(dbcr *kciv1beta1.Database) (string, string, error) {
+	instance, err := dbcr.GetInstanceRef()
+	if err != nil {
+		return "", "", err
+	}
+	b, err := backend.For(instance)
+	if err != nil {
+		return "", "", err
+	}
+	// only proxies passing connections unchanged can be used for consistent dumps
+	if dbcr.Status.ProxyStatus.Status && b.Proxy != nil && b.Proxy.TransparentDatabaseProxy() {
+		host := dbcr.Status.ProxyStatus.ServiceName + "." + dbcr.Namespace
+		return host, strconv.FormatInt(int64(dbcr.Status.ProxyStatus.SQLPort), 10), nil
+	}
+
+	return instance.Status.Info["DB_CONN"], instance.Status.Info["DB_PORT"], nil
+}
+
+func secretEnvVar(name, secretName, key string) v1.EnvVar {
+	return v1.EnvVar{
+		Name: name,
+		ValueFrom: &v1.EnvVarSource{
+			SecretKeyRef: &v1.SecretKeySelector{
+				LocalObjectReference: v1.LocalObjectReference{Name: secretName},
+				Key:                  key,
+			},
+		},
+	}
+}
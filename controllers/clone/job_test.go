@@ -0,0 +1,117 @@
+/*
+ * Copyright 2021 kloeckner.i GmbH
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package clone
+
+import (
+	"os"
+	"testing"
+
+	kciv1beta1 "github.com/kloeckner-i/db-operator/api/v1beta1"
+	_ "github.com/kloeckner-i/db-operator/pkg/backend/all"
+	"github.com/kloeckner-i/db-operator/pkg/config"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testDatabases() (*kciv1beta1.Database, *kciv1beta1.Database) {
+	instance := &kciv1beta1.DbInstance{}
+	instance.Status.Info = map[string]string{"DB_CONN": "TestConnection", "DB_PORT": "1234"}
+	instance.Spec.Generic = &kciv1beta1.GenericInstance{}
+
+	source := &kciv1beta1.Database{}
+	source.Namespace = "SourceNS"
+	source.Name = "SourceDB"
+	source.Status.InstanceRef = instance
+
+	dbcr := &kciv1beta1.Database{}
+	dbcr.Namespace = "TestNS"
+	dbcr.Name = "TestDB"
+	dbcr.Spec.SecretName = "TestSecret"
+	dbcr.Spec.DataSource = &kciv1beta1.DatabaseDataSource{Namespace: "SourceNS", Name: "SourceDB"}
+	dbcr.Status.InstanceRef = instance.DeepCopy()
+	dbcr.Status.InstanceRef.Spec.Generic = nil
+	dbcr.Status.InstanceRef.Spec.Google = &kciv1beta1.GoogleInstance{}
+	dbcr.Status.ProxyStatus = kciv1beta1.DatabaseProxyStatus{Status: true, ServiceName: "db-TestDB-svc", SQLPort: 5432}
+
+	return dbcr, source
+}
+
+func TestDumpRestoreJob(t *testing.T) {
+	os.Setenv("CONFIG_PATH", "./test/clone_config.yaml")
+	conf := config.LoadConfig()
+	dbcr, source := testDatabases()
+
+	dbcr.Status.InstanceRef.Spec.Engine = "postgres"
+	job, err := DumpRestoreJob(&conf, dbcr, source, dbcr.Spec.SecretName, []metav1.OwnerReference{})
+	assert.NoError(t, err)
+	assert.Equal(t, "TestNS-TestDB-clone", job.Name)
+	assert.Equal(t, "TestNS", job.Namespace)
+	assert.Equal(t, int64(3600), *job.Spec.ActiveDeadlineSeconds)
+
+	container := job.Spec.Template.Spec.Containers[0]
+	assert.Equal(t, "postgrescloneimage:latest", container.Image)
+	env := map[string]v1.EnvVar{}
+	for _, e := range container.Env {
+		env[e.Name] = e
+	}
+	assert.Equal(t, "TestConnection", env["SOURCE_HOST"].Value)
+	assert.Equal(t, "1234", env["SOURCE_PORT"].Value)
+	assert.Equal(t, "TestDB-clone-source", env["SOURCE_PASSWORD"].ValueFrom.SecretKeyRef.Name)
+	assert.Equal(t, "db-TestDB-svc.TestNS", env["TARGET_HOST"].Value)
+	assert.Equal(t, "5432", env["TARGET_PORT"].Value)
+	assert.Equal(t, "TestSecret", env["TARGET_DB"].ValueFrom.SecretKeyRef.Name)
+	assert.Equal(t, "POSTGRES_DB", env["TARGET_DB"].ValueFrom.SecretKeyRef.Key)
+
+	// poolers of generic instances are bypassed
+	host, port, err := databaseAddress(&kciv1beta1.Database{Status: kciv1beta1.DatabaseStatus{
+		InstanceRef: source.Status.InstanceRef,
+		ProxyStatus: dbcr.Status.ProxyStatus,
+	}})
+	assert.NoError(t, err)
+	assert.Equal(t, "TestConnection", host)
+	assert.Equal(t, "1234", port)
+
+	dbcr.Status.InstanceRef.Spec.Engine = "mysql"
+	job, err = DumpRestoreJob(&conf, dbcr, source, dbcr.Spec.SecretName, []metav1.OwnerReference{})
+	assert.NoError(t, err)
+	assert.Equal(t, "mysqlcloneimage:latest", job.Spec.Template.Spec.Containers[0].Image)
+
+	dbcr.Status.InstanceRef.Spec.Engine = "oracle"
+	_, err = DumpRestoreJob(&conf, dbcr, source, dbcr.Spec.SecretName, []metav1.OwnerReference{})
+	assert.Error(t, err)
+}
+
+func TestSourceSecret(t *testing.T) {
+	dbcr, _ := testDatabases()
+	secret := SourceSecret(dbcr, "sourcedb", "sourceuser", "sourcepass", []metav1.OwnerReference{})
+	assert.Equal(t, "TestDB-clone-source", secret.Name)
+	assert.Equal(t, "TestNS", secret.Namespace)
+	assert.Equal(t, []byte("sourceuser"), secret.Data["USER"])
+
+	reader := ReaderCredentials(secret)
+	assert.Equal(t, "sourceuser", reader.Username)
+	assert.Equal(t, "sourcepass", reader.Password)
+}
+
+func TestReaderName(t *testing.T) {
+	dbcr, source := testDatabases()
+	name := ReaderName(dbcr)
+	assert.Len(t, name, len("clone_")+16)
+	assert.Equal(t, name, ReaderName(dbcr))
+	assert.NotEqual(t, name, ReaderName(source))
+}
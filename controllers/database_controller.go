@@ -19,22 +19,28 @@ package controllers
 import (
 	"context"
 	"errors"
-	"os"
+	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	"github.com/go-logr/logr"
 	kciv1beta1 "github.com/kloeckner-i/db-operator/api/v1beta1"
 	"github.com/kloeckner-i/db-operator/controllers/backup"
+	"github.com/kloeckner-i/db-operator/controllers/clone"
+	"github.com/kloeckner-i/db-operator/pkg/backend"
 	"github.com/kloeckner-i/db-operator/pkg/config"
 	"github.com/kloeckner-i/db-operator/pkg/utils/database"
 	"github.com/kloeckner-i/db-operator/pkg/utils/kci"
 	"github.com/kloeckner-i/db-operator/pkg/utils/proxy"
+	"github.com/kloeckner-i/db-operator/pkg/utils/sshtunnel"
 	"github.com/sirupsen/logrus"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	crdv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
@@ -59,10 +65,14 @@ type DatabaseReconciler struct {
 	WatchNamespaces []string
 }
 
+var errCloneInProgress = errors.New("clone job is still running")
+
 var (
 	dbPhaseCreate               = "Creating"
 	dbPhaseInstanceAccessSecret = "InstanceAccessSecretCreating"
 	dbPhaseProxy                = "ProxyCreating"
+	dbPhaseClone                = "Cloning"
+	dbPhaseMaskingPending       = "WaitingForMasking"
 	dbPhaseSecretsTemplating    = "SecretsTemplating"
 	dbPhaseConfigMap            = "InfoConfigMapCreating"
 	dbPhaseMonitoring           = "MonitoringCreating"
@@ -75,6 +85,7 @@ var (
 //+kubebuilder:rbac:groups=kci.rocks,resources=databases,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=kci.rocks,resources=databases/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=kci.rocks,resources=databases/finalizers,verbs=update
+//+kubebuilder:rbac:groups=kci.rocks,resources=dbclonegrants,verbs=get;list;watch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -123,7 +134,14 @@ func (r *DatabaseReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 		// finalization logic fails, don't remove the finalizer so
 		// that we can retry during the next reconciliation.
 		if containsString(dbcr.ObjectMeta.Finalizers, "db."+dbcr.Name) {
-			err := r.deleteDatabase(ctx, dbcr)
+			err := r.cleanupClone(ctx, dbcr)
+			if err == nil {
+				err = r.deleteDatabase(ctx, dbcr)
+			}
+			if errors.Is(err, database.ErrRequestInProgress) {
+				logrus.Infof("DB: namespace=%s, name=%s waiting for executor job", dbcr.Namespace, dbcr.Name)
+				return reconcile.Result{RequeueAfter: executorRequeueInterval}, nil
+			}
 			if err != nil {
 				logrus.Errorf("DB: namespace=%s, name=%s failed deleting database - %s", dbcr.Namespace, dbcr.Name, err)
 				// when database deletion failed, don't requeue request. to prevent exceeding api limit (ex: against google api)
@@ -149,6 +167,14 @@ func (r *DatabaseReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 		return reconcileResult, nil
 	}
 
+	// credentials held back while the copied content was masked are published once it's released
+	if !isMaskingPending(dbcr) {
+		if err := r.publishDatabaseSecret(ctx, dbcr); err != nil {
+			logrus.Errorf("could not publish database secret - %s", err)
+			return r.manageError(ctx, dbcr, err, true)
+		}
+	}
+
 	databaseSecret, err := r.getDatabaseSecret(ctx, dbcr)
 	if err != nil && !k8serrors.IsNotFound(err) {
 		logrus.Errorf("could not get database secret - %s", err)
@@ -194,6 +220,10 @@ func (r *DatabaseReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 
 		defer promDBsPhaseTime.WithLabelValues(phase).Observe(kci.TimeTrack(time.Now()))
 		err := r.createDatabase(ctx, dbcr, ownership)
+		if errors.Is(err, database.ErrRequestInProgress) {
+			logrus.Infof("DB: namespace=%s, name=%s waiting for executor job", dbcr.Namespace, dbcr.Name)
+			return reconcile.Result{RequeueAfter: executorRequeueInterval}, nil
+		}
 		if err != nil {
 			// when database creation failed, don't requeue request. to prevent exceeding api limit (ex: against google api)
 			return r.manageError(ctx, dbcr, err, false)
@@ -209,6 +239,21 @@ func (r *DatabaseReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 		if err != nil {
 			return r.manageError(ctx, dbcr, err, true)
 		}
+		dbcr.Status.Phase = dbPhaseClone
+		err = r.cloneDatabase(ctx, dbcr, ownership)
+		if err != nil {
+			if errors.Is(err, errCloneInProgress) {
+				logrus.Infof("DB: namespace=%s, name=%s waiting for clone job to finish", dbcr.Namespace, dbcr.Name)
+				return reconcile.Result{RequeueAfter: 10 * time.Second}, nil
+			}
+			return r.manageError(ctx, dbcr, err, true)
+		}
+		if isMaskingPending(dbcr) {
+			// apps must not get the credentials before the copied content is anonymized
+			dbcr.Status.Phase = dbPhaseMaskingPending
+			logrus.Infof("DB: namespace=%s, name=%s waiting for masking rules to be applied", dbcr.Namespace, dbcr.Name)
+			return reconcile.Result{RequeueAfter: 10 * time.Second}, nil
+		}
 		dbcr.Status.Phase = dbPhaseSecretsTemplating
 		if err = r.createTemplatedSecrets(ctx, dbcr, ownership); err != nil {
 			return r.manageError(ctx, dbcr, err, true)
@@ -242,14 +287,18 @@ func (r *DatabaseReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 func (r *DatabaseReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	eventFilter := predicate.Funcs{
 		CreateFunc: func(e event.CreateEvent) bool {
-			return isWatchedNamespace(r.WatchNamespaces, e.Object) && isDatabase(e.Object)
+			return isDatabase(e.Object) && isWatchedNamespace(r.WatchNamespaces, e.Object)
 		}, // Reconcile only Database Create Event
 		DeleteFunc: func(e event.DeleteEvent) bool {
-			return isWatchedNamespace(r.WatchNamespaces, e.Object) && isDatabase(e.Object)
+			return isDatabase(e.Object) && isWatchedNamespace(r.WatchNamespaces, e.Object)
 		}, // Reconcile only Database Delete Event
 		UpdateFunc: func(e event.UpdateEvent) bool {
+			// executor jobs run in the namespace of the instance executor
+			if _, isJob := e.ObjectNew.(*batchv1.Job); isJob {
+				return isExecutorJob(e.ObjectNew)
+			}
 			return isWatchedNamespace(r.WatchNamespaces, e.ObjectNew) && isObjectUpdated(e)
-		}, // Reconcile Database and Secret Update Events
+		}, // Reconcile Database, Secret and executor Job Update Events
 		GenericFunc: func(e event.GenericEvent) bool { return true }, // Reconcile any Generic Events (operator POD or cluster restarted)
 	}
 
@@ -257,12 +306,18 @@ func (r *DatabaseReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		For(&kciv1beta1.Database{}).
 		WithEventFilter(eventFilter).
 		Watches(&source.Kind{Type: &corev1.Secret{}}, &secretEventHandler{r.Client}).
+		Watches(&source.Kind{Type: &batchv1.Job{}}, handler.EnqueueRequestsFromMapFunc(requestsForExecutorJob("Database"))).
 		Complete(r)
 }
 
 func (r *DatabaseReconciler) initialize(ctx context.Context, dbcr *kciv1beta1.Database) error {
+	// content of the data source must be copied only once, started backend operations must be continued
+	clonedFrom := dbcr.Status.ClonedFrom
+	operation := dbcr.Status.Operation
 	dbcr.Status = kciv1beta1.DatabaseStatus{}
 	dbcr.Status.Status = false
+	dbcr.Status.ClonedFrom = clonedFrom
+	dbcr.Status.Operation = operation
 
 	if dbcr.Spec.Instance != "" {
 		instance := &kciv1beta1.DbInstance{}
@@ -288,15 +343,26 @@ func (r *DatabaseReconciler) initialize(ctx context.Context, dbcr *kciv1beta1.Da
 
 // createDatabase secret, actual database using admin secret
 func (r *DatabaseReconciler) createDatabase(ctx context.Context, dbcr *kciv1beta1.Database, ownership []metav1.OwnerReference) error {
+	adopted := false
 	databaseSecret, err := r.getDatabaseSecret(ctx, dbcr)
 	if err != nil {
 		if k8serrors.IsNotFound(err) {
-			secretData, err := generateDatabaseSecretData(dbcr)
-			if err != nil {
-				logrus.Errorf("can not generate credentials for database - %s", err)
-				return err
+			var secretData map[string][]byte
+			if dbcr.Spec.Adopt != nil {
+				secretData, err = r.adoptDatabase(ctx, dbcr)
+				if err != nil {
+					logrus.Errorf("can not adopt database - %s", err)
+					return err
+				}
+				adopted = true
+			} else {
+				secretData, err = generateDatabaseSecretData(dbcr, r.Conf.Naming)
+				if err != nil {
+					logrus.Errorf("can not generate credentials for database - %s", err)
+					return err
+				}
 			}
-			newDatabaseSecret := kci.SecretBuilder(dbcr.Spec.SecretName, dbcr.Namespace, secretData, ownership)
+			newDatabaseSecret := kci.SecretBuilder(databaseSecretName(dbcr), dbcr.Namespace, secretData, ownership)
 			err = r.Create(ctx, newDatabaseSecret)
 			if err != nil {
 				// failed to create secret
@@ -314,12 +380,25 @@ func (r *DatabaseReconciler) createDatabase(ctx context.Context, dbcr *kciv1beta
 		return err
 	}
 
-	db, err := determinDatabaseType(dbcr, databaseCred)
+	db, err := connectableDatabase(ctx, r, dbcr, databaseCred)
 	if err != nil {
 		// failed to determine database type
 		return err
 	}
 
+	var inPlaceSource *kciv1beta1.Database
+	if dbcr.Spec.DataSource != nil && dbcr.Status.ClonedFrom == "" {
+		source, err := r.getDataSource(ctx, dbcr)
+		if err != nil {
+			logrus.Errorf("DB: namespace=%s, name=%s can not use data source - %s", dbcr.Namespace, dbcr.Name, err)
+			return err
+		}
+		if isInPlaceClone(dbcr, source) {
+			db = withTemplate(db, source)
+			inPlaceSource = source
+		}
+	}
+
 	adminSecretResource, err := r.getAdminSecret(ctx, dbcr)
 	if err != nil {
 		if k8serrors.IsNotFound(err) {
@@ -335,11 +414,31 @@ func (r *DatabaseReconciler) createDatabase(ctx context.Context, dbcr *kciv1beta
 		// failed to parse database admin secret
 		return err
 	}
+	adminCred, err = instanceAdminCredentials(dbcr.Status.InstanceRef, adminCred)
+	if err != nil {
+		return err
+	}
 
-	err = database.Create(db, adminCred)
+	req, err := database.NewRequest(database.OpCreate, db, adminCred)
 	if err != nil {
 		return err
 	}
+	req.Owner = r.databaseOwner(dbcr)
+	// the existing database and user of an adoption are verified, they must not be altered,
+	// neither when the secret is created nor on any later reconcile
+	req.Adopt = dbcr.Spec.Adopt != nil
+	err = r.executeOwnedRequest(ctx, dbcr, req).Err()
+	if errors.Is(err, database.ErrRequestInProgress) {
+		return err
+	}
+	if err != nil {
+		setOwnershipCondition(dbcr, err)
+		return err
+	}
+	if adopted {
+		logrus.Infof("DB: namespace=%s, name=%s adopted database %s", dbcr.Namespace, dbcr.Name, databaseCred.Name)
+	}
+	setOwnershipCondition(dbcr, nil)
 
 	kci.AddFinalizer(&dbcr.ObjectMeta, "db."+dbcr.Name)
 	err = r.Update(ctx, dbcr)
@@ -356,10 +455,292 @@ func (r *DatabaseReconciler) createDatabase(ctx context.Context, dbcr *kciv1beta
 
 	dbcr.Status.DatabaseName = databaseCred.Name
 	dbcr.Status.UserName = databaseCred.Username
+	if inPlaceSource != nil {
+		dbcr.Status.ClonedFrom = inPlaceSource.Namespace + "/" + inPlaceSource.Name
+	}
 	logrus.Infof("DB: namespace=%s, name=%s successfully created", dbcr.Namespace, dbcr.Name)
 	return nil
 }
 
+// adoptDatabase verifies that the database and user defined in spec.adopt exist and can be accessed
+// with the given password, and returns the data of the database secret
+func (r *DatabaseReconciler) adoptDatabase(ctx context.Context, dbcr *kciv1beta1.Database) (map[string][]byte, error) {
+	passwordRef := dbcr.Spec.Adopt.PasswordSecretRef
+	passwordSecret := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: dbcr.Namespace, Name: passwordRef.Name}, passwordSecret)
+	if err != nil {
+		return nil, err
+	}
+	password, ok := passwordSecret.Data[passwordRef.Key]
+	if !ok {
+		return nil, fmt.Errorf("%s key does not exist in secret %s", passwordRef.Key, passwordRef.Name)
+	}
+
+	secretData, err := adoptedDatabaseSecretData(dbcr, string(password))
+	if err != nil {
+		return nil, err
+	}
+	databaseCred, err := parseDatabaseSecretData(dbcr, secretData)
+	if err != nil {
+		return nil, err
+	}
+	db, err := connectableDatabase(ctx, r, dbcr, databaseCred)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := database.NewRequest(database.OpCheckStatus, db, database.AdminCredentials{})
+	if err != nil {
+		return nil, err
+	}
+	err = executeForDatabase(ctx, r.Client, r.Conf, dbcr, req).Err()
+	if err != nil {
+		return nil, fmt.Errorf("existing database %s can not be verified - %w", databaseCred.Name, err)
+	}
+	return secretData, nil
+}
+
+// getDataSource returns the Database referenced in spec.dataSource
+// if it can be used as data source for dbcr
+func (r *DatabaseReconciler) getDataSource(ctx context.Context, dbcr *kciv1beta1.Database) (*kciv1beta1.Database, error) {
+	key, err := dbcr.DataSourceKey()
+	if err != nil {
+		return nil, err
+	}
+
+	if key.Namespace != dbcr.Namespace {
+		grants := &kciv1beta1.DbCloneGrantList{}
+		err := r.List(ctx, grants, client.InNamespace(key.Namespace))
+		if err != nil {
+			return nil, err
+		}
+		if !isCloneGranted(grants.Items, dbcr.Namespace, key.Name) {
+			return nil, fmt.Errorf("no DbCloneGrant in namespace %s allows cloning %s into namespace %s", key.Namespace, key.Name, dbcr.Namespace)
+		}
+	}
+
+	source := &kciv1beta1.Database{}
+	err = r.Get(ctx, key.ToKubernetesType(), source)
+	if err != nil {
+		return nil, err
+	}
+
+	if !source.Status.Status {
+		return nil, fmt.Errorf("data source %s/%s is not ready", source.Namespace, source.Name)
+	}
+
+	sourceEngine, err := source.GetEngineType()
+	if err != nil {
+		return nil, err
+	}
+	engine, err := dbcr.GetEngineType()
+	if err != nil {
+		return nil, err
+	}
+	if sourceEngine != engine {
+		return nil, fmt.Errorf("data source engine %s doesn't match %s", sourceEngine, engine)
+	}
+
+	return source, nil
+}
+
+// cloneDatabase copies the content of the data source with a dump/restore job
+// if it couldn't be cloned in place during the database creation
+func (r *DatabaseReconciler) cloneDatabase(ctx context.Context, dbcr *kciv1beta1.Database, ownership []metav1.OwnerReference) error {
+	if dbcr.Spec.DataSource == nil || dbcr.Status.ClonedFrom != "" {
+		// nothing to clone or already cloned, skip
+		return nil
+	}
+
+	source, err := r.getDataSource(ctx, dbcr)
+	if err != nil {
+		return err
+	}
+
+	job := &batchv1.Job{}
+	err = r.Get(ctx, types.NamespacedName{Namespace: dbcr.Namespace, Name: clone.JobName(dbcr)}, job)
+	if err != nil {
+		if !k8serrors.IsNotFound(err) {
+			return err
+		}
+
+		secret, err := r.cloneSourceSecret(ctx, dbcr, source, ownership)
+		if err != nil {
+			return err
+		}
+		// the job reads the data source with a temporary user instead of the credentials of its owner
+		err = r.executeCloneReader(ctx, dbcr, source, database.OpCreateReader, clone.ReaderCredentials(secret))
+		if errors.Is(err, database.ErrRequestInProgress) {
+			return errCloneInProgress
+		}
+		if err != nil {
+			logrus.Errorf("DB: namespace=%s, name=%s failed creating clone reader", dbcr.Namespace, dbcr.Name)
+			return err
+		}
+
+		job, err = clone.DumpRestoreJob(r.Conf, dbcr, source, databaseSecretName(dbcr), ownership)
+		if err != nil {
+			return err
+		}
+		err = r.Create(ctx, job)
+		if err != nil {
+			logrus.Errorf("DB: namespace=%s, name=%s failed creating clone job", dbcr.Namespace, dbcr.Name)
+			return err
+		}
+		logrus.Infof("DB: namespace=%s, name=%s clone job created", dbcr.Namespace, dbcr.Name)
+		return errCloneInProgress
+	}
+
+	finished, failed := kci.IsJobFinished(job)
+	if !finished {
+		return errCloneInProgress
+	}
+	// the reader isn't needed anymore, a retry creates a new one
+	err = r.removeCloneReader(ctx, dbcr, source)
+	if errors.Is(err, database.ErrRequestInProgress) {
+		return errCloneInProgress
+	}
+	if err != nil {
+		return err
+	}
+	if failed {
+		return fmt.Errorf("clone job %s failed, delete it to retry", job.Name)
+	}
+
+	dbcr.Status.ClonedFrom = source.Namespace + "/" + source.Name
+	logrus.Infof("DB: namespace=%s, name=%s cloned from %s", dbcr.Namespace, dbcr.Name, dbcr.Status.ClonedFrom)
+	return nil
+}
+
+// cloneSourceSecret returns the secret with the credentials of the clone reader,
+// the password is generated once so that repeated requests stay the same
+func (r *DatabaseReconciler) cloneSourceSecret(ctx context.Context, dbcr, source *kciv1beta1.Database, ownership []metav1.OwnerReference) (*corev1.Secret, error) {
+	secret := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: dbcr.Namespace, Name: clone.SourceSecretName(dbcr)}, secret)
+	if err == nil && clone.ReaderCredentials(secret).Username == clone.ReaderName(dbcr) {
+		return secret, nil
+	}
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return nil, err
+	}
+
+	exists := err == nil
+	resourceVersion := secret.ResourceVersion
+	secret = clone.SourceSecret(dbcr, source.Status.DatabaseName, clone.ReaderName(dbcr), kci.GeneratePass(), ownership)
+	if exists {
+		// secrets of older versions contain the credentials of the data source owner
+		secret.ResourceVersion = resourceVersion
+		err = r.Update(ctx, secret)
+	} else {
+		err = r.Create(ctx, secret)
+	}
+	if err != nil {
+		logrus.Errorf("DB: namespace=%s, name=%s failed writing clone source secret", dbcr.Namespace, dbcr.Name)
+		return nil, err
+	}
+	return secret, nil
+}
+
+// removeCloneReader deletes the clone reader and its secret if they exist,
+// only the secret is deleted if the data source is gone
+func (r *DatabaseReconciler) removeCloneReader(ctx context.Context, dbcr, source *kciv1beta1.Database) error {
+	secret := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: dbcr.Namespace, Name: clone.SourceSecretName(dbcr)}, secret)
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	reader := clone.ReaderCredentials(secret)
+	if reader.Username != clone.ReaderName(dbcr) {
+		// secrets of older versions contain the credentials of the data source owner, they must not be deleted
+		logrus.Infof("DB: namespace=%s, name=%s clone source secret doesn't belong to a reader", dbcr.Namespace, dbcr.Name)
+	} else if source != nil {
+		err = r.executeCloneReader(ctx, dbcr, source, database.OpDeleteReader, reader)
+		if err != nil {
+			if !errors.Is(err, database.ErrRequestInProgress) {
+				logrus.Errorf("DB: namespace=%s, name=%s failed deleting clone reader - %s", dbcr.Namespace, dbcr.Name, err)
+			}
+			return err
+		}
+	} else {
+		logrus.Warnf("DB: namespace=%s, name=%s data source is gone, clone reader %s can't be deleted", dbcr.Namespace, dbcr.Name, clone.ReaderName(dbcr))
+	}
+
+	err = r.Delete(ctx, secret)
+	if err != nil && !k8serrors.IsNotFound(err) {
+		logrus.Errorf("DB: namespace=%s, name=%s failed deleting clone source secret - %s", dbcr.Namespace, dbcr.Name, err)
+		return err
+	}
+	return nil
+}
+
+// cleanupClone removes the clone reader of a database which is deleted while it's cloned
+func (r *DatabaseReconciler) cleanupClone(ctx context.Context, dbcr *kciv1beta1.Database) error {
+	if dbcr.Spec.DataSource == nil || dbcr.Status.ClonedFrom != "" {
+		return nil
+	}
+	key, err := dbcr.DataSourceKey()
+	if err != nil {
+		return err
+	}
+
+	var source *kciv1beta1.Database
+	found := &kciv1beta1.Database{}
+	err = r.Get(ctx, key.ToKubernetesType(), found)
+	if err == nil {
+		source = found
+	} else if !k8serrors.IsNotFound(err) {
+		return err
+	}
+	return r.removeCloneReader(ctx, dbcr, source)
+}
+
+// executeCloneReader runs the reader operation on the server of the data source,
+// the executor job belongs to dbcr which is reconciled when it's finished
+func (r *DatabaseReconciler) executeCloneReader(ctx context.Context, dbcr, source *kciv1beta1.Database, operation string, reader database.ReaderCredentials) error {
+	sourceSecret := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: source.Namespace, Name: source.Spec.SecretName}, sourceSecret)
+	if err != nil {
+		logrus.Errorf("DB: namespace=%s, name=%s can not get data source secret", dbcr.Namespace, dbcr.Name)
+		return err
+	}
+	sourceCred, err := parseDatabaseSecretData(source, sourceSecret.Data)
+	if err != nil {
+		return err
+	}
+	db, err := connectableDatabase(ctx, r, source, sourceCred)
+	if err != nil {
+		return err
+	}
+
+	adminSecret, err := r.getAdminSecret(ctx, source)
+	if err != nil {
+		return err
+	}
+	adminCred, err := db.ParseAdminCredentials(adminSecret.Data)
+	if err != nil {
+		return err
+	}
+	instance, err := source.GetInstanceRef()
+	if err != nil {
+		return err
+	}
+	adminCred, err = instanceAdminCredentials(instance, adminCred)
+	if err != nil {
+		return err
+	}
+
+	req, err := database.NewRequest(operation, db, adminCred)
+	if err != nil {
+		return err
+	}
+	req.Reader = reader
+	return newExecutor(ctx, r.Client, r.Conf, instance, dbcr).Execute(req).Err()
+}
+
 func (r *DatabaseReconciler) deleteDatabase(ctx context.Context, dbcr *kciv1beta1.Database) error {
 	if dbcr.Spec.DeletionProtected {
 		logrus.Infof("DB: namespace=%s, name=%s is deletion protected. will not be deleted in backends", dbcr.Name, dbcr.Namespace)
@@ -371,7 +752,7 @@ func (r *DatabaseReconciler) deleteDatabase(ctx context.Context, dbcr *kciv1beta
 		Username: dbcr.Status.UserName,
 	}
 
-	db, err := determinDatabaseType(dbcr, databaseCred)
+	db, err := connectableDatabase(ctx, r, dbcr, databaseCred)
 	if err != nil {
 		// failed to determine database type
 		return err
@@ -388,47 +769,75 @@ func (r *DatabaseReconciler) deleteDatabase(ctx context.Context, dbcr *kciv1beta
 		// failed to parse database admin secret
 		return err
 	}
+	adminCred, err = instanceAdminCredentials(dbcr.Status.InstanceRef, adminCred)
+	if err != nil {
+		return err
+	}
 
-	err = database.Delete(db, adminCred)
+	req, err := database.NewRequest(database.OpDelete, db, adminCred)
 	if err != nil {
 		return err
 	}
+	req.Owner = r.databaseOwner(dbcr)
+	err = r.executeOwnedRequest(ctx, dbcr, req).Err()
+	if err != nil {
+		var conflict *database.OwnershipConflictError
+		if errors.As(err, &conflict) {
+			// objects of someone else are never dropped, the resource can go away nevertheless
+			logrus.Errorf("DB: namespace=%s, name=%s will not be deleted in backends - %s", dbcr.Namespace, dbcr.Name, err)
+			r.Recorder.Event(dbcr, "Warning", kciv1beta1.DatabaseConditionOwnershipConflict, err.Error())
+			return nil
+		}
+		return err
+	}
 
 	return nil
 }
 
+// executeOwnedRequest runs a request changing the database and the user of dbcr, they are owned by dbcr once it has the finalizer.
+// The operation the backend api started is kept in the status and continued by the next attempt of the same request.
+func (r *DatabaseReconciler) executeOwnedRequest(ctx context.Context, dbcr *kciv1beta1.Database, req database.Request) database.Result {
+	req.Owned = containsString(dbcr.ObjectMeta.Finalizers, "db."+dbcr.Name)
+	if strings.HasPrefix(dbcr.Status.Operation, req.Operation+":") {
+		req.BackendOperation = strings.TrimPrefix(dbcr.Status.Operation, req.Operation+":")
+	}
+
+	result := executeForDatabase(ctx, r.Client, r.Conf, dbcr, req)
+	dbcr.Status.Operation = ""
+	if result.BackendOperation != "" {
+		dbcr.Status.Operation = req.Operation + ":" + result.BackendOperation
+	}
+	return result
+}
+
+// databaseOwner returns the owner marker of the objects managed by the Database resource
+func (r *DatabaseReconciler) databaseOwner(dbcr *kciv1beta1.Database) database.Owner {
+	return database.Owner{
+		ClusterID: r.Conf.ClusterID,
+		Namespace: dbcr.Namespace,
+		Name:      dbcr.Name,
+		UID:       string(dbcr.GetUID()),
+	}
+}
+
 func (r *DatabaseReconciler) createInstanceAccessSecret(ctx context.Context, dbcr *kciv1beta1.Database, ownership []metav1.OwnerReference) error {
 	if backend, _ := dbcr.GetBackendType(); backend != "google" {
 		logrus.Debugf("DB: namespace=%s, name=%s %s doesn't need instance access secret skipping...", dbcr.Namespace, dbcr.Name, backend)
 		return nil
 	}
 
-	var data []byte
-
 	instance, err := dbcr.GetInstanceRef()
 	if err != nil {
 		return err
 	}
 
-	credFile := "credentials.json"
-
-	if instance.Spec.Google.ClientSecret.Name != "" {
-		key := instance.Spec.Google.ClientSecret.ToKubernetesType()
-		secret := &corev1.Secret{}
-		err := r.Get(ctx, key, secret)
-		if err != nil {
-			logrus.Errorf("DB: namespace=%s, name=%s can not get instance access secret", dbcr.Namespace, dbcr.Name)
-			return err
-		}
-		data = secret.Data[credFile]
-	} else {
-		data, err = os.ReadFile(os.Getenv("GCSQL_CLIENT_CREDENTIALS"))
-		if err != nil {
-			return err
-		}
+	data, err := instanceAccessCredentials(ctx, r.Client, instance)
+	if err != nil {
+		logrus.Errorf("DB: namespace=%s, name=%s can not get instance access credentials", dbcr.Namespace, dbcr.Name)
+		return err
 	}
 	secretData := make(map[string][]byte)
-	secretData[credFile] = data
+	secretData[instanceAccessCredentialsKey] = data
 
 	newName := dbcr.InstanceAccessSecretName()
 	newSecret := kci.SecretBuilder(newName, dbcr.GetNamespace(), secretData, ownership)
@@ -452,14 +861,18 @@ func (r *DatabaseReconciler) createInstanceAccessSecret(ctx context.Context, dbc
 }
 
 func (r *DatabaseReconciler) createProxy(ctx context.Context, dbcr *kciv1beta1.Database, ownership []metav1.OwnerReference) error {
-	backend, _ := dbcr.GetBackendType()
-	if backend == "generic" {
-		logrus.Infof("DB: namespace=%s, name=%s %s proxy creation is not yet implemented skipping...", dbcr.Namespace, dbcr.Name, backend)
-		return nil
-	}
-
 	proxyInterface, err := determineProxyTypeForDB(r.Conf, dbcr)
 	if err != nil {
+		if err == ErrNoProxySupport {
+			// databases on generic instances are accessed directly unless a pooler is requested
+			logrus.Infof("DB: namespace=%s, name=%s no proxy required, skipping...", dbcr.Namespace, dbcr.Name)
+			dbcr.Status.ProxyStatus = kciv1beta1.DatabaseProxyStatus{}
+			return nil
+		}
+		return err
+	}
+
+	if err := r.createTunnelSecret(ctx, dbcr, ownership); err != nil {
 		return err
 	}
 
@@ -546,19 +959,21 @@ func (r *DatabaseReconciler) createProxy(ctx context.Context, dbcr *kciv1beta1.D
 		if err != nil {
 			return err
 		}
-		err = r.Create(ctx, promSvcMon)
-		if err != nil {
-			if k8serrors.IsAlreadyExists(err) {
-				patch := client.MergeFrom(promSvcMon)
-				err := r.Patch(ctx, promSvcMon, patch)
-				if err != nil {
-					logrus.Errorf("DB: namespace=%s, name=%s failed patching prometheus service monitor", dbcr.Namespace, dbcr.Name)
+		if promSvcMon != nil { // if proxy exposes metrics
+			err = r.Create(ctx, promSvcMon)
+			if err != nil {
+				if k8serrors.IsAlreadyExists(err) {
+					patch := client.MergeFrom(promSvcMon)
+					err := r.Patch(ctx, promSvcMon, patch)
+					if err != nil {
+						logrus.Errorf("DB: namespace=%s, name=%s failed patching prometheus service monitor", dbcr.Namespace, dbcr.Name)
+						return err
+					}
+				} else {
+					// failed to create service
+					logrus.Errorf("DB: namespace=%s, name=%s failed creating prometehus service monitor", dbcr.Namespace, dbcr.Name)
 					return err
 				}
-			} else {
-				// failed to create service
-				logrus.Errorf("DB: namespace=%s, name=%s failed creating prometehus service monitor", dbcr.Namespace, dbcr.Name)
-				return err
 			}
 		}
 	}
@@ -588,7 +1003,16 @@ func (r *DatabaseReconciler) createTemplatedSecrets(ctx context.Context, dbcr *k
 		return err
 	}
 
-	dbSecrets, err := generateTemplatedSecrets(dbcr, databaseCred)
+	instance, err := dbcr.GetInstanceRef()
+	if err != nil {
+		return err
+	}
+	certs, err := backend.SSLCerts(ctx, r.Client, instance)
+	if err != nil {
+		return err
+	}
+
+	dbSecrets, err := generateTemplatedSecrets(dbcr, databaseCred, certs)
 	if err != nil {
 		return err
 	}
@@ -646,6 +1070,10 @@ func (r *DatabaseReconciler) createBackupJob(ctx context.Context, dbcr *kciv1bet
 		return nil
 	}
 
+	if err := r.createTunnelSecret(ctx, dbcr, ownership); err != nil {
+		return err
+	}
+
 	cronjob, err := backup.GCSBackupCron(r.Conf, dbcr, ownership)
 	if err != nil {
 		return err
@@ -675,11 +1103,48 @@ func (r *DatabaseReconciler) createBackupJob(ctx context.Context, dbcr *kciv1bet
 	return nil
 }
 
+// createTunnelSecret copies the ssh key of the instance next to the backup cronjob and the pooler
+// if the instance is reached through an ssh tunnel
+func (r *DatabaseReconciler) createTunnelSecret(ctx context.Context, dbcr *kciv1beta1.Database, ownership []metav1.OwnerReference) error {
+	instance, err := dbcr.GetInstanceRef()
+	if err != nil {
+		return err
+	}
+	tunnel := instance.GetSSHTunnel()
+	if tunnel == nil {
+		return nil
+	}
+
+	keySecret := &corev1.Secret{}
+	err = r.Get(ctx, tunnel.PrivateKeySecret.ToKubernetesType(), keySecret)
+	if err != nil {
+		logrus.Errorf("DB: namespace=%s, name=%s failed getting ssh tunnel secret %s/%s", dbcr.Namespace, dbcr.Name, tunnel.PrivateKeySecret.Namespace, tunnel.PrivateKeySecret.Name)
+		return err
+	}
+
+	secret := sshtunnel.Secret(sshtunnel.SecretName(dbcr.Name), dbcr.Namespace, keySecret, ownership)
+	err = r.Create(ctx, secret)
+	if err != nil {
+		if k8serrors.IsAlreadyExists(err) {
+			err = r.Update(ctx, secret)
+			if err != nil {
+				logrus.Errorf("DB: namespace=%s, name=%s failed updating ssh tunnel secret", dbcr.Namespace, dbcr.Name)
+				return err
+			}
+		} else {
+			logrus.Errorf("DB: namespace=%s, name=%s failed creating ssh tunnel secret", dbcr.Namespace, dbcr.Name)
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (r *DatabaseReconciler) getDatabaseSecret(ctx context.Context, dbcr *kciv1beta1.Database) (*corev1.Secret, error) {
 	secret := &corev1.Secret{}
 	key := types.NamespacedName{
 		Namespace: dbcr.Namespace,
-		Name:      dbcr.Spec.SecretName,
+		Name:      databaseSecretName(dbcr),
 	}
 	err := r.Get(ctx, key, secret)
 	if err != nil {
@@ -689,6 +1154,29 @@ func (r *DatabaseReconciler) getDatabaseSecret(ctx context.Context, dbcr *kciv1b
 	return secret, nil
 }
 
+// publishDatabaseSecret moves the credentials held back during masking into the secret of the spec
+func (r *DatabaseReconciler) publishDatabaseSecret(ctx context.Context, dbcr *kciv1beta1.Database) error {
+	held := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: dbcr.Namespace, Name: heldSecretName(dbcr)}, held)
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	secret := kci.SecretBuilder(dbcr.Spec.SecretName, dbcr.Namespace, held.Data, held.OwnerReferences)
+	secret.Annotations = held.Annotations
+	if err := r.Create(ctx, secret); err != nil && !k8serrors.IsAlreadyExists(err) {
+		return err
+	}
+	if err := r.Delete(ctx, held); err != nil && !k8serrors.IsNotFound(err) {
+		return err
+	}
+	logrus.Infof("DB: namespace=%s, name=%s masked content released, credentials published in %s", dbcr.Namespace, dbcr.Name, dbcr.Spec.SecretName)
+	return nil
+}
+
 func (r *DatabaseReconciler) annotateDatabaseSecret(ctx context.Context, dbcr *kciv1beta1.Database, secret *corev1.Secret) error {
 	annotations := secret.ObjectMeta.GetAnnotations()
 	if len(annotations) == 0 {
@@ -0,0 +1,107 @@
+/*
+ * Copyright 2021 kloeckner.i GmbH
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"bou.ke/monkey"
+	kciv1beta1 "github.com/kloeckner-i/db-operator/api/v1beta1"
+	"github.com/kloeckner-i/db-operator/pkg/config"
+	"github.com/kloeckner-i/db-operator/pkg/utils/database"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestCreateDatabaseAdoptedOnEveryReconcile(t *testing.T) {
+	ctx := context.Background()
+	dbin := newPostgresTestDbInstanceCr()
+	dbin.Spec.AdminUserSecret = kciv1beta1.NamespacedName{Namespace: "operator", Name: "admin"}
+	dbcr := newPostgresTestDbCr(dbin)
+	dbcr.Name = "legacy"
+	dbcr.Spec.Adopt = &kciv1beta1.DatabaseAdoption{
+		DatabaseName:      "legacy_db",
+		UserName:          "legacy_user",
+		PasswordSecretRef: corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "legacy-password"}, Key: "password"},
+	}
+	objects := []client.Object{
+		dbcr,
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "operator", Name: "admin"}, Data: map[string][]byte{"password": []byte("admin")}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: dbcr.Namespace, Name: "legacy-password"}, Data: map[string][]byte{"password": []byte("secret")}},
+	}
+	scheme := runtime.NewScheme()
+	assert.NoError(t, clientgoscheme.AddToScheme(scheme))
+	assert.NoError(t, kciv1beta1.AddToScheme(scheme))
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build()
+	r := &DatabaseReconciler{Client: c, Conf: &config.Config{}}
+
+	// the first create request waits for the executor, the second one finishes it
+	creates := []database.Request{}
+	patch := monkey.Patch(executeForDatabase, func(_ context.Context, _ client.Client, _ *config.Config, _ *kciv1beta1.Database, req database.Request) database.Result {
+		if req.Operation != database.OpCreate {
+			return database.Result{}
+		}
+		creates = append(creates, req)
+		return database.Result{Pending: len(creates) == 1}
+	})
+	defer patch.Unpatch()
+
+	assert.ErrorIs(t, r.createDatabase(ctx, dbcr, nil), database.ErrRequestInProgress)
+	assert.NoError(t, r.createDatabase(ctx, dbcr, nil))
+	assert.Len(t, creates, 2)
+	for _, req := range creates {
+		assert.True(t, req.Adopt, "the adopted database isn't altered once its secret exists")
+	}
+	assert.Equal(t, "legacy_user", dbcr.Status.UserName)
+}
+
+func TestPublishDatabaseSecret(t *testing.T) {
+	ctx := context.Background()
+	dbcr := newPostgresTestDbCr(newPostgresTestDbInstanceCr())
+	dbcr.Name = "masked"
+	dbcr.Annotations = map[string]string{maskingPendingAnnotation: "true"}
+	assert.Equal(t, "masked-masking-credentials", databaseSecretName(dbcr), "credentials are held back while masking is pending")
+
+	held := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: dbcr.Namespace, Name: databaseSecretName(dbcr), Annotations: map[string]string{"checksum/secret": "1234"}},
+		Data:       map[string][]byte{"POSTGRES_PASSWORD": []byte("secret")},
+	}
+	scheme := runtime.NewScheme()
+	assert.NoError(t, clientgoscheme.AddToScheme(scheme))
+	assert.NoError(t, kciv1beta1.AddToScheme(scheme))
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(held).Build()
+	r := &DatabaseReconciler{Client: c, Conf: &config.Config{}}
+
+	delete(dbcr.Annotations, maskingPendingAnnotation)
+	assert.Equal(t, TestSecretName, databaseSecretName(dbcr))
+	assert.NoError(t, r.publishDatabaseSecret(ctx, dbcr))
+	secret, err := r.getDatabaseSecret(ctx, dbcr)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("secret"), secret.Data["POSTGRES_PASSWORD"])
+	assert.Equal(t, "1234", secret.Annotations["checksum/secret"])
+	assert.True(t, k8serrors.IsNotFound(c.Get(ctx, client.ObjectKeyFromObject(held), &corev1.Secret{})), "held secret is removed")
+
+	// nothing is held back anymore
+	assert.NoError(t, r.publishDatabaseSecret(ctx, dbcr))
+}
@@ -18,11 +18,15 @@ package controllers
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
+	kciv1beta1 "github.com/kloeckner-i/db-operator/api/v1beta1"
 	"github.com/kloeckner-i/db-operator/pkg/utils/database"
+	"github.com/kloeckner-i/db-operator/pkg/utils/naming"
 	"github.com/stretchr/testify/assert"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -137,7 +141,7 @@ func TestPsqlDefaultTemplatedSecretGeneratationWithProxy(t *testing.T) {
 		"CONNECTION_STRING": fmt.Sprintf("%s://%s:%s@%s:%d/%s", protocol, c.UserName, c.Password, c.DatabaseHost, c.DatabasePort, c.DatabaseName),
 	}
 
-	connString, err := generateTemplatedSecrets(postgresDbCr, testDbcred)
+	connString, err := generateTemplatedSecrets(postgresDbCr, testDbcred, nil)
 	if err != nil {
 		t.Logf("Unexpected error: %s", err)
 		t.Fail()
@@ -162,7 +166,7 @@ func TestPsqlDefaultTemplatedSecretGeneratationWithoutProxy(t *testing.T) {
 		"CONNECTION_STRING": fmt.Sprintf("%s://%s:%s@%s:%d/%s", protocol, c.UserName, c.Password, c.DatabaseHost, c.DatabasePort, c.DatabaseName),
 	}
 
-	connString, err := generateTemplatedSecrets(postgresDbCr, testDbcred)
+	connString, err := generateTemplatedSecrets(postgresDbCr, testDbcred, nil)
 	if err != nil {
 		t.Logf("Unexpected error: %s", err)
 		t.Fail()
@@ -170,6 +174,45 @@ func TestPsqlDefaultTemplatedSecretGeneratationWithoutProxy(t *testing.T) {
 	assert.Equal(t, expectedData, connString, "generated connections string is wrong")
 }
 
+func TestPsqlDefaultTemplatedSecretGeneratationWithReadReplica(t *testing.T) {
+	instance := newPostgresTestDbInstanceCr()
+	instance.Spec.ReadReplicas = []kciv1beta1.ReadReplica{
+		{Generic: &kciv1beta1.GenericReplica{Host: "postgres-ro", Port: 5433}},
+	}
+	postgresDbCr := newPostgresTestDbCr(instance)
+
+	c := SecretsTemplatesFields{
+		DatabaseHost: "postgres",
+		DatabasePort: 5432,
+		UserName:     testDbcred.Username,
+		Password:     testDbcred.Password,
+		DatabaseName: testDbcred.Name,
+	}
+
+	// without a healthy replica reads go to the primary
+	connString, err := generateTemplatedSecrets(postgresDbCr, testDbcred, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("postgresql://%s:%s@%s:%d/%s", c.UserName, c.Password, c.DatabaseHost, c.DatabasePort, c.DatabaseName), connString["CONNECTION_STRING_RO"])
+
+	postgresDbCr.Status.InstanceRef.Status.Info = map[string]string{
+		"DB_CONN":    "postgres",
+		"DB_PORT":    "5432",
+		"DB_RO_CONN": "postgres-ro",
+		"DB_RO_PORT": "5433",
+	}
+	connString, err = generateTemplatedSecrets(postgresDbCr, testDbcred, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("postgresql://%s:%s@%s:%d/%s", c.UserName, c.Password, c.DatabaseHost, c.DatabasePort, c.DatabaseName), connString["CONNECTION_STRING"])
+	assert.Equal(t, fmt.Sprintf("postgresql://%s:%s@postgres-ro:5433/%s", c.UserName, c.Password, c.DatabaseName), connString["CONNECTION_STRING_RO"])
+
+	postgresDbCr.Spec.SecretsTemplates = map[string]string{
+		"READ_HOST": "{{ .ReadOnlyHost }}:{{ .ReadOnlyPort }}",
+	}
+	connString, err = generateTemplatedSecrets(postgresDbCr, testDbcred, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"READ_HOST": "postgres-ro:5433"}, connString)
+}
+
 func TestMysqlDefaultTemlatedSecretGeneratationWithoutProxy(t *testing.T) {
 	mysqlDbCr := newMysqlTestDbCr()
 	c := SecretsTemplatesFields{
@@ -184,7 +227,7 @@ func TestMysqlDefaultTemlatedSecretGeneratationWithoutProxy(t *testing.T) {
 		"CONNECTION_STRING": fmt.Sprintf("%s://%s:%s@%s:%d/%s", protocol, c.UserName, c.Password, c.DatabaseHost, c.DatabasePort, c.DatabaseName),
 	}
 
-	connString, err := generateTemplatedSecrets(mysqlDbCr, testDbcred)
+	connString, err := generateTemplatedSecrets(mysqlDbCr, testDbcred, nil)
 	if err != nil {
 		t.Logf("Unexpected error: %s", err)
 		t.Fail()
@@ -235,7 +278,7 @@ func TestPsqlCustomSecretGeneratation(t *testing.T) {
 		"CHECK_2": fmt.Sprintf("%s://%s:%s@%s:%d/%s", protocol, c.UserName, c.Password, c.DatabaseHost, c.DatabasePort, c.DatabaseName),
 	}
 
-	connString, err := generateTemplatedSecrets(postgresDbCr, testDbcred)
+	connString, err := generateTemplatedSecrets(postgresDbCr, testDbcred, nil)
 	if err != nil {
 		t.Logf("unexpected error: %s", err)
 		t.Fail()
@@ -243,6 +286,28 @@ func TestPsqlCustomSecretGeneratation(t *testing.T) {
 	assert.Equal(t, connString, expectedData, "generated connections string is wrong")
 }
 
+func TestSSLTemplatedSecrets(t *testing.T) {
+	instance := newPostgresTestDbInstanceCr()
+	postgresDbCr := newPostgresTestDbCr(instance)
+	postgresDbCr.Spec.SecretsTemplates = map[string]string{
+		"JDBC_PARAMS": "sslmode=verify-ca&sslrootcert={{ if .SSLRootCert }}/etc/db/sslrootcert{{ end }}",
+	}
+
+	certs := &database.SSLCerts{RootCert: []byte("ca"), Cert: []byte("cert"), Key: []byte("key")}
+	secrets, err := generateTemplatedSecrets(postgresDbCr, testDbcred, certs)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"JDBC_PARAMS": "sslmode=verify-ca&sslrootcert=/etc/db/sslrootcert",
+		"sslrootcert": "ca",
+		"sslcert":     "cert",
+		"sslkey":      "key",
+	}, secrets)
+
+	secrets, err = generateTemplatedSecrets(postgresDbCr, testDbcred, &database.SSLCerts{RootCert: []byte("ca")})
+	assert.NoError(t, err)
+	assert.NotContains(t, secrets, "sslcert", "instance has no client certificate")
+}
+
 func TestWrongTemplatedSecretGeneratation(t *testing.T) {
 	instance := newPostgresTestDbInstanceCr()
 	postgresDbCr := newPostgresTestDbCr(instance)
@@ -251,7 +316,7 @@ func TestWrongTemplatedSecretGeneratation(t *testing.T) {
 		"TMPL": "{{ .Protocol }}://{{ .User }}:{{ .Password }}@{{ .DatabaseHost }}:{{ .DatabasePort }}/{{ .DatabaseName }}",
 	}
 
-	_, err := generateTemplatedSecrets(postgresDbCr, testDbcred)
+	_, err := generateTemplatedSecrets(postgresDbCr, testDbcred, nil)
 	errSubstr := "can't evaluate field User in type controllers.SecretsTemplatesFields"
 
 	assert.Contains(t, err.Error(), errSubstr, "the error doesn't contain expected substring")
@@ -271,7 +336,7 @@ func TestBlockedTempatedKeysGeneratation(t *testing.T) {
 		"TMPL": []byte("DUMMY"),
 	}
 
-	sercretData, err := generateTemplatedSecrets(postgresDbCr, testDbcred)
+	sercretData, err := generateTemplatedSecrets(postgresDbCr, testDbcred, nil)
 	if err != nil {
 		t.Logf("unexpected error: %s", err)
 		t.Fail()
@@ -299,7 +364,7 @@ func TestObsoleteFieldsRemoving(t *testing.T) {
 		"TMPL": []byte("DUMMY"),
 	}
 
-	sercretData, err := generateTemplatedSecrets(postgresDbCr, testDbcred)
+	sercretData, err := generateTemplatedSecrets(postgresDbCr, testDbcred, nil)
 	if err != nil {
 		t.Logf("unexpected error: %s", err)
 		t.Fail()
@@ -316,3 +381,167 @@ func TestObsoleteFieldsRemoving(t *testing.T) {
 
 	assert.Equal(t, newSecret.Data, expectedData, "generated connections string is wrong")
 }
+
+func TestInPlaceClone(t *testing.T) {
+	postgresDbCr := newPostgresTestDbCr(newPostgresTestDbInstanceCr())
+	postgresDbCr.Spec.Instance = "postgres"
+	source := newPostgresTestDbCr(newPostgresTestDbInstanceCr())
+	source.Spec.Instance = "postgres"
+	source.Status.DatabaseName = "sourcedb"
+	source.Status.UserName = "sourceuser"
+
+	assert.True(t, isInPlaceClone(postgresDbCr, source))
+
+	db, _ := determinDatabaseType(postgresDbCr, testDbcred)
+	pg, ok := withTemplate(db, source).(database.Postgres)
+	assert.True(t, ok)
+	assert.Equal(t, "sourcedb", pg.Template)
+	assert.Equal(t, "sourceuser", pg.TemplateOwner)
+
+	source.Spec.Instance = "other"
+	assert.False(t, isInPlaceClone(postgresDbCr, source))
+
+	mysqlDbCr := newMysqlTestDbCr()
+	assert.False(t, isInPlaceClone(mysqlDbCr, mysqlDbCr))
+}
+
+func TestCloneGranted(t *testing.T) {
+	grants := []kciv1beta1.DbCloneGrant{
+		{Spec: kciv1beta1.DbCloneGrantSpec{Namespaces: []string{"preview"}, Databases: []string{"app"}}},
+		{Spec: kciv1beta1.DbCloneGrantSpec{Namespaces: []string{"staging"}}},
+	}
+
+	assert.True(t, isCloneGranted(grants, "preview", "app"))
+	assert.False(t, isCloneGranted(grants, "preview", "other"))
+	assert.True(t, isCloneGranted(grants, "staging", "other"))
+	assert.False(t, isCloneGranted(grants, "dev", "app"))
+	assert.False(t, isCloneGranted([]kciv1beta1.DbCloneGrant{}, "preview", "app"))
+}
+
+func TestAdoptedDatabaseSecretData(t *testing.T) {
+	postgresDbCr := newPostgresTestDbCr(newPostgresTestDbInstanceCr())
+	_, err := adoptedDatabaseSecretData(postgresDbCr, "password")
+	assert.Error(t, err)
+
+	adoption := &kciv1beta1.DatabaseAdoption{DatabaseName: "legacy_db", UserName: "legacy_user"}
+	postgresDbCr.Spec.Adopt = adoption
+	data, err := adoptedDatabaseSecretData(postgresDbCr, "password")
+	assert.NoError(t, err)
+	cred, err := parseDatabaseSecretData(postgresDbCr, data)
+	assert.NoError(t, err)
+	assert.Equal(t, database.Credentials{Name: "legacy_db", Username: "legacy_user", Password: "password"}, cred)
+
+	mysqlDbCr := newMysqlTestDbCr()
+	mysqlDbCr.Spec.Adopt = adoption
+	data, err = adoptedDatabaseSecretData(mysqlDbCr, "password")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("legacy_db"), data["DB"])
+	assert.Equal(t, []byte("legacy_user"), data["USER"])
+
+	mysqlDbCr.Spec.Adopt = &kciv1beta1.DatabaseAdoption{DatabaseName: "legacy`; DROP DATABASE other; --", UserName: "legacy_user"}
+	_, err = adoptedDatabaseSecretData(mysqlDbCr, "password")
+	assert.Error(t, err, "adopted names are checked before they're used in statements")
+}
+
+func TestGenerateDatabaseSecretDataNaming(t *testing.T) {
+	postgresDbCr := newPostgresTestDbCr(newPostgresTestDbInstanceCr())
+	postgresDbCr.Name = "app"
+	data, err := generateDatabaseSecretData(postgresDbCr, naming.Rules{})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte(TestNamespace+"-app"), data["POSTGRES_DB"])
+	assert.Equal(t, []byte(TestNamespace+"-app"), data["POSTGRES_USER"])
+
+	rules := naming.Rules{Template: "{{ .Prefix }}{{ .Name }}", Prefix: "cluster1_"}
+	postgresDbCr.Spec.UserName = "app_owner"
+	data, err = generateDatabaseSecretData(postgresDbCr, rules)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("cluster1_app"), data["POSTGRES_DB"])
+	assert.Equal(t, []byte("app_owner"), data["POSTGRES_USER"])
+
+	mysqlDbCr := newMysqlTestDbCr()
+	mysqlDbCr.Name = "app"
+	data, err = generateDatabaseSecretData(mysqlDbCr, naming.Rules{})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("testns_app"), data["DB"])
+
+	mysqlDbCr.Spec.DatabaseName = "app-db"
+	_, err = generateDatabaseSecretData(mysqlDbCr, naming.Rules{})
+	assert.Error(t, err)
+}
+
+func TestIAMDatabaseSecretData(t *testing.T) {
+	postgresDbCr := newPostgresTestDbCr(newPostgresTestDbInstanceCr())
+	postgresDbCr.Name = "app"
+	postgresDbCr.Spec.IAMAuth = &kciv1beta1.DatabaseIAMAuth{ServiceAccount: "app-user@my-project.iam.gserviceaccount.com", CredentialsSecret: "app-sa"}
+	data, err := generateDatabaseSecretData(postgresDbCr, naming.Rules{})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("app-user@my-project.iam"), data["POSTGRES_USER"])
+	assert.Equal(t, []byte("app-user@my-project.iam.gserviceaccount.com"), data["IAM_PRINCIPAL"])
+	assert.NotContains(t, data, "POSTGRES_PASSWORD")
+
+	cred, err := parseDatabaseSecretData(postgresDbCr, data)
+	assert.NoError(t, err)
+	assert.Equal(t, "app-user@my-project.iam.gserviceaccount.com", cred.IAMPrincipal)
+	assert.Empty(t, cred.Password)
+
+	db, err := determinDatabaseType(postgresDbCr, cred)
+	assert.NoError(t, err)
+	assert.Equal(t, cred.IAMPrincipal, db.GetCredentials().IAMPrincipal)
+
+	postgresDbCr.Status.ProxyStatus.Status = true
+	postgresDbCr.Status.ProxyStatus.ServiceName = "db-app-svc"
+	postgresDbCr.Status.ProxyStatus.SQLPort = 5432
+	secrets, err := generateTemplatedSecrets(postgresDbCr, cred, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "postgresql://app-user%40my-project.iam@db-app-svc:5432/"+cred.Name, secrets["CONNECTION_STRING"])
+
+	mysqlDbCr := newMysqlTestDbCr()
+	mysqlDbCr.Name = "app"
+	mysqlDbCr.Spec.IAMAuth = postgresDbCr.Spec.IAMAuth
+	data, err = generateDatabaseSecretData(mysqlDbCr, naming.Rules{})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("app-user"), data["USER"])
+	assert.NotContains(t, data, "PASSWORD")
+}
+
+func TestSetOwnershipCondition(t *testing.T) {
+	dbcr := newPostgresTestDbCr(newPostgresTestDbInstanceCr())
+
+	setOwnershipCondition(dbcr, &database.OwnershipConflictError{Kind: "database", Name: "test-db", Owner: database.Owner{ClusterID: "cluster2"}})
+	condition := meta.FindStatusCondition(dbcr.Status.Conditions, kciv1beta1.DatabaseConditionOwnershipConflict)
+	assert.NotNil(t, condition)
+	assert.Equal(t, metav1.ConditionTrue, condition.Status)
+
+	// other errors don't tell anything about the ownership
+	setOwnershipCondition(dbcr, fmt.Errorf("connection refused"))
+	assert.True(t, meta.IsStatusConditionTrue(dbcr.Status.Conditions, kciv1beta1.DatabaseConditionOwnershipConflict))
+
+	setOwnershipCondition(dbcr, nil)
+	assert.True(t, meta.IsStatusConditionFalse(dbcr.Status.Conditions, kciv1beta1.DatabaseConditionOwnershipConflict))
+}
+
+func TestInstanceAdminCredentials(t *testing.T) {
+	admin := database.AdminCredentials{Username: "admin", Password: "admin-password"}
+
+	generic := newPostgresTestDbInstanceCr()
+	cred, err := instanceAdminCredentials(&generic, admin)
+	assert.NoError(t, err)
+	assert.Equal(t, admin, cred)
+
+	dbin := &kciv1beta1.DbInstance{
+		Spec: kciv1beta1.DbInstanceSpec{
+			DbInstanceSource: kciv1beta1.DbInstanceSource{
+				Aws: &kciv1beta1.AwsInstance{InstanceIdentifier: "postgres", Region: "eu-central-1", IAMAuth: true},
+			},
+		},
+		Status: kciv1beta1.DbInstanceStatus{
+			Info: map[string]string{"DB_CONN": "postgres.abcdefgh.eu-central-1.rds.amazonaws.com", "DB_PORT": "5432"},
+		},
+	}
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	cred, err = instanceAdminCredentials(dbin, admin)
+	assert.NoError(t, err)
+	assert.Equal(t, "admin", cred.Username)
+	assert.True(t, strings.HasPrefix(cred.Password, "postgres.abcdefgh.eu-central-1.rds.amazonaws.com:5432/?Action=connect&DBUser=admin&"))
+}
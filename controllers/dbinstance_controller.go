@@ -17,24 +17,43 @@
 package controllers
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-logr/logr"
 	kciv1beta1 "github.com/kloeckner-i/db-operator/api/v1beta1"
+	"github.com/kloeckner-i/db-operator/pkg/backend"
+	"github.com/kloeckner-i/db-operator/pkg/backend/generic"
 	"github.com/kloeckner-i/db-operator/pkg/config"
 	"github.com/kloeckner-i/db-operator/pkg/utils/database"
 	"github.com/kloeckner-i/db-operator/pkg/utils/dbinstance"
 	"github.com/kloeckner-i/db-operator/pkg/utils/kci"
+	"github.com/kloeckner-i/db-operator/pkg/utils/provision"
 	"github.com/kloeckner-i/db-operator/pkg/utils/proxy"
 	"github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	// registers the in-tree backends
+	_ "github.com/kloeckner-i/db-operator/pkg/backend/all"
 )
 
 var (
@@ -45,11 +64,31 @@ var (
 	dbInstancePhaseRunning     = "Running"
 )
 
+const (
+	// instanceFinalizer removes the instance proxy and applies the deletion policy of the instance
+	instanceFinalizer  = "dbinstance.kci.rocks"
+	provisionFinalizer = "provision.kci.rocks"
+	// promoteReplicaAnnotation set to true promotes a google read replica to a standalone instance
+	promoteReplicaAnnotation = "db-operator/promote-replica"
+	// backupRunAnnotation set to true starts an on-demand backup of a google instance
+	backupRunAnnotation = "db-operator/backup-run"
+	// skipFinalBackupAnnotation set to true deletes a google instance without its final backup, e.g. when the export keeps failing
+	skipFinalBackupAnnotation = "db-operator/skip-final-backup"
+	// clientCertFingerprintAnnotation is the fingerprint of the managed client certificate stored in the secret
+	clientCertFingerprintAnnotation = "db-operator/client-cert-fingerprint"
+)
+
+var (
+	errProvisionInProgress = errors.New("provisioned server is not ready yet")
+	errInstanceInUse       = errors.New("instance is still used by databases or replicas")
+)
+
 // DbInstanceReconciler reconciles a DbInstance object
 type DbInstanceReconciler struct {
 	client.Client
 	Log      logr.Logger
 	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
 	Interval time.Duration
 	Conf     *config.Config
 }
@@ -57,6 +96,12 @@ type DbInstanceReconciler struct {
 //+kubebuilder:rbac:groups=kci.rocks,resources=dbinstances,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=kci.rocks,resources=dbinstances/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=kci.rocks,resources=dbinstances/finalizers,verbs=update
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups="",resources=endpoints,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=persistentvolumeclaims,verbs=list;delete;deletecollection
+//+kubebuilder:rbac:groups=apps,resources=deployments;statefulsets,verbs=get;list;watch;create;update;patch;delete
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -87,6 +132,65 @@ func (r *DbInstanceReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return reconcileResult, err
 	}
 
+	if dbin.GetDeletionTimestamp() != nil {
+		if containsString(dbin.ObjectMeta.Finalizers, instanceFinalizer) {
+			if err := r.delete(ctx, dbin); err != nil {
+				if errors.Is(err, dbinstance.ErrOperationInProgress) {
+					// the operation is stored to be polled on the next reconcile
+					if err := r.Status().Update(ctx, dbin); err != nil {
+						logrus.Errorf("failed to update status - %s", err)
+						return reconcileResult, err
+					}
+					logrus.Infof("Instance: name=%s waiting for operation %s", dbin.Name, dbin.Status.Operation)
+					return reconcile.Result{RequeueAfter: 30 * time.Second}, nil
+				}
+				r.reportDeletionBlocked(ctx, dbin, err)
+				if errors.Is(err, errInstanceInUse) {
+					logrus.Infof("Instance: name=%s can not be deleted - %s", dbin.Name, err)
+					return reconcileResult, nil
+				}
+				logrus.Errorf("Instance: name=%s deletion failed - %s", dbin.Name, err)
+				return reconcileResult, err
+			}
+			kci.RemoveFinalizer(&dbin.ObjectMeta, instanceFinalizer)
+			if err := r.Update(ctx, dbin); err != nil {
+				logrus.Errorf("error resource updating - %s", err)
+				return reconcileResult, err
+			}
+		}
+		if containsString(dbin.ObjectMeta.Finalizers, provisionFinalizer) {
+			if err := r.deprovision(ctx, dbin); err != nil {
+				logrus.Errorf("Instance: name=%s failed removing provisioned server - %s", dbin.Name, err)
+				return reconcileResult, err
+			}
+			kci.RemoveFinalizer(&dbin.ObjectMeta, provisionFinalizer)
+			if err := r.Update(ctx, dbin); err != nil {
+				logrus.Errorf("error resource updating - %s", err)
+				return reconcileResult, err
+			}
+		}
+		return reconcileResult, nil
+	}
+
+	// the deletion of google instances waits for their databases and replicas,
+	// the provisioned server is removed by the finalizer when the instance is deleted
+	finalizers := []string{}
+	if dbin.Spec.Google != nil {
+		finalizers = append(finalizers, instanceFinalizer)
+	}
+	if dbin.Spec.Generic != nil && dbin.Spec.Generic.Provision != nil {
+		finalizers = append(finalizers, provisionFinalizer)
+	}
+	if missing := missingFinalizers(dbin, finalizers); len(missing) > 0 {
+		for _, finalizer := range missing {
+			kci.AddFinalizer(&dbin.ObjectMeta, finalizer)
+		}
+		if err := r.Update(ctx, dbin); err != nil {
+			logrus.Errorf("error resource updating - %s", err)
+			return reconcileResult, err
+		}
+	}
+
 	// Update object status always when function returns, either normally or through a panic.
 	defer func() {
 		if err := r.Status().Update(ctx, dbin); err != nil {
@@ -94,6 +198,22 @@ func (r *DbInstanceReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		}
 	}()
 
+	if dbin.GoogleMasterInstance() != "" && dbin.GetAnnotations()[promoteReplicaAnnotation] == "true" {
+		if err := r.promote(ctx, dbin); err != nil {
+			if errors.Is(err, dbinstance.ErrOperationInProgress) {
+				logrus.Infof("Instance: name=%s waiting for operation %s", dbin.Name, dbin.Status.Operation)
+				return reconcile.Result{RequeueAfter: 30 * time.Second}, nil
+			}
+			logrus.Errorf("Instance: name=%s replica promotion failed - %s", dbin.Name, err)
+			return reconcileResult, err
+		}
+	}
+
+	if err := r.linkInstances(ctx, dbin); err != nil {
+		logrus.Errorf("Instance: name=%s failed listing replicas - %s", dbin.Name, err)
+		return reconcileResult, err
+	}
+
 	// Check if spec changed
 	if isDBInstanceSpecChanged(ctx, dbin) {
 		logrus.Infof("Instance: name=%s spec changed", dbin.Name)
@@ -103,7 +223,9 @@ func (r *DbInstanceReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 
 	phase := dbin.Status.Phase
 	logrus.Infof("Instance: name=%s %s", dbin.Name, phase)
-	defer promDBInstancesPhaseTime.WithLabelValues(phase).Observe(time.Since(time.Now()).Seconds())
+	defer func(start time.Time) {
+		promDBInstancesPhaseTime.WithLabelValues(phase).Observe(kci.TimeTrack(start))
+	}(time.Now())
 	promDBInstancesPhase.WithLabelValues(dbin.Name).Set(dbInstancePhaseToFloat64(phase))
 	if !dbin.Status.Status {
 		if err := dbin.ValidateBackend(); err != nil {
@@ -114,15 +236,48 @@ func (r *DbInstanceReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 			return reconcileResult, err
 		}
 
-		addDBInstanceChecksumStatus(ctx, dbin)
+		// the checksum is recorded when a change starts, a spec changed while an operation
+		// of the backend is pending is applied once the operation is done
+		if dbin.Status.Operation == "" {
+			addDBInstanceChecksumStatus(ctx, dbin)
+		}
 		dbin.Status.Phase = dbInstancePhaseCreate
 		dbin.Status.Info = map[string]string{}
 
 		err = r.create(ctx, dbin)
 		if err != nil {
+			if errors.Is(err, errProvisionInProgress) {
+				logrus.Infof("Instance: name=%s waiting for provisioned server to be ready", dbin.Name)
+				return reconcile.Result{RequeueAfter: 10 * time.Second}, nil
+			}
+			if errors.Is(err, database.ErrRequestInProgress) {
+				logrus.Infof("Instance: name=%s waiting for executor job", dbin.Name)
+				return reconcile.Result{RequeueAfter: executorRequeueInterval}, nil
+			}
+			if errors.Is(err, dbinstance.ErrOperationInProgress) {
+				logrus.Infof("Instance: name=%s waiting for operation %s", dbin.Name, dbin.Status.Operation)
+				return reconcile.Result{RequeueAfter: 30 * time.Second}, nil
+			}
+			if errors.Is(err, dbinstance.ErrInstanceNotReady) {
+				logrus.Infof("Instance: name=%s waiting for instance to be ready", dbin.Name)
+				return reconcile.Result{RequeueAfter: 30 * time.Second}, nil
+			}
 			logrus.Errorf("Instance: name=%s instance creation failed - %s", dbin.Name, err)
 			return reconcileResult, nil // failed but don't requeue the request. retry by changing spec or config
 		}
+		if isDBInstanceSpecChanged(ctx, dbin) {
+			logrus.Infof("Instance: name=%s spec changed during operation, applying it", dbin.Name)
+			return reconcile.Result{Requeue: true}, nil
+		}
+
+		if _, err = r.checkClientCert(ctx, dbin); err != nil {
+			logrus.Errorf("Instance: name=%s client certificate check failed - %s", dbin.Name, err)
+			return reconcileResult, err
+		}
+		if _, err = r.checkReadReplicas(ctx, dbin); err != nil {
+			logrus.Errorf("Instance: name=%s read replica check failed - %s", dbin.Name, err)
+			return reconcileResult, err
+		}
 		dbin.Status.Status = true
 		dbin.Status.Phase = dbInstancePhaseBroadcast
 
@@ -131,6 +286,10 @@ func (r *DbInstanceReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 			logrus.Errorf("Instance: name=%s broadcasting failed - %s", dbin.Name, err)
 			return reconcileResult, err
 		}
+		if _, err = r.checkAccessSecrets(ctx, dbin); err != nil {
+			logrus.Errorf("Instance: name=%s access secret sync failed - %s", dbin.Name, err)
+			return reconcileResult, err
+		}
 		dbin.Status.Phase = dbInstancePhaseProxyCreate
 
 		err = r.createProxy(ctx, dbin, []metav1.OwnerReference{})
@@ -140,85 +299,656 @@ func (r *DbInstanceReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		}
 		dbin.Status.Phase = dbInstancePhaseRunning
 
+	} else {
+		if err := r.checkBackupRuns(ctx, dbin); err != nil {
+			if !errors.Is(err, dbinstance.ErrOperationInProgress) {
+				logrus.Errorf("Instance: name=%s backup run failed - %s", dbin.Name, err)
+				return reconcileResult, err
+			}
+			logrus.Infof("Instance: name=%s waiting for backup run %s", dbin.Name, dbin.Status.BackupOperation)
+		}
+		primaryChanged, err := r.checkPrimary(ctx, dbin)
+		if err != nil {
+			logrus.Errorf("Instance: name=%s primary check failed - %s", dbin.Name, err)
+			return reconcileResult, err
+		}
+		serviceChanged, err := r.checkService(ctx, dbin)
+		if err != nil {
+			logrus.Errorf("Instance: name=%s service check failed - %s", dbin.Name, err)
+			return reconcileResult, err
+		}
+		replicasChanged, err := r.checkReadReplicas(ctx, dbin)
+		if err != nil {
+			logrus.Errorf("Instance: name=%s read replica check failed - %s", dbin.Name, err)
+			return reconcileResult, err
+		}
+		certChanged, err := r.checkClientCert(ctx, dbin)
+		if err != nil {
+			logrus.Errorf("Instance: name=%s client certificate check failed - %s", dbin.Name, err)
+			return reconcileResult, err
+		}
+		credentialsChanged, err := r.checkAccessSecrets(ctx, dbin)
+		if err != nil {
+			logrus.Errorf("Instance: name=%s access secret sync failed - %s", dbin.Name, err)
+			return reconcileResult, err
+		}
+		if credentialsChanged {
+			logrus.Infof("Instance: name=%s access credentials changed, cloud proxies restarted", dbin.Name)
+		}
+		// databases regenerate their configmaps and secrets with the new endpoints and certificates
+		if primaryChanged || serviceChanged || replicasChanged || certChanged {
+			logrus.Infof("Instance: name=%s endpoints changed", dbin.Name)
+			// databases read the endpoints from the instance status, so it's stored before broadcasting
+			if err = r.Status().Update(ctx, dbin); err != nil {
+				logrus.Errorf("Instance: name=%s failed to update status - %s", dbin.Name, err)
+				return reconcileResult, err
+			}
+			if err = r.broadcast(ctx, dbin); err != nil {
+				logrus.Errorf("Instance: name=%s broadcasting failed - %s", dbin.Name, err)
+				return reconcileResult, err
+			}
+		}
 	}
 	return reconcileResult, nil
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *DbInstanceReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	// instances referencing a service follow changes of its address
+	serviceHandler := handler.EnqueueRequestsFromMapFunc(r.requestsForService)
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&kciv1beta1.DbInstance{}).
+		Watches(&source.Kind{Type: &corev1.Service{}}, serviceHandler).
+		Watches(&source.Kind{Type: &corev1.Endpoints{}}, serviceHandler).
+		// masters list their replicas in the status
+		Watches(&source.Kind{Type: &kciv1beta1.DbInstance{}}, handler.EnqueueRequestsFromMapFunc(requestsForMaster)).
+		Watches(&source.Kind{Type: &batchv1.Job{}}, handler.EnqueueRequestsFromMapFunc(requestsForExecutorJob("DbInstance"))).
+		// rotated credentials are copied to the namespaces of the databases
+		Watches(&source.Kind{Type: &corev1.Secret{}}, handler.EnqueueRequestsFromMapFunc(r.requestsForAccessSecret)).
 		Complete(r)
 }
 
-func (r *DbInstanceReconciler) create(ctx context.Context, dbin *kciv1beta1.DbInstance) error {
+// requestsForMaster returns the master of a replica, the previous master is still in the status after a promotion
+func requestsForMaster(obj client.Object) []reconcile.Request {
+	dbin, ok := obj.(*kciv1beta1.DbInstance)
+	if !ok {
+		return nil
+	}
+
+	requests := []reconcile.Request{}
+	master := dbin.GoogleMasterInstance()
+	if master != "" {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: master}})
+	}
+	if dbin.Status.MasterInstance != "" && dbin.Status.MasterInstance != master {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: dbin.Status.MasterInstance}})
+	}
+	return requests
+}
+
+func (r *DbInstanceReconciler) requestsForService(obj client.Object) []reconcile.Request {
+	dbinList := &kciv1beta1.DbInstanceList{}
+	if err := r.List(context.Background(), dbinList); err != nil {
+		logrus.Errorf("failed to list instances - %s", err)
+		return nil
+	}
+
+	requests := []reconcile.Request{}
+	for _, name := range instancesForService(dbinList.Items, obj.GetNamespace(), obj.GetName()) {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: name}})
+	}
+	return requests
+}
+
+func (r *DbInstanceReconciler) requestsForAccessSecret(obj client.Object) []reconcile.Request {
+	dbinList := &kciv1beta1.DbInstanceList{}
+	if err := r.List(context.Background(), dbinList); err != nil {
+		logrus.Errorf("failed to list instances - %s", err)
+		return nil
+	}
+
+	requests := []reconcile.Request{}
+	for _, name := range instancesForAccessSecret(dbinList.Items, obj.GetNamespace(), obj.GetName()) {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: name}})
+	}
+	return requests
+}
+
+// checkService updates the address of a generic instance referencing a service,
+// it returns true when the address changed
+func (r *DbInstanceReconciler) checkService(ctx context.Context, dbin *kciv1beta1.DbInstance) (bool, error) {
+	if dbin.Spec.Generic == nil || dbin.Spec.Generic.ServiceRef == nil {
+		return false, nil
+	}
+
+	host, port, err := generic.ServiceAddress(ctx, r, dbin)
+	if err != nil {
+		return false, err
+	}
+
+	if dbin.Status.Info == nil {
+		dbin.Status.Info = map[string]string{}
+	}
+	portValue := strconv.FormatInt(int64(port), 10)
+	if dbin.Status.Info["DB_CONN"] == host && dbin.Status.Info["DB_PORT"] == portValue {
+		return false, nil
+	}
+
+	logrus.Infof("Instance: name=%s service address changed to %s:%s", dbin.Name, host, portValue)
+	dbin.Status.Info["DB_CONN"] = host
+	dbin.Status.Info["DB_PORT"] = portValue
+	return true, nil
+}
+
+func (r *DbInstanceReconciler) adminCredentials(ctx context.Context, dbin *kciv1beta1.DbInstance) (database.AdminCredentials, error) {
 	secret, err := kci.GetSecretResource(ctx, dbin.Spec.AdminUserSecret.ToKubernetesType())
 	if err != nil {
 		logrus.Errorf("Instance: name=%s failed to get instance admin user secret %s/%s", dbin.Name, dbin.Spec.AdminUserSecret.Namespace, dbin.Spec.AdminUserSecret.Name)
-		return err
+		return database.AdminCredentials{}, err
 	}
 
 	db := database.New(dbin.Spec.Engine)
-	cred, err := db.ParseAdminCredentials(secret.Data)
+	return db.ParseAdminCredentials(secret.Data)
+}
+
+func (r *DbInstanceReconciler) create(ctx context.Context, dbin *kciv1beta1.DbInstance) error {
+	if dbin.Spec.Generic != nil && dbin.Spec.Generic.Provision != nil {
+		if err := r.provision(ctx, dbin); err != nil {
+			return err
+		}
+	}
+
+	cred, err := r.adminCredentials(ctx, dbin)
 	if err != nil {
 		return err
 	}
 
-	backend, err := dbin.GetBackendType()
+	b, err := backend.For(dbin)
 	if err != nil {
 		return err
 	}
 
-	var instance dbinstance.DbInstance
-	switch backend {
-	case "google":
-		configmap, err := kci.GetConfigResource(ctx, dbin.Spec.Google.ConfigmapName.ToKubernetesType())
-		if err != nil {
-			logrus.Errorf("Instance: name=%s reading GCSQL instance config %s/%s", dbin.Name, dbin.Spec.Google.ConfigmapName.Namespace, dbin.Spec.Google.ConfigmapName.Name)
-			return err
-		}
-
-		name := dbin.Spec.Google.InstanceName
-		config := configmap.Data["config"]
-		user := cred.Username
-		password := cred.Password
-		apiEndpoint := dbin.Spec.Google.APIEndpoint
-
-		instance = dbinstance.GsqlNew(name, config, user, password, apiEndpoint)
-	case "generic":
-		instance = &dbinstance.Generic{
-			Host:         dbin.Spec.Generic.Host,
-			Port:         dbin.Spec.Generic.Port,
-			PublicIP:     dbin.Spec.Generic.PublicIP,
-			Engine:       dbin.Spec.Engine,
-			User:         cred.Username,
-			Password:     cred.Password,
-			SSLEnabled:   dbin.Spec.SSLConnection.Enabled,
-			SkipCAVerify: dbin.Spec.SSLConnection.SkipVerify,
-		}
-	default:
-		return errors.New("not supported backend type")
+	env := backend.Env{Client: r.Client, Conf: r.Conf, Executor: newExecutor(ctx, r.Client, r.Conf, dbin, dbin)}
+	instance, err := b.Driver.Instance(ctx, env, dbin, cred)
+	if err != nil {
+		return err
 	}
 
+	// the driver polls the pending operation, a new one is recorded if the driver starts it
+	dbin.Status.Operation = ""
 	info, err := dbinstance.Create(instance)
 	if err != nil {
 		if err == dbinstance.ErrAlreadyExists {
+			// the users are updated after the restore, it overwrites them
+			if err := restore(dbin, instance); err != nil {
+				return recordOperation(dbin, err)
+			}
 			logrus.Debugf("Instance: name=%s instance already exists in backend, updating instance", dbin.Name)
 			info, err = dbinstance.Update(instance)
 			if err != nil {
-				logrus.Errorf("Instance: name=%s failed updating instance - %s", dbin.Name, err)
-				return err
+				return recordOperation(dbin, err)
 			}
 		} else {
-			logrus.Errorf("Instance: name=%s failed creating instance - %s", dbin.Name, err)
-			return err
+			return recordOperation(dbin, err)
 		}
 	}
 
 	dbin.Status.Info = info
+	// drivers only reset the admin password when it differs from the last applied one
+	backend.SetAdminPasswordApplied(dbin, cred)
+	return nil
+}
+
+// promote turns a google read replica into a standalone instance,
+// the former master is kept in the status so the spec can be cleaned up by the user afterwards
+func (r *DbInstanceReconciler) promote(ctx context.Context, dbin *kciv1beta1.DbInstance) error {
+	b, err := backend.For(dbin)
+	if err != nil {
+		return err
+	}
+	env := backend.Env{Client: r.Client, Conf: r.Conf}
+	instance, err := b.Driver.Instance(ctx, env, dbin, database.AdminCredentials{})
+	if err != nil {
+		return err
+	}
+
+	dbin.Status.Operation = ""
+	if err := dbinstance.Promote(instance); err != nil {
+		return recordOperation(dbin, err)
+	}
+
+	logrus.Infof("Instance: name=%s promoted from replica of %s", dbin.Name, dbin.Spec.Google.MasterInstanceName)
+	dbin.Status.PromotedFrom = dbin.Spec.Google.MasterInstanceName
+	dbin.Status.MasterInstance = ""
+	return nil
+}
+
+// linkInstances stores the master, the source and the replicas of a google instance in its status
+func (r *DbInstanceReconciler) linkInstances(ctx context.Context, dbin *kciv1beta1.DbInstance) error {
+	dbin.Status.MasterInstance = ""
+	dbin.Status.ClonedFrom = ""
+	if dbin.Spec.Google != nil {
+		dbin.Status.MasterInstance = dbin.GoogleMasterInstance()
+		if dbin.Spec.Google.CloneOf != nil {
+			dbin.Status.ClonedFrom = dbin.Spec.Google.CloneOf.Instance
+		}
+	}
+
+	replicas, err := r.replicasOf(ctx, dbin)
+	if err != nil {
+		return err
+	}
+	dbin.Status.Replicas = replicas
 	return nil
 }
 
+// replicasOf returns the names of the instances replicating the instance
+func (r *DbInstanceReconciler) replicasOf(ctx context.Context, dbin *kciv1beta1.DbInstance) ([]string, error) {
+	dbinList := &kciv1beta1.DbInstanceList{}
+	if err := r.List(ctx, dbinList); err != nil {
+		return nil, err
+	}
+	replicas := []string{}
+	for _, replica := range dbinList.Items {
+		if replica.GoogleMasterInstance() == dbin.Name {
+			replicas = append(replicas, replica.Name)
+		}
+	}
+	sort.Strings(replicas)
+	return replicas, nil
+}
+
+// checkClientCert issues the client certificate of a google instance through the Cloud SQL admin api
+// and stores it in the client cert secret of the ssl connection, it returns true when a new certificate was issued
+func (r *DbInstanceReconciler) checkClientCert(ctx context.Context, dbin *kciv1beta1.DbInstance) (bool, error) {
+	if dbin.Spec.Google == nil || !dbin.Spec.Google.ManageClientCert || dbin.Spec.SSLConnection.ClientCertSecret == nil {
+		return false, nil
+	}
+
+	ref := dbin.Spec.SSLConnection.ClientCertSecret.ToKubernetesType()
+	secret := &corev1.Secret{}
+	err := r.Get(ctx, ref, secret)
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return false, err
+	}
+	exists := err == nil
+	// the stored certificate is checked first, the api is only asked when it's missing or about to expire
+	if exists && secret.Annotations[clientCertFingerprintAnnotation] != "" && !dbinstance.GsqlClientCertDue(secret.Data[corev1.TLSCertKey], time.Now()) {
+		return false, nil
+	}
+
+	b, err := backend.For(dbin)
+	if err != nil {
+		return false, err
+	}
+	env := backend.Env{Client: r.Client, Conf: r.Conf}
+	instance, err := b.Driver.Instance(ctx, env, dbin, database.AdminCredentials{})
+	if err != nil {
+		return false, err
+	}
+
+	// a lost secret can't be restored, the key is only returned when the certificate is issued
+	cert, err := dbinstance.IssueClientCert(instance, "db-operator-"+dbin.Name, secret.Annotations[clientCertFingerprintAnnotation])
+	if err != nil || cert == nil {
+		return false, err
+	}
+
+	secret.Name = ref.Name
+	secret.Namespace = ref.Namespace
+	if !exists {
+		secret.Type = corev1.SecretTypeTLS
+	}
+	secret.Data = map[string][]byte{
+		corev1.TLSCertKey:       []byte(cert.Cert),
+		corev1.TLSPrivateKeyKey: []byte(cert.Key),
+		backend.SSLCAKey:        []byte(cert.CA),
+	}
+	if secret.Annotations == nil {
+		secret.Annotations = map[string]string{}
+	}
+	secret.Annotations[clientCertFingerprintAnnotation] = cert.Fingerprint
+	if exists {
+		err = r.Update(ctx, secret)
+	} else {
+		err = r.Create(ctx, secret)
+	}
+	if err != nil {
+		return false, err
+	}
+	logrus.Infof("Instance: name=%s client certificate %s stored in %s/%s", dbin.Name, cert.Fingerprint, ref.Namespace, ref.Name)
+	return true, nil
+}
+
+// restore overwrites a new google instance with the backup run it's restored from, it's done once
+func restore(dbin *kciv1beta1.DbInstance, instance dbinstance.DbInstance) error {
+	if dbin.Spec.Google == nil || dbin.Spec.Google.RestoreFrom == nil || dbin.Status.RestoredBackupRun == dbin.Spec.Google.RestoreFrom.BackupRunID {
+		return nil
+	}
+	if err := dbinstance.Restore(instance); err != nil {
+		return err
+	}
+	logrus.Infof("Instance: name=%s restored backup run %d of %s", dbin.Name, dbin.Spec.Google.RestoreFrom.BackupRunID, dbin.Spec.Google.RestoreFrom.Instance)
+	dbin.Status.RestoredBackupRun = dbin.Spec.Google.RestoreFrom.BackupRunID
+	return nil
+}
+
+// checkBackupRuns starts an on-demand backup of a google instance when it's requested by annotation or due by schedule,
+// the most recent backup runs are listed in the status
+func (r *DbInstanceReconciler) checkBackupRuns(ctx context.Context, dbin *kciv1beta1.DbInstance) error {
+	if dbin.Spec.Google == nil || dbin.GoogleMasterInstance() != "" {
+		return nil
+	}
+
+	b, err := backend.For(dbin)
+	if err != nil {
+		return err
+	}
+	env := backend.Env{Client: r.Client, Conf: r.Conf}
+	instance, err := b.Driver.Instance(ctx, env, dbin, database.AdminCredentials{})
+	if err != nil {
+		return err
+	}
+
+	// a pending backup run is polled until it's done
+	now := time.Now()
+	requested := dbin.GetAnnotations()[backupRunAnnotation] == "true"
+	var backupErr error
+	started := false
+	if requested || dbin.Status.BackupOperation != "" || backupRunDue(dbin, now) {
+		polled := dbin.Status.BackupOperation != ""
+		dbin.Status.BackupOperation = ""
+		if err := dbinstance.Backup(instance); err != nil {
+			var pending *dbinstance.OperationInProgressError
+			if !errors.As(err, &pending) {
+				return err
+			}
+			dbin.Status.BackupOperation = pending.Operation
+			backupErr = err
+		} else if requested {
+			logrus.Infof("Instance: name=%s requested backup run is done", dbin.Name)
+			annotations := dbin.GetAnnotations()
+			delete(annotations, backupRunAnnotation)
+			dbin.SetAnnotations(annotations)
+			status := dbin.Status
+			if err := r.Update(ctx, dbin); err != nil {
+				return err
+			}
+			// the update returns the stored status
+			dbin.Status = status
+		}
+		started = !polled || dbin.Status.BackupOperation == ""
+	}
+
+	// a started backup run is listed right away, so it isn't due again while it's running,
+	// otherwise the runs are listed once per reconcile period
+	if !started && !backupRunsListDue(dbin, now, r.Interval*time.Second) {
+		return backupErr
+	}
+	runs, err := dbinstance.BackupRuns(instance)
+	if err != nil {
+		return err
+	}
+	dbin.Status.BackupRuns = backupRunStatus(runs)
+	dbin.Status.BackupRunsListedAt = &metav1.Time{Time: now}
+	return backupErr
+}
+
+// backupRunsListDue returns true when the backup runs in the status are older than the interval
+func backupRunsListDue(dbin *kciv1beta1.DbInstance, now time.Time, interval time.Duration) bool {
+	return dbin.Status.BackupRunsListedAt == nil || now.Sub(dbin.Status.BackupRunsListedAt.Time) >= interval
+}
+
+// backupRunDue returns true when the last on-demand backup run is older than the interval of the schedule
+func backupRunDue(dbin *kciv1beta1.DbInstance, now time.Time) bool {
+	if dbin.Spec.Google.BackupRuns == nil {
+		return false
+	}
+	for _, run := range dbin.Status.BackupRuns {
+		if run.Type != "ON_DEMAND" {
+			continue
+		}
+		enqueued, err := time.Parse(time.RFC3339, run.EnqueuedTime)
+		if err != nil {
+			continue
+		}
+		// runs are listed newest first
+		return now.Sub(enqueued) >= dbin.Spec.Google.BackupRuns.Interval.Duration
+	}
+	return true
+}
+
+func backupRunStatus(runs []dbinstance.BackupRun) []kciv1beta1.GoogleBackupRunStatus {
+	statuses := []kciv1beta1.GoogleBackupRunStatus{}
+	for _, run := range runs {
+		statuses = append(statuses, kciv1beta1.GoogleBackupRunStatus{
+			ID:           run.ID,
+			Type:         run.Type,
+			Status:       run.Status,
+			EnqueuedTime: run.EnqueuedTime,
+			EndTime:      run.EndTime,
+		})
+	}
+	return statuses
+}
+
+// recordOperation stores the operation the driver is waiting for in the instance status
+func recordOperation(dbin *kciv1beta1.DbInstance, err error) error {
+	var pending *dbinstance.OperationInProgressError
+	if errors.As(err, &pending) {
+		dbin.Status.Operation = pending.Operation
+		return err
+	}
+	if errors.Is(err, database.ErrRequestInProgress) || errors.Is(err, dbinstance.ErrInstanceNotReady) {
+		return err
+	}
+	logrus.Errorf("Instance: name=%s failed creating or updating instance - %s", dbin.Name, err)
+	return err
+}
+
+// checkPrimary follows the primary of a generic instance with multiple hosts,
+// it returns true when the primary changed
+func (r *DbInstanceReconciler) checkPrimary(ctx context.Context, dbin *kciv1beta1.DbInstance) (bool, error) {
+	if dbin.Spec.Generic == nil || len(dbin.Spec.Generic.Hosts) == 0 {
+		return false, nil
+	}
+
+	cred, err := r.adminCredentials(ctx, dbin)
+	if err != nil {
+		return false, err
+	}
+
+	instance, err := generic.Instance(ctx, r, dbin, cred)
+	if err != nil {
+		return false, err
+	}
+	instance.Executor = newExecutor(ctx, r.Client, r.Conf, dbin, dbin)
+
+	primary, err := dbinstance.DetectPrimary(instance)
+	if errors.Is(err, database.ErrRequestInProgress) {
+		// the primary is checked again when the executor jobs finished
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if dbin.Status.Info == nil {
+		dbin.Status.Info = map[string]string{}
+	}
+	if dbin.Status.Info["DB_CONN"] == primary {
+		return false, nil
+	}
+
+	logrus.Infof("Instance: name=%s primary changed from %s to %s", dbin.Name, dbin.Status.Info["DB_CONN"], primary)
+	dbin.Status.Info["DB_CONN"] = primary
+	return true, nil
+}
+
+// checkReadReplicas updates the health of the read replicas and the read-only endpoint in the instance info,
+// it returns true when the read-only endpoint changed
+func (r *DbInstanceReconciler) checkReadReplicas(ctx context.Context, dbin *kciv1beta1.DbInstance) (bool, error) {
+	if len(dbin.Spec.ReadReplicas) == 0 && len(dbin.Status.ReadReplicas) == 0 {
+		return false, nil
+	}
+
+	oldHost, oldPort, _ := dbin.ReadOnlyEndpoint()
+
+	cred, err := r.adminCredentials(ctx, dbin)
+	if err != nil {
+		return false, err
+	}
+
+	certs, err := backend.SSLCerts(ctx, r.Client, dbin)
+	if err != nil {
+		return false, err
+	}
+
+	statuses := []kciv1beta1.ReadReplicaStatus{}
+	for _, replica := range dbin.Spec.ReadReplicas {
+		var instance dbinstance.Replica
+		status := kciv1beta1.ReadReplicaStatus{}
+		switch {
+		case replica.Generic != nil:
+			status.Name = replica.Generic.Host
+			instance = &dbinstance.Generic{
+				Host:         replica.Generic.Host,
+				Port:         replica.Generic.Port,
+				Engine:       dbin.Spec.Engine,
+				User:         cred.Username,
+				Password:     cred.Password,
+				SSLEnabled:   dbin.Spec.SSLConnection.Enabled,
+				SkipCAVerify: dbin.Spec.SSLConnection.SkipVerify,
+				SSLCerts:     certs,
+				Executor:     newExecutor(ctx, r.Client, r.Conf, dbin, dbin),
+			}
+		case replica.Google != nil:
+			status.Name = replica.Google.InstanceName
+			instance = dbinstance.GsqlNew(replica.Google.InstanceName, "", cred.Username, cred.Password, dbin.Spec.Google.APIEndpoint)
+		default:
+			return false, errors.New("read replica type not defined")
+		}
+
+		host, port, err := dbinstance.CheckReplica(instance)
+		if errors.Is(err, database.ErrRequestInProgress) {
+			// the health is kept until the executor job finished
+			for _, previous := range dbin.Status.ReadReplicas {
+				if previous.Name == status.Name {
+					status = previous
+				}
+			}
+			statuses = append(statuses, status)
+			continue
+		}
+		if err != nil {
+			logrus.Warnf("Instance: name=%s read replica %s is not healthy - %s", dbin.Name, status.Name, err)
+			status.Message = err.Error()
+		} else {
+			status.Host = host
+			status.Port = port
+			status.Healthy = true
+		}
+		statuses = append(statuses, status)
+	}
+	dbin.Status.ReadReplicas = statuses
+
+	if dbin.Status.Info == nil {
+		dbin.Status.Info = map[string]string{}
+	}
+	host, port, found := dbin.ReadOnlyEndpoint()
+	if found {
+		dbin.Status.Info["DB_RO_CONN"] = host
+		dbin.Status.Info["DB_RO_PORT"] = port
+	} else {
+		delete(dbin.Status.Info, "DB_RO_CONN")
+		delete(dbin.Status.Info, "DB_RO_PORT")
+	}
+
+	return host != oldHost || port != oldPort, nil
+}
+
+// checkAccessSecrets copies changed credentials of a google instance to the access secrets of its databases
+// and restarts the cloud proxies not running with them, it returns true when the credentials changed since the last sync.
+// The checksum is only stored once all proxies are restarted, so failed restarts are retried on the next reconcile
+func (r *DbInstanceReconciler) checkAccessSecrets(ctx context.Context, dbin *kciv1beta1.DbInstance) (bool, error) {
+	if dbin.Spec.Google == nil {
+		return false, nil
+	}
+
+	data, err := instanceAccessCredentials(ctx, r.Client, dbin)
+	if err != nil {
+		return false, err
+	}
+	checksum := kci.GenerateChecksum(data)
+	if checksum == dbin.Status.AccessSecretChecksum {
+		return false, nil
+	}
+
+	dbList := &kciv1beta1.DatabaseList{}
+	if err := r.List(ctx, dbList); err != nil {
+		return false, err
+	}
+	for _, db := range dbList.Items {
+		if db.Spec.Instance != dbin.Name {
+			continue
+		}
+
+		secret := &corev1.Secret{}
+		err := r.Get(ctx, types.NamespacedName{Namespace: db.Namespace, Name: db.InstanceAccessSecretName()}, secret)
+		if k8serrors.IsNotFound(err) {
+			// the secret is created with the current credentials when the database is provisioned
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		if !bytes.Equal(secret.Data[instanceAccessCredentialsKey], data) {
+			secret.Data = map[string][]byte{instanceAccessCredentialsKey: data}
+			if err := r.Update(ctx, secret); err != nil {
+				return false, err
+			}
+			logrus.Infof("DB: namespace=%s, name=%s instance access secret updated", db.Namespace, db.Name)
+		}
+
+		// the proxy of an iam user mounts the key of its service account
+		if db.Spec.IAMAuth != nil {
+			continue
+		}
+		deploy := &appsv1.Deployment{}
+		err = r.Get(ctx, types.NamespacedName{Namespace: db.Namespace, Name: "db-" + db.Name + "-cloudproxy"}, deploy)
+		if k8serrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		if deploy.Spec.Template.Annotations[proxy.AccessSecretChecksumAnnotation] == checksum {
+			continue
+		}
+		patch := client.MergeFrom(deploy.DeepCopy())
+		if deploy.Spec.Template.Annotations == nil {
+			deploy.Spec.Template.Annotations = map[string]string{}
+		}
+		deploy.Spec.Template.Annotations[proxy.AccessSecretChecksumAnnotation] = checksum
+		if err := r.Patch(ctx, deploy, patch); err != nil {
+			return false, err
+		}
+		logrus.Infof("DB: namespace=%s, name=%s cloud proxy restarted with new credentials", db.Namespace, db.Name)
+	}
+
+	previous := dbin.Status.AccessSecretChecksum
+	dbin.Status.AccessSecretChecksum = checksum
+	if previous == "" {
+		// the instance proxy mounts the source secret, so it already uses the current credentials
+		return false, nil
+	}
+	// the instance proxy is restarted with the checksum of the new credentials
+	if err := r.createProxy(ctx, dbin, []metav1.OwnerReference{}); err != nil {
+		dbin.Status.AccessSecretChecksum = previous
+		return false, err
+	}
+	return true, nil
+}
+
 func (r *DbInstanceReconciler) broadcast(ctx context.Context, dbin *kciv1beta1.DbInstance) error {
 	dbList := &kciv1beta1.DatabaseList{}
 	err := r.List(ctx, dbList)
@@ -297,3 +1027,246 @@ func (r *DbInstanceReconciler) createProxy(ctx context.Context, dbin *kciv1beta1
 
 	return nil
 }
+
+// provision deploys the database server of a generic instance in the cluster,
+// errProvisionInProgress is returned until the server is ready
+func (r *DbInstanceReconciler) provision(ctx context.Context, dbin *kciv1beta1.DbInstance) error {
+	// the admin secret is generated once, an existing secret is used as it is
+	secret := provision.AdminSecret(dbin)
+	err := r.Create(ctx, secret)
+	if err != nil && !k8serrors.IsAlreadyExists(err) {
+		logrus.Errorf("Instance: name=%s failed creating admin secret", dbin.Name)
+		return err
+	}
+
+	svc := provision.Service(dbin)
+	err = r.Create(ctx, svc)
+	if err != nil {
+		if k8serrors.IsAlreadyExists(err) {
+			// if resource already exists, update
+			patch := client.MergeFrom(svc)
+			err = r.Patch(ctx, svc, patch)
+			if err != nil {
+				logrus.Errorf("Instance: name=%s failed patching server service", dbin.Name)
+				return err
+			}
+		} else {
+			logrus.Errorf("Instance: name=%s failed creating server service", dbin.Name)
+			return err
+		}
+	}
+
+	sts, err := provision.StatefulSet(r.Conf, dbin)
+	if err != nil {
+		return err
+	}
+	err = r.Create(ctx, sts)
+	if err != nil {
+		if k8serrors.IsAlreadyExists(err) {
+			// volume claim templates of a statefulset can't be updated
+			existing := &appsv1.StatefulSet{}
+			if err := r.Get(ctx, client.ObjectKeyFromObject(sts), existing); err != nil {
+				return err
+			}
+			existing.Spec.Template = sts.Spec.Template
+			err = r.Update(ctx, existing)
+			if err != nil {
+				logrus.Errorf("Instance: name=%s failed updating server statefulset", dbin.Name)
+				return err
+			}
+			sts = existing
+		} else {
+			logrus.Errorf("Instance: name=%s failed creating server statefulset", dbin.Name)
+			return err
+		}
+	}
+
+	if !provision.IsReady(sts) {
+		return errProvisionInProgress
+	}
+	return nil
+}
+
+// missingFinalizers returns the finalizers which are not set on the instance yet
+func missingFinalizers(dbin *kciv1beta1.DbInstance, finalizers []string) []string {
+	missing := []string{}
+	for _, finalizer := range finalizers {
+		if !containsString(dbin.ObjectMeta.Finalizers, finalizer) {
+			missing = append(missing, finalizer)
+		}
+	}
+	return missing
+}
+
+// delete removes the instance proxy and the instance itself if its deletion policy says so,
+// it's refused while databases use a google instance
+func (r *DbInstanceReconciler) delete(ctx context.Context, dbin *kciv1beta1.DbInstance) error {
+	if dbin.Spec.Google == nil {
+		// instances of other backends may still carry the finalizer, it's removed without a check
+		return r.deleteProxy(ctx, dbin)
+	}
+
+	dbList := &kciv1beta1.DatabaseList{}
+	if err := r.List(ctx, dbList); err != nil {
+		return err
+	}
+	users := []string{}
+	for _, db := range dbList.Items {
+		if db.Spec.Instance == dbin.Name {
+			users = append(users, db.Namespace+"/"+db.Name)
+		}
+	}
+	// replicas can't outlive their master
+	replicas, err := r.replicasOf(ctx, dbin)
+	if err != nil {
+		return err
+	}
+	users = append(users, replicas...)
+	if len(users) > 0 {
+		return fmt.Errorf("%w %s", errInstanceInUse, strings.Join(users, ", "))
+	}
+
+	if err := r.deleteProxy(ctx, dbin); err != nil {
+		return err
+	}
+
+	if dbin.Spec.Google.DeletionPolicy != kciv1beta1.GoogleDeletionPolicyDelete {
+		return nil
+	}
+
+	b, err := backend.For(dbin)
+	if err != nil {
+		return err
+	}
+	source := dbin
+	if dbin.Spec.Google.FinalBackup != nil && dbin.GetAnnotations()[skipFinalBackupAnnotation] == "true" {
+		logrus.Infof("Instance: name=%s deleting without final backup", dbin.Name)
+		source = dbin.DeepCopy()
+		source.Spec.Google.FinalBackup = nil
+	}
+	// the admin user isn't needed to delete the instance, its secret may be gone already
+	env := backend.Env{Client: r.Client, Conf: r.Conf}
+	instance, err := b.Driver.Instance(ctx, env, source, database.AdminCredentials{})
+	if err != nil {
+		return err
+	}
+
+	err = dbinstance.Delete(instance)
+	var pending *dbinstance.OperationInProgressError
+	if errors.As(err, &pending) {
+		dbin.Status.Operation = pending.Operation
+		return err
+	}
+	// the failed operation isn't polled again, the deletion starts over on the next reconcile
+	dbin.Status.Operation = ""
+	if errors.Is(err, dbinstance.ErrFinalBackupFailed) {
+		return fmt.Errorf("%w, set annotation %s to true to delete the instance without it", err, skipFinalBackupAnnotation)
+	}
+	if err != nil {
+		return err
+	}
+	logrus.Infof("Instance: name=%s deleted from backend", dbin.Name)
+	return nil
+}
+
+// reportDeletionBlocked sets the DeletionBlocked condition and records an event with the reason the deletion is refused or failed
+func (r *DbInstanceReconciler) reportDeletionBlocked(ctx context.Context, dbin *kciv1beta1.DbInstance, err error) {
+	condition := metav1.Condition{
+		Type:    kciv1beta1.DbInstanceConditionDeletionBlocked,
+		Status:  metav1.ConditionTrue,
+		Reason:  "DeletionFailed",
+		Message: err.Error(),
+	}
+	switch {
+	case errors.Is(err, errInstanceInUse):
+		condition.Reason = "InUse"
+	case errors.Is(err, dbinstance.ErrFinalBackupFailed):
+		condition.Reason = "FinalBackupFailed"
+	}
+	meta.SetStatusCondition(&dbin.Status.Conditions, condition)
+	if err := r.Status().Update(ctx, dbin); err != nil {
+		logrus.Errorf("Instance: name=%s failed to update status - %s", dbin.Name, err)
+	}
+	r.Recorder.Event(dbin, "Warning", condition.Reason, err.Error())
+}
+
+// deleteProxy removes the instance proxy, it runs in the operator namespace and isn't owned by the instance
+func (r *DbInstanceReconciler) deleteProxy(ctx context.Context, dbin *kciv1beta1.DbInstance) error {
+	if _, err := backend.InstancePort(dbin); err != nil {
+		// the proxy is created after the instance, it doesn't exist without the address of the instance
+		return nil
+	}
+
+	proxyInterface, err := determineProxyTypeForInstance(r.Conf, dbin)
+	if err != nil {
+		if err == ErrNoProxySupport {
+			return nil
+		}
+		return err
+	}
+
+	deploy, err := proxy.BuildDeployment(proxyInterface, nil)
+	if err != nil {
+		return err
+	}
+	if err := r.Delete(ctx, deploy); err != nil && !k8serrors.IsNotFound(err) {
+		logrus.Errorf("Instance: name=%s failed deleting proxy deployment", dbin.Name)
+		return err
+	}
+
+	svc, err := proxy.BuildService(proxyInterface, nil)
+	if err != nil {
+		return err
+	}
+	if err := r.Delete(ctx, svc); err != nil && !k8serrors.IsNotFound(err) {
+		logrus.Errorf("Instance: name=%s failed deleting proxy service", dbin.Name)
+		return err
+	}
+	return nil
+}
+
+// deprovision removes the provisioned database server with its data and the generated admin secret,
+// nothing is removed if the instance retains the server
+func (r *DbInstanceReconciler) deprovision(ctx context.Context, dbin *kciv1beta1.DbInstance) error {
+	if dbin.Spec.Generic == nil || dbin.Spec.Generic.Provision == nil {
+		return nil
+	}
+
+	if dbin.Spec.Generic.Provision.Retain {
+		logrus.Infof("Instance: name=%s provisioned server is retained", dbin.Name)
+		return nil
+	}
+
+	err := r.Delete(ctx, &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: provision.ServerName(dbin), Namespace: provision.Namespace(dbin)}})
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return err
+	}
+
+	err = r.Delete(ctx, &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: provision.ServerName(dbin), Namespace: provision.Namespace(dbin)}})
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return err
+	}
+
+	// volumes of a statefulset are not removed with it
+	err = r.DeleteAllOf(ctx, &corev1.PersistentVolumeClaim{}, client.InNamespace(provision.Namespace(dbin)), client.MatchingLabels(provision.Labels(dbin)))
+	if err != nil {
+		return err
+	}
+
+	secret := &corev1.Secret{}
+	err = r.Get(ctx, dbin.Spec.AdminUserSecret.ToKubernetesType(), secret)
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if provision.IsGeneratedSecret(dbin, secret) {
+		if err := r.Delete(ctx, secret); err != nil && !k8serrors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	logrus.Infof("Instance: name=%s provisioned server removed", dbin.Name)
+	return nil
+}
@@ -0,0 +1,284 @@
+/*
+ * Copyright 2021 kloeckner.i GmbH
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"bou.ke/monkey"
+	kciv1beta1 "github.com/kloeckner-i/db-operator/api/v1beta1"
+	"github.com/kloeckner-i/db-operator/pkg/config"
+	"github.com/kloeckner-i/db-operator/pkg/utils/dbinstance"
+	"github.com/kloeckner-i/db-operator/pkg/utils/kci"
+	"github.com/kloeckner-i/db-operator/pkg/utils/proxy"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestDbInstanceDelete(t *testing.T) {
+	patch := monkey.Patch(getOperatorNamespace, mockOperatorNamespace)
+	defer patch.Unpatch()
+
+	ctx := context.Background()
+	dbin := makeGsqlInstance()
+	dbin.Name = "example-gsql"
+	dbin.Spec.Engine = "postgres"
+
+	db := newPostgresTestDbCr(dbin)
+	db.Name = "app"
+	db.Spec.Instance = dbin.Name
+	deploy := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: "operator", Name: "dbinstance-example-gsql-cloudproxy"}}
+	svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "operator", Name: "dbinstance-example-gsql-svc"}}
+	scheme := runtime.NewScheme()
+	assert.NoError(t, clientgoscheme.AddToScheme(scheme))
+	assert.NoError(t, kciv1beta1.AddToScheme(scheme))
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(db, deploy, svc).Build()
+
+	r := &DbInstanceReconciler{Client: c, Conf: &config.Config{}}
+	err := r.delete(ctx, &dbin)
+	assert.ErrorIs(t, err, errInstanceInUse)
+	assert.Contains(t, err.Error(), db.Namespace+"/"+db.Name)
+	assert.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(deploy), &appsv1.Deployment{}), "proxy is kept while the instance is used")
+
+	assert.NoError(t, c.Delete(ctx, db))
+	// the cloud sql instance is retained by default, only the proxy is removed
+	assert.NoError(t, r.delete(ctx, &dbin))
+	assert.True(t, k8serrors.IsNotFound(c.Get(ctx, client.ObjectKeyFromObject(deploy), &appsv1.Deployment{})))
+	assert.True(t, k8serrors.IsNotFound(c.Get(ctx, client.ObjectKeyFromObject(svc), &corev1.Service{})))
+	assert.NoError(t, r.delete(ctx, &dbin), "removed proxy is ignored")
+}
+
+func TestReportDeletionBlocked(t *testing.T) {
+	ctx := context.Background()
+	dbin := makeGsqlInstance()
+	dbin.Name = "example-gsql"
+	scheme := runtime.NewScheme()
+	assert.NoError(t, kciv1beta1.AddToScheme(scheme))
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(&dbin).Build()
+	recorder := record.NewFakeRecorder(2)
+
+	r := &DbInstanceReconciler{Client: c, Conf: &config.Config{}, Recorder: recorder}
+	r.reportDeletionBlocked(ctx, &dbin, fmt.Errorf("%w app/db", errInstanceInUse))
+	condition := meta.FindStatusCondition(dbin.Status.Conditions, kciv1beta1.DbInstanceConditionDeletionBlocked)
+	assert.Equal(t, "InUse", condition.Reason)
+	assert.Contains(t, <-recorder.Events, "Warning InUse")
+
+	r.reportDeletionBlocked(ctx, &dbin, fmt.Errorf("%w - bucket not writable", dbinstance.ErrFinalBackupFailed))
+	stored := &kciv1beta1.DbInstance{}
+	assert.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(&dbin), stored))
+	condition = meta.FindStatusCondition(stored.Status.Conditions, kciv1beta1.DbInstanceConditionDeletionBlocked)
+	assert.Equal(t, "FinalBackupFailed", condition.Reason)
+	assert.Contains(t, condition.Message, "bucket not writable")
+	assert.Contains(t, <-recorder.Events, "Warning FinalBackupFailed")
+}
+
+func TestDbInstanceDeleteGeneric(t *testing.T) {
+	patch := monkey.Patch(getOperatorNamespace, mockOperatorNamespace)
+	defer patch.Unpatch()
+
+	ctx := context.Background()
+	dbin := makeGenericInstance()
+	dbin.Name = "example-generic"
+	db := newPostgresTestDbCr(dbin)
+	db.Name = "app"
+	db.Spec.Instance = dbin.Name
+	scheme := runtime.NewScheme()
+	assert.NoError(t, clientgoscheme.AddToScheme(scheme))
+	assert.NoError(t, kciv1beta1.AddToScheme(scheme))
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(db).Build()
+
+	// only the deletion of google instances waits for their databases
+	r := &DbInstanceReconciler{Client: c, Conf: &config.Config{}}
+	assert.NoError(t, r.delete(ctx, &dbin))
+}
+
+func TestMissingFinalizers(t *testing.T) {
+	dbin := &kciv1beta1.DbInstance{}
+	dbin.Finalizers = []string{provisionFinalizer}
+	assert.Equal(t, []string{instanceFinalizer}, missingFinalizers(dbin, []string{instanceFinalizer, provisionFinalizer}))
+	assert.Empty(t, missingFinalizers(dbin, []string{provisionFinalizer}))
+}
+
+func TestLinkInstances(t *testing.T) {
+	ctx := context.Background()
+	master := makeGsqlInstance()
+	master.Name = "master"
+	replica := makeGsqlInstance()
+	replica.Name = "replica"
+	replica.Spec.Google.MasterInstanceName = master.Name
+	clone := makeGsqlInstance()
+	clone.Name = "clone"
+	clone.Spec.Google.CloneOf = &kciv1beta1.GoogleClone{Instance: master.Name}
+	scheme := runtime.NewScheme()
+	assert.NoError(t, kciv1beta1.AddToScheme(scheme))
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(&master, &replica, &clone).Build()
+
+	r := &DbInstanceReconciler{Client: c, Conf: &config.Config{}}
+	assert.NoError(t, r.linkInstances(ctx, &master))
+	assert.Equal(t, []string{"replica"}, master.Status.Replicas)
+	assert.Empty(t, master.Status.MasterInstance)
+
+	assert.NoError(t, r.linkInstances(ctx, &replica))
+	assert.Equal(t, "master", replica.Status.MasterInstance)
+	assert.Empty(t, replica.Status.Replicas)
+
+	assert.NoError(t, r.linkInstances(ctx, &clone))
+	assert.Equal(t, "master", clone.Status.ClonedFrom)
+
+	// replicas can't outlive their master
+	err := r.delete(ctx, &master)
+	assert.ErrorIs(t, err, errInstanceInUse)
+	assert.Contains(t, err.Error(), "replica")
+}
+
+func TestRequestsForMaster(t *testing.T) {
+	replica := makeGsqlInstance()
+	replica.Spec.Google.MasterInstanceName = "master"
+	requests := requestsForMaster(&replica)
+	assert.Len(t, requests, 1)
+	assert.Equal(t, "master", requests[0].Name)
+
+	// the previous master is updated after a promotion, the spec may still name it
+	replica.Status.PromotedFrom = "master"
+	replica.Status.MasterInstance = "master"
+	requests = requestsForMaster(&replica)
+	assert.Len(t, requests, 1)
+	assert.Equal(t, "master", requests[0].Name)
+
+	assert.Empty(t, requestsForMaster(&corev1.Service{}))
+}
+
+func TestBackupRunDue(t *testing.T) {
+	dbin := makeGsqlInstance()
+	now, _ := time.Parse(time.RFC3339, "2022-06-01T12:00:00Z")
+	assert.False(t, backupRunDue(&dbin, now), "backup runs aren't scheduled")
+
+	dbin.Spec.Google.BackupRuns = &kciv1beta1.GoogleBackupRuns{Interval: metav1.Duration{Duration: 6 * time.Hour}}
+	dbin.Status.BackupRuns = []kciv1beta1.GoogleBackupRunStatus{
+		{ID: 3, Type: "AUTOMATED", Status: "SUCCESSFUL", EnqueuedTime: "2022-06-01T11:00:00Z"},
+	}
+	assert.True(t, backupRunDue(&dbin, now), "automated runs don't count")
+
+	dbin.Status.BackupRuns = append(dbin.Status.BackupRuns,
+		kciv1beta1.GoogleBackupRunStatus{ID: 2, Type: "ON_DEMAND", Status: "RUNNING", EnqueuedTime: "2022-06-01T08:00:00Z"},
+		kciv1beta1.GoogleBackupRunStatus{ID: 1, Type: "ON_DEMAND", Status: "SUCCESSFUL", EnqueuedTime: "2022-06-01T02:00:00Z"},
+	)
+	assert.False(t, backupRunDue(&dbin, now))
+	assert.True(t, backupRunDue(&dbin, now.Add(2*time.Hour)))
+}
+
+func TestBackupRunsListDue(t *testing.T) {
+	dbin := makeGsqlInstance()
+	now, _ := time.Parse(time.RFC3339, "2022-06-01T12:00:00Z")
+	assert.True(t, backupRunsListDue(&dbin, now, time.Minute), "backup runs weren't listed yet")
+
+	dbin.Status.BackupRunsListedAt = &metav1.Time{Time: now}
+	assert.False(t, backupRunsListDue(&dbin, now.Add(30*time.Second), time.Minute))
+	assert.True(t, backupRunsListDue(&dbin, now.Add(time.Minute), time.Minute))
+}
+
+func TestCheckAccessSecrets(t *testing.T) {
+	ctx := context.Background()
+	dbin := makeGsqlInstance()
+	dbin.Name = "example-gsql"
+	dbin.Spec.Google.ClientSecret = kciv1beta1.NamespacedName{Namespace: "operator", Name: "gsql-credentials"}
+	source := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "operator", Name: "gsql-credentials"},
+		Data:       map[string][]byte{"credentials.json": []byte("old")},
+	}
+
+	app := newPostgresTestDbCr(dbin)
+	app.Name = "app"
+	app.Spec.Instance = dbin.Name
+	worker := newPostgresTestDbCr(dbin)
+	worker.Name = "worker"
+	worker.Spec.Instance = dbin.Name
+	iam := newPostgresTestDbCr(dbin)
+	iam.Name = "iam"
+	iam.Spec.Instance = dbin.Name
+	iam.Spec.IAMAuth = &kciv1beta1.DatabaseIAMAuth{ServiceAccount: "iam@test.iam.gserviceaccount.com", CredentialsSecret: "iam-key"}
+	copied := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: app.Namespace, Name: app.InstanceAccessSecretName()},
+		Data:       map[string][]byte{"credentials.json": []byte("old")},
+	}
+	objects := []client.Object{&dbin, source, app, worker, iam, copied}
+	for _, db := range []*kciv1beta1.Database{app, worker, iam} {
+		objects = append(objects, &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: db.Namespace, Name: "db-" + db.Name + "-cloudproxy"}})
+	}
+	scheme := runtime.NewScheme()
+	assert.NoError(t, clientgoscheme.AddToScheme(scheme))
+	assert.NoError(t, kciv1beta1.AddToScheme(scheme))
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build()
+	r := &DbInstanceReconciler{Client: c, Conf: &config.Config{}}
+	patchGetOperatorNamespace := monkey.Patch(getOperatorNamespace, mockOperatorNamespace)
+	defer patchGetOperatorNamespace.Unpatch()
+
+	proxyChecksum := func(db *kciv1beta1.Database) string {
+		deploy := &appsv1.Deployment{}
+		assert.NoError(t, c.Get(ctx, client.ObjectKey{Namespace: db.Namespace, Name: "db-" + db.Name + "-cloudproxy"}, deploy))
+		return deploy.Spec.Template.Annotations[proxy.AccessSecretChecksumAnnotation]
+	}
+
+	// the first sync records the checksum of the credentials in use
+	changed, err := r.checkAccessSecrets(ctx, &dbin)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+	assert.Equal(t, kci.GenerateChecksum([]byte("old")), dbin.Status.AccessSecretChecksum)
+	assert.Equal(t, kci.GenerateChecksum([]byte("old")), proxyChecksum(app))
+
+	source.Data["credentials.json"] = []byte("new")
+	assert.NoError(t, c.Update(ctx, source))
+	changed, err = r.checkAccessSecrets(ctx, &dbin)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	checksum := kci.GenerateChecksum([]byte("new"))
+	assert.Equal(t, checksum, dbin.Status.AccessSecretChecksum)
+	assert.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(copied), copied))
+	assert.Equal(t, []byte("new"), copied.Data["credentials.json"])
+	assert.Equal(t, checksum, proxyChecksum(app))
+	assert.Equal(t, checksum, proxyChecksum(worker), "databases sharing the secret are restarted too")
+	assert.Empty(t, proxyChecksum(iam), "iam proxies don't mount the instance credentials")
+	instanceProxy := &appsv1.Deployment{}
+	assert.NoError(t, c.Get(ctx, client.ObjectKey{Namespace: "operator", Name: "dbinstance-" + dbin.Name + "-cloudproxy"}, instanceProxy))
+	assert.Equal(t, checksum, instanceProxy.Spec.Template.Annotations[proxy.AccessSecretChecksumAnnotation])
+
+	changed, err = r.checkAccessSecrets(ctx, &dbin)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	// a proxy missed by a failed sync is restarted although its secret is already up to date
+	source.Data["credentials.json"] = []byte("newer")
+	assert.NoError(t, c.Update(ctx, source))
+	copied.Data = map[string][]byte{"credentials.json": []byte("newer")}
+	assert.NoError(t, c.Update(ctx, copied))
+	changed, err = r.checkAccessSecrets(ctx, &dbin)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, kci.GenerateChecksum([]byte("newer")), proxyChecksum(app))
+}
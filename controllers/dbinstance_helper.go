@@ -0,0 +1,71 @@
+/*
+ * Copyright 2021 kloeckner.i GmbH
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controllers
+
+import (
+	"context"
+	"os"
+
+	kciv1beta1 "github.com/kloeckner-i/db-operator/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// instanceAccessCredentialsKey is the key of the google credentials in the access secrets
+const instanceAccessCredentialsKey = "credentials.json"
+
+// instanceAccessCredentials returns the google credentials of the instance,
+// they're read from the client secret of the instance or the file of GCSQL_CLIENT_CREDENTIALS
+func instanceAccessCredentials(ctx context.Context, c client.Reader, dbin *kciv1beta1.DbInstance) ([]byte, error) {
+	if dbin.Spec.Google.ClientSecret.Name == "" {
+		return os.ReadFile(os.Getenv("GCSQL_CLIENT_CREDENTIALS"))
+	}
+
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, dbin.Spec.Google.ClientSecret.ToKubernetesType(), secret); err != nil {
+		return nil, err
+	}
+	return secret.Data[instanceAccessCredentialsKey], nil
+}
+
+// instancesForAccessSecret returns the names of the google instances reading their credentials from the secret
+func instancesForAccessSecret(instances []kciv1beta1.DbInstance, namespace, name string) []string {
+	names := []string{}
+	for _, dbin := range instances {
+		if dbin.Spec.Google == nil {
+			continue
+		}
+		if dbin.Spec.Google.ClientSecret.Namespace == namespace && dbin.Spec.Google.ClientSecret.Name == name {
+			names = append(names, dbin.Name)
+		}
+	}
+	return names
+}
+
+// instancesForService returns the names of the generic instances referencing the service
+func instancesForService(instances []kciv1beta1.DbInstance, namespace, name string) []string {
+	names := []string{}
+	for _, dbin := range instances {
+		if dbin.Spec.Generic == nil || dbin.Spec.Generic.ServiceRef == nil {
+			continue
+		}
+		if dbin.Spec.Generic.ServiceRef.Namespace == namespace && dbin.Spec.Generic.ServiceRef.Name == name {
+			names = append(names, dbin.Name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,53 @@
+/*
+ * Copyright 2021 kloeckner.i GmbH
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controllers
+
+import (
+	"testing"
+
+	kciv1beta1 "github.com/kloeckner-i/db-operator/api/v1beta1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstancesForService(t *testing.T) {
+	instances := []kciv1beta1.DbInstance{
+		makeGenericInstance(),
+		makeGenericInstance(),
+		makeGsqlInstance(),
+	}
+	instances[0].Name = "referencing"
+	instances[0].Spec.Generic.ServiceRef = &kciv1beta1.ServiceReference{Namespace: "databases", Name: "postgres"}
+	instances[1].Name = "other"
+	instances[1].Spec.Generic.ServiceRef = &kciv1beta1.ServiceReference{Namespace: "databases", Name: "mysql"}
+
+	assert.Equal(t, []string{"referencing"}, instancesForService(instances, "databases", "postgres"))
+	assert.Empty(t, instancesForService(instances, "default", "postgres"))
+}
+
+func TestInstancesForAccessSecret(t *testing.T) {
+	instances := []kciv1beta1.DbInstance{
+		makeGsqlInstance(),
+		makeGsqlInstance(),
+		makeGenericInstance(),
+	}
+	instances[0].Name = "referencing"
+	instances[0].Spec.Google.ClientSecret = kciv1beta1.NamespacedName{Namespace: "operator", Name: "gsql-credentials"}
+	instances[1].Name = "default-credentials"
+
+	assert.Equal(t, []string{"referencing"}, instancesForAccessSecret(instances, "operator", "gsql-credentials"))
+	assert.Empty(t, instancesForAccessSecret(instances, "default", "gsql-credentials"))
+}
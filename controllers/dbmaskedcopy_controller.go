@@ -0,0 +1,353 @@
+/*
+ * Copyright 2021 kloeckner.i GmbH
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	kciv1beta1 "github.com/kloeckner-i/db-operator/api/v1beta1"
+	"github.com/kloeckner-i/db-operator/pkg/config"
+	"github.com/kloeckner-i/db-operator/pkg/utils/database"
+	"github.com/kloeckner-i/db-operator/pkg/utils/kci"
+	"github.com/sirupsen/logrus"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// DbMaskedCopyReconciler reconciles a DbMaskedCopy object
+type DbMaskedCopyReconciler struct {
+	client.Client
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	Interval time.Duration
+	Conf     *config.Config
+}
+
+var (
+	maskedCopyPhaseCopy  = "Copying"
+	maskedCopyPhaseMask  = "Masking"
+	maskedCopyPhaseReady = "Ready"
+)
+
+const (
+	// maskingPendingAnnotation holds the credentials and secrets of the target Database back until the masking rules are applied
+	maskingPendingAnnotation = "db-operator/masking-pending"
+	maskingSaltKey           = "SALT"
+)
+
+//+kubebuilder:rbac:groups=kci.rocks,resources=dbmaskedcopies,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=kci.rocks,resources=dbmaskedcopies/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch;delete
+
+// Reconcile creates the target Database of a DbMaskedCopy,
+// waits until the content of the source is copied and applies the masking rules once.
+func (r *DbMaskedCopyReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	_ = r.Log.WithValues("dbmaskedcopy", req.NamespacedName)
+
+	reconcilePeriod := r.Interval * time.Second
+	reconcileResult := reconcile.Result{RequeueAfter: reconcilePeriod}
+
+	mc := &kciv1beta1.DbMaskedCopy{}
+	err := r.Get(ctx, req.NamespacedName, mc)
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			// Requested object not found, the target database is garbage collected
+			return reconcileResult, nil
+		}
+		return reconcileResult, err
+	}
+
+	if mc.Status.Status {
+		// masking rules are applied only once, the target is released afterwards
+		if err := r.releaseTarget(ctx, mc); err != nil {
+			logrus.Errorf("DbMaskedCopy: namespace=%s, name=%s failed releasing target database - %s", mc.Namespace, mc.Name, err)
+			return reconcile.Result{RequeueAfter: 10 * time.Second}, nil
+		}
+		return reconcileResult, nil
+	}
+
+	// Update object status always when function exit abnormally or through a panic.
+	defer func() {
+		if err := r.Status().Update(ctx, mc); err != nil {
+			logrus.Errorf("failed to update status - %s", err)
+		}
+	}()
+
+	mc.Status.Phase = maskedCopyPhaseCopy
+	target, err := r.getTargetDatabase(ctx, mc)
+	if err != nil {
+		return r.manageError(mc, err)
+	}
+	if target.Status.Phase != dbPhaseMaskingPending || target.Status.ClonedFrom == "" {
+		logrus.Infof("DbMaskedCopy: namespace=%s, name=%s waiting for database %s to be copied", mc.Namespace, mc.Name, target.Name)
+		return reconcile.Result{RequeueAfter: 10 * time.Second}, nil
+	}
+
+	mc.Status.Phase = maskedCopyPhaseMask
+	results, err := r.applyMasking(ctx, mc, target)
+	if errors.Is(err, database.ErrRequestInProgress) {
+		logrus.Infof("DbMaskedCopy: namespace=%s, name=%s waiting for executor job", mc.Namespace, mc.Name)
+		return reconcile.Result{RequeueAfter: executorRequeueInterval}, nil
+	}
+	mc.Status.Report = maskingReport(results)
+	if err != nil {
+		return r.manageError(mc, err)
+	}
+
+	now := metav1.Now()
+	mc.Status.MaskedAt = &now
+	mc.Status.Phase = maskedCopyPhaseReady
+	mc.Status.Status = true
+	r.Recorder.Event(mc, "Normal", "Masked", fmt.Sprintf("%d masking rules applied on database %s", len(results), target.Name))
+	logrus.Infof("DbMaskedCopy: namespace=%s, name=%s masking rules applied", mc.Namespace, mc.Name)
+
+	if err := r.releaseTarget(ctx, mc); err != nil {
+		logrus.Errorf("DbMaskedCopy: namespace=%s, name=%s failed releasing target database - %s", mc.Namespace, mc.Name, err)
+		return reconcile.Result{RequeueAfter: 10 * time.Second}, nil
+	}
+	return reconcileResult, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *DbMaskedCopyReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&kciv1beta1.DbMaskedCopy{}).
+		Owns(&kciv1beta1.Database{}).
+		Watches(&source.Kind{Type: &batchv1.Job{}}, handler.EnqueueRequestsFromMapFunc(requestsForExecutorJob("DbMaskedCopy"))).
+		Complete(r)
+}
+
+// getTargetDatabase returns the target Database of the masked copy and creates it if it doesn't exist yet.
+// Masking rules are only applied on a Database controlled by the masked copy,
+// to never anonymize a database which is used by someone else.
+func (r *DbMaskedCopyReconciler) getTargetDatabase(ctx context.Context, mc *kciv1beta1.DbMaskedCopy) (*kciv1beta1.Database, error) {
+	target := &kciv1beta1.Database{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: mc.Namespace, Name: mc.Spec.Target.Name}, target)
+	if err != nil {
+		if !k8serrors.IsNotFound(err) {
+			return nil, err
+		}
+
+		target = buildMaskedCopyTarget(mc)
+		err = controllerutil.SetControllerReference(mc, target, r.Scheme)
+		if err != nil {
+			return nil, err
+		}
+		err = r.Create(ctx, target)
+		if err != nil {
+			logrus.Errorf("DbMaskedCopy: namespace=%s, name=%s failed creating target database", mc.Namespace, mc.Name)
+			return nil, err
+		}
+		logrus.Infof("DbMaskedCopy: namespace=%s, name=%s target database %s created", mc.Namespace, mc.Name, target.Name)
+		return target, nil
+	}
+
+	if !metav1.IsControlledBy(target, mc) {
+		return nil, fmt.Errorf("database %s already exists and is not controlled by this masked copy", target.Name)
+	}
+	return target, nil
+}
+
+// releaseTarget removes the masking pending annotation, the target Database gets ready afterwards
+func (r *DbMaskedCopyReconciler) releaseTarget(ctx context.Context, mc *kciv1beta1.DbMaskedCopy) error {
+	target := &kciv1beta1.Database{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: mc.Namespace, Name: mc.Spec.Target.Name}, target)
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if !isMaskingPending(target) || !metav1.IsControlledBy(target, mc) {
+		return nil
+	}
+
+	delete(target.Annotations, maskingPendingAnnotation)
+	return r.Update(ctx, target)
+}
+
+// maskingSalt returns the random salt of the hashed values of the copy, it's generated once
+// and kept in a secret so that retried masking requests stay the same
+func (r *DbMaskedCopyReconciler) maskingSalt(ctx context.Context, mc *kciv1beta1.DbMaskedCopy) (string, error) {
+	secret := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: mc.Namespace, Name: maskingSaltSecretName(mc)}, secret)
+	if err == nil {
+		return string(secret.Data[maskingSaltKey]), nil
+	}
+	if !k8serrors.IsNotFound(err) {
+		return "", err
+	}
+
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	secret = kci.SecretBuilder(maskingSaltSecretName(mc), mc.Namespace, map[string][]byte{maskingSaltKey: []byte(hex.EncodeToString(salt))}, nil)
+	if err := controllerutil.SetControllerReference(mc, secret, r.Scheme); err != nil {
+		return "", err
+	}
+	if err := r.Create(ctx, secret); err != nil {
+		logrus.Errorf("DbMaskedCopy: namespace=%s, name=%s failed creating masking salt secret", mc.Namespace, mc.Name)
+		return "", err
+	}
+	return string(secret.Data[maskingSaltKey]), nil
+}
+
+func (r *DbMaskedCopyReconciler) applyMasking(ctx context.Context, mc *kciv1beta1.DbMaskedCopy, target *kciv1beta1.Database) ([]database.MaskingResult, error) {
+	cred := database.Credentials{
+		Name:     target.Status.DatabaseName,
+		Username: target.Status.UserName,
+	}
+	db, err := connectableDatabase(ctx, r, target, cred)
+	if err != nil {
+		return nil, err
+	}
+
+	instance, err := target.GetInstanceRef()
+	if err != nil {
+		return nil, err
+	}
+	adminSecret := &corev1.Secret{}
+	err = r.Get(ctx, instance.Spec.AdminUserSecret.ToKubernetesType(), adminSecret)
+	if err != nil {
+		return nil, err
+	}
+	adminCred, err := db.ParseAdminCredentials(adminSecret.Data)
+	if err != nil {
+		return nil, err
+	}
+	adminCred, err = instanceAdminCredentials(instance, adminCred)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := database.NewRequest(database.OpMask, db, adminCred)
+	if err != nil {
+		return nil, err
+	}
+	req.Rules = maskingRules(mc)
+	req.MaskingSalt, err = r.maskingSalt(ctx, mc)
+	if err != nil {
+		return nil, err
+	}
+	result := newExecutor(ctx, r.Client, r.Conf, instance, mc).Execute(req)
+	return result.MaskingResults(), result.Err()
+}
+
+func (r *DbMaskedCopyReconciler) manageError(mc *kciv1beta1.DbMaskedCopy, issue error) (reconcile.Result, error) {
+	mc.Status.Status = false
+	logrus.Errorf("DbMaskedCopy: namespace=%s, name=%s failed %s - %s", mc.Namespace, mc.Name, mc.Status.Phase, issue)
+	r.Recorder.Event(mc, "Warning", "Failed"+mc.Status.Phase, issue.Error())
+
+	return reconcile.Result{RequeueAfter: 60 * time.Second}, nil
+}
+
+func buildMaskedCopyTarget(mc *kciv1beta1.DbMaskedCopy) *kciv1beta1.Database {
+	source := mc.Spec.Source
+	return &kciv1beta1.Database{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        mc.Spec.Target.Name,
+			Namespace:   mc.Namespace,
+			Annotations: map[string]string{maskingPendingAnnotation: "true"},
+		},
+		Spec: kciv1beta1.DatabaseSpec{
+			SecretName: mc.Spec.Target.SecretName,
+			Instance:   mc.Spec.Target.Instance,
+			Cleanup:    mc.Spec.Target.Cleanup,
+			DataSource: &source,
+		},
+	}
+}
+
+func maskingSaltSecretName(mc *kciv1beta1.DbMaskedCopy) string {
+	return mc.Name + "-masking-salt"
+}
+
+// heldSecretName returns the name of the secret keeping the credentials of a database while its content is masked
+func heldSecretName(dbcr *kciv1beta1.Database) string {
+	return dbcr.Name + "-masking-credentials"
+}
+
+// databaseSecretName returns the secret with the credentials of the database, they're held back
+// from spec.secretName until the masking rules are applied, so apps can't read the content before
+func databaseSecretName(dbcr *kciv1beta1.Database) string {
+	if isMaskingPending(dbcr) {
+		return heldSecretName(dbcr)
+	}
+	return dbcr.Spec.SecretName
+}
+
+// isMaskingPending returns true if the content of the database must be masked before it's used
+func isMaskingPending(dbcr *kciv1beta1.Database) bool {
+	_, ok := dbcr.Annotations[maskingPendingAnnotation]
+	return ok
+}
+
+// maskingRules converts masked tables of the spec to rules executed on the database
+func maskingRules(mc *kciv1beta1.DbMaskedCopy) []database.MaskingRule {
+	rules := []database.MaskingRule{}
+	for _, table := range mc.Spec.Masking {
+		if table.Truncate {
+			rules = append(rules, database.MaskingRule{Table: table.Table, Strategy: database.MaskTruncate})
+			continue
+		}
+		for _, column := range table.Columns {
+			rules = append(rules, database.MaskingRule{
+				Table:    table.Table,
+				Column:   column.Name,
+				Strategy: column.Strategy,
+				Value:    column.Value,
+			})
+		}
+	}
+	return rules
+}
+
+func maskingReport(results []database.MaskingResult) []kciv1beta1.MaskingReport {
+	report := []kciv1beta1.MaskingReport{}
+	for _, result := range results {
+		entry := kciv1beta1.MaskingReport{
+			Table:        result.Rule.Table,
+			Column:       result.Rule.Column,
+			Strategy:     result.Rule.Strategy,
+			RowsAffected: result.RowsAffected,
+		}
+		if result.Err != nil {
+			entry.Error = result.Err.Error()
+		}
+		report = append(report, entry)
+	}
+	return report
+}
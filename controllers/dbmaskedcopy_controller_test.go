@@ -0,0 +1,116 @@
+/*
+ * Copyright 2021 kloeckner.i GmbH
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	kciv1beta1 "github.com/kloeckner-i/db-operator/api/v1beta1"
+	"github.com/kloeckner-i/db-operator/pkg/utils/database"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+func newTestMaskedCopy() *kciv1beta1.DbMaskedCopy {
+	mc := &kciv1beta1.DbMaskedCopy{}
+	mc.Namespace = TestNamespace
+	mc.Name = "masked"
+	mc.Spec.Source = kciv1beta1.DatabaseDataSource{Namespace: "production", Name: "app"}
+	mc.Spec.Target = kciv1beta1.DbMaskedCopyTarget{Name: "app-masked", Instance: "staging", SecretName: "app-masked-credentials"}
+	mc.Spec.Masking = []kciv1beta1.MaskedTable{
+		{
+			Table: "users",
+			Columns: []kciv1beta1.MaskedColumn{
+				{Name: "email", Strategy: "fakeEmail"},
+				{Name: "name", Strategy: "fixed", Value: "john"},
+			},
+		},
+		{
+			Table:    "sessions",
+			Truncate: true,
+			Columns:  []kciv1beta1.MaskedColumn{{Name: "token", Strategy: "hash"}},
+		},
+	}
+	return mc
+}
+
+func TestMaskingRules(t *testing.T) {
+	rules := maskingRules(newTestMaskedCopy())
+	expected := []database.MaskingRule{
+		{Table: "users", Column: "email", Strategy: database.MaskFakeEmail},
+		{Table: "users", Column: "name", Strategy: database.MaskFixed, Value: "john"},
+		{Table: "sessions", Strategy: database.MaskTruncate},
+	}
+	assert.Equal(t, expected, rules)
+}
+
+func TestMaskingReport(t *testing.T) {
+	results := []database.MaskingResult{
+		{Rule: database.MaskingRule{Table: "users", Column: "email", Strategy: database.MaskHash}, RowsAffected: 3},
+		{Rule: database.MaskingRule{Table: "missing", Strategy: database.MaskTruncate}, Err: errors.New("relation does not exist")},
+	}
+	report := maskingReport(results)
+	assert.Len(t, report, 2)
+	assert.Equal(t, int64(3), report[0].RowsAffected)
+	assert.Equal(t, "", report[0].Error)
+	assert.Equal(t, "relation does not exist", report[1].Error)
+}
+
+func TestBuildMaskedCopyTarget(t *testing.T) {
+	target := buildMaskedCopyTarget(newTestMaskedCopy())
+	assert.Equal(t, "app-masked", target.Name)
+	assert.Equal(t, TestNamespace, target.Namespace)
+	assert.Equal(t, "staging", target.Spec.Instance)
+	assert.Equal(t, "app-masked-credentials", target.Spec.SecretName)
+	assert.Equal(t, "production", target.Spec.DataSource.Namespace)
+	assert.Equal(t, "app", target.Spec.DataSource.Name)
+	assert.True(t, isMaskingPending(target))
+}
+
+func TestMaskedCopyReleaseTarget(t *testing.T) {
+	ctx := context.Background()
+	mc := newTestMaskedCopy()
+	mc.UID = "masked-uid"
+	scheme := runtime.NewScheme()
+	assert.NoError(t, clientgoscheme.AddToScheme(scheme))
+	assert.NoError(t, kciv1beta1.AddToScheme(scheme))
+
+	target := buildMaskedCopyTarget(mc)
+	assert.NoError(t, controllerutil.SetControllerReference(mc, target, scheme))
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(mc, target).Build()
+	r := &DbMaskedCopyReconciler{Client: c, Scheme: scheme}
+
+	salt, err := r.maskingSalt(ctx, mc)
+	assert.NoError(t, err)
+	assert.Len(t, salt, 64)
+	// the salt is generated once
+	again, err := r.maskingSalt(ctx, mc)
+	assert.NoError(t, err)
+	assert.Equal(t, salt, again)
+
+	assert.NoError(t, r.releaseTarget(ctx, mc))
+	released := &kciv1beta1.Database{}
+	assert.NoError(t, c.Get(ctx, types.NamespacedName{Namespace: mc.Namespace, Name: target.Name}, released))
+	assert.False(t, isMaskingPending(released))
+	assert.NoError(t, r.releaseTarget(ctx, mc))
+}
@@ -0,0 +1,218 @@
+/*
+ * Copyright 2021 kloeckner.i GmbH
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	kciv1beta1 "github.com/kloeckner-i/db-operator/api/v1beta1"
+	"github.com/kloeckner-i/db-operator/controllers/executor"
+	"github.com/kloeckner-i/db-operator/pkg/backend"
+	"github.com/kloeckner-i/db-operator/pkg/config"
+	"github.com/kloeckner-i/db-operator/pkg/utils/database"
+	"github.com/kloeckner-i/db-operator/pkg/utils/kci"
+	"github.com/sirupsen/logrus"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// executorRequeueInterval is the fallback to poll a pending request, the requester is reconciled when the job finishes
+	executorRequeueInterval = 30 * time.Second
+	// executorRequesterAnnotation is the kind, namespace and name of the resource waiting for the result of an executor job
+	executorRequesterAnnotation = "db-operator/executor-requester"
+)
+
+//+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;delete
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch;delete
+
+// jobExecutor runs requests in executor jobs scheduled near the database server,
+// the result is pending until the job finished
+type jobExecutor struct {
+	ctx       context.Context
+	client    client.Client
+	conf      *config.Config
+	dbin      *kciv1beta1.DbInstance
+	requester string
+}
+
+// newExecutor returns the executor of the instance, requests are run in the operator pod unless spec.executor is defined,
+// the backend may run them through its api instead. The requester is reconciled when an executor job finishes.
+func newExecutor(ctx context.Context, c client.Client, conf *config.Config, dbin *kciv1beta1.DbInstance, requester client.Object) database.Executor {
+	var executor database.Executor = database.LocalExecutor{}
+	if dbin.Spec.Executor != nil {
+		executor = &jobExecutor{ctx: ctx, client: c, conf: conf, dbin: dbin, requester: executorRequester(requester)}
+	}
+	if b, err := backend.For(dbin); err == nil && b.Executor != nil {
+		return b.Executor.Executor(dbin, executor)
+	}
+	return executor
+}
+
+// executorRequester returns the value of the requester annotation of executor jobs started for obj
+func executorRequester(obj client.Object) string {
+	kind := ""
+	switch obj.(type) {
+	case *kciv1beta1.Database:
+		kind = "Database"
+	case *kciv1beta1.DbInstance:
+		kind = "DbInstance"
+	case *kciv1beta1.DbMaskedCopy:
+		kind = "DbMaskedCopy"
+	}
+	return kind + "/" + obj.GetNamespace() + "/" + obj.GetName()
+}
+
+// requestsForExecutorJob returns the map function reconciling the requester of kind when its executor job changes
+func requestsForExecutorJob(kind string) handler.MapFunc {
+	return func(obj client.Object) []reconcile.Request {
+		parts := strings.SplitN(obj.GetAnnotations()[executorRequesterAnnotation], "/", 3)
+		if len(parts) != 3 || parts[0] != kind {
+			return nil
+		}
+		return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: parts[1], Name: parts[2]}}}
+	}
+}
+
+// isExecutorJob returns true if obj is a job started by an executor
+func isExecutorJob(obj client.Object) bool {
+	_, ok := obj.GetAnnotations()[executorRequesterAnnotation]
+	return ok
+}
+
+// Execute implements database.Executor
+func (e *jobExecutor) Execute(req database.Request) database.Result {
+	result, err := e.run(req)
+	if err != nil {
+		logrus.Errorf("Instance: name=%s failed running %s in executor job - %s", e.dbin.Name, req.Operation, err)
+		return database.ErrorResult(err)
+	}
+	return result
+}
+
+// jobName returns the name of the job running the request, the same request of the same requester
+// finds its job on the next reconcile
+func (e *jobExecutor) jobName(req database.Request) (string, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(append([]byte(e.requester+"\n"), data...))
+	return e.dbin.Name + "-executor-" + hex.EncodeToString(hash[:5]), nil
+}
+
+func (e *jobExecutor) run(req database.Request) (database.Result, error) {
+	name, err := e.jobName(req)
+	if err != nil {
+		return database.Result{}, err
+	}
+
+	job := &batchv1.Job{}
+	err = e.client.Get(e.ctx, types.NamespacedName{Namespace: e.dbin.Spec.Executor.Namespace, Name: name}, job)
+	if k8serrors.IsNotFound(err) {
+		return database.PendingResult(), e.start(name, req)
+	}
+	if err != nil {
+		return database.Result{}, err
+	}
+
+	finished, failed := kci.IsJobFinished(job)
+	// the job of the previous identical request is still being removed
+	if !finished || job.GetDeletionTimestamp() != nil {
+		return database.PendingResult(), nil
+	}
+
+	secret := &corev1.Secret{}
+	err = e.client.Get(e.ctx, types.NamespacedName{Namespace: job.Namespace, Name: executor.ResultSecretName(job.Name)}, secret)
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return database.Result{}, err
+	}
+	result, ok := executor.Result(secret)
+
+	// the secrets are removed with the job
+	err = e.client.Delete(e.ctx, job, client.PropagationPolicy(metav1.DeletePropagationBackground))
+	if err != nil && !k8serrors.IsNotFound(err) {
+		logrus.Warnf("Instance: name=%s failed deleting executor job %s - %s", e.dbin.Name, name, err)
+	}
+
+	if !ok {
+		if failed {
+			return database.Result{}, fmt.Errorf("executor job %s failed", job.Name)
+		}
+		return database.Result{}, fmt.Errorf("executor job %s didn't return a result", job.Name)
+	}
+	return result, nil
+}
+
+// start creates the secrets of the request and the result before the job, they're owned by the job afterwards
+func (e *jobExecutor) start(name string, req database.Request) error {
+	job, err := executor.Job(e.conf, e.dbin, name)
+	if err != nil {
+		return err
+	}
+	job.Annotations = map[string]string{executorRequesterAnnotation: e.requester}
+
+	request, err := executor.RequestSecret(job, req)
+	if err != nil {
+		return err
+	}
+	secrets := []*corev1.Secret{request, executor.ResultSecret(job)}
+	for _, secret := range secrets {
+		if err := e.client.Create(e.ctx, secret); err != nil {
+			if !k8serrors.IsAlreadyExists(err) {
+				return err
+			}
+			// left behind by a job which couldn't be created
+			if err := e.client.Update(e.ctx, secret); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := e.client.Create(e.ctx, job); err != nil {
+		return err
+	}
+	for _, secret := range secrets {
+		secret.OwnerReferences = executor.Ownership(job)
+		if err := e.client.Update(e.ctx, secret); err != nil {
+			logrus.Warnf("Instance: name=%s failed adding owner to executor secret %s - %s", e.dbin.Name, secret.Name, err)
+		}
+	}
+	logrus.Infof("Instance: name=%s executor job %s started for %s", e.dbin.Name, name, req.Operation)
+	return nil
+}
+
+// executeForDatabase runs the request with the executor of the instance of dbcr
+func executeForDatabase(ctx context.Context, c client.Client, conf *config.Config, dbcr *kciv1beta1.Database, req database.Request) database.Result {
+	instance, err := dbcr.GetInstanceRef()
+	if err != nil {
+		return database.ErrorResult(err)
+	}
+	return newExecutor(ctx, c, conf, instance, dbcr).Execute(req)
+}
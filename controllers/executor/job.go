@@ -0,0 +1,202 @@
+/*
+ * Copyright 2021 kloeckner.i GmbH
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	kciv1beta1 "github.com/kloeckner-i/db-operator/api/v1beta1"
+	"github.com/kloeckner-i/db-operator/pkg/config"
+	"github.com/kloeckner-i/db-operator/pkg/utils/database"
+	"github.com/kloeckner-i/db-operator/pkg/utils/kci"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	containerName    = "executor"
+	requestKey       = "request.json"
+	requestMountPath = "/srv/k8s/executor/"
+	resultKey        = "result.json"
+	// resultSecretEnv and namespaceEnv tell the executor where to store the result
+	resultSecretEnv = "EXECUTOR_RESULT_SECRET"
+	namespaceEnv    = "EXECUTOR_NAMESPACE"
+	// jobs are removed by the operator after reading the result, the ttl cleans up after a restart of the operator
+	jobTTLSeconds = int32(600)
+)
+
+// Labels returns the labels of executor jobs of dbin
+func Labels(dbin *kciv1beta1.DbInstance) map[string]string {
+	return kci.LabelBuilder(map[string]string{
+		"app":        "db-executor",
+		"dbinstance": dbin.Name,
+	})
+}
+
+// Job builds kubernetes job object
+// which runs a single request against the server of dbin with the request read from the secret of the same name
+func Job(conf *config.Config, dbin *kciv1beta1.DbInstance, name string) (*batchv1.Job, error) {
+	if dbin.Spec.Executor == nil {
+		return nil, errors.New("executor is not defined")
+	}
+	if conf.Executor.Image == "" {
+		return nil, errors.New("image of executor is not configured")
+	}
+	executor := dbin.Spec.Executor
+
+	backoffLimit := int32(0)
+	ttl := jobTTLSeconds
+	var activeDeadlineSeconds *int64
+	if conf.Executor.ActiveDeadlineSeconds > 0 {
+		activeDeadlineSeconds = &conf.Executor.ActiveDeadlineSeconds
+	}
+
+	return &batchv1.Job{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Job",
+			APIVersion: "batch/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: executor.Namespace,
+			Labels:    Labels(dbin),
+		},
+		Spec: batchv1.JobSpec{
+			ActiveDeadlineSeconds:   activeDeadlineSeconds,
+			BackoffLimit:            &backoffLimit,
+			TTLSecondsAfterFinished: &ttl,
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: Labels(dbin),
+				},
+				Spec: v1.PodSpec{
+					Containers: []v1.Container{
+						{
+							Name:            containerName,
+							Image:           conf.Executor.Image,
+							ImagePullPolicy: v1.PullIfNotPresent,
+							Command:         []string{"/usr/local/bin/db-operator", "--execute", requestMountPath + requestKey},
+							Env: []v1.EnvVar{
+								{Name: resultSecretEnv, Value: ResultSecretName(name)},
+								{
+									Name: namespaceEnv,
+									ValueFrom: &v1.EnvVarSource{
+										FieldRef: &v1.ObjectFieldSelector{FieldPath: "metadata.namespace"},
+									},
+								},
+							},
+							VolumeMounts: []v1.VolumeMount{
+								{
+									Name:      "request",
+									MountPath: requestMountPath,
+								},
+							},
+						},
+					},
+					ServiceAccountName: executor.ServiceAccountName,
+					NodeSelector:       executor.NodeSelector,
+					Tolerations:        executor.Tolerations,
+					RestartPolicy:      v1.RestartPolicyNever,
+					Volumes: []v1.Volume{
+						{
+							Name: "request",
+							VolumeSource: v1.VolumeSource{
+								Secret: &v1.SecretVolumeSource{SecretName: name},
+							},
+						},
+					},
+				},
+			},
+		},
+	}, nil
+}
+
+// ResultSecretName returns the name of the secret the executor job stores its result in
+func ResultSecretName(jobName string) string {
+	return jobName + "-result"
+}
+
+// RequestSecret builds kubernetes secret object
+// containing the request run by the job, it's created before the job so the pod never starts without it
+func RequestSecret(job *batchv1.Job, req database.Request) (*v1.Secret, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	secret := kci.SecretBuilder(job.Name, job.Namespace, map[string][]byte{requestKey: data}, nil)
+	secret.ObjectMeta.Labels = job.Labels
+	return secret, nil
+}
+
+// ResultSecret builds the empty kubernetes secret object
+// the job stores its result in, the termination message of a pod is too small for large results
+func ResultSecret(job *batchv1.Job) *v1.Secret {
+	secret := kci.SecretBuilder(ResultSecretName(job.Name), job.Namespace, map[string][]byte{}, nil)
+	secret.ObjectMeta.Labels = job.Labels
+	return secret
+}
+
+// Ownership returns the owner reference of the secrets of the job, they're removed with it
+func Ownership(job *batchv1.Job) []metav1.OwnerReference {
+	return []metav1.OwnerReference{
+		{
+			APIVersion: "batch/v1",
+			Kind:       "Job",
+			Name:       job.Name,
+			UID:        job.UID,
+		},
+	}
+}
+
+// Result returns the result stored in the result secret,
+// false if the executor didn't store a result
+func Result(secret *v1.Secret) (database.Result, bool) {
+	data, ok := secret.Data[resultKey]
+	if !ok {
+		return database.Result{}, false
+	}
+	result := database.Result{}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return database.Result{}, false
+	}
+	return result, true
+}
+
+// StoreResult stores the result in the result secret of the job the executor runs in,
+// the secret is only patched, so the service account of the job doesn't need to read secrets
+func StoreResult(ctx context.Context, c client.Client, result database.Result) error {
+	name := os.Getenv(resultSecretEnv)
+	namespace := os.Getenv(namespaceEnv)
+	if name == "" || namespace == "" {
+		return fmt.Errorf("%s and %s must be set", resultSecretEnv, namespaceEnv)
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	secret := &v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}}
+	patch := client.MergeFrom(secret.DeepCopy())
+	secret.Data = map[string][]byte{resultKey: data}
+	return c.Patch(ctx, secret, patch)
+}
@@ -0,0 +1,105 @@
+/*
+ * Copyright 2021 kloeckner.i GmbH
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package executor
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	kciv1beta1 "github.com/kloeckner-i/db-operator/api/v1beta1"
+	"github.com/kloeckner-i/db-operator/pkg/config"
+	"github.com/kloeckner-i/db-operator/pkg/utils/database"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func testInstance() *kciv1beta1.DbInstance {
+	dbin := &kciv1beta1.DbInstance{}
+	dbin.Name = "example"
+	dbin.Spec.Engine = "postgres"
+	dbin.Spec.Executor = &kciv1beta1.DbInstanceExecutor{
+		Namespace:    "databases",
+		NodeSelector: map[string]string{"network": "databases"},
+		Tolerations:  []v1.Toleration{{Key: "databases", Operator: v1.TolerationOpExists}},
+	}
+	return dbin
+}
+
+func TestJob(t *testing.T) {
+	conf := &config.Config{}
+	dbin := testInstance()
+
+	_, err := Job(conf, dbin, "example-executor-abcde")
+	assert.Error(t, err, "image must be configured")
+
+	conf.Executor.Image = "kloeckneri/db-operator:test"
+	job, err := Job(conf, dbin, "example-executor-abcde")
+	assert.NoError(t, err)
+	assert.Equal(t, "databases", job.Namespace)
+	assert.Equal(t, int32(0), *job.Spec.BackoffLimit)
+
+	podSpec := job.Spec.Template.Spec
+	assert.Equal(t, map[string]string{"network": "databases"}, podSpec.NodeSelector)
+	assert.Len(t, podSpec.Tolerations, 1)
+	assert.Equal(t, []string{"/usr/local/bin/db-operator", "--execute", "/srv/k8s/executor/request.json"}, podSpec.Containers[0].Command)
+	assert.Equal(t, "example-executor-abcde", podSpec.Volumes[0].Secret.SecretName)
+	assert.Equal(t, "example-executor-abcde-result", podSpec.Containers[0].Env[0].Value)
+}
+
+func TestRequestSecret(t *testing.T) {
+	conf := &config.Config{}
+	conf.Executor.Image = "kloeckneri/db-operator:test"
+	job, err := Job(conf, testInstance(), "example-executor-abcde")
+	assert.NoError(t, err)
+	job.UID = "1234"
+
+	req := database.Request{Operation: database.OpCheckStatus, Postgres: &database.Postgres{Host: "postgres", Port: 5432}}
+	secret, err := RequestSecret(job, req)
+	assert.NoError(t, err)
+	assert.Equal(t, "example-executor-abcde", secret.Name)
+	assert.Equal(t, "databases", secret.Namespace)
+	assert.Empty(t, secret.OwnerReferences, "the secret is created before the job")
+	assert.Contains(t, string(secret.Data["request.json"]), `"operation":"checkStatus"`)
+	assert.Equal(t, "Job", Ownership(job)[0].Kind)
+	assert.Equal(t, "example-executor-abcde-result", ResultSecret(job).Name)
+}
+
+func TestStoreResult(t *testing.T) {
+	ctx := context.Background()
+	secret := &v1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "databases", Name: "example-executor-abcde-result"}}
+	c := fake.NewClientBuilder().WithObjects(secret).Build()
+
+	_, ok := Result(secret)
+	assert.False(t, ok)
+	assert.Error(t, StoreResult(ctx, c, database.Result{Primary: true}), "the secret is passed by the job")
+
+	os.Setenv("EXECUTOR_RESULT_SECRET", secret.Name)
+	os.Setenv("EXECUTOR_NAMESPACE", secret.Namespace)
+	defer os.Unsetenv("EXECUTOR_RESULT_SECRET")
+	defer os.Unsetenv("EXECUTOR_NAMESPACE")
+	assert.NoError(t, StoreResult(ctx, c, database.ErrorResult(errors.New("connection refused"))))
+
+	assert.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(secret), secret))
+	result, ok := Result(secret)
+	assert.True(t, ok)
+	assert.EqualError(t, result.Err(), "connection refused")
+}
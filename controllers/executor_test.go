@@ -0,0 +1,83 @@
+/*
+ * Copyright 2021 kloeckner.i GmbH
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	kciv1beta1 "github.com/kloeckner-i/db-operator/api/v1beta1"
+	"github.com/kloeckner-i/db-operator/pkg/config"
+	"github.com/kloeckner-i/db-operator/pkg/utils/database"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestJobExecutor(t *testing.T) {
+	ctx := context.Background()
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+	conf := &config.Config{}
+	conf.Executor.Image = "kloeckneri/db-operator:test"
+	dbin := &kciv1beta1.DbInstance{}
+	dbin.Name = "example"
+	dbin.Spec.Executor = &kciv1beta1.DbInstanceExecutor{Namespace: "databases"}
+	dbcr := &kciv1beta1.Database{ObjectMeta: metav1.ObjectMeta{Namespace: "app", Name: "db"}}
+
+	exec := newExecutor(ctx, c, conf, dbin, dbcr)
+	req, err := database.NewRequest(database.OpIsPrimary, database.Postgres{Host: "postgres", Port: 5432}, database.AdminCredentials{})
+	assert.NoError(t, err)
+	assert.ErrorIs(t, exec.Execute(req).Err(), database.ErrRequestInProgress)
+
+	jobs := &batchv1.JobList{}
+	assert.NoError(t, c.List(ctx, jobs, client.InNamespace("databases")))
+	assert.Len(t, jobs.Items, 1)
+	job := jobs.Items[0]
+	assert.Equal(t, "Database/app/db", job.Annotations[executorRequesterAnnotation])
+	assert.Equal(t, []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: "app", Name: "db"}}}, requestsForExecutorJob("Database")(&job))
+	assert.Empty(t, requestsForExecutorJob("DbMaskedCopy")(&job))
+	result := &corev1.Secret{}
+	assert.NoError(t, c.Get(ctx, types.NamespacedName{Namespace: "databases", Name: job.Name + "-result"}, result))
+	assert.Equal(t, "Job", result.OwnerReferences[0].Kind)
+
+	assert.ErrorIs(t, exec.Execute(req).Err(), database.ErrRequestInProgress, "the running job is reused")
+	assert.NoError(t, c.List(ctx, jobs, client.InNamespace("databases")))
+	assert.Len(t, jobs.Items, 1)
+
+	// the executor stores the result and the job completes
+	result.Data = map[string][]byte{"result.json": []byte(`{"primary":true}`)}
+	assert.NoError(t, c.Update(ctx, result))
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+	assert.NoError(t, c.Status().Update(ctx, &job))
+
+	primary := exec.Execute(req)
+	assert.NoError(t, primary.Err())
+	assert.True(t, primary.Primary)
+	assert.NoError(t, c.List(ctx, jobs, client.InNamespace("databases")))
+	assert.Empty(t, jobs.Items, "job must be removed after reading the result")
+}
+
+func TestNewExecutorLocal(t *testing.T) {
+	dbin := &kciv1beta1.DbInstance{}
+	assert.Equal(t, database.LocalExecutor{}, newExecutor(context.Background(), nil, &config.Config{}, dbin, dbin))
+}
@@ -22,6 +22,7 @@ import (
 	corev1 "k8s.io/api/core/v1"
 
 	kciv1beta1 "github.com/kloeckner-i/db-operator/api/v1beta1"
+	"github.com/kloeckner-i/db-operator/pkg/backend"
 	"github.com/kloeckner-i/db-operator/pkg/utils/kci"
 	crdv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 )
@@ -57,8 +58,8 @@ func isDBInstanceSpecChanged(ctx context.Context, dbin *kciv1beta1.DbInstance) b
 		return true
 	}
 
-	if backend, _ := dbin.GetBackendType(); backend == "google" {
-		instanceConfig, _ := kci.GetConfigResource(ctx, dbin.Spec.Google.ConfigmapName.ToKubernetesType())
+	if configmapName, ok := instanceConfigmapName(dbin); ok {
+		instanceConfig, _ := kci.GetConfigResource(ctx, configmapName.ToKubernetesType())
 		if checksums["config"] != kci.GenerateChecksum(instanceConfig) {
 			return true
 		}
@@ -74,14 +75,23 @@ func addDBInstanceChecksumStatus(ctx context.Context, dbin *kciv1beta1.DbInstanc
 	}
 	checksums["spec"] = kci.GenerateChecksum(dbin.Spec)
 
-	if backend, _ := dbin.GetBackendType(); backend == "google" {
-		instanceConfig, _ := kci.GetConfigResource(ctx, dbin.Spec.Google.ConfigmapName.ToKubernetesType())
+	if configmapName, ok := instanceConfigmapName(dbin); ok {
+		instanceConfig, _ := kci.GetConfigResource(ctx, configmapName.ToKubernetesType())
 		checksums["config"] = kci.GenerateChecksum(instanceConfig)
 	}
 
 	dbin.Status.Checksums = checksums
 }
 
+// instanceConfigmapName returns the configmap of the instance config of managed instances
+func instanceConfigmapName(dbin *kciv1beta1.DbInstance) (kciv1beta1.NamespacedName, bool) {
+	b, err := backend.For(dbin)
+	if err != nil {
+		return kciv1beta1.NamespacedName{}, false
+	}
+	return b.Driver.ConfigmapName(dbin)
+}
+
 func containsString(slice []string, s string) bool {
 	for _, item := range slice {
 		if item == s {
@@ -95,6 +95,7 @@ func dbPhaseToFloat64(phase string) float64 {
 		dbPhaseConfigMap:            20,
 		dbPhaseInstanceAccessSecret: 25,
 		dbPhaseProxy:                30,
+		dbPhaseClone:                35,
 		dbPhaseBackupJob:            40,
 		dbPhaseMonitoring:           45,
 		dbPhaseFinish:               50,
@@ -20,12 +20,11 @@ package controllers
 import (
 	"errors"
 	"os"
-	"strconv"
 	"strings"
 
 	kciv1beta1 "github.com/kloeckner-i/db-operator/api/v1beta1"
+	"github.com/kloeckner-i/db-operator/pkg/backend"
 	"github.com/kloeckner-i/db-operator/pkg/config"
-	"github.com/kloeckner-i/db-operator/pkg/utils/kci"
 	proxy "github.com/kloeckner-i/db-operator/pkg/utils/proxy"
 	"github.com/sirupsen/logrus"
 )
@@ -35,65 +34,27 @@ var (
 	// environment
 	ErrNoNamespace = errors.New("namespace not found for current environment")
 	// ErrNoProxySupport is thrown when proxy creation is not supported
-	ErrNoProxySupport = errors.New("no proxy supported backend type")
+	ErrNoProxySupport = backend.ErrNoProxySupport
 )
 
 func determineProxyTypeForDB(conf *config.Config, dbcr *kciv1beta1.Database) (proxy.Proxy, error) {
 	logrus.Debugf("DB: namespace=%s, name=%s - determinProxyType", dbcr.Namespace, dbcr.Name)
-	backend, err := dbcr.GetBackendType()
-	if err != nil {
-		logrus.Errorf("could not get backend type %s - %s", dbcr.Name, err)
-		return nil, err
-	}
-
 	instance, err := dbcr.GetInstanceRef()
 	if err != nil {
-		logrus.Errorf("can not create cloudsql proxy because can not get instanceRef - %s", err)
+		logrus.Errorf("can not create proxy because can not get instanceRef - %s", err)
 		return nil, err
 	}
 
-	engine, err := dbcr.GetEngineType()
+	b, err := backend.For(instance)
 	if err != nil {
-		logrus.Errorf("can not create cloudsql proxy because can not get engineType - %s", err)
+		logrus.Errorf("could not get backend type %s - %s", dbcr.Name, err)
 		return nil, err
 	}
-
-	portString := instance.Status.Info["DB_PORT"]
-	port, err := strconv.Atoi(portString)
-	if err != nil {
-		logrus.Errorf("can not convert DB_PORT to int - %s", err)
-		return nil, err
+	if b.Proxy == nil {
+		return nil, ErrNoProxySupport
 	}
 
-	switch backend {
-	case "google":
-		labels := map[string]string{
-			"app":     "cloudproxy",
-			"db-name": dbcr.Name,
-		}
-
-		monitoringEnabled, err := dbcr.IsMonitoringEnabled()
-		if err != nil {
-			return nil, err
-		}
-
-		proxy := &proxy.CloudProxy{
-			NamePrefix:             "db-" + dbcr.Name,
-			Namespace:              dbcr.Namespace,
-			InstanceConnectionName: instance.Status.Info["DB_CONN"],
-			AccessSecretName:       dbcr.InstanceAccessSecretName(),
-			Engine:                 engine,
-			Port:                   int32(port),
-			Labels:                 kci.LabelBuilder(labels),
-			Conf:                   conf,
-			MonitoringEnabled:      monitoringEnabled,
-		}
-		return proxy, nil
-
-	default:
-		err := errors.New("not supported backend type")
-		return nil, err
-	}
+	return b.Proxy.DatabaseProxy(conf, dbcr, instance)
 }
 
 func determineProxyTypeForInstance(conf *config.Config, dbin *kciv1beta1.DbInstance) (proxy.Proxy, error) {
@@ -104,48 +65,15 @@ func determineProxyTypeForInstance(conf *config.Config, dbin *kciv1beta1.DbInsta
 		return nil, err
 	}
 
-	backend, err := dbin.GetBackendType()
+	b, err := backend.For(dbin)
 	if err != nil {
 		return nil, err
 	}
-
-	switch backend {
-	case "google":
-		portString := dbin.Status.Info["DB_PORT"]
-		port, err := strconv.Atoi(portString)
-		if err != nil {
-			logrus.Errorf("can not convert DB_PORT to int - %s", err)
-			return nil, err
-		}
-
-		labels := map[string]string{
-			"app":           "cloudproxy",
-			"instance-name": dbin.Name,
-		}
-
-		monitoringEnabled := dbin.IsMonitoringEnabled()
-
-		var accessSecretName string
-		if dbin.Spec.Google.ClientSecret.Name != "" {
-			accessSecretName = dbin.Spec.Google.ClientSecret.Name
-		} else {
-			accessSecretName = conf.Instances.Google.ClientSecretName
-		}
-
-		return &proxy.CloudProxy{
-			NamePrefix:             "dbinstance-" + dbin.Name,
-			Namespace:              operatorNamespace,
-			InstanceConnectionName: dbin.Status.Info["DB_CONN"],
-			AccessSecretName:       accessSecretName,
-			Engine:                 dbin.Spec.Engine,
-			Port:                   int32(port),
-			Labels:                 kci.LabelBuilder(labels),
-			Conf:                   conf,
-			MonitoringEnabled:      monitoringEnabled,
-		}, nil
-	default:
+	if b.Proxy == nil {
 		return nil, ErrNoProxySupport
 	}
+
+	return b.Proxy.InstanceProxy(conf, dbin, operatorNamespace)
 }
 
 // getOperatorNamespace returns the namespace the operator should be running in.
@@ -25,6 +25,7 @@ import (
 	"github.com/kloeckner-i/db-operator/pkg/config"
 	"github.com/kloeckner-i/db-operator/pkg/utils/proxy"
 	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
 )
 
 func makeGsqlInstance() kciv1beta1.DbInstance {
@@ -68,12 +69,23 @@ func mockOperatorNamespace() (string, error) {
 func TestDetermineProxyTypeForDBGoogleBackend(t *testing.T) {
 	config := &config.Config{}
 	dbin := makeGsqlInstance()
+	dbin.Status.AccessSecretChecksum = "1234"
 	db := newPostgresTestDbCr(dbin)
 	dbProxy, err := determineProxyTypeForDB(config, db)
 	assert.NoError(t, err)
 	cloudProxy, ok := dbProxy.(*proxy.CloudProxy)
 	assert.Equal(t, ok, true, "expected true")
 	assert.Equal(t, cloudProxy.AccessSecretName, db.InstanceAccessSecretName())
+	assert.Equal(t, "1234", cloudProxy.AccessSecretChecksum)
+	assert.False(t, cloudProxy.IAMAuth)
+
+	db.Spec.IAMAuth = &kciv1beta1.DatabaseIAMAuth{ServiceAccount: "app-user@my-project.iam.gserviceaccount.com", CredentialsSecret: "app-sa"}
+	dbProxy, err = determineProxyTypeForDB(config, db)
+	assert.NoError(t, err)
+	cloudProxy = dbProxy.(*proxy.CloudProxy)
+	assert.Equal(t, "app-sa", cloudProxy.AccessSecretName)
+	assert.Empty(t, cloudProxy.AccessSecretChecksum)
+	assert.True(t, cloudProxy.IAMAuth)
 }
 
 func TestDetermineProxyTypeForDBGenericBackend(t *testing.T) {
@@ -110,3 +122,126 @@ func TestDetermineProxyTypeForGenericInstance(t *testing.T) {
 	_, err := determineProxyTypeForInstance(config, &dbin)
 	assert.Error(t, err)
 }
+
+func TestDetermineProxyTypeForDBGenericBackendWithPooler(t *testing.T) {
+	os.Setenv("CONFIG_PATH", "../pkg/config/test/config_ok.yaml")
+	config := config.LoadConfig()
+	dbin := makeGenericInstance()
+	dbin.Spec.Engine = "postgres"
+	db := newPostgresTestDbCr(dbin)
+	db.Name = "TestDB"
+	db.Status.DatabaseName = "TestNS-TestDB"
+	db.Spec.Pooler = &kciv1beta1.DatabasePooler{PoolMode: "session", PoolSize: 5}
+
+	dbProxy, err := determineProxyTypeForDB(&config, db)
+	assert.NoError(t, err)
+	pooler, ok := dbProxy.(*proxy.Pooler)
+	assert.Equal(t, ok, true, "expected true")
+	assert.Equal(t, "test-conn", pooler.ServerHost)
+	assert.Equal(t, int32(1234), pooler.ServerPort)
+
+	cm, err := proxy.BuildConfigmap(dbProxy, ownership)
+	assert.NoError(t, err)
+	ini := cm.Data["pgbouncer.ini"]
+	assert.Contains(t, ini, `"TestNS-TestDB" = host=test-conn port=1234 dbname='TestNS-TestDB'`)
+	assert.Contains(t, ini, "pool_mode = session")
+	assert.Contains(t, ini, "default_pool_size = 5")
+
+	deploy, err := proxy.BuildDeployment(dbProxy, ownership)
+	assert.NoError(t, err)
+	container := deploy.Spec.Template.Spec.Containers[0]
+	assert.Equal(t, "pgbouncer:test", container.Image)
+	assert.Equal(t, TestSecretName, container.Env[1].ValueFrom.SecretKeyRef.Name)
+	assert.Equal(t, "POSTGRES_PASSWORD", container.Env[1].ValueFrom.SecretKeyRef.Key)
+
+	svc, err := proxy.BuildService(dbProxy, ownership)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(5432), svc.Spec.Ports[0].Port)
+
+	mysqlDb := newMysqlTestDbCr()
+	mysqlDb.Status.InstanceRef.Status.Info = dbin.Status.Info
+	mysqlDb.Spec.Pooler = &kciv1beta1.DatabasePooler{}
+	dbProxy, err = determineProxyTypeForDB(&config, mysqlDb)
+	assert.NoError(t, err)
+	cm, err = proxy.BuildConfigmap(dbProxy, ownership)
+	assert.NoError(t, err)
+	assert.Contains(t, cm.Data["proxysql.cnf"], `{ address="test-conn", port=1234, hostgroup=0, max_connections=20, use_ssl=0 }`)
+}
+
+func TestDetermineProxyTypeForDBPerconaBackend(t *testing.T) {
+	os.Setenv("CONFIG_PATH", "../pkg/config/test/config_ok.yaml")
+	config := config.LoadConfig()
+	dbin := kciv1beta1.DbInstance{
+		Spec: kciv1beta1.DbInstanceSpec{
+			Engine: "mysql",
+			DbInstanceSource: kciv1beta1.DbInstanceSource{
+				Percona: &kciv1beta1.PerconaCluster{
+					ServerList: []kciv1beta1.BackendServer{
+						{Host: "pxc-0", Port: 3306, MaxConnection: 100},
+						{Host: "pxc-1", Port: 3306, ReadOnly: true},
+					},
+				},
+			},
+		},
+		Status: kciv1beta1.DbInstanceStatus{
+			Info: map[string]string{"DB_CONN": "pxc-0", "DB_PORT": "3306"},
+		},
+	}
+	db := newMysqlTestDbCr()
+	db.Status.InstanceRef = &dbin
+
+	dbProxy, err := determineProxyTypeForDB(&config, db)
+	assert.NoError(t, err)
+	proxysql, ok := dbProxy.(*proxy.ProxySQL)
+	assert.Equal(t, ok, true, "expected true")
+	assert.Len(t, proxysql.Servers, 2)
+
+	cm, err := proxy.BuildConfigmap(dbProxy, ownership)
+	assert.NoError(t, err)
+	cnf := cm.Data["proxysql.cnf"]
+	assert.Contains(t, cnf, `{ address="pxc-0", port=3306, hostgroup=0, max_connections=100, use_ssl=0 }`)
+	assert.Contains(t, cnf, `{ address="pxc-1", port=3306, hostgroup=1, use_ssl=0 }`)
+	assert.Contains(t, cnf, `match_digest="^SELECT", destination_hostgroup=1`)
+
+	deploy, err := proxy.BuildDeployment(dbProxy, ownership)
+	assert.NoError(t, err)
+	assert.Equal(t, "severalnines/proxysql:2.0", deploy.Spec.Template.Spec.Containers[0].Image)
+
+	svc, err := proxy.BuildService(dbProxy, ownership)
+	assert.NoError(t, err)
+	assert.Equal(t, "metrics", svc.Spec.Ports[1].Name)
+}
+
+func TestDetermineProxyTypeForDBGenericBackendWithPoolerAndSSHTunnel(t *testing.T) {
+	os.Setenv("CONFIG_PATH", "../pkg/config/test/config_ok.yaml")
+	config := config.LoadConfig()
+	dbin := makeGenericInstance()
+	dbin.Spec.Engine = "postgres"
+	dbin.Spec.Generic.SSHTunnel = &kciv1beta1.SSHTunnel{
+		Host:             "bastion.example.com",
+		User:             "tunnel",
+		PrivateKeySecret: kciv1beta1.NamespacedName{Namespace: "db-operator", Name: "bastion-key"},
+	}
+	db := newPostgresTestDbCr(dbin)
+	db.Name = "TestDB"
+	db.Status.DatabaseName = "TestNS-TestDB"
+	db.Spec.Pooler = &kciv1beta1.DatabasePooler{}
+
+	dbProxy, err := determineProxyTypeForDB(&config, db)
+	assert.NoError(t, err)
+
+	cm, err := proxy.BuildConfigmap(dbProxy, ownership)
+	assert.NoError(t, err)
+	assert.Contains(t, cm.Data["pgbouncer.ini"], `"TestNS-TestDB" = host=127.0.0.1 port=15432 dbname='TestNS-TestDB'`)
+
+	deploy, err := proxy.BuildDeployment(dbProxy, ownership)
+	assert.NoError(t, err)
+	podSpec := deploy.Spec.Template.Spec
+	assert.Len(t, podSpec.Containers, 2)
+	tunnel := podSpec.Containers[1]
+	assert.Equal(t, "kroniak/ssh-client:3.15", tunnel.Image)
+	assert.Contains(t, tunnel.Env, corev1.EnvVar{Name: "DB_HOST", Value: "test-conn"})
+	assert.Contains(t, tunnel.Env, corev1.EnvVar{Name: "LOCAL_PORT", Value: "15432"})
+	assert.Contains(t, tunnel.Env, corev1.EnvVar{Name: "SSH_FLAGS", Value: "-N"})
+	assert.Equal(t, "TestDB-ssh-tunnel", podSpec.Volumes[len(podSpec.Volumes)-1].Secret.SecretName)
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
 	"os"
 	"strconv"
@@ -31,12 +32,15 @@ import (
 	kcirocksv1alpha1 "github.com/kloeckner-i/db-operator/api/v1alpha1"
 	kcirocksv1beta1 "github.com/kloeckner-i/db-operator/api/v1beta1"
 	"github.com/kloeckner-i/db-operator/controllers"
+	"github.com/kloeckner-i/db-operator/controllers/executor"
 	"github.com/kloeckner-i/db-operator/pkg/config"
+	"github.com/kloeckner-i/db-operator/pkg/utils/database"
 	"github.com/kloeckner-i/db-operator/pkg/utils/thirdpartyapi"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.) to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 )
@@ -60,17 +64,42 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var executeRequest string
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":60000", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&executeRequest, "execute", "",
+		"Run the database request stored in the file and exit, it's used by executor jobs.")
 	opts := zap.Options{
 		Development: true,
 	}
 	opts.BindFlags(flag.CommandLine)
 	flag.Parse()
 
+	if executeRequest != "" {
+		result, err := database.ExecuteFile(executeRequest)
+		if err != nil {
+			logrus.Errorf("can not read request - %s", err)
+			os.Exit(1)
+		}
+		c, err := client.New(ctrl.GetConfigOrDie(), client.Options{Scheme: scheme})
+		if err != nil {
+			logrus.Errorf("can not create client - %s", err)
+			os.Exit(1)
+		}
+		if err := executor.StoreResult(context.Background(), c, result); err != nil {
+			logrus.Errorf("can not store result - %s", err)
+			os.Exit(1)
+		}
+		if err := result.Err(); err != nil {
+			logrus.Errorf("request failed - %s", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
@@ -99,6 +128,7 @@ func main() {
 		Client:   mgr.GetClient(),
 		Log:      ctrl.Log.WithName("controllers").WithName("DbInstance"),
 		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("dbinstance-controller"),
 		Interval: time.Duration(i),
 		Conf:     &conf,
 	}).SetupWithManager(mgr); err != nil {
@@ -122,6 +152,18 @@ func main() {
 		setupLog.Error(err, "unable to create controller", "controller", "Database")
 		os.Exit(1)
 	}
+	if err = (&controllers.DbMaskedCopyReconciler{
+		Client:   mgr.GetClient(),
+		Log:      ctrl.Log.WithName("controllers").WithName("DbMaskedCopy"),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("dbmaskedcopy-controller"),
+		Interval: time.Duration(i),
+		Conf:     &conf,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "DbMaskedCopy")
+		os.Exit(1)
+	}
+	kcirocksv1beta1.DatabaseNamingRules = conf.Naming
 	if err = (&kcirocksv1beta1.Database{}).SetupWebhookWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create webhook", "webhook", "Database")
 		os.Exit(1)
@@ -0,0 +1,28 @@
+/*
+ * Copyright 2021 kloeckner.i GmbH
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package all registers the backends of the operator,
+// builds with additional backends import their packages next to this one
+package all
+
+import (
+	// backends register themselves in init
+	_ "github.com/kloeckner-i/db-operator/pkg/backend/aws"
+	_ "github.com/kloeckner-i/db-operator/pkg/backend/azure"
+	_ "github.com/kloeckner-i/db-operator/pkg/backend/generic"
+	_ "github.com/kloeckner-i/db-operator/pkg/backend/google"
+	_ "github.com/kloeckner-i/db-operator/pkg/backend/percona"
+)
@@ -0,0 +1,78 @@
+/*
+ * Copyright 2021 kloeckner.i GmbH
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package aws
+
+import (
+	"context"
+
+	kciv1beta1 "github.com/kloeckner-i/db-operator/api/v1beta1"
+	"github.com/kloeckner-i/db-operator/pkg/backend"
+	"github.com/kloeckner-i/db-operator/pkg/config"
+	"github.com/kloeckner-i/db-operator/pkg/utils/database"
+	"github.com/kloeckner-i/db-operator/pkg/utils/dbinstance"
+	"github.com/kloeckner-i/db-operator/pkg/utils/kci"
+	"github.com/kloeckner-i/db-operator/pkg/utils/proxy"
+	"github.com/sirupsen/logrus"
+)
+
+func init() {
+	backend.Register("aws", backend.Backend{
+		Driver: rds{},
+		Proxy:  rds{},
+		Backup: rds{},
+		// iam auth tokens are sent in clear text over verified ssl connections
+		Dialer: database.TCPDialer{AllowCleartextPasswords: true},
+	})
+}
+
+// rds manages AWS RDS instances
+type rds struct{}
+
+func (rds) Instance(ctx context.Context, env backend.Env, dbin *kciv1beta1.DbInstance, cred database.AdminCredentials) (dbinstance.DbInstance, error) {
+	configmap, err := kci.GetConfigResource(ctx, dbin.Spec.Aws.ConfigmapName.ToKubernetesType())
+	if err != nil {
+		logrus.Errorf("Instance: name=%s reading RDS instance config %s/%s", dbin.Name, dbin.Spec.Aws.ConfigmapName.Namespace, dbin.Spec.Aws.ConfigmapName.Name)
+		return nil, err
+	}
+
+	spec := dbin.Spec.Aws
+	instance := dbinstance.RdsNew(spec.InstanceIdentifier, configmap.Data["config"], cred.Username, cred.Password, spec.Region, spec.APIEndpoint, spec.IAMAuth)
+	instance.PasswordChanged = backend.AdminPasswordChanged(dbin, cred)
+	instance.Operation = dbin.Status.Operation
+	return instance, nil
+}
+
+func (rds) ConfigmapName(dbin *kciv1beta1.DbInstance) (kciv1beta1.NamespacedName, bool) {
+	return dbin.Spec.Aws.ConfigmapName, true
+}
+
+func (rds) DatabaseProxy(conf *config.Config, dbcr *kciv1beta1.Database, instance *kciv1beta1.DbInstance) (proxy.Proxy, error) {
+	return backend.PoolerProxy(conf, dbcr, instance, nil)
+}
+
+func (rds) InstanceProxy(conf *config.Config, dbin *kciv1beta1.DbInstance, namespace string) (proxy.Proxy, error) {
+	return nil, backend.ErrNoProxySupport
+}
+
+// TransparentDatabaseProxy is false, poolers in transaction mode can't be used for consistent dumps
+func (rds) TransparentDatabaseProxy() bool {
+	return false
+}
+
+func (rds) BackupHost(dbcr *kciv1beta1.Database, instance *kciv1beta1.DbInstance) (string, error) {
+	return instance.Status.Info["DB_CONN"], nil
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright 2021 kloeckner.i GmbH
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package azure
+
+import (
+	"context"
+
+	kciv1beta1 "github.com/kloeckner-i/db-operator/api/v1beta1"
+	"github.com/kloeckner-i/db-operator/pkg/backend"
+	"github.com/kloeckner-i/db-operator/pkg/config"
+	"github.com/kloeckner-i/db-operator/pkg/utils/database"
+	"github.com/kloeckner-i/db-operator/pkg/utils/dbinstance"
+	"github.com/kloeckner-i/db-operator/pkg/utils/kci"
+	"github.com/kloeckner-i/db-operator/pkg/utils/proxy"
+	"github.com/sirupsen/logrus"
+)
+
+func init() {
+	backend.Register("azure", backend.Backend{
+		Driver: flexibleServer{},
+		Proxy:  flexibleServer{},
+		Backup: flexibleServer{},
+	})
+}
+
+// flexibleServer manages Azure Database flexible servers
+type flexibleServer struct{}
+
+func (flexibleServer) Instance(ctx context.Context, env backend.Env, dbin *kciv1beta1.DbInstance, cred database.AdminCredentials) (dbinstance.DbInstance, error) {
+	configmap, err := kci.GetConfigResource(ctx, dbin.Spec.Azure.ConfigmapName.ToKubernetesType())
+	if err != nil {
+		logrus.Errorf("Instance: name=%s reading azure server config %s/%s", dbin.Name, dbin.Spec.Azure.ConfigmapName.Namespace, dbin.Spec.Azure.ConfigmapName.Name)
+		return nil, err
+	}
+
+	rules := []dbinstance.AzureFirewallRule{}
+	for _, rule := range dbin.Spec.Azure.FirewallRules {
+		rules = append(rules, dbinstance.AzureFirewallRule(rule))
+	}
+	return &dbinstance.Azure{
+		Name:           dbin.Spec.Azure.ServerName,
+		SubscriptionID: dbin.Spec.Azure.SubscriptionID,
+		ResourceGroup:  dbin.Spec.Azure.ResourceGroup,
+		Engine:         dbin.Spec.Engine,
+		Config:         configmap.Data["config"],
+		User:           cred.Username,
+		Password:       cred.Password,
+		FirewallRules:  rules,
+		APIEndpoint:    dbin.Spec.Azure.APIEndpoint,
+
+		PasswordChanged: backend.AdminPasswordChanged(dbin, cred),
+		Operation:       dbin.Status.Operation,
+	}, nil
+}
+
+func (flexibleServer) ConfigmapName(dbin *kciv1beta1.DbInstance) (kciv1beta1.NamespacedName, bool) {
+	return dbin.Spec.Azure.ConfigmapName, true
+}
+
+func (flexibleServer) DatabaseProxy(conf *config.Config, dbcr *kciv1beta1.Database, instance *kciv1beta1.DbInstance) (proxy.Proxy, error) {
+	return backend.PoolerProxy(conf, dbcr, instance, nil)
+}
+
+func (flexibleServer) InstanceProxy(conf *config.Config, dbin *kciv1beta1.DbInstance, namespace string) (proxy.Proxy, error) {
+	return nil, backend.ErrNoProxySupport
+}
+
+// TransparentDatabaseProxy is false, poolers in transaction mode can't be used for consistent dumps
+func (flexibleServer) TransparentDatabaseProxy() bool {
+	return false
+}
+
+func (flexibleServer) BackupHost(dbcr *kciv1beta1.Database, instance *kciv1beta1.DbInstance) (string, error) {
+	return instance.Status.Info["DB_CONN"], nil
+}
@@ -0,0 +1,159 @@
+/*
+ * Copyright 2021 kloeckner.i GmbH
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	kciv1beta1 "github.com/kloeckner-i/db-operator/api/v1beta1"
+	"github.com/kloeckner-i/db-operator/pkg/config"
+	"github.com/kloeckner-i/db-operator/pkg/utils/database"
+	"github.com/kloeckner-i/db-operator/pkg/utils/dbinstance"
+	"github.com/kloeckner-i/db-operator/pkg/utils/kci"
+	"github.com/kloeckner-i/db-operator/pkg/utils/proxy"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var (
+	// ErrNoProxySupport is thrown when proxy creation is not supported
+	ErrNoProxySupport = errors.New("no proxy supported backend type")
+	// ErrUnknownBackend is thrown when no backend is registered by the backend type of an instance
+	ErrUnknownBackend = errors.New("unknown backend type")
+)
+
+// Env gives backends access to the cluster and the configuration of the operator
+type Env struct {
+	Client client.Client
+	Conf   *config.Config
+	// Executor runs the database operations of the instance, in the operator or in executor jobs
+	Executor database.Executor
+}
+
+// InstanceDriver builds the driver which manages the database server of an instance
+type InstanceDriver interface {
+	// Instance returns the driver of the server, the admin user is used to manage it
+	Instance(ctx context.Context, env Env, dbin *kciv1beta1.DbInstance, cred database.AdminCredentials) (dbinstance.DbInstance, error)
+	// ConfigmapName returns the configmap the server is configured by, false if the instance has none
+	ConfigmapName(dbin *kciv1beta1.DbInstance) (kciv1beta1.NamespacedName, bool)
+}
+
+// ProxyBuilder builds the proxies between clients and the database server
+type ProxyBuilder interface {
+	// DatabaseProxy returns the proxy deployed next to a database, ErrNoProxySupport if it doesn't need one
+	DatabaseProxy(conf *config.Config, dbcr *kciv1beta1.Database, instance *kciv1beta1.DbInstance) (proxy.Proxy, error)
+	// InstanceProxy returns the proxy of an instance deployed to the namespace of the operator,
+	// ErrNoProxySupport if it doesn't need one
+	InstanceProxy(conf *config.Config, dbin *kciv1beta1.DbInstance, namespace string) (proxy.Proxy, error)
+	// TransparentDatabaseProxy returns true if the proxy of a database passes connections to the server unchanged,
+	// clones and dumps connect through it instead of connecting to the server
+	TransparentDatabaseProxy() bool
+}
+
+// BackupHostResolver returns the host the backups of a database are dumped from
+type BackupHostResolver interface {
+	BackupHost(dbcr *kciv1beta1.Database, instance *kciv1beta1.DbInstance) (string, error)
+}
+
+// ExecutorBuilder runs the database requests of instances through the api of the backend
+type ExecutorBuilder interface {
+	// Executor returns the executor of the instance, sql runs the requests with sql connections
+	// and is returned or wrapped if the backend doesn't replace it
+	Executor(dbin *kciv1beta1.DbInstance, sql database.Executor) database.Executor
+}
+
+// Backend bundles the parts of a backend, Proxy, Dialer and Executor may be nil
+// when the backend has no proxies, the database servers are connected directly or the requests are run with sql connections
+type Backend struct {
+	Driver   InstanceDriver
+	Proxy    ProxyBuilder
+	Backup   BackupHostResolver
+	Dialer   database.Dialer
+	Executor ExecutorBuilder
+}
+
+var (
+	backends   = map[string]Backend{}
+	backendsMu sync.RWMutex
+)
+
+// Register makes a backend available by the backend type of its instances,
+// it panics if a backend is registered twice or driver or backup host resolver are missing
+func Register(name string, b Backend) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+
+	if b.Driver == nil || b.Backup == nil {
+		panic("backend: driver and backup host resolver of backend " + name + " must be defined")
+	}
+	if _, found := backends[name]; found {
+		panic("backend: register called twice for backend " + name)
+	}
+	backends[name] = b
+	if b.Dialer != nil {
+		database.RegisterDialer(name, b.Dialer)
+	}
+}
+
+// Get returns the backend registered by the name
+func Get(name string) (Backend, error) {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+
+	b, found := backends[name]
+	if !found {
+		return Backend{}, fmt.Errorf("%w %s", ErrUnknownBackend, name)
+	}
+	return b, nil
+}
+
+// For returns the backend of the instance
+func For(dbin *kciv1beta1.DbInstance) (Backend, error) {
+	name, err := dbin.GetBackendType()
+	if err != nil {
+		return Backend{}, err
+	}
+	return Get(name)
+}
+
+// InstancePort returns the port of the database server from the instance status
+func InstancePort(instance *kciv1beta1.DbInstance) (int32, error) {
+	port, err := strconv.Atoi(instance.Status.Info["DB_PORT"])
+	if err != nil {
+		return 0, fmt.Errorf("can not convert DB_PORT to int - %w", err)
+	}
+	return int32(port), nil
+}
+
+// adminPasswordChecksum is the key of the checksum of the admin password in the instance status
+const adminPasswordChecksum = "adminPassword"
+
+// AdminPasswordChanged returns true if the admin password differs from the one last applied to the server of the instance
+func AdminPasswordChanged(dbin *kciv1beta1.DbInstance, cred database.AdminCredentials) bool {
+	return dbin.Status.Checksums[adminPasswordChecksum] != kci.GenerateChecksum(cred.Password)
+}
+
+// SetAdminPasswordApplied records the admin password as applied to the server of the instance
+func SetAdminPasswordApplied(dbin *kciv1beta1.DbInstance, cred database.AdminCredentials) {
+	if dbin.Status.Checksums == nil {
+		dbin.Status.Checksums = map[string]string{}
+	}
+	dbin.Status.Checksums[adminPasswordChecksum] = kci.GenerateChecksum(cred.Password)
+}
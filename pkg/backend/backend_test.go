@@ -0,0 +1,78 @@
+/*
+ * Copyright 2021 kloeckner.i GmbH
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package backend
+
+import (
+	"context"
+	"testing"
+
+	kciv1beta1 "github.com/kloeckner-i/db-operator/api/v1beta1"
+	"github.com/kloeckner-i/db-operator/pkg/utils/database"
+	"github.com/kloeckner-i/db-operator/pkg/utils/dbinstance"
+	"github.com/stretchr/testify/assert"
+)
+
+type testBackend struct{}
+
+func (testBackend) Instance(ctx context.Context, env Env, dbin *kciv1beta1.DbInstance, cred database.AdminCredentials) (dbinstance.DbInstance, error) {
+	return &dbinstance.Generic{Host: dbin.Spec.Generic.Host}, nil
+}
+
+func (testBackend) ConfigmapName(dbin *kciv1beta1.DbInstance) (kciv1beta1.NamespacedName, bool) {
+	return kciv1beta1.NamespacedName{}, false
+}
+
+func (testBackend) BackupHost(dbcr *kciv1beta1.Database, instance *kciv1beta1.DbInstance) (string, error) {
+	return "backup", nil
+}
+
+func TestRegister(t *testing.T) {
+	Register("generic", Backend{Driver: testBackend{}, Backup: testBackend{}})
+	defer delete(backends, "generic")
+
+	dbin := &kciv1beta1.DbInstance{
+		Spec: kciv1beta1.DbInstanceSpec{
+			DbInstanceSource: kciv1beta1.DbInstanceSource{
+				Generic: &kciv1beta1.GenericInstance{Host: "postgres"},
+			},
+		},
+	}
+	b, err := For(dbin)
+	assert.NoError(t, err)
+	assert.Nil(t, b.Proxy)
+	host, err := b.Backup.BackupHost(&kciv1beta1.Database{}, dbin)
+	assert.NoError(t, err)
+	assert.Equal(t, "backup", host)
+
+	assert.Panics(t, func() { Register("generic", Backend{Driver: testBackend{}, Backup: testBackend{}}) }, "backends can't be registered twice")
+	assert.Panics(t, func() { Register("incomplete", Backend{Driver: testBackend{}}) }, "backup host resolver is required")
+
+	_, err = Get("unknown")
+	assert.ErrorIs(t, err, ErrUnknownBackend)
+}
+
+func TestInstancePort(t *testing.T) {
+	dbin := &kciv1beta1.DbInstance{}
+	dbin.Status.Info = map[string]string{"DB_PORT": "5432"}
+	port, err := InstancePort(dbin)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(5432), port)
+
+	dbin.Status.Info["DB_PORT"] = ""
+	_, err = InstancePort(dbin)
+	assert.Error(t, err)
+}
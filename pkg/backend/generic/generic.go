@@ -0,0 +1,130 @@
+/*
+ * Copyright 2021 kloeckner.i GmbH
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generic
+
+import (
+	"context"
+
+	kciv1beta1 "github.com/kloeckner-i/db-operator/api/v1beta1"
+	"github.com/kloeckner-i/db-operator/pkg/backend"
+	"github.com/kloeckner-i/db-operator/pkg/config"
+	"github.com/kloeckner-i/db-operator/pkg/utils/database"
+	"github.com/kloeckner-i/db-operator/pkg/utils/dbinstance"
+	"github.com/kloeckner-i/db-operator/pkg/utils/provision"
+	"github.com/kloeckner-i/db-operator/pkg/utils/proxy"
+	"github.com/kloeckner-i/db-operator/pkg/utils/sshtunnel"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func init() {
+	backend.Register("generic", backend.Backend{
+		Driver: generic{},
+		Proxy:  generic{},
+		Backup: generic{},
+	})
+}
+
+// generic manages database servers which are reached by address, optionally through an ssh jump host
+type generic struct{}
+
+func (generic) Instance(ctx context.Context, env backend.Env, dbin *kciv1beta1.DbInstance, cred database.AdminCredentials) (dbinstance.DbInstance, error) {
+	instance, err := Instance(ctx, env.Client, dbin, cred)
+	if err != nil {
+		return nil, err
+	}
+	instance.Executor = env.Executor
+	return instance, nil
+}
+
+// Instance returns the driver of a generic instance,
+// the address of a referenced service is resolved and the ssh tunnel is attached
+func Instance(ctx context.Context, c client.Reader, dbin *kciv1beta1.DbInstance, cred database.AdminCredentials) (*dbinstance.Generic, error) {
+	instance := &dbinstance.Generic{
+		Host:         dbin.Spec.Generic.Host,
+		Hosts:        dbin.Spec.Generic.Hosts,
+		Port:         dbin.Spec.Generic.Port,
+		PublicIP:     dbin.Spec.Generic.PublicIP,
+		Engine:       dbin.Spec.Engine,
+		User:         cred.Username,
+		Password:     cred.Password,
+		SSLEnabled:   dbin.Spec.SSLConnection.Enabled,
+		SkipCAVerify: dbin.Spec.SSLConnection.SkipVerify,
+	}
+
+	if dbin.Spec.Generic.Provision != nil {
+		instance.Host = provision.Host(dbin)
+		instance.Port = provision.Port(dbin)
+		instance.Hosts = nil
+		instance.PublicIP = ""
+	}
+
+	var err error
+	instance.Tunnel, err = SSHTunnel(ctx, c, dbin)
+	if err != nil {
+		return nil, err
+	}
+	instance.SSLCerts, err = backend.SSLCerts(ctx, c, dbin)
+	if err != nil {
+		return nil, err
+	}
+
+	if dbin.Spec.Generic.ServiceRef != nil {
+		instance.Host, instance.Port, err = ServiceAddress(ctx, c, dbin)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return instance, nil
+}
+
+func (generic) ConfigmapName(dbin *kciv1beta1.DbInstance) (kciv1beta1.NamespacedName, bool) {
+	return kciv1beta1.NamespacedName{}, false
+}
+
+func (generic) DatabaseProxy(conf *config.Config, dbcr *kciv1beta1.Database, instance *kciv1beta1.DbInstance) (proxy.Proxy, error) {
+	var tunnel *sshtunnel.Sidecar
+	if sshTunnel := instance.GetSSHTunnel(); sshTunnel != nil {
+		tunnel = &sshtunnel.Sidecar{
+			Image:             conf.Instances.Generic.SSHTunnel.Image,
+			Host:              sshTunnel.Host,
+			Port:              sshTunnel.Port,
+			User:              sshTunnel.User,
+			SkipHostKeyVerify: sshTunnel.SkipHostKeyVerify,
+			SecretName:        sshtunnel.SecretName(dbcr.Name),
+			ServerHost:        instance.Status.Info["DB_CONN"],
+			ServerPort:        instance.Status.Info["DB_PORT"],
+		}
+	}
+	return backend.PoolerProxy(conf, dbcr, instance, tunnel)
+}
+
+func (generic) InstanceProxy(conf *config.Config, dbin *kciv1beta1.DbInstance, namespace string) (proxy.Proxy, error) {
+	return nil, backend.ErrNoProxySupport
+}
+
+// TransparentDatabaseProxy is false, poolers in transaction mode can't be used for consistent dumps
+func (generic) TransparentDatabaseProxy() bool {
+	return false
+}
+
+func (generic) BackupHost(dbcr *kciv1beta1.Database, instance *kciv1beta1.DbInstance) (string, error) {
+	if instance.Spec.Generic.BackupHost != "" {
+		return instance.Spec.Generic.BackupHost, nil
+	}
+	// the current primary if the instance has multiple hosts
+	return instance.Status.Info["DB_CONN"], nil
+}
@@ -0,0 +1,119 @@
+/*
+ * Copyright 2021 kloeckner.i GmbH
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generic
+
+import (
+	"testing"
+
+	kciv1beta1 "github.com/kloeckner-i/db-operator/api/v1beta1"
+	"github.com/kloeckner-i/db-operator/pkg/utils/sshtunnel"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testDatabaseService() (*corev1.Service, *corev1.Endpoints) {
+	meta := metav1.ObjectMeta{Namespace: "databases", Name: "postgres"}
+	svc := &corev1.Service{
+		ObjectMeta: meta,
+		Spec: corev1.ServiceSpec{
+			Ports: []corev1.ServicePort{
+				{Name: "postgres", Port: 5432},
+				{Name: "metrics", Port: 9187},
+			},
+		},
+	}
+	endpoints := &corev1.Endpoints{
+		ObjectMeta: meta,
+		Subsets: []corev1.EndpointSubset{
+			{
+				Addresses: []corev1.EndpointAddress{{IP: "10.0.0.1"}},
+				Ports: []corev1.EndpointPort{
+					{Name: "postgres", Port: 5432},
+					{Name: "metrics", Port: 9187},
+				},
+			},
+		},
+	}
+	return svc, endpoints
+}
+
+func TestResolveServiceRef(t *testing.T) {
+	svc, endpoints := testDatabaseService()
+	ref := &kciv1beta1.ServiceReference{Namespace: "databases", Name: "postgres", Port: "postgres"}
+
+	host, port, err := resolveServiceRef(ref, svc, endpoints)
+	assert.NoError(t, err)
+	assert.Equal(t, "postgres.databases.svc", host)
+	assert.Equal(t, uint16(5432), port)
+
+	ref.Port = "unknown"
+	_, _, err = resolveServiceRef(ref, svc, endpoints)
+	assert.Error(t, err)
+
+	// the port name is required if the service has more than one port
+	ref.Port = ""
+	_, _, err = resolveServiceRef(ref, svc, endpoints)
+	assert.Error(t, err)
+
+	svc.Spec.Ports = svc.Spec.Ports[:1]
+	_, port, err = resolveServiceRef(ref, svc, endpoints)
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(5432), port)
+}
+
+func TestResolveServiceRefWithoutEndpoints(t *testing.T) {
+	svc, endpoints := testDatabaseService()
+	ref := &kciv1beta1.ServiceReference{Namespace: "databases", Name: "postgres", Port: "postgres"}
+
+	_, _, err := resolveServiceRef(ref, svc, nil)
+	assert.ErrorIs(t, err, errNoReadyEndpoints)
+
+	endpoints.Subsets[0].NotReadyAddresses = endpoints.Subsets[0].Addresses
+	endpoints.Subsets[0].Addresses = nil
+	_, _, err = resolveServiceRef(ref, svc, endpoints)
+	assert.ErrorIs(t, err, errNoReadyEndpoints)
+
+	svc.Spec.Type = corev1.ServiceTypeExternalName
+	_, _, err = resolveServiceRef(ref, svc, nil)
+	assert.NoError(t, err)
+}
+
+func TestSSHTunnelFromSecret(t *testing.T) {
+	tunnel := &kciv1beta1.SSHTunnel{
+		Host:             "bastion.example.com",
+		User:             "tunnel",
+		PrivateKeySecret: kciv1beta1.NamespacedName{Namespace: "db-operator", Name: "bastion-key"},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "db-operator", Name: "bastion-key"},
+		Data: map[string][]byte{
+			corev1.SSHAuthPrivateKey: []byte("private key"),
+			sshtunnel.KnownHostsKey:  []byte("bastion.example.com ssh-ed25519 AAAA"),
+		},
+	}
+
+	result, err := sshTunnelFromSecret(tunnel, secret)
+	assert.NoError(t, err)
+	assert.Equal(t, "bastion.example.com", result.Host)
+	assert.Equal(t, []byte("private key"), result.PrivateKey)
+	assert.Equal(t, []byte("bastion.example.com ssh-ed25519 AAAA"), result.KnownHosts)
+
+	delete(secret.Data, corev1.SSHAuthPrivateKey)
+	_, err = sshTunnelFromSecret(tunnel, secret)
+	assert.Error(t, err)
+}
@@ -0,0 +1,94 @@
+/*
+ * Copyright 2021 kloeckner.i GmbH
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	kciv1beta1 "github.com/kloeckner-i/db-operator/api/v1beta1"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var errNoReadyEndpoints = errors.New("service has no ready endpoints")
+
+// ServiceAddress resolves the service referenced by a generic instance
+func ServiceAddress(ctx context.Context, c client.Reader, dbin *kciv1beta1.DbInstance) (string, uint16, error) {
+	ref := dbin.Spec.Generic.ServiceRef
+	key := types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}
+
+	svc := &corev1.Service{}
+	if err := c.Get(ctx, key, svc); err != nil {
+		logrus.Errorf("Instance: name=%s failed to get service %s", dbin.Name, key)
+		return "", 0, err
+	}
+
+	endpoints := &corev1.Endpoints{}
+	if err := c.Get(ctx, key, endpoints); err != nil {
+		if !k8serrors.IsNotFound(err) {
+			return "", 0, err
+		}
+		endpoints = nil
+	}
+
+	return resolveServiceRef(ref, svc, endpoints)
+}
+
+// resolveServiceRef returns host and port of the service port referenced by a generic instance,
+// the service must have a ready endpoint serving the port
+func resolveServiceRef(ref *kciv1beta1.ServiceReference, svc *corev1.Service, endpoints *corev1.Endpoints) (string, uint16, error) {
+	var port *corev1.ServicePort
+	for i := range svc.Spec.Ports {
+		if svc.Spec.Ports[i].Name == ref.Port {
+			port = &svc.Spec.Ports[i]
+			break
+		}
+	}
+	if port == nil && ref.Port == "" && len(svc.Spec.Ports) == 1 {
+		port = &svc.Spec.Ports[0]
+	}
+	if port == nil {
+		return "", 0, fmt.Errorf("port %q not found in service %s/%s", ref.Port, svc.Namespace, svc.Name)
+	}
+
+	host := svc.Name + "." + svc.Namespace + ".svc"
+
+	// external name services don't have endpoints
+	if svc.Spec.Type == corev1.ServiceTypeExternalName {
+		return host, uint16(port.Port), nil
+	}
+
+	if endpoints == nil {
+		return "", 0, errNoReadyEndpoints
+	}
+	for _, subset := range endpoints.Subsets {
+		if len(subset.Addresses) == 0 {
+			continue
+		}
+		for _, endpointPort := range subset.Ports {
+			if endpointPort.Name == port.Name {
+				return host, uint16(port.Port), nil
+			}
+		}
+	}
+	return "", 0, errNoReadyEndpoints
+}
@@ -0,0 +1,57 @@
+/*
+ * Copyright 2021 kloeckner.i GmbH
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generic
+
+import (
+	"context"
+	"fmt"
+
+	kciv1beta1 "github.com/kloeckner-i/db-operator/api/v1beta1"
+	"github.com/kloeckner-i/db-operator/pkg/utils/database"
+	"github.com/kloeckner-i/db-operator/pkg/utils/sshtunnel"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// SSHTunnel returns the ssh tunnel of the instance, nil if the instance is reached directly
+func SSHTunnel(ctx context.Context, c client.Reader, dbin *kciv1beta1.DbInstance) (*database.SSHTunnel, error) {
+	tunnel := dbin.GetSSHTunnel()
+	if tunnel == nil {
+		return nil, nil
+	}
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, tunnel.PrivateKeySecret.ToKubernetesType(), secret); err != nil {
+		return nil, fmt.Errorf("can't get private key secret of ssh tunnel: %w", err)
+	}
+	return sshTunnelFromSecret(tunnel, secret)
+}
+
+// sshTunnelFromSecret builds the tunnel of a generic instance with the private key stored in the secret
+func sshTunnelFromSecret(tunnel *kciv1beta1.SSHTunnel, secret *corev1.Secret) (*database.SSHTunnel, error) {
+	privateKey, ok := secret.Data[corev1.SSHAuthPrivateKey]
+	if !ok {
+		return nil, fmt.Errorf("secret %s/%s has no key %s", secret.Namespace, secret.Name, corev1.SSHAuthPrivateKey)
+	}
+	return &database.SSHTunnel{
+		Host:              tunnel.Host,
+		Port:              tunnel.Port,
+		User:              tunnel.User,
+		PrivateKey:        privateKey,
+		KnownHosts:        secret.Data[sshtunnel.KnownHostsKey],
+		SkipHostKeyVerify: tunnel.SkipHostKeyVerify,
+	}, nil
+}
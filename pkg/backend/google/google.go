@@ -0,0 +1,234 @@
+/*
+ * Copyright 2021 kloeckner.i GmbH
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package google
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/cloudsql-proxy/proxy/dialers/mysql"
+	kciv1beta1 "github.com/kloeckner-i/db-operator/api/v1beta1"
+	"github.com/kloeckner-i/db-operator/pkg/backend"
+	"github.com/kloeckner-i/db-operator/pkg/config"
+	"github.com/kloeckner-i/db-operator/pkg/utils/database"
+	"github.com/kloeckner-i/db-operator/pkg/utils/dbinstance"
+	"github.com/kloeckner-i/db-operator/pkg/utils/kci"
+	"github.com/kloeckner-i/db-operator/pkg/utils/proxy"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/types"
+
+	// Don't delete below package. Used for driver "cloudsqlpostgres"
+	_ "github.com/GoogleCloudPlatform/cloudsql-proxy/proxy/dialers/postgres"
+)
+
+func init() {
+	backend.Register("google", backend.Backend{
+		Driver:   gsql{},
+		Proxy:    gsql{},
+		Backup:   gsql{},
+		Dialer:   gsql{},
+		Executor: gsql{},
+	})
+}
+
+// gsql manages Google Cloud SQL instances, databases are connected through the cloud sql proxy
+type gsql struct{}
+
+func (gsql) Instance(ctx context.Context, env backend.Env, dbin *kciv1beta1.DbInstance, cred database.AdminCredentials) (dbinstance.DbInstance, error) {
+	// the configmap is optional if the settings are defined in the spec
+	var err error
+	config := ""
+	if dbin.Spec.Google.ConfigmapName.Name != "" {
+		configmap, err := kci.GetConfigResource(ctx, dbin.Spec.Google.ConfigmapName.ToKubernetesType())
+		if err != nil {
+			logrus.Errorf("Instance: name=%s reading GCSQL instance config %s/%s", dbin.Name, dbin.Spec.Google.ConfigmapName.Namespace, dbin.Spec.Google.ConfigmapName.Name)
+			return nil, err
+		}
+		config = configmap.Data["config"]
+	}
+
+	name := dbin.Spec.Google.InstanceName
+	user := cred.Username
+	password := cred.Password
+	apiEndpoint := dbin.Spec.Google.APIEndpoint
+
+	instance := dbinstance.GsqlNew(name, config, user, password, apiEndpoint)
+	instance.Settings = instanceSettings(dbin.Spec.Engine, dbin.Spec.Google.Settings)
+	instance.Operation = dbin.Status.Operation
+	instance.BackupOperation = dbin.Status.BackupOperation
+	if dbin.Spec.Google.FinalBackup != nil {
+		instance.FinalBackupBucket = dbin.Spec.Google.FinalBackup.Bucket
+	}
+	if master := dbin.GoogleMasterInstance(); master != "" {
+		instance.MasterInstanceName, err = sourceInstanceName(ctx, env, master)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if clone := dbin.Spec.Google.CloneOf; clone != nil {
+		instance.CloneSource, err = sourceInstanceName(ctx, env, clone.Instance)
+		if err != nil {
+			return nil, err
+		}
+		instance.ClonePointInTime = clone.PointInTime
+	}
+	if restore := dbin.Spec.Google.RestoreFrom; restore != nil {
+		instance.RestoreSource, err = sourceInstanceName(ctx, env, restore.Instance)
+		if err != nil {
+			return nil, err
+		}
+		instance.RestoreBackupRunID = restore.BackupRunID
+	}
+	return instance, nil
+}
+
+// sourceInstanceName returns the Cloud SQL instance name of the google DbInstance a replica, clone or restore is created from
+func sourceInstanceName(ctx context.Context, env backend.Env, name string) (string, error) {
+	source := &kciv1beta1.DbInstance{}
+	if err := env.Client.Get(ctx, types.NamespacedName{Name: name}, source); err != nil {
+		return "", err
+	}
+	if source.Spec.Google == nil {
+		return "", fmt.Errorf("source instance %s is not a google instance", name)
+	}
+	return source.Spec.Google.InstanceName, nil
+}
+
+// ConfigmapName returns the configmap of the settings, they may be defined in the spec only
+func (gsql) ConfigmapName(dbin *kciv1beta1.DbInstance) (kciv1beta1.NamespacedName, bool) {
+	return dbin.Spec.Google.ConfigmapName, dbin.Spec.Google.ConfigmapName.Name != ""
+}
+
+func (gsql) DatabaseProxy(conf *config.Config, dbcr *kciv1beta1.Database, instance *kciv1beta1.DbInstance) (proxy.Proxy, error) {
+	port, err := backend.InstancePort(instance)
+	if err != nil {
+		return nil, err
+	}
+
+	labels := map[string]string{
+		"app":     "cloudproxy",
+		"db-name": dbcr.Name,
+	}
+
+	monitoringEnabled, err := dbcr.IsMonitoringEnabled()
+	if err != nil {
+		return nil, err
+	}
+
+	// iam users are logged in by the proxy with the key of their service account
+	accessSecretName := dbcr.InstanceAccessSecretName()
+	accessSecretChecksum := instance.Status.AccessSecretChecksum
+	if dbcr.Spec.IAMAuth != nil {
+		accessSecretName = dbcr.Spec.IAMAuth.CredentialsSecret
+		accessSecretChecksum = ""
+	}
+
+	return &proxy.CloudProxy{
+		NamePrefix:             "db-" + dbcr.Name,
+		Namespace:              dbcr.Namespace,
+		InstanceConnectionName: instance.Status.Info["DB_CONN"],
+		AccessSecretName:       accessSecretName,
+		Engine:                 instance.Spec.Engine,
+		Port:                   port,
+		Labels:                 kci.LabelBuilder(labels),
+		Conf:                   conf,
+		MonitoringEnabled:      monitoringEnabled,
+		IAMAuth:                dbcr.Spec.IAMAuth != nil,
+		AccessSecretChecksum:   accessSecretChecksum,
+	}, nil
+}
+
+func (gsql) InstanceProxy(conf *config.Config, dbin *kciv1beta1.DbInstance, namespace string) (proxy.Proxy, error) {
+	port, err := backend.InstancePort(dbin)
+	if err != nil {
+		return nil, err
+	}
+
+	labels := map[string]string{
+		"app":           "cloudproxy",
+		"instance-name": dbin.Name,
+	}
+
+	var accessSecretName string
+	if dbin.Spec.Google.ClientSecret.Name != "" {
+		accessSecretName = dbin.Spec.Google.ClientSecret.Name
+	} else {
+		accessSecretName = conf.Instances.Google.ClientSecretName
+	}
+
+	return &proxy.CloudProxy{
+		NamePrefix:             "dbinstance-" + dbin.Name,
+		Namespace:              namespace,
+		InstanceConnectionName: dbin.Status.Info["DB_CONN"],
+		AccessSecretName:       accessSecretName,
+		Engine:                 dbin.Spec.Engine,
+		Port:                   port,
+		Labels:                 kci.LabelBuilder(labels),
+		Conf:                   conf,
+		MonitoringEnabled:      dbin.IsMonitoringEnabled(),
+		AccessSecretChecksum:   dbin.Status.AccessSecretChecksum,
+	}, nil
+}
+
+// TransparentDatabaseProxy is true, the cloud sql proxy only authorizes the connections
+func (gsql) TransparentDatabaseProxy() bool {
+	return true
+}
+
+func (gsql) BackupHost(dbcr *kciv1beta1.Database, instance *kciv1beta1.DbInstance) (string, error) {
+	return "db-" + dbcr.Name + "-svc", nil // cloud proxy service name
+}
+
+func (gsql) Executor(dbin *kciv1beta1.DbInstance, sql database.Executor) database.Executor {
+	if dbin.Spec.Google.AdminAPI {
+		return dbinstance.GsqlNew(dbin.Spec.Google.InstanceName, "", "", "", dbin.Spec.Google.APIEndpoint)
+	}
+	return &iamExecutor{spec: dbin.Spec.Google, sql: sql}
+}
+
+// iamExecutor creates the iam users of databases through the admin api before their privileges are granted with sql,
+// the instance is only connected to the api if a request has an iam user
+type iamExecutor struct {
+	spec *kciv1beta1.GoogleInstance
+	sql  database.Executor
+}
+
+func (e *iamExecutor) Execute(req database.Request) database.Result {
+	db, err := req.Database()
+	if err != nil || db.GetCredentials().IAMPrincipal == "" {
+		return e.sql.Execute(req)
+	}
+	return dbinstance.GsqlNew(e.spec.InstanceName, "", "", "", e.spec.APIEndpoint).WithIAMUsers(e.sql).Execute(req)
+}
+
+func (gsql) OpenPostgres(p database.Postgres, dataSourceName string) (*sql.DB, error) {
+	db, err := sql.Open("cloudsqlpostgres", dataSourceName)
+	if err != nil {
+		return nil, fmt.Errorf("sql.Open: %v", err)
+	}
+	return db, nil
+}
+
+func (gsql) OpenMysql(m database.Mysql, user, password string) (*sql.DB, error) {
+	db, err := mysql.DialPassword(m.Host, user, password)
+	if err != nil {
+		logrus.Debugf("failed to validate db connection: %s", err)
+		return db, err
+	}
+	return db, nil
+}
@@ -0,0 +1,110 @@
+/*
+ * Copyright 2021 kloeckner.i GmbH
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package google
+
+import (
+	"sort"
+
+	kciv1beta1 "github.com/kloeckner-i/db-operator/api/v1beta1"
+	sqladmin "google.golang.org/api/sqladmin/v1beta4"
+)
+
+// instanceSettings converts the settings of the spec to a DatabaseInstance of the admin api,
+// fields whose zero value is meaningful are sent explicitly
+func instanceSettings(engine string, spec *kciv1beta1.GoogleInstanceSettings) *sqladmin.DatabaseInstance {
+	if spec == nil {
+		return nil
+	}
+
+	settings := &sqladmin.Settings{
+		Tier:                   spec.Tier,
+		DataDiskSizeGb:         spec.DiskSizeGB,
+		StorageAutoResize:      spec.DiskAutoresize,
+		StorageAutoResizeLimit: spec.DiskAutoresizeLimitGB,
+	}
+
+	if spec.Flags != nil {
+		names := []string{}
+		for name := range spec.Flags {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		settings.DatabaseFlags = []*sqladmin.DatabaseFlags{}
+		for _, name := range names {
+			settings.DatabaseFlags = append(settings.DatabaseFlags, &sqladmin.DatabaseFlags{Name: name, Value: spec.Flags[name]})
+		}
+		// an empty map removes all flags
+		settings.ForceSendFields = append(settings.ForceSendFields, "DatabaseFlags")
+	}
+
+	if spec.Backup != nil {
+		settings.BackupConfiguration = &sqladmin.BackupConfiguration{
+			Enabled:         spec.Backup.Enabled,
+			StartTime:       spec.Backup.StartTime,
+			ForceSendFields: []string{"Enabled"},
+		}
+		// point in time recovery of mysql is based on its binary log
+		if engine == "mysql" {
+			settings.BackupConfiguration.BinaryLogEnabled = spec.Backup.PointInTimeRecovery
+			settings.BackupConfiguration.ForceSendFields = append(settings.BackupConfiguration.ForceSendFields, "BinaryLogEnabled")
+		} else {
+			settings.BackupConfiguration.PointInTimeRecoveryEnabled = spec.Backup.PointInTimeRecovery
+			settings.BackupConfiguration.ForceSendFields = append(settings.BackupConfiguration.ForceSendFields, "PointInTimeRecoveryEnabled")
+		}
+		if spec.Backup.RetainedBackups != 0 {
+			settings.BackupConfiguration.BackupRetentionSettings = &sqladmin.BackupRetentionSettings{
+				RetainedBackups: spec.Backup.RetainedBackups,
+				RetentionUnit:   "COUNT",
+			}
+		}
+	}
+
+	if spec.MaintenanceWindow != nil {
+		settings.MaintenanceWindow = &sqladmin.MaintenanceWindow{
+			Day:             spec.MaintenanceWindow.Day,
+			Hour:            spec.MaintenanceWindow.Hour,
+			ForceSendFields: []string{"Hour"},
+		}
+	}
+
+	if spec.AuthorizedNetworks != nil || spec.PrivateNetwork != "" || spec.PublicIP != nil {
+		ipConfiguration := &sqladmin.IpConfiguration{
+			PrivateNetwork: spec.PrivateNetwork,
+		}
+		if spec.AuthorizedNetworks != nil {
+			ipConfiguration.AuthorizedNetworks = []*sqladmin.AclEntry{}
+			for _, network := range spec.AuthorizedNetworks {
+				ipConfiguration.AuthorizedNetworks = append(ipConfiguration.AuthorizedNetworks, &sqladmin.AclEntry{
+					Name:  network.Name,
+					Value: network.Value,
+				})
+			}
+			ipConfiguration.ForceSendFields = append(ipConfiguration.ForceSendFields, "AuthorizedNetworks")
+		}
+		if spec.PublicIP != nil {
+			ipConfiguration.Ipv4Enabled = *spec.PublicIP
+			ipConfiguration.ForceSendFields = append(ipConfiguration.ForceSendFields, "Ipv4Enabled")
+		}
+		settings.IpConfiguration = ipConfiguration
+	}
+
+	return &sqladmin.DatabaseInstance{
+		DatabaseVersion: spec.DatabaseVersion,
+		Region:          spec.Region,
+		Settings:        settings,
+	}
+}
@@ -0,0 +1,67 @@
+/*
+ * Copyright 2021 kloeckner.i GmbH
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package google
+
+import (
+	"encoding/json"
+	"testing"
+
+	kciv1beta1 "github.com/kloeckner-i/db-operator/api/v1beta1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstanceSettings(t *testing.T) {
+	assert.Nil(t, instanceSettings("postgres", nil))
+
+	publicIP := false
+	settings := instanceSettings("postgres", &kciv1beta1.GoogleInstanceSettings{
+		Tier:            "db-custom-1-3840",
+		Region:          "europe-west1",
+		DatabaseVersion: "POSTGRES_14",
+		DiskSizeGB:      20,
+		Flags:           map[string]string{"max_connections": "200", "log_min_duration_statement": "1000"},
+		Backup:          &kciv1beta1.GoogleBackup{Enabled: false},
+		MaintenanceWindow: &kciv1beta1.GoogleMaintenanceWindow{
+			Day:  7,
+			Hour: 0,
+		},
+		PrivateNetwork: "projects/test-project/global/networks/default",
+		PublicIP:       &publicIP,
+	})
+	assert.Equal(t, "europe-west1", settings.Region)
+	assert.Equal(t, "db-custom-1-3840", settings.Settings.Tier)
+	assert.Equal(t, "log_min_duration_statement", settings.Settings.DatabaseFlags[0].Name, "flags are sorted by name")
+
+	data, err := settings.MarshalJSON()
+	assert.NoError(t, err)
+	request := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(data, &request))
+	s := request["settings"].(map[string]interface{})
+	assert.Equal(t, "20", s["dataDiskSizeGb"])
+	assert.Equal(t, false, s["backupConfiguration"].(map[string]interface{})["enabled"], "disabled backups are sent")
+	assert.Equal(t, float64(0), s["maintenanceWindow"].(map[string]interface{})["hour"], "midnight is sent")
+	assert.Equal(t, false, s["ipConfiguration"].(map[string]interface{})["ipv4Enabled"])
+	assert.NotContains(t, s, "storageAutoResize", "undefined fields are taken from the configmap")
+	assert.Equal(t, false, s["backupConfiguration"].(map[string]interface{})["pointInTimeRecoveryEnabled"])
+
+	backup := &kciv1beta1.GoogleBackup{Enabled: true, PointInTimeRecovery: true}
+	settings = instanceSettings("postgres", &kciv1beta1.GoogleInstanceSettings{Backup: backup})
+	assert.True(t, settings.Settings.BackupConfiguration.PointInTimeRecoveryEnabled)
+	settings = instanceSettings("mysql", &kciv1beta1.GoogleInstanceSettings{Backup: backup})
+	assert.True(t, settings.Settings.BackupConfiguration.BinaryLogEnabled, "point in time recovery of mysql uses the binary log")
+	assert.False(t, settings.Settings.BackupConfiguration.PointInTimeRecoveryEnabled)
+}
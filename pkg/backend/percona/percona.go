@@ -0,0 +1,115 @@
+/*
+ * Copyright 2021 kloeckner.i GmbH
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package percona
+
+import (
+	"context"
+
+	kciv1beta1 "github.com/kloeckner-i/db-operator/api/v1beta1"
+	"github.com/kloeckner-i/db-operator/pkg/backend"
+	"github.com/kloeckner-i/db-operator/pkg/config"
+	"github.com/kloeckner-i/db-operator/pkg/utils/database"
+	"github.com/kloeckner-i/db-operator/pkg/utils/dbinstance"
+	"github.com/kloeckner-i/db-operator/pkg/utils/kci"
+	"github.com/kloeckner-i/db-operator/pkg/utils/proxy"
+)
+
+func init() {
+	backend.Register("percona", backend.Backend{
+		Driver: cluster{},
+		Proxy:  cluster{},
+		Backup: cluster{},
+	})
+}
+
+// cluster manages percona xtradb clusters, databases are connected through proxysql
+type cluster struct{}
+
+func (cluster) Instance(ctx context.Context, env backend.Env, dbin *kciv1beta1.DbInstance, cred database.AdminCredentials) (dbinstance.DbInstance, error) {
+	servers := []dbinstance.PerconaServer{}
+	for _, server := range dbin.Spec.Percona.ServerList {
+		servers = append(servers, dbinstance.PerconaServer{
+			Host:     server.Host,
+			Port:     server.Port,
+			ReadOnly: server.ReadOnly,
+		})
+	}
+	certs, err := backend.SSLCerts(ctx, env.Client, dbin)
+	if err != nil {
+		return nil, err
+	}
+	return &dbinstance.PerconaCluster{
+		Servers:      servers,
+		User:         cred.Username,
+		Password:     cred.Password,
+		SSLEnabled:   dbin.Spec.SSLConnection.Enabled,
+		SkipCAVerify: dbin.Spec.SSLConnection.SkipVerify,
+		SSLCerts:     certs,
+		Executor:     env.Executor,
+	}, nil
+}
+
+func (cluster) ConfigmapName(dbin *kciv1beta1.DbInstance) (kciv1beta1.NamespacedName, bool) {
+	return kciv1beta1.NamespacedName{}, false
+}
+
+func (cluster) DatabaseProxy(conf *config.Config, dbcr *kciv1beta1.Database, instance *kciv1beta1.DbInstance) (proxy.Proxy, error) {
+	labels := map[string]string{
+		"app":     "proxysql",
+		"db-name": dbcr.Name,
+	}
+
+	monitoringEnabled, err := dbcr.IsMonitoringEnabled()
+	if err != nil {
+		return nil, err
+	}
+
+	servers := []proxy.BackendServer{}
+	for _, server := range instance.Spec.Percona.ServerList {
+		servers = append(servers, proxy.BackendServer(server))
+	}
+
+	return &proxy.ProxySQL{
+		NamePrefix:            "db-" + dbcr.Name,
+		Namespace:             dbcr.Namespace,
+		Servers:               servers,
+		ServerSSL:             instance.Spec.SSLConnection.Enabled,
+		CredentialsSecretName: dbcr.Spec.SecretName,
+		Labels:                kci.LabelBuilder(labels),
+		Conf:                  conf,
+		MonitoringEnabled:     monitoringEnabled,
+	}, nil
+}
+
+func (cluster) InstanceProxy(conf *config.Config, dbin *kciv1beta1.DbInstance, namespace string) (proxy.Proxy, error) {
+	return nil, backend.ErrNoProxySupport
+}
+
+// TransparentDatabaseProxy is false, proxysql may route reads to replicas which can't be used for consistent dumps
+func (cluster) TransparentDatabaseProxy() bool {
+	return false
+}
+
+func (cluster) BackupHost(dbcr *kciv1beta1.Database, instance *kciv1beta1.DbInstance) (string, error) {
+	// dump from a read-only server to keep the load away from the writable one
+	for _, server := range instance.Spec.Percona.ServerList {
+		if server.ReadOnly {
+			return server.Host, nil
+		}
+	}
+	return instance.Status.Info["DB_CONN"], nil
+}
@@ -0,0 +1,59 @@
+/*
+ * Copyright 2021 kloeckner.i GmbH
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package backend
+
+import (
+	kciv1beta1 "github.com/kloeckner-i/db-operator/api/v1beta1"
+	"github.com/kloeckner-i/db-operator/pkg/config"
+	"github.com/kloeckner-i/db-operator/pkg/utils/kci"
+	"github.com/kloeckner-i/db-operator/pkg/utils/proxy"
+	"github.com/kloeckner-i/db-operator/pkg/utils/sshtunnel"
+)
+
+// PoolerProxy returns the connection pooler of a database with spec.pooler,
+// servers which are only reachable through an ssh jump host are connected through the tunnel sidecar
+func PoolerProxy(conf *config.Config, dbcr *kciv1beta1.Database, instance *kciv1beta1.DbInstance, tunnel *sshtunnel.Sidecar) (proxy.Proxy, error) {
+	if dbcr.Spec.Pooler == nil {
+		return nil, ErrNoProxySupport
+	}
+
+	port, err := InstancePort(instance)
+	if err != nil {
+		return nil, err
+	}
+
+	labels := map[string]string{
+		"app":     "pooler",
+		"db-name": dbcr.Name,
+	}
+
+	return &proxy.Pooler{
+		NamePrefix:            "db-" + dbcr.Name,
+		Namespace:             dbcr.Namespace,
+		Engine:                instance.Spec.Engine,
+		ServerHost:            instance.Status.Info["DB_CONN"],
+		ServerPort:            port,
+		ServerSSL:             instance.Spec.SSLConnection.Enabled,
+		Database:              dbcr.Status.DatabaseName,
+		CredentialsSecretName: dbcr.Spec.SecretName,
+		PoolMode:              dbcr.Spec.Pooler.PoolMode,
+		PoolSize:              dbcr.Spec.Pooler.PoolSize,
+		Labels:                kci.LabelBuilder(labels),
+		Conf:                  conf,
+		Tunnel:                tunnel,
+	}, nil
+}
@@ -0,0 +1,63 @@
+/*
+ * Copyright 2021 kloeckner.i GmbH
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package backend
+
+import (
+	"context"
+	"fmt"
+
+	kciv1beta1 "github.com/kloeckner-i/db-operator/api/v1beta1"
+	"github.com/kloeckner-i/db-operator/pkg/utils/database"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// SSLCAKey is the key of the CA bundle in the certificate secrets of ssl connections
+const SSLCAKey = "ca.crt"
+
+// SSLCerts returns the certificates of the ssl connection of the instance, nil if the instance doesn't reference any
+func SSLCerts(ctx context.Context, c client.Reader, dbin *kciv1beta1.DbInstance) (*database.SSLCerts, error) {
+	ssl := dbin.Spec.SSLConnection
+	if !ssl.Enabled || (ssl.CASecret == nil && ssl.ClientCertSecret == nil) {
+		return nil, nil
+	}
+
+	certs := &database.SSLCerts{}
+	if ssl.ClientCertSecret != nil {
+		secret := &corev1.Secret{}
+		if err := c.Get(ctx, ssl.ClientCertSecret.ToKubernetesType(), secret); err != nil {
+			return nil, fmt.Errorf("can't get client certificate secret of ssl connection: %w", err)
+		}
+		certs.Cert = secret.Data[corev1.TLSCertKey]
+		certs.Key = secret.Data[corev1.TLSPrivateKeyKey]
+		if len(certs.Cert) == 0 || len(certs.Key) == 0 {
+			return nil, fmt.Errorf("secret %s/%s has no keys %s and %s", secret.Namespace, secret.Name, corev1.TLSCertKey, corev1.TLSPrivateKeyKey)
+		}
+		certs.RootCert = secret.Data[SSLCAKey]
+	}
+	if ssl.CASecret != nil {
+		secret := &corev1.Secret{}
+		if err := c.Get(ctx, ssl.CASecret.ToKubernetesType(), secret); err != nil {
+			return nil, fmt.Errorf("can't get CA secret of ssl connection: %w", err)
+		}
+		certs.RootCert = secret.Data[SSLCAKey]
+		if len(certs.RootCert) == 0 {
+			return nil, fmt.Errorf("secret %s/%s has no key %s", secret.Namespace, secret.Name, SSLCAKey)
+		}
+	}
+	return certs, nil
+}
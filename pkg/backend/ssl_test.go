@@ -0,0 +1,65 @@
+/*
+ * Copyright 2021 kloeckner.i GmbH
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package backend
+
+import (
+	"context"
+	"testing"
+
+	kciv1beta1 "github.com/kloeckner-i/db-operator/api/v1beta1"
+	"github.com/kloeckner-i/db-operator/pkg/utils/database"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestSSLCerts(t *testing.T) {
+	ctx := context.Background()
+	client := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "db-operator", Name: "postgres-client"},
+		Data:       map[string][]byte{corev1.TLSCertKey: []byte("cert"), corev1.TLSPrivateKeyKey: []byte("key"), SSLCAKey: []byte("server ca")},
+	}
+	ca := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "db-operator", Name: "postgres-ca"},
+		Data:       map[string][]byte{SSLCAKey: []byte("ca")},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(client, ca).Build()
+
+	dbin := &kciv1beta1.DbInstance{}
+	certs, err := SSLCerts(ctx, c, dbin)
+	assert.NoError(t, err)
+	assert.Nil(t, certs, "instance doesn't use ssl")
+
+	dbin.Spec.SSLConnection = kciv1beta1.DbInstanceSSLConnection{
+		Enabled:          true,
+		ClientCertSecret: &kciv1beta1.NamespacedName{Namespace: "db-operator", Name: "postgres-client"},
+	}
+	certs, err = SSLCerts(ctx, c, dbin)
+	assert.NoError(t, err)
+	assert.Equal(t, &database.SSLCerts{RootCert: []byte("server ca"), Cert: []byte("cert"), Key: []byte("key")}, certs, "CA of the client cert secret is used")
+
+	dbin.Spec.SSLConnection.CASecret = &kciv1beta1.NamespacedName{Namespace: "db-operator", Name: "postgres-ca"}
+	certs, err = SSLCerts(ctx, c, dbin)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("ca"), certs.RootCert, "CA secret takes precedence")
+
+	dbin.Spec.SSLConnection.ClientCertSecret.Name = "missing"
+	_, err = SSLCerts(ctx, c, dbin)
+	assert.Error(t, err)
+}
@@ -32,6 +32,8 @@ func TestLoadConfig(t *testing.T) {
 	confStatic.Instances.Google.ClientSecretName = "cloudsql-readonly-serviceaccount"
 	assert.Equal(t, confStatic.Instances.Google.ClientSecretName, confLoad.Instances.Google.ClientSecretName, "Values should be match")
 	assert.EqualValues(t, confLoad.Backup.ActiveDeadlineSeconds, int64(600))
+	assert.Equal(t, "cluster1-", confLoad.Naming.Prefix)
+	assert.Equal(t, "cluster1", confLoad.ClusterID)
 }
 
 func TestLoadConfigFailCases(t *testing.T) {
@@ -16,11 +16,19 @@
 
 package config
 
+import "github.com/kloeckner-i/db-operator/pkg/utils/naming"
+
 // Config defines configurations needed by db-operator
 type Config struct {
 	Instances  instanceConfig   `yaml:"instance"`
 	Backup     backupConfig     `yaml:"backup"`
 	Monitoring monitoringConfig `yaml:"monitoring"`
+	Clone      cloneConfig      `yaml:"clone"`
+	Executor   executorConfig   `yaml:"executor"`
+	Naming     naming.Rules     `yaml:"naming"`
+	// ClusterID is written to the owner markers of databases and users on the server,
+	// it must be unique for every cluster sharing a database server
+	ClusterID string `yaml:"clusterID"`
 }
 
 type instanceConfig struct {
@@ -34,7 +42,48 @@ type googleInstanceConfig struct {
 	ProxyConfig      proxyConfig `yaml:"proxy"`
 }
 
-type genericInstanceConfig struct { // TODO
+type genericInstanceConfig struct {
+	Pooler    poolerConfig    `yaml:"pooler"`
+	Provision provisionConfig `yaml:"provision"`
+	SSHTunnel sshTunnelConfig `yaml:"sshTunnel"`
+}
+
+// sshTunnelConfig defines docker image of the sidecar forwarding the database port through the jump host,
+// it's added to backup jobs of generic instances with spec.generic.sshTunnel
+type sshTunnelConfig struct {
+	Image string `yaml:"image"`
+}
+
+// provisionConfig defines docker images of database servers
+// server will be deployed by db-operator when a generic instance has spec.generic.provision
+type provisionConfig struct {
+	Postgres     postgresProvisionConfig `yaml:"postgres"`
+	Mysql        mysqlProvisionConfig    `yaml:"mysql"`
+	NodeSelector map[string]string       `yaml:"nodeSelector"`
+}
+
+type postgresProvisionConfig struct {
+	Image string `yaml:"image"`
+}
+
+type mysqlProvisionConfig struct {
+	Image string `yaml:"image"`
+}
+
+// poolerConfig defines docker images of connection poolers
+// pooler will be created by db-operator when a database on a generic instance has spec.pooler
+type poolerConfig struct {
+	Postgres     postgresPoolerConfig `yaml:"postgres"`
+	Mysql        mysqlPoolerConfig    `yaml:"mysql"`
+	NodeSelector map[string]string    `yaml:"nodeSelector"`
+}
+
+type postgresPoolerConfig struct {
+	Image string `yaml:"image"`
+}
+
+type mysqlPoolerConfig struct {
+	Image string `yaml:"image"`
 }
 
 type perconaClusterConfig struct {
@@ -75,6 +124,30 @@ type ResourceList struct {
 	Memory string `yaml:"memory,omitempty"`
 }
 
+// executorConfig defines the jobs running queries of instances with spec.executor,
+// the image is the image of db-operator which runs a single request in executor mode
+type executorConfig struct {
+	Image                 string `yaml:"image"`
+	ActiveDeadlineSeconds int64  `yaml:"activeDeadlineSeconds"`
+}
+
+// cloneConfig defines docker image for copying the content of a database into another one
+// clone job will be created by db-operator when a database has a data source that can't be cloned in place
+type cloneConfig struct {
+	Postgres              postgresCloneConfig `yaml:"postgres"`
+	Mysql                 mysqlCloneConfig    `yaml:"mysql"`
+	NodeSelector          map[string]string   `yaml:"nodeSelector"`
+	ActiveDeadlineSeconds int64               `yaml:"activeDeadlineSeconds"`
+}
+
+type postgresCloneConfig struct {
+	Image string `yaml:"image"`
+}
+
+type mysqlCloneConfig struct {
+	Image string `yaml:"image"`
+}
+
 // monitoringConfig defines prometheus exporter configurations
 // which will be created by db-operator when monitoring is enabled
 type monitoringConfig struct {
@@ -0,0 +1,76 @@
+/*
+ * Copyright 2021 kloeckner.i GmbH
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package azure
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+const (
+	defaultAuthorityHost = "https://login.microsoftonline.com/"
+	managementScope      = "https://management.azure.com/.default"
+)
+
+// Credentials is a client secret of an azure ad application (service principal)
+type Credentials struct {
+	TenantID     string
+	ClientID     string
+	ClientSecret string
+}
+
+// ErrNoCredentials is returned when the client secret is not configured
+var ErrNoCredentials = errors.New("azure credentials are not defined, AZURE_TENANT_ID, AZURE_CLIENT_ID and AZURE_CLIENT_SECRET must be set")
+
+// GetCredentials reads the client secret from the standard azure environment variables
+func GetCredentials() (Credentials, error) {
+	creds := Credentials{
+		TenantID:     os.Getenv("AZURE_TENANT_ID"),
+		ClientID:     os.Getenv("AZURE_CLIENT_ID"),
+		ClientSecret: os.Getenv("AZURE_CLIENT_SECRET"),
+	}
+	if creds.TenantID == "" || creds.ClientID == "" || creds.ClientSecret == "" {
+		return Credentials{}, ErrNoCredentials
+	}
+	return creds, nil
+}
+
+// DefaultSubscriptionID returns the subscription used if an instance doesn't define one
+func DefaultSubscriptionID() string {
+	return os.Getenv("AZURE_SUBSCRIPTION_ID")
+}
+
+// Client returns a http client which authorizes requests to the azure resource manager
+func (c Credentials) Client(ctx context.Context) *http.Client {
+	authorityHost := os.Getenv("AZURE_AUTHORITY_HOST")
+	if authorityHost == "" {
+		authorityHost = defaultAuthorityHost
+	}
+
+	conf := clientcredentials.Config{
+		ClientID:     c.ClientID,
+		ClientSecret: c.ClientSecret,
+		TokenURL:     strings.TrimSuffix(authorityHost, "/") + "/" + c.TenantID + "/oauth2/v2.0/token",
+		Scopes:       []string{managementScope},
+	}
+	return conf.Client(ctx)
+}
@@ -0,0 +1,102 @@
+/*
+ * Copyright 2021 kloeckner.i GmbH
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Dialer opens the connections of a backend to its database servers
+type Dialer interface {
+	// OpenPostgres connects to the server of the database with a data source name of lib/pq
+	OpenPostgres(p Postgres, dataSourceName string) (*sql.DB, error)
+	// OpenMysql connects to the server of the database as the user
+	OpenMysql(m Mysql, user, password string) (*sql.DB, error)
+}
+
+var (
+	dialers   = map[string]Dialer{}
+	dialersMu sync.RWMutex
+)
+
+// RegisterDialer makes the dialer open the connections of the backend,
+// databases of backends without a dialer are connected by TCPDialer
+func RegisterDialer(backend string, dialer Dialer) {
+	dialersMu.Lock()
+	defer dialersMu.Unlock()
+	dialers[backend] = dialer
+}
+
+func dialerFor(backend string) Dialer {
+	dialersMu.RLock()
+	defer dialersMu.RUnlock()
+	if dialer, found := dialers[backend]; found {
+		return dialer
+	}
+	return TCPDialer{}
+}
+
+// TCPDialer connects to database servers by address and port,
+// servers behind an ssh jump host are connected through the tunnel of the database
+type TCPDialer struct {
+	// AllowCleartextPasswords sends the password of mysql users in clear text when the server asks for it,
+	// it's only sent for iam authentication through ssl connections with a verified server certificate
+	AllowCleartextPasswords bool
+}
+
+// OpenPostgres implements Dialer
+func (d TCPDialer) OpenPostgres(p Postgres, dataSourceName string) (*sql.DB, error) {
+	if p.Tunnel != nil {
+		return sql.OpenDB(pqTunnelConnector{dsn: dataSourceName, tunnel: p.Tunnel}), nil
+	}
+	db, err := sql.Open("postgres", dataSourceName)
+	if err != nil {
+		return nil, fmt.Errorf("sql.Open: %v", err)
+	}
+	return db, nil
+}
+
+// OpenMysql implements Dialer
+func (d TCPDialer) OpenMysql(m Mysql, user, password string) (*sql.DB, error) {
+	network := "tcp"
+	if m.Tunnel != nil {
+		network = m.Tunnel.mysqlNetwork()
+	}
+	tlsConfig := m.sslMode()
+	if m.SSLEnabled && m.SSLCerts != nil {
+		var err error
+		tlsConfig, err = m.SSLCerts.mysqlTLSConfig(m.Host, m.SkipCAVerify)
+		if err != nil {
+			return nil, err
+		}
+	}
+	dataSourceName := fmt.Sprintf("%s:%s@%s(%s:%d)/?tls=%s", user, password, network, m.Host, m.Port, tlsConfig)
+	if d.AllowCleartextPasswords && m.IAMAuth && m.SSLEnabled && !m.SkipCAVerify {
+		dataSourceName += "&allowCleartextPasswords=true"
+	}
+	db, err := sql.Open("mysql", dataSourceName)
+	if err != nil {
+		logrus.Debugf("failed to validate db connection: %s", err)
+		return db, err
+	}
+	db.SetMaxIdleConns(0)
+	return db, nil
+}
@@ -0,0 +1,239 @@
+/*
+ * Copyright 2021 kloeckner.i GmbH
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Operations which are run by an executor
+const (
+	// OpCreate verifies the ownership, creates database and user and marks them as owned,
+	// existing objects are only verified and marked if Adopt is set
+	OpCreate = "create"
+	// OpDelete verifies the ownership and deletes database and user
+	OpDelete = "delete"
+	// OpMask applies the masking rules
+	OpMask = "mask"
+	// OpCheckStatus checks the connection with the credentials of the database
+	OpCheckStatus = "checkStatus"
+	// OpIsPrimary checks if the server accepts writes
+	OpIsPrimary = "isPrimary"
+	// OpCreateReader creates the Reader user which can only read the database
+	OpCreateReader = "createReader"
+	// OpDeleteReader revokes the privileges of the Reader user and deletes it
+	OpDeleteReader = "deleteReader"
+)
+
+// Request is a database operation with everything needed to connect to the server,
+// it's serialized when the operation is run outside of the operator
+type Request struct {
+	Operation string           `json:"operation"`
+	Postgres  *Postgres        `json:"postgres,omitempty"`
+	Mysql     *Mysql           `json:"mysql,omitempty"`
+	Admin     AdminCredentials `json:"admin"`
+	Owner     Owner            `json:"owner,omitempty"`
+	Adopt     bool             `json:"adopt,omitempty"`
+	Rules     []MaskingRule    `json:"rules,omitempty"`
+	// MaskingSalt is prepended to values before they are hashed by masking rules
+	MaskingSalt string            `json:"maskingSalt,omitempty"`
+	Reader      ReaderCredentials `json:"reader,omitempty"`
+	// Owned is set if database and user were created for the requester before,
+	// executors which can't read owner markers only change existing objects if it's set
+	Owned bool `json:"owned,omitempty"`
+	// BackendOperation is the operation a previous attempt of the request started in the backend api
+	BackendOperation string `json:"backendOperation,omitempty"`
+}
+
+// ErrRequestInProgress is returned while a request is run asynchronously,
+// the caller repeats the request later to get its result
+var ErrRequestInProgress = errors.New("request is still running")
+
+// Result is the outcome of a request
+type Result struct {
+	// Pending is set while the request is run somewhere else, it's never serialized
+	Pending bool   `json:"-"`
+	Error   string `json:"error,omitempty"`
+	// Conflict is set instead of Error if the objects are owned by another resource
+	Conflict *OwnershipConflictError `json:"conflict,omitempty"`
+	Primary  bool                    `json:"primary,omitempty"`
+	Masking  []maskingResult         `json:"masking,omitempty"`
+	// BackendOperation is the operation the request started in the backend api,
+	// the next attempt of the request continues it
+	BackendOperation string `json:"backendOperation,omitempty"`
+}
+
+type maskingResult struct {
+	Rule         MaskingRule `json:"rule"`
+	RowsAffected int64       `json:"rowsAffected"`
+	Error        string      `json:"error,omitempty"`
+}
+
+// Executor runs requests against the database server
+type Executor interface {
+	Execute(req Request) Result
+}
+
+// LocalExecutor runs requests in the operator pod
+type LocalExecutor struct{}
+
+// Execute implements Executor
+func (LocalExecutor) Execute(req Request) Result {
+	return Execute(req)
+}
+
+// NewRequest builds a request of the operation on db
+func NewRequest(operation string, db Database, admin AdminCredentials) (Request, error) {
+	req := Request{Operation: operation, Admin: admin}
+	switch db := db.(type) {
+	case Postgres:
+		req.Postgres = &db
+	case *Postgres:
+		req.Postgres = db
+	case Mysql:
+		req.Mysql = &db
+	case *Mysql:
+		req.Mysql = db
+	default:
+		return Request{}, errors.New("not supported database type")
+	}
+	return req, nil
+}
+
+// Database returns the database the request is run on
+func (req Request) Database() (Database, error) {
+	switch {
+	case req.Postgres != nil:
+		return *req.Postgres, nil
+	case req.Mysql != nil:
+		return *req.Mysql, nil
+	default:
+		return nil, errors.New("request has no database")
+	}
+}
+
+// Execute runs the request
+func Execute(req Request) Result {
+	db, err := req.Database()
+	if err != nil {
+		return ErrorResult(err)
+	}
+
+	switch req.Operation {
+	case OpCreate:
+		if err := VerifyOwnership(db, req.Admin, req.Owner); err != nil {
+			return ErrorResult(err)
+		}
+		if !req.Adopt {
+			if err := Create(db, req.Admin); err != nil {
+				return ErrorResult(err)
+			}
+		}
+		return ErrorResult(MarkOwnership(db, req.Admin, req.Owner))
+	case OpDelete:
+		if err := VerifyOwnership(db, req.Admin, req.Owner); err != nil {
+			return ErrorResult(err)
+		}
+		return ErrorResult(Delete(db, req.Admin))
+	case OpMask:
+		results, err := Mask(db, req.Admin, req.Rules, req.MaskingSalt)
+		result := ErrorResult(err)
+		for _, r := range results {
+			masking := maskingResult{Rule: r.Rule, RowsAffected: r.RowsAffected}
+			if r.Err != nil {
+				masking.Error = r.Err.Error()
+			}
+			result.Masking = append(result.Masking, masking)
+		}
+		return result
+	case OpCheckStatus:
+		return ErrorResult(CheckStatus(db, req.Admin))
+	case OpIsPrimary:
+		primary, err := IsPrimary(db, req.Admin)
+		result := ErrorResult(err)
+		result.Primary = primary
+		return result
+	case OpCreateReader:
+		return ErrorResult(CreateReader(db, req.Admin, req.Reader))
+	case OpDeleteReader:
+		return ErrorResult(DeleteReader(db, req.Admin, req.Reader.Username))
+	default:
+		return ErrorResult(fmt.Errorf("unknown operation %s", req.Operation))
+	}
+}
+
+// ErrorResult returns the result of a request which failed with err, an empty result if err is nil
+func ErrorResult(err error) Result {
+	if err == nil {
+		return Result{}
+	}
+	var conflict *OwnershipConflictError
+	if errors.As(err, &conflict) {
+		return Result{Conflict: conflict}
+	}
+	return Result{Error: err.Error()}
+}
+
+// PendingResult returns the result of a request which is still running
+func PendingResult() Result {
+	return Result{Pending: true}
+}
+
+// Err returns the error of the request, an *OwnershipConflictError for ownership conflicts
+// and ErrRequestInProgress while it's pending
+func (r Result) Err() error {
+	if r.Pending {
+		return ErrRequestInProgress
+	}
+	if r.Conflict != nil {
+		return r.Conflict
+	}
+	if r.Error != "" {
+		return errors.New(r.Error)
+	}
+	return nil
+}
+
+// MaskingResults returns the results of the masking rules of the request
+func (r Result) MaskingResults() []MaskingResult {
+	results := []MaskingResult{}
+	for _, masking := range r.Masking {
+		result := MaskingResult{Rule: masking.Rule, RowsAffected: masking.RowsAffected}
+		if masking.Error != "" {
+			result.Err = errors.New(masking.Error)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// ExecuteFile runs the request stored in requestPath as json, it's the entrypoint of executor jobs.
+// The error is only set if the request can't be read, failures of the request are part of the result.
+func ExecuteFile(requestPath string) (Result, error) {
+	data, err := os.ReadFile(requestPath)
+	if err != nil {
+		return Result{}, err
+	}
+	req := Request{}
+	if err := json.Unmarshal(data, &req); err != nil {
+		return Result{}, fmt.Errorf("can not parse request - %s", err)
+	}
+	return Execute(req), nil
+}
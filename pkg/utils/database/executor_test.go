@@ -0,0 +1,58 @@
+/*
+ * Copyright 2021 kloeckner.i GmbH
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResultKeepsOwnershipConflict(t *testing.T) {
+	conflict := &OwnershipConflictError{Kind: ownedDatabase, Name: "testdb", Owner: Owner{ClusterID: "other", Namespace: "default", Name: "testdb"}}
+	data, err := json.Marshal(ErrorResult(conflict))
+	assert.NoError(t, err)
+
+	result := Result{}
+	assert.NoError(t, json.Unmarshal(data, &result))
+	var parsed *OwnershipConflictError
+	assert.True(t, errors.As(result.Err(), &parsed))
+	assert.Equal(t, conflict.Error(), parsed.Error())
+}
+
+func TestExecuteUnknownOperation(t *testing.T) {
+	req, err := NewRequest("unknown", Postgres{}, AdminCredentials{})
+	assert.NoError(t, err)
+	assert.Error(t, Execute(req).Err())
+
+	_, err = NewRequest(OpCreate, nil, AdminCredentials{})
+	assert.Error(t, err)
+}
+
+func TestMaskingResults(t *testing.T) {
+	result := Result{Masking: []maskingResult{
+		{Rule: MaskingRule{Table: "users", Column: "email", Strategy: MaskFakeEmail}, RowsAffected: 3},
+		{Rule: MaskingRule{Table: "orders", Strategy: MaskTruncate}, Error: "permission denied"},
+	}}
+	results := result.MaskingResults()
+	assert.Len(t, results, 2)
+	assert.NoError(t, results[0].Err)
+	assert.Equal(t, int64(3), results[0].RowsAffected)
+	assert.EqualError(t, results[1].Err, "permission denied")
+}
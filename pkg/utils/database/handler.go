@@ -16,6 +16,11 @@
 
 package database
 
+import (
+	"errors"
+	"fmt"
+)
+
 // Create executes queries to create database and user
 func Create(db Database, admin AdminCredentials) error {
 	err := db.createDatabase(admin)
@@ -45,6 +50,86 @@ func Delete(db Database, admin AdminCredentials) error {
 	return nil
 }
 
+// CheckStatus checks the connection with the credentials of the database,
+// the operator can't log in as iam user, it checks that database and user exist instead
+func CheckStatus(db Database, admin AdminCredentials) error {
+	if db.GetCredentials().IAMPrincipal == "" {
+		return db.CheckStatus()
+	}
+	return db.checkExistence(admin)
+}
+
+// IsPrimary returns true if the server accepts writes
+func IsPrimary(db Database, admin AdminCredentials) (bool, error) {
+	readOnly, err := db.isReadOnly(admin)
+	if err != nil {
+		return false, err
+	}
+	return !readOnly, nil
+}
+
+// CreateReader creates a user which can only read the database, it's used to copy the database
+// without handing out the credentials of its owner
+func CreateReader(db Database, admin AdminCredentials, reader ReaderCredentials) error {
+	if reader.Username == "" || reader.Password == "" {
+		return errors.New("reader credentials are not defined")
+	}
+	return db.createReader(admin, reader)
+}
+
+// DeleteReader revokes the privileges of the user created by CreateReader and deletes it
+func DeleteReader(db Database, admin AdminCredentials, username string) error {
+	if username == "" {
+		return errors.New("reader username is not defined")
+	}
+	return db.deleteReader(admin, username)
+}
+
+// Mask applies masking rules in the given order and returns a result per rule,
+// rules are applied even if a previous one failed, the returned error reports the first failure.
+// Hashed values are salted, the same salt must be used for all rules of a copy to keep values joinable.
+func Mask(db Database, admin AdminCredentials, rules []MaskingRule, salt string) ([]MaskingResult, error) {
+	var firstErr error
+	results := []MaskingResult{}
+
+	for _, rule := range rules {
+		result := MaskingResult{Rule: rule}
+		if err := validateMaskingRule(rule, salt); err != nil {
+			result.Err = err
+		} else {
+			result.RowsAffected, result.Err = db.mask(admin, rule, salt)
+		}
+		if result.Err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("masking %s failed - %s", rule.Table, result.Err)
+		}
+		results = append(results, result)
+	}
+
+	return results, firstErr
+}
+
+func validateMaskingRule(rule MaskingRule, salt string) error {
+	if rule.Table == "" {
+		return errors.New("table is not defined")
+	}
+
+	switch rule.Strategy {
+	case MaskTruncate:
+		return nil
+	case MaskNull, MaskHash, MaskFakeEmail, MaskFixed:
+		if rule.Column == "" {
+			return fmt.Errorf("column is required for %s strategy", rule.Strategy)
+		}
+		if salt == "" && (rule.Strategy == MaskHash || rule.Strategy == MaskFakeEmail) {
+			// unsalted hashes of known values like emails can be reversed with a lookup table
+			return fmt.Errorf("salt is required for %s strategy", rule.Strategy)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown masking strategy %s", rule.Strategy)
+	}
+}
+
 // New returns database interface according to engine type
 func New(engine string) Database {
 	switch engine {
@@ -60,6 +60,149 @@ func TestCreateMysql(t *testing.T) {
 	assert.NoErrorf(t, err, "Unexpected error %v", err)
 }
 
+func TestValidateMaskingRule(t *testing.T) {
+	assert.NoError(t, validateMaskingRule(MaskingRule{Table: "users", Strategy: MaskTruncate}, ""))
+	assert.NoError(t, validateMaskingRule(MaskingRule{Table: "users", Column: "email", Strategy: MaskFakeEmail}, "salt"))
+	assert.NoError(t, validateMaskingRule(MaskingRule{Table: "users", Column: "phone", Strategy: MaskNull}, ""))
+	assert.Error(t, validateMaskingRule(MaskingRule{Table: "users", Column: "email", Strategy: MaskFakeEmail}, ""))
+	assert.Error(t, validateMaskingRule(MaskingRule{Column: "email", Strategy: MaskHash}, "salt"))
+	assert.Error(t, validateMaskingRule(MaskingRule{Table: "users", Strategy: MaskNull}, "salt"))
+	assert.Error(t, validateMaskingRule(MaskingRule{Table: "users", Column: "email", Strategy: "shuffle"}, "salt"))
+}
+
+func TestMaskPostgres(t *testing.T) {
+	p := testPostgres()
+	admin := getPostgresAdmin()
+
+	assert.NoError(t, p.executeExec(p.Database, "CREATE TABLE IF NOT EXISTS users (email text, phone text, name text);", admin))
+	assert.NoError(t, p.executeExec(p.Database, "CREATE TABLE IF NOT EXISTS audit (entry text);", admin))
+	assert.NoError(t, p.executeExec(p.Database, "INSERT INTO users VALUES ('a@b.c', '123', 'alice'), ('d@e.f', '456', 'bob');", admin))
+	assert.NoError(t, p.executeExec(p.Database, "INSERT INTO audit VALUES ('login');", admin))
+
+	rules := []MaskingRule{
+		{Table: "users", Column: "email", Strategy: MaskFakeEmail},
+		{Table: "users", Column: "phone", Strategy: MaskNull},
+		{Table: "users", Column: "name", Strategy: MaskFixed, Value: "john"},
+		{Table: "public.audit", Strategy: MaskTruncate},
+		{Table: "missing", Column: "x", Strategy: MaskHash},
+	}
+	results, err := Mask(p, admin, rules, "testsalt")
+	assert.Error(t, err)
+	assert.Len(t, results, 5)
+	assert.Equal(t, int64(2), results[0].RowsAffected)
+	assert.Equal(t, int64(1), results[3].RowsAffected)
+	assert.NoError(t, results[2].Err)
+	assert.Error(t, results[4].Err)
+
+	assert.True(t, p.isRowExist(p.Database, "SELECT name FROM users WHERE name = 'john' AND phone IS NULL AND email LIKE 'user_%@example.com';", admin.Username, admin.Password))
+	assert.False(t, p.isRowExist(p.Database, "SELECT entry FROM audit;", admin.Username, admin.Password))
+}
+
+func TestMaskMysql(t *testing.T) {
+	m := testMysql()
+	admin := getMysqlAdmin()
+
+	assert.NoError(t, m.executeQuery("CREATE TABLE IF NOT EXISTS testdb.users (email text, name text);", admin))
+	assert.NoError(t, m.executeQuery("INSERT INTO testdb.users VALUES ('a@b.c', 'alice');", admin))
+
+	rules := []MaskingRule{
+		{Table: "users", Column: "email", Strategy: MaskHash},
+		{Table: "users", Column: "name", Strategy: MaskFixed, Value: "john"},
+	}
+	results, err := Mask(m, admin, rules, "testsalt")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), results[0].RowsAffected)
+	assert.True(t, m.isRowExist("SELECT name FROM testdb.users WHERE name = 'john' AND email <> 'a@b.c';", admin))
+}
+
+func TestOwnerMarker(t *testing.T) {
+	owner := Owner{ClusterID: "cluster1", Namespace: "test", Name: "db", UID: "a1"}
+	marker, err := formatOwnerMarker(owner)
+	assert.NoError(t, err)
+
+	parsed, ok := parseOwnerMarker(marker)
+	assert.True(t, ok)
+	assert.Equal(t, owner, parsed)
+
+	_, ok = parseOwnerMarker("")
+	assert.False(t, ok)
+	_, ok = parseOwnerMarker("comment set by a human")
+	assert.False(t, ok)
+	_, ok = parseOwnerMarker(`{"clusterID":"cluster1"}`)
+	assert.False(t, ok)
+
+	recreated := owner
+	recreated.UID = "b2"
+	assert.True(t, owner.sameAs(recreated))
+	otherCluster := owner
+	otherCluster.ClusterID = "cluster2"
+	assert.False(t, owner.sameAs(otherCluster))
+}
+
+func testOwnership(t *testing.T, db Database, admin AdminCredentials) {
+	owner := Owner{ClusterID: "cluster1", Namespace: "test", Name: "db", UID: "a1"}
+	other := Owner{ClusterID: "cluster2", Namespace: "test", Name: "db", UID: "b2"}
+
+	assert.NoError(t, VerifyOwnership(db, admin, owner))
+	assert.NoError(t, MarkOwnership(db, admin, owner))
+	assert.NoError(t, VerifyOwnership(db, admin, owner))
+
+	err := VerifyOwnership(db, admin, other)
+	conflict := &OwnershipConflictError{}
+	assert.ErrorAs(t, err, &conflict)
+	assert.Equal(t, owner, conflict.Owner)
+}
+
+func TestOwnershipPostgres(t *testing.T) {
+	testOwnership(t, testPostgres(), getPostgresAdmin())
+}
+
+func TestOwnershipMysql(t *testing.T) {
+	testOwnership(t, testMysql(), getMysqlAdmin())
+}
+
+func TestIsPrimaryPostgres(t *testing.T) {
+	primary, err := IsPrimary(testPostgres(), getPostgresAdmin())
+	assert.NoError(t, err)
+	assert.True(t, primary)
+}
+
+func TestIsPrimaryMysql(t *testing.T) {
+	primary, err := IsPrimary(testMysql(), getMysqlAdmin())
+	assert.NoError(t, err)
+	assert.True(t, primary)
+}
+
+func TestReaderPostgres(t *testing.T) {
+	p := testPostgres()
+	admin := getPostgresAdmin()
+	reader := ReaderCredentials{Username: "clone_reader", Password: "readerpass"}
+
+	assert.Error(t, CreateReader(p, admin, ReaderCredentials{Username: "clone_reader"}))
+	assert.NoError(t, CreateReader(p, admin, reader))
+	// the password is updated if the reader exists
+	assert.NoError(t, CreateReader(p, admin, reader))
+	assert.True(t, p.isRowExist("postgres", "SELECT 1 FROM pg_roles WHERE rolname = 'clone_reader';", admin.Username, admin.Password))
+
+	assert.NoError(t, DeleteReader(p, admin, reader.Username))
+	assert.False(t, p.isRowExist("postgres", "SELECT 1 FROM pg_roles WHERE rolname = 'clone_reader';", admin.Username, admin.Password))
+	assert.NoError(t, DeleteReader(p, admin, reader.Username))
+}
+
+func TestReaderMysql(t *testing.T) {
+	m := testMysql()
+	admin := getMysqlAdmin()
+	reader := ReaderCredentials{Username: "clone_reader", Password: "readerpass"}
+
+	assert.NoError(t, CreateReader(m, admin, reader))
+	assert.NoError(t, CreateReader(m, admin, reader))
+	assert.True(t, m.isRowExist("SELECT 1 FROM mysql.user WHERE user = 'clone_reader';", admin))
+
+	assert.NoError(t, DeleteReader(m, admin, reader.Username))
+	assert.False(t, m.isRowExist("SELECT 1 FROM mysql.user WHERE user = 'clone_reader';", admin))
+	assert.NoError(t, DeleteReader(m, admin, reader.Username))
+}
+
 func TestDeletePostgres(t *testing.T) {
 	p := testPostgres()
 	admin := getPostgresAdmin()
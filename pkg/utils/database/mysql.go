@@ -20,16 +20,19 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
-	"github.com/GoogleCloudPlatform/cloudsql-proxy/proxy/dialers/mysql"
-
 	// do not delete
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/kloeckner-i/db-operator/pkg/utils/kci"
 	"github.com/sirupsen/logrus"
 )
 
+// mysql has no comments on databases and users,
+// owner markers are kept in a metadata table instead
+const mysqlOwnershipTable = "`db_operator`.`ownership`"
+
 // Mysql is a database interface, abstraced object
 // represents a database on mysql instance
 // can be used to execute query to mysql database
@@ -42,6 +45,15 @@ type Mysql struct {
 	Password     string
 	SSLEnabled   bool
 	SkipCAVerify bool
+	// SSLCerts are the CA bundle and the client certificate of ssl connections, the system roots are used if it's nil
+	SSLCerts *SSLCerts
+	// Tunnel is the jump host the server is reached through, the server is connected directly if it's nil
+	Tunnel *SSHTunnel
+	// IAMPrincipal is the cloud iam principal User authenticates with instead of Password,
+	// the user is created by the cloud provider and only granted privileges on the database
+	IAMPrincipal string
+	// IAMAuth is set when the admin password is an iam auth token of the cloud provider, which is sent in clear text
+	IAMAuth bool
 }
 
 const mysqlDefaultSSLMode = "preferred"
@@ -84,27 +96,7 @@ func (m Mysql) CheckStatus() error {
 }
 
 func (m Mysql) getDbConn(user, password string) (*sql.DB, error) {
-	var db *sql.DB
-	var err error
-
-	switch m.Backend {
-	case "google":
-		db, err = mysql.DialPassword(m.Host, user, password)
-		if err != nil {
-			logrus.Debugf("failed to validate db connection: %s", err)
-			return db, err
-		}
-	default:
-		dataSourceName := fmt.Sprintf("%s:%s@tcp(%s:%d)/?tls=%s", user, password, m.Host, m.Port, m.sslMode())
-		db, err = sql.Open("mysql", dataSourceName)
-		if err != nil {
-			logrus.Debugf("failed to validate db connection: %s", err)
-			return db, err
-		}
-		db.SetMaxIdleConns(0)
-	}
-
-	return db, nil
+	return dialerFor(m.Backend).OpenMysql(m, user, password)
 }
 
 func (m Mysql) executeQuery(query string, admin AdminCredentials) error {
@@ -151,7 +143,7 @@ func (m Mysql) deleteDatabase(admin AdminCredentials) error {
 		return err
 	}
 
-	return nil
+	return m.removeOwnerMarker(admin, ownedDatabase)
 }
 
 func (m Mysql) createUser(admin AdminCredentials) error {
@@ -159,7 +151,11 @@ func (m Mysql) createUser(admin AdminCredentials) error {
 	grant := fmt.Sprintf("GRANT ALL PRIVILEGES ON `%s`.* TO '%s'@'%%';", m.Database, m.User)
 	update := fmt.Sprintf("ALTER USER `%s` IDENTIFIED BY '%s';", m.User, m.Password)
 
-	if !m.isUserExist(admin) {
+	if m.IAMPrincipal != "" {
+		if !m.isUserExist(admin) {
+			return fmt.Errorf("iam user %s doesn't exist", m.User)
+		}
+	} else if !m.isUserExist(admin) {
 		err := m.executeQuery(create, admin)
 		if err != nil {
 			return err
@@ -182,16 +178,34 @@ func (m Mysql) createUser(admin AdminCredentials) error {
 func (m Mysql) deleteUser(admin AdminCredentials) error {
 	delete := fmt.Sprintf("DROP USER `%s`;", m.User)
 
-	if m.isUserExist(admin) {
+	// iam users are deleted by the cloud provider
+	if m.IAMPrincipal == "" && m.isUserExist(admin) {
 		err := m.executeQuery(delete, admin)
 		if err != nil {
 			return err
 		}
 	}
 
+	return m.removeOwnerMarker(admin, ownedUser)
+}
+
+func (m Mysql) createReader(admin AdminCredentials, reader ReaderCredentials) error {
+	create := fmt.Sprintf("CREATE USER IF NOT EXISTS '%s'@'%%' IDENTIFIED BY '%s';", reader.Username, reader.Password)
+	update := fmt.Sprintf("ALTER USER '%s'@'%%' IDENTIFIED BY '%s';", reader.Username, reader.Password)
+	grant := fmt.Sprintf("GRANT SELECT, SHOW VIEW, TRIGGER, LOCK TABLES ON `%s`.* TO '%s'@'%%';", m.Database, reader.Username)
+
+	for _, query := range []string{create, update, grant} {
+		if err := m.executeQuery(query, admin); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+func (m Mysql) deleteReader(admin AdminCredentials, username string) error {
+	return m.executeQuery(fmt.Sprintf("DROP USER IF EXISTS '%s'@'%%';", username), admin)
+}
+
 func (m Mysql) isRowExist(query string, admin AdminCredentials) bool {
 	db, err := m.getDbConn(admin.Username, admin.Password)
 	if err != nil {
@@ -220,12 +234,25 @@ func (m Mysql) isUserExist(admin AdminCredentials) bool {
 	return false
 }
 
+// checkExistence checks as admin that database and user exist
+func (m Mysql) checkExistence(admin AdminCredentials) error {
+	check := fmt.Sprintf("SELECT SCHEMA_NAME FROM INFORMATION_SCHEMA.SCHEMATA WHERE SCHEMA_NAME = '%s';", m.Database)
+	if !m.isRowExist(check, admin) {
+		return fmt.Errorf("database %s doesn't exist", m.Database)
+	}
+	if !m.isUserExist(admin) {
+		return fmt.Errorf("user %s doesn't exist", m.User)
+	}
+	return nil
+}
+
 // GetCredentials returns credentials of the mysql database
 func (m Mysql) GetCredentials() Credentials {
 	return Credentials{
-		Name:     m.Database,
-		Username: m.User,
-		Password: m.Password,
+		Name:         m.Database,
+		Username:     m.User,
+		Password:     m.Password,
+		IAMPrincipal: m.IAMPrincipal,
 	}
 }
 
@@ -266,3 +293,148 @@ func (m Mysql) ParseAdminCredentials(data map[string][]byte) (AdminCredentials,
 
 	return cred, errors.New("can not find mysql admin credentials")
 }
+
+func quoteMysqlIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+func (m Mysql) mask(admin AdminCredentials, rule MaskingRule, salt string) (int64, error) {
+	db, err := m.getDbConn(admin.Username, admin.Password)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	table := quoteMysqlIdentifier(m.Database) + "." + quoteMysqlIdentifier(rule.Table)
+	column := quoteMysqlIdentifier(rule.Column)
+
+	var query string
+	args := []interface{}{}
+	switch rule.Strategy {
+	case MaskNull:
+		query = fmt.Sprintf("UPDATE %s SET %s = NULL;", table, column)
+	case MaskHash:
+		query = fmt.Sprintf("UPDATE %s SET %s = LEFT(SHA2(CONCAT(?, %s), 256), 32) WHERE %s IS NOT NULL;", table, column, column, column)
+		args = append(args, salt)
+	case MaskFakeEmail:
+		query = fmt.Sprintf("UPDATE %s SET %s = CONCAT('user_', LEFT(SHA2(CONCAT(?, %s), 256), 32), '@example.com') WHERE %s IS NOT NULL;", table, column, column, column)
+		args = append(args, salt)
+	case MaskFixed:
+		query = fmt.Sprintf("UPDATE %s SET %s = ?;", table, column)
+		args = append(args, rule.Value)
+	case MaskTruncate:
+		var count int64
+		if err := db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s;", table)).Scan(&count); err != nil {
+			return 0, err
+		}
+		if _, err := db.Exec(fmt.Sprintf("TRUNCATE TABLE %s;", table)); err != nil {
+			return 0, err
+		}
+		return count, nil
+	default:
+		return 0, fmt.Errorf("unknown masking strategy %s", rule.Strategy)
+	}
+
+	result, err := db.Exec(query, args...)
+	if err != nil {
+		logrus.Errorf("failed masking %s.%s - %s", rule.Table, rule.Column, err)
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (m Mysql) ownedObjectName(kind string) string {
+	if kind == ownedUser {
+		return m.User
+	}
+	return m.Database
+}
+
+func (m Mysql) isOwnershipTableExist(admin AdminCredentials) bool {
+	check := "SELECT 1 FROM information_schema.tables WHERE table_schema = 'db_operator' AND table_name = 'ownership';"
+	return m.isRowExist(check, admin)
+}
+
+// readOwnerMarker returns the marker from the metadata table, empty if there is none
+func (m Mysql) readOwnerMarker(admin AdminCredentials, kind string) (string, error) {
+	if !m.isOwnershipTableExist(admin) {
+		return "", nil
+	}
+
+	db, err := m.getDbConn(admin.Username, admin.Password)
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+
+	var marker string
+	query := fmt.Sprintf("SELECT marker FROM %s WHERE kind = ? AND name = ?;", mysqlOwnershipTable)
+	err = db.QueryRow(query, kind, m.ownedObjectName(kind)).Scan(&marker)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil
+		}
+		return "", err
+	}
+	return marker, nil
+}
+
+// writeOwnerMarker stores the marker in the metadata table, which is created on first use
+func (m Mysql) writeOwnerMarker(admin AdminCredentials, kind, marker string) error {
+	createSchema := "CREATE DATABASE IF NOT EXISTS `db_operator`;"
+	createTable := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (kind VARCHAR(16) NOT NULL, name VARCHAR(64) NOT NULL, marker TEXT NOT NULL, PRIMARY KEY (kind, name));", mysqlOwnershipTable)
+	upsert := fmt.Sprintf("INSERT INTO %s (kind, name, marker) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE marker = VALUES(marker);", mysqlOwnershipTable)
+
+	db, err := m.getDbConn(admin.Username, admin.Password)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	for _, query := range []string{createSchema, createTable} {
+		if _, err := db.Exec(query); err != nil {
+			logrus.Errorf("failed creating ownership table - %s", err)
+			return err
+		}
+	}
+	if _, err := db.Exec(upsert, kind, m.ownedObjectName(kind), marker); err != nil {
+		logrus.Errorf("failed writing owner marker on %s - %s", kind, err)
+		return err
+	}
+	return nil
+}
+
+func (m Mysql) removeOwnerMarker(admin AdminCredentials, kind string) error {
+	if !m.isOwnershipTableExist(admin) {
+		return nil
+	}
+
+	db, err := m.getDbConn(admin.Username, admin.Password)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	query := fmt.Sprintf("DELETE FROM %s WHERE kind = ? AND name = ?;", mysqlOwnershipTable)
+	if _, err := db.Exec(query, kind, m.ownedObjectName(kind)); err != nil {
+		logrus.Errorf("failed removing owner marker of %s - %s", kind, err)
+		return err
+	}
+	return nil
+}
+
+// isReadOnly returns true if the server doesn't accept writes, e.g. a replica
+func (m Mysql) isReadOnly(admin AdminCredentials) (bool, error) {
+	db, err := m.getDbConn(admin.Username, admin.Password)
+	if err != nil {
+		return false, err
+	}
+	defer db.Close()
+
+	var readOnly bool
+	err = db.QueryRow("SELECT @@global.read_only;").Scan(&readOnly)
+	if err != nil {
+		return false, err
+	}
+	return readOnly, nil
+}
@@ -25,7 +25,7 @@ import (
 )
 
 func testMysql() *Mysql {
-	return &Mysql{"local", test.GetMysqlHost(), test.GetMysqlPort(), "testdb", "testuser", "testpwd", false, false}
+	return &Mysql{"local", test.GetMysqlHost(), test.GetMysqlPort(), "testdb", "testuser", "testpwd", false, false, nil, nil, "", false}
 }
 
 func getMysqlAdmin() AdminCredentials {
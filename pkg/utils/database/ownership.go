@@ -0,0 +1,117 @@
+/*
+ * Copyright 2021 kloeckner.i GmbH
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	ownerManagedBy = "db-operator"
+
+	ownedDatabase = "database"
+	ownedUser     = "user"
+)
+
+// Owner identifies the Database resource which manages a database and a user on the server.
+// It's stored as a marker next to the objects, so several clusters can share one server.
+type Owner struct {
+	ClusterID string `json:"clusterID"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	UID       string `json:"uid"`
+}
+
+type ownerMarker struct {
+	ManagedBy string `json:"managedBy"`
+	Owner
+}
+
+// OwnershipConflictError is returned when a database or user on the server is owned by another Database resource
+type OwnershipConflictError struct {
+	Kind  string
+	Name  string
+	Owner Owner
+}
+
+func (e *OwnershipConflictError) Error() string {
+	return fmt.Sprintf("%s %s is owned by %s/%s in cluster %q", e.Kind, e.Name, e.Owner.Namespace, e.Owner.Name, e.Owner.ClusterID)
+}
+
+// sameAs returns true if both owners point to the same Database resource,
+// the UID is not compared, a recreated resource takes over its objects again
+func (o Owner) sameAs(other Owner) bool {
+	return o.ClusterID == other.ClusterID && o.Namespace == other.Namespace && o.Name == other.Name
+}
+
+func formatOwnerMarker(owner Owner) (string, error) {
+	marker, err := json.Marshal(ownerMarker{ManagedBy: ownerManagedBy, Owner: owner})
+	if err != nil {
+		return "", err
+	}
+	return string(marker), nil
+}
+
+// parseOwnerMarker returns false if the marker wasn't written by db-operator
+func parseOwnerMarker(marker string) (Owner, bool) {
+	parsed := ownerMarker{}
+	if err := json.Unmarshal([]byte(marker), &parsed); err != nil {
+		return Owner{}, false
+	}
+	if parsed.ManagedBy != ownerManagedBy {
+		return Owner{}, false
+	}
+	return parsed.Owner, true
+}
+
+func ownedObjectName(db Database, kind string) string {
+	if kind == ownedUser {
+		return db.GetCredentials().Username
+	}
+	return db.GetCredentials().Name
+}
+
+// VerifyOwnership checks that neither the database nor the user is owned by another Database resource.
+// Objects without a marker, e.g. created before markers were introduced, can be taken over.
+func VerifyOwnership(db Database, admin AdminCredentials, owner Owner) error {
+	for _, kind := range []string{ownedDatabase, ownedUser} {
+		marker, err := db.readOwnerMarker(admin, kind)
+		if err != nil {
+			return fmt.Errorf("can not read owner of %s - %s", kind, err)
+		}
+		current, ok := parseOwnerMarker(marker)
+		if ok && !current.sameAs(owner) {
+			return &OwnershipConflictError{Kind: kind, Name: ownedObjectName(db, kind), Owner: current}
+		}
+	}
+	return nil
+}
+
+// MarkOwnership stores the owner marker on the database and the user
+func MarkOwnership(db Database, admin AdminCredentials, owner Owner) error {
+	marker, err := formatOwnerMarker(owner)
+	if err != nil {
+		return err
+	}
+	for _, kind := range []string{ownedDatabase, ownedUser} {
+		if err := db.writeOwnerMarker(admin, kind, marker); err != nil {
+			return fmt.Errorf("can not mark owner of %s - %s", kind, err)
+		}
+	}
+	return nil
+}
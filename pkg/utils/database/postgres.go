@@ -20,10 +20,9 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
-	// Don't delete below package. Used for driver "cloudsqlpostgres"
-	_ "github.com/GoogleCloudPlatform/cloudsql-proxy/proxy/dialers/postgres"
 	"github.com/kloeckner-i/db-operator/pkg/utils/kci"
 
 	// Don't delete below package. Used for driver "postgres"
@@ -35,18 +34,30 @@ import (
 // represents a database on postgres instance
 // can be used to execute query to postgres database
 type Postgres struct {
-	Backend          string
-	Host             string
-	Port             uint16
-	Database         string
-	User             string
-	Password         string
-	Monitoring       bool
-	Extensions       []string
-	SSLEnabled       bool
-	SkipCAVerify     bool
+	Backend      string
+	Host         string
+	Port         uint16
+	Database     string
+	User         string
+	Password     string
+	Monitoring   bool
+	Extensions   []string
+	SSLEnabled   bool
+	SkipCAVerify bool
+	// SSLCerts are the CA bundle and the client certificate of ssl connections, the system roots are used if it's nil
+	SSLCerts         *SSLCerts
 	DropPublicSchema bool
 	Schemas          []string
+	// Template is a database on the same server which is copied on creation
+	Template string
+	// TemplateOwner is the user owning the objects of the template database,
+	// the objects of the copy are reassigned to User
+	TemplateOwner string
+	// Tunnel is the jump host the server is reached through, the server is connected directly if it's nil
+	Tunnel *SSHTunnel
+	// IAMPrincipal is the cloud iam principal User authenticates with instead of Password,
+	// the user is created by the cloud provider and only granted privileges on the database
+	IAMPrincipal string
 }
 
 const postgresDefaultSSLMode = "disable"
@@ -68,23 +79,15 @@ func (p Postgres) sslMode() string {
 }
 
 func (p Postgres) getDbConn(dbname, user, password string) (*sql.DB, error) {
-	var db *sql.DB
-	var sqldriver string
-
-	switch p.Backend {
-	case "google":
-		sqldriver = "cloudsqlpostgres"
-	default:
-		sqldriver = "postgres"
-	}
-
 	dataSourceName := fmt.Sprintf("host=%s port=%d dbname=%s user=%s password=%s sslmode=%s", p.Host, p.Port, dbname, user, password, p.sslMode())
-	db, err := sql.Open(sqldriver, dataSourceName)
-	if err != nil {
-		return nil, fmt.Errorf("sql.Open: %v", err)
+	if p.SSLEnabled && p.SSLCerts != nil {
+		params, err := p.SSLCerts.postgresParams(p.SkipCAVerify)
+		if err != nil {
+			return nil, err
+		}
+		dataSourceName += params
 	}
-
-	return db, err
+	return dialerFor(p.Backend).OpenPostgres(p, dataSourceName)
 }
 
 func (p Postgres) executeExec(database, query string, admin AdminCredentials) error {
@@ -135,6 +138,17 @@ func (p Postgres) CheckStatus() error {
 	return nil
 }
 
+// checkExistence checks as admin that database and user exist
+func (p Postgres) checkExistence(admin AdminCredentials) error {
+	if !p.isDbExist(admin) {
+		return fmt.Errorf("database %s doesn't exist", p.Database)
+	}
+	if !p.isUserExist(admin) {
+		return fmt.Errorf("user %s doesn't exist", p.User)
+	}
+	return nil
+}
+
 func (p Postgres) isRowExist(database, query, user, password string) bool {
 	db, err := p.getDbConn(database, user, password)
 	if err != nil {
@@ -155,7 +169,12 @@ func (p Postgres) createDatabase(admin AdminCredentials) error {
 	create := fmt.Sprintf("CREATE DATABASE \"%s\";", p.Database)
 
 	if !p.isDbExist(admin) {
-		err := p.executeExec("postgres", create, admin)
+		var err error
+		if p.Template != "" {
+			err = p.createDatabaseFromTemplate(admin)
+		} else {
+			err = p.executeExec("postgres", create, admin)
+		}
 		if err != nil {
 			logrus.Errorf("failed creating postgres database %s", err)
 			return err
@@ -193,12 +212,40 @@ func (p Postgres) createDatabase(admin AdminCredentials) error {
 	return nil
 }
 
+// createDatabaseFromTemplate copies the template database into a new one.
+// Postgres refuses to copy a database while other sessions are connected to it,
+// so sessions on the template are terminated right before the copy.
+func (p Postgres) createDatabaseFromTemplate(admin AdminCredentials) error {
+	terminate := fmt.Sprintf("SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE datname = '%s' AND pid <> pg_backend_pid();", p.Template)
+	create := fmt.Sprintf("CREATE DATABASE \"%s\" TEMPLATE \"%s\";", p.Database, p.Template)
+
+	return kci.Retry(3, 5*time.Second, func() error {
+		err := p.executeExec("postgres", terminate, admin)
+		if err != nil {
+			logrus.Errorf("failed terminating sessions on template database %s - %s", p.Template, err)
+			return err
+		}
+
+		err = p.executeExec("postgres", create, admin)
+		if err != nil {
+			// new sessions could have been opened in the meantime, this error will result in a retry
+			logrus.Debugf("failed creating database from template %s: %s...retry...", p.Template, err)
+			return err
+		}
+		return nil
+	})
+}
+
 func (p Postgres) createUser(admin AdminCredentials) error {
 	create := fmt.Sprintf("CREATE USER \"%s\" WITH ENCRYPTED PASSWORD '%s' NOSUPERUSER;", p.User, p.Password)
 	grant := fmt.Sprintf("GRANT ALL PRIVILEGES ON DATABASE \"%s\" TO \"%s\";", p.Database, p.User)
 	update := fmt.Sprintf("ALTER ROLE \"%s\" WITH ENCRYPTED PASSWORD '%s';", p.User, p.Password)
 
-	if !p.isUserExist(admin) {
+	if p.IAMPrincipal != "" {
+		if !p.isUserExist(admin) {
+			return fmt.Errorf("iam user %s doesn't exist", p.User)
+		}
+	} else if !p.isUserExist(admin) {
 		err := p.executeExec("postgres", create, admin)
 		if err != nil {
 			logrus.Errorf("failed creating postgres user - %s", err)
@@ -218,6 +265,13 @@ func (p Postgres) createUser(admin AdminCredentials) error {
 		return err
 	}
 
+	if p.Template != "" && p.TemplateOwner != "" && p.TemplateOwner != p.User {
+		if err := p.executeExec(p.Database, p.reassignTemplateObjects(), admin); err != nil {
+			logrus.Errorf("failed reassigning objects copied from template %s - %s", p.Template, err)
+			return err
+		}
+	}
+
 	for _, s := range p.Schemas {
 		grantUserAccess := fmt.Sprintf("GRANT ALL ON SCHEMA \"%s\" TO \"%s\"", s, p.User)
 		if err := p.executeExec(p.Database, grantUserAccess, admin); err != nil {
@@ -228,6 +282,52 @@ func (p Postgres) createUser(admin AdminCredentials) error {
 	return nil
 }
 
+// reassignTemplateObjects returns a statement changing the owner of the objects copied from the template.
+// REASSIGN OWNED can't be used, it also changes the owner of shared objects like other databases of TemplateOwner.
+// Objects of extensions and sequences owned by a table follow their parent.
+func (p Postgres) reassignTemplateObjects() string {
+	owner := pq.QuoteLiteral(p.TemplateOwner)
+	user := pq.QuoteLiteral(p.User)
+	return fmt.Sprintf(`DO $reassign$
+DECLARE
+	stmt text;
+BEGIN
+	FOR stmt IN
+		SELECT format('ALTER SCHEMA %%I OWNER TO %%I', n.nspname, %[2]s)
+		FROM pg_namespace n
+		WHERE pg_get_userbyid(n.nspowner) = %[1]s
+		UNION ALL
+		SELECT format('ALTER %%s %%s OWNER TO %%I',
+			CASE c.relkind WHEN 'v' THEN 'VIEW' WHEN 'm' THEN 'MATERIALIZED VIEW' WHEN 'S' THEN 'SEQUENCE'
+				WHEN 'f' THEN 'FOREIGN TABLE' WHEN 'c' THEN 'TYPE' ELSE 'TABLE' END,
+			c.oid::regclass, %[2]s)
+		FROM pg_class c
+		WHERE c.relkind IN ('r', 'p', 'v', 'm', 'S', 'f', 'c')
+			AND pg_get_userbyid(c.relowner) = %[1]s
+			AND NOT EXISTS (SELECT 1 FROM pg_depend d WHERE d.classid = 'pg_class'::regclass AND d.objid = c.oid AND d.deptype IN ('a', 'i', 'e'))
+		UNION ALL
+		SELECT format('ALTER %%s %%s OWNER TO %%I',
+			CASE pr.prokind WHEN 'p' THEN 'PROCEDURE' WHEN 'a' THEN 'AGGREGATE' ELSE 'FUNCTION' END,
+			pr.oid::regprocedure, %[2]s)
+		FROM pg_proc pr
+		WHERE pr.prokind IN ('f', 'p', 'a')
+			AND pg_get_userbyid(pr.proowner) = %[1]s
+			AND NOT EXISTS (SELECT 1 FROM pg_depend d WHERE d.classid = 'pg_proc'::regclass AND d.objid = pr.oid AND d.deptype = 'e')
+		UNION ALL
+		SELECT format('ALTER %%s %%s OWNER TO %%I',
+			CASE t.typtype WHEN 'd' THEN 'DOMAIN' ELSE 'TYPE' END,
+			t.oid::regtype, %[2]s)
+		FROM pg_type t
+		WHERE t.typtype IN ('d', 'e', 'r')
+			AND pg_get_userbyid(t.typowner) = %[1]s
+			AND NOT EXISTS (SELECT 1 FROM pg_depend d WHERE d.classid = 'pg_type'::regclass AND d.objid = t.oid AND d.deptype = 'e')
+	LOOP
+		EXECUTE stmt;
+	END LOOP;
+END
+$reassign$;`, owner, user)
+}
+
 func (p Postgres) dropPublicSchema(admin AdminCredentials) error {
 	if p.Monitoring {
 		return fmt.Errorf("can not drop public schema when monitoring is enabled on instance level")
@@ -301,7 +401,8 @@ func (p Postgres) deleteDatabase(admin AdminCredentials) error {
 func (p Postgres) deleteUser(admin AdminCredentials) error {
 	delete := fmt.Sprintf("DROP USER \"%s\";", p.User)
 
-	if p.isUserExist(admin) {
+	// iam users are deleted by the cloud provider
+	if p.IAMPrincipal == "" && p.isUserExist(admin) {
 		logrus.Debugf("deleting user %s", p.User)
 		err := p.executeExec("postgres", delete, admin)
 		if err != nil {
@@ -317,12 +418,63 @@ func (p Postgres) deleteUser(admin AdminCredentials) error {
 	return nil
 }
 
+// createReader creates a login role with read access to all tables and sequences of the database,
+// the privileges are granted by the owner of the tables, the admin isn't a superuser on every backend
+func (p Postgres) createReader(admin AdminCredentials, reader ReaderCredentials) error {
+	check := fmt.Sprintf("SELECT 1 FROM pg_roles WHERE rolname = '%s';", reader.Username)
+	create := fmt.Sprintf("CREATE ROLE \"%s\" WITH LOGIN ENCRYPTED PASSWORD '%s' NOSUPERUSER NOCREATEDB NOCREATEROLE;", reader.Username, reader.Password)
+	update := fmt.Sprintf("ALTER ROLE \"%s\" WITH LOGIN ENCRYPTED PASSWORD '%s';", reader.Username, reader.Password)
+	connect := fmt.Sprintf("GRANT CONNECT ON DATABASE \"%s\" TO \"%s\";", p.Database, reader.Username)
+	grant := fmt.Sprintf(`DO $grant$
+DECLARE
+	s name;
+BEGIN
+	FOR s IN SELECT nspname FROM pg_namespace WHERE nspname NOT LIKE 'pg\_%%' AND nspname <> 'information_schema' LOOP
+		EXECUTE format('GRANT USAGE ON SCHEMA %%I TO %%I', s, %[1]s);
+		EXECUTE format('GRANT SELECT ON ALL TABLES IN SCHEMA %%I TO %%I', s, %[1]s);
+		EXECUTE format('GRANT SELECT ON ALL SEQUENCES IN SCHEMA %%I TO %%I', s, %[1]s);
+	END LOOP;
+END
+$grant$;`, pq.QuoteLiteral(reader.Username))
+
+	query := create
+	if p.isRowExist("postgres", check, admin.Username, admin.Password) {
+		query = update
+	}
+	if err := p.executeExec("postgres", query, admin); err != nil {
+		return err
+	}
+	if err := p.executeExec("postgres", connect, admin); err != nil {
+		return err
+	}
+
+	owner := admin
+	if p.IAMPrincipal == "" {
+		owner = AdminCredentials{Username: p.User, Password: p.Password}
+	}
+	return p.executeExec(p.Database, grant, owner)
+}
+
+// deleteReader drops the privileges of the reader in the database before the role can be dropped
+func (p Postgres) deleteReader(admin AdminCredentials, username string) error {
+	check := fmt.Sprintf("SELECT 1 FROM pg_roles WHERE rolname = '%s';", username)
+	if !p.isRowExist("postgres", check, admin.Username, admin.Password) {
+		return nil
+	}
+
+	if err := p.executeExec(p.Database, fmt.Sprintf("DROP OWNED BY \"%s\";", username), admin); err != nil {
+		return err
+	}
+	return p.executeExec("postgres", fmt.Sprintf("DROP ROLE \"%s\";", username), admin)
+}
+
 // GetCredentials returns credentials of the postgres database
 func (p Postgres) GetCredentials() Credentials {
 	return Credentials{
-		Name:     p.Database,
-		Username: p.User,
-		Password: p.Password,
+		Name:         p.Database,
+		Username:     p.User,
+		Password:     p.Password,
+		IAMPrincipal: p.IAMPrincipal,
 	}
 }
 
@@ -405,3 +557,114 @@ func (p Postgres) ParseAdminCredentials(data map[string][]byte) (AdminCredential
 
 	return cred, errors.New("can not find postgres admin credentials")
 }
+
+// quotePostgresTable quotes a table name which can be qualified by a schema
+func quotePostgresTable(table string) string {
+	parts := strings.Split(table, ".")
+	for i, part := range parts {
+		parts[i] = pq.QuoteIdentifier(part)
+	}
+	return strings.Join(parts, ".")
+}
+
+func (p Postgres) mask(admin AdminCredentials, rule MaskingRule, salt string) (int64, error) {
+	db, err := p.getDbConn(p.Database, admin.Username, admin.Password)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	table := quotePostgresTable(rule.Table)
+	column := pq.QuoteIdentifier(rule.Column)
+
+	var query string
+	args := []interface{}{}
+	switch rule.Strategy {
+	case MaskNull:
+		query = fmt.Sprintf("UPDATE %s SET %s = NULL;", table, column)
+	case MaskHash:
+		query = fmt.Sprintf("UPDATE %s SET %s = left(encode(sha256(convert_to($1::text || %s::text, 'UTF8')), 'hex'), 32) WHERE %s IS NOT NULL;", table, column, column, column)
+		args = append(args, salt)
+	case MaskFakeEmail:
+		query = fmt.Sprintf("UPDATE %s SET %s = 'user_' || left(encode(sha256(convert_to($1::text || %s::text, 'UTF8')), 'hex'), 32) || '@example.com' WHERE %s IS NOT NULL;", table, column, column, column)
+		args = append(args, salt)
+	case MaskFixed:
+		query = fmt.Sprintf("UPDATE %s SET %s = $1;", table, column)
+		args = append(args, rule.Value)
+	case MaskTruncate:
+		var count int64
+		if err := db.QueryRow(fmt.Sprintf("SELECT count(*) FROM %s;", table)).Scan(&count); err != nil {
+			return 0, err
+		}
+		if _, err := db.Exec(fmt.Sprintf("TRUNCATE TABLE %s;", table)); err != nil {
+			return 0, err
+		}
+		return count, nil
+	default:
+		return 0, fmt.Errorf("unknown masking strategy %s", rule.Strategy)
+	}
+
+	result, err := db.Exec(query, args...)
+	if err != nil {
+		logrus.Errorf("failed masking %s.%s - %s", rule.Table, rule.Column, err)
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// readOwnerMarker returns the comment on the database or the user, empty if the object doesn't exist
+func (p Postgres) readOwnerMarker(admin AdminCredentials, kind string) (string, error) {
+	query := "SELECT shobj_description(oid, 'pg_database') FROM pg_database WHERE datname = $1;"
+	name := p.Database
+	if kind == ownedUser {
+		query = "SELECT shobj_description(oid, 'pg_authid') FROM pg_roles WHERE rolname = $1;"
+		name = p.User
+	}
+
+	db, err := p.getDbConn("postgres", admin.Username, admin.Password)
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+
+	var marker sql.NullString
+	err = db.QueryRow(query, name).Scan(&marker)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil
+		}
+		return "", err
+	}
+	return marker.String, nil
+}
+
+// writeOwnerMarker stores the marker as comment on the database or the user
+func (p Postgres) writeOwnerMarker(admin AdminCredentials, kind, marker string) error {
+	comment := fmt.Sprintf("COMMENT ON DATABASE %s IS %s;", pq.QuoteIdentifier(p.Database), pq.QuoteLiteral(marker))
+	if kind == ownedUser {
+		comment = fmt.Sprintf("COMMENT ON ROLE %s IS %s;", pq.QuoteIdentifier(p.User), pq.QuoteLiteral(marker))
+	}
+
+	err := p.executeExec("postgres", comment, admin)
+	if err != nil {
+		logrus.Errorf("failed writing owner marker on %s - %s", kind, err)
+		return err
+	}
+	return nil
+}
+
+// isReadOnly returns true if the server is a standby in recovery
+func (p Postgres) isReadOnly(admin AdminCredentials) (bool, error) {
+	db, err := p.getDbConn("postgres", admin.Username, admin.Password)
+	if err != nil {
+		return false, err
+	}
+	defer db.Close()
+
+	var inRecovery bool
+	err = db.QueryRow("SELECT pg_is_in_recovery();").Scan(&inRecovery)
+	if err != nil {
+		return false, err
+	}
+	return inRecovery, nil
+}
@@ -79,6 +79,50 @@ func TestPostgresCreateUser(t *testing.T) {
 	assert.Error(t, err, "Should get error")
 }
 
+func TestPostgresIAMUser(t *testing.T) {
+	admin := getPostgresAdmin()
+	p := testPostgres()
+	p.User = "app@project.iam"
+	p.Password = ""
+	p.IAMPrincipal = "app@project.iam.gserviceaccount.com"
+
+	assert.NoError(t, p.createDatabase(admin))
+	assert.Error(t, p.createUser(admin), "iam users are created by the cloud provider")
+
+	// simulates the user created by cloud sql
+	assert.NoError(t, p.executeExec("postgres", "CREATE USER \"app@project.iam\";", admin))
+	assert.NoError(t, p.createUser(admin))
+	assert.NoError(t, CheckStatus(p, admin))
+
+	assert.NoError(t, p.deleteUser(admin))
+	assert.True(t, p.isUserExist(admin), "iam users are deleted by the cloud provider")
+	assert.NoError(t, p.executeExec("postgres", "DROP USER \"app@project.iam\";", admin))
+}
+
+func TestPostgresCreateDatabaseFromTemplate(t *testing.T) {
+	admin := getPostgresAdmin()
+	p := testPostgres()
+	p.Database = "testdb-clone"
+	p.Template = "testdb"
+	p.TemplateOwner = "testuser"
+
+	assert.NoError(t, p.createDatabase(admin))
+	assert.True(t, p.isDbExist(admin))
+	assert.NoError(t, p.createUser(admin))
+	assert.NoError(t, p.deleteDatabase(admin))
+}
+
+func TestPostgresReassignTemplateObjects(t *testing.T) {
+	p := testPostgres()
+	p.User = "clone'user"
+	p.TemplateOwner = "sourceuser"
+
+	reassign := p.reassignTemplateObjects()
+	assert.NotContains(t, reassign, "REASSIGN OWNED")
+	assert.Contains(t, reassign, "pg_get_userbyid(c.relowner) = 'sourceuser'")
+	assert.Contains(t, reassign, "'clone''user'")
+}
+
 func TestPublicSchema(t *testing.T) {
 	p := testPostgres()
 	p.DropPublicSchema = false
@@ -0,0 +1,121 @@
+/*
+ * Copyright 2021 kloeckner.i GmbH
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package database
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+)
+
+// SSLCerts are the certificates of ssl connections to the server in PEM format
+type SSLCerts struct {
+	// RootCert is the CA bundle the server certificate is verified with, the system roots are used if it's empty
+	RootCert []byte
+	// Cert and Key are the client certificate, no client certificate is sent if they are empty
+	Cert []byte
+	Key  []byte
+}
+
+var (
+	// sslDir keeps the certificates for lib/pq, it reads them from files on every connection
+	sslDir   = filepath.Join(os.TempDir(), "db-operator-ssl")
+	sslDirMu sync.Mutex
+)
+
+// key identifies the certificates, files and tls configs are shared by connections with the same certificates
+func (c *SSLCerts) key() string {
+	h := sha256.New()
+	for _, data := range [][]byte{c.RootCert, c.Cert, c.Key} {
+		h.Write(data)
+		h.Write([]byte{0})
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)[:8])
+}
+
+// postgresParams writes the certificates to files and returns the connection parameters referencing them,
+// the root certificate is left out if the server certificate isn't verified
+func (c *SSLCerts) postgresParams(skipVerify bool) (string, error) {
+	sslDirMu.Lock()
+	defer sslDirMu.Unlock()
+
+	dir := filepath.Join(sslDir, c.key())
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+
+	rootCert := c.RootCert
+	if skipVerify {
+		rootCert = nil
+	}
+	params := ""
+	files := []struct {
+		param string
+		name  string
+		data  []byte
+	}{
+		{"sslrootcert", "ca.crt", rootCert},
+		{"sslcert", "client.crt", c.Cert},
+		{"sslkey", "client.key", c.Key},
+	}
+	for _, file := range files {
+		if len(file.data) == 0 {
+			continue
+		}
+		path := filepath.Join(dir, file.name)
+		// lib/pq refuses keys which are readable by others
+		if err := os.WriteFile(path, file.data, 0o600); err != nil {
+			return "", err
+		}
+		params += fmt.Sprintf(" %s=%s", file.param, path)
+	}
+	return params, nil
+}
+
+// mysqlTLSConfig registers the certificates as tls config of the mysql driver and returns its name
+func (c *SSLCerts) mysqlTLSConfig(serverName string, skipVerify bool) (string, error) {
+	config := &tls.Config{ServerName: serverName, InsecureSkipVerify: skipVerify}
+	if len(c.RootCert) > 0 && !skipVerify {
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(c.RootCert) {
+			return "", errors.New("can't parse root certificate")
+		}
+	}
+	if len(c.Cert) > 0 {
+		cert, err := tls.X509KeyPair(c.Cert, c.Key)
+		if err != nil {
+			return "", fmt.Errorf("can't parse client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	name := fmt.Sprintf("db-operator-%s-%s", c.key(), serverName)
+	if skipVerify {
+		name += "-skip-verify"
+	}
+	if err := mysqldriver.RegisterTLSConfig(name, config); err != nil {
+		return "", err
+	}
+	return name, nil
+}
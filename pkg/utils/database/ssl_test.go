@@ -0,0 +1,94 @@
+/*
+ * Copyright 2021 kloeckner.i GmbH
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package database
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCertificate generates a self-signed certificate and returns it and its key in pem format
+func testCertificate(t *testing.T) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "db-operator"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+}
+
+func TestSSLCertsPostgresParams(t *testing.T) {
+	cert, key := testCertificate(t)
+	certs := &SSLCerts{RootCert: cert, Cert: cert, Key: key}
+
+	params, err := certs.postgresParams(false)
+	assert.NoError(t, err)
+	values := map[string]string{}
+	for _, param := range strings.Fields(params) {
+		name, value, _ := strings.Cut(param, "=")
+		values[name] = value
+	}
+	assert.Len(t, values, 3)
+	data, err := os.ReadFile(values["sslkey"])
+	assert.NoError(t, err)
+	assert.Equal(t, key, data)
+	info, err := os.Stat(values["sslkey"])
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm(), "key must not be readable by others")
+
+	params, err = certs.postgresParams(true)
+	assert.NoError(t, err)
+	assert.NotContains(t, params, "sslrootcert", "server certificate isn't verified")
+
+	params, err = (&SSLCerts{RootCert: cert}).postgresParams(false)
+	assert.NoError(t, err)
+	assert.NotContains(t, params, "sslcert", "no client certificate is sent")
+}
+
+func TestSSLCertsMysqlTLSConfig(t *testing.T) {
+	cert, key := testCertificate(t)
+
+	name, err := (&SSLCerts{RootCert: cert, Cert: cert, Key: key}).mysqlTLSConfig("mysql.example.com", false)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(name, "db-operator-"))
+
+	_, err = (&SSLCerts{RootCert: []byte("not a certificate")}).mysqlTLSConfig("mysql.example.com", false)
+	assert.Error(t, err)
+	_, err = (&SSLCerts{Cert: cert}).mysqlTLSConfig("mysql.example.com", false)
+	assert.Error(t, err, "client certificate needs its key")
+}
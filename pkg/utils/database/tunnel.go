@@ -0,0 +1,227 @@
+/*
+ * Copyright 2021 kloeckner.i GmbH
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package database
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+const sshDialTimeout = 10 * time.Second
+
+// SSHTunnel is a jump host the database server is reached through
+type SSHTunnel struct {
+	Host       string
+	Port       uint16
+	User       string
+	PrivateKey []byte
+	// KnownHosts contains the host keys of the jump host in known_hosts format
+	KnownHosts []byte
+	// SkipHostKeyVerify accepts any host key of the jump host if KnownHosts is empty
+	SkipHostKeyVerify bool
+}
+
+var (
+	sshClients   = map[string]*ssh.Client{}
+	sshClientsMu sync.Mutex
+)
+
+// key identifies the ssh connection of the tunnel,
+// connections are shared by all tunnels with the same jump host and credentials
+func (t *SSHTunnel) key() string {
+	sum := sha256.Sum256(append(append([]byte{}, t.PrivateKey...), t.KnownHosts...))
+	return fmt.Sprintf("%s@%s:%d/%x", t.User, t.Host, t.Port, sum[:8])
+}
+
+func (t *SSHTunnel) address() string {
+	port := t.Port
+	if port == 0 {
+		port = 22
+	}
+	return net.JoinHostPort(t.Host, strconv.Itoa(int(port)))
+}
+
+func (t *SSHTunnel) clientConfig() (*ssh.ClientConfig, error) {
+	signer, err := ssh.ParsePrivateKey(t.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse private key of ssh tunnel: %w", err)
+	}
+
+	hostKeyCallback, err := t.hostKeyCallback()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ssh.ClientConfig{
+		User:            t.User,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         sshDialTimeout,
+	}, nil
+}
+
+func (t *SSHTunnel) hostKeyCallback() (ssh.HostKeyCallback, error) {
+	if len(t.KnownHosts) == 0 {
+		if !t.SkipHostKeyVerify {
+			return nil, errors.New("known hosts of ssh tunnel are not defined and host key verification is not skipped")
+		}
+		logrus.Warnf("host key of ssh tunnel %s is not verified", t.address())
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+
+	var keys []ssh.PublicKey
+	rest := t.KnownHosts
+	for {
+		_, _, key, _, next, err := ssh.ParseKnownHosts(rest)
+		if err != nil {
+			break
+		}
+		keys = append(keys, key)
+		rest = next
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("known hosts of ssh tunnel don't contain any host key")
+	}
+
+	// known hosts are defined for the jump host only, so the host patterns are not matched
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		for _, known := range keys {
+			if bytes.Equal(known.Marshal(), key.Marshal()) {
+				return nil
+			}
+		}
+		return fmt.Errorf("host key of %s is not known", hostname)
+	}, nil
+}
+
+func (t *SSHTunnel) client() (*ssh.Client, error) {
+	sshClientsMu.Lock()
+	defer sshClientsMu.Unlock()
+
+	if client, ok := sshClients[t.key()]; ok {
+		return client, nil
+	}
+
+	config, err := t.clientConfig()
+	if err != nil {
+		return nil, err
+	}
+	client, err := ssh.Dial("tcp", t.address(), config)
+	if err != nil {
+		return nil, fmt.Errorf("can't connect to ssh tunnel %s: %w", t.address(), err)
+	}
+	sshClients[t.key()] = client
+	return client, nil
+}
+
+func (t *SSHTunnel) dropClient(client *ssh.Client) {
+	sshClientsMu.Lock()
+	defer sshClientsMu.Unlock()
+
+	if sshClients[t.key()] == client {
+		delete(sshClients, t.key())
+	}
+	client.Close()
+}
+
+// Dial connects to the address through the jump host
+func (t *SSHTunnel) Dial(network, address string) (net.Conn, error) {
+	client, err := t.client()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := client.Dial(network, address)
+	if err != nil {
+		// the connection to the jump host might be broken, reconnect once
+		logrus.Debugf("dialing %s through ssh tunnel failed, reconnecting: %s", address, err)
+		t.dropClient(client)
+		if client, err = t.client(); err != nil {
+			return nil, err
+		}
+		return client.Dial(network, address)
+	}
+	return conn, nil
+}
+
+// DialTimeout connects to the address through the jump host,
+// the timeout only applies to the connection to the jump host
+func (t *SSHTunnel) DialTimeout(network, address string, timeout time.Duration) (net.Conn, error) {
+	return t.Dial(network, address)
+}
+
+// DialContext connects to the address through the jump host
+func (t *SSHTunnel) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		conn, err := t.Dial(network, address)
+		done <- result{conn, err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		go func() {
+			if res := <-done; res.conn != nil {
+				res.conn.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	case res := <-done:
+		return res.conn, res.err
+	}
+}
+
+// mysqlNetwork registers the tunnel as a network of the mysql driver
+// and returns its name to be used in the data source name
+func (t *SSHTunnel) mysqlNetwork() string {
+	network := "ssh-" + fmt.Sprintf("%x", sha256.Sum256([]byte(t.key())))[:16]
+	mysqldriver.RegisterDialContext(network, func(ctx context.Context, addr string) (net.Conn, error) {
+		return t.DialContext(ctx, "tcp", addr)
+	})
+	return network
+}
+
+// pqTunnelConnector opens postgres connections through the tunnel,
+// lib/pq accepts a custom dialer only with DialOpen
+type pqTunnelConnector struct {
+	dsn    string
+	tunnel *SSHTunnel
+}
+
+func (c pqTunnelConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return pq.DialOpen(c.tunnel, c.dsn)
+}
+
+func (c pqTunnelConnector) Driver() driver.Driver {
+	return &pq.Driver{}
+}
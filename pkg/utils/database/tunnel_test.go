@@ -0,0 +1,201 @@
+/*
+ * Copyright 2021 kloeckner.i GmbH
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package database
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// testSigner generates a key pair and returns its signer and the private key in pem format
+func testSigner(t *testing.T) (ssh.Signer, []byte) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(key)
+	require.NoError(t, err)
+	return signer, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+// testSSHServer starts a jump host accepting the client key and forwarding tcp connections,
+// it returns the address of the server
+func testSSHServer(t *testing.T, hostKey ssh.Signer, clientKey ssh.PublicKey) string {
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) != string(clientKey.Marshal()) {
+				return nil, assert.AnError
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSSH(conn, config)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func serveSSH(conn net.Conn, config *ssh.ServerConfig) {
+	_, channels, requests, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(requests)
+
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "direct-tcpip" {
+			newChannel.Reject(ssh.UnknownChannelType, "unsupported channel type")
+			continue
+		}
+		var target struct {
+			Host       string
+			Port       uint32
+			OriginHost string
+			OriginPort uint32
+		}
+		if err := ssh.Unmarshal(newChannel.ExtraData(), &target); err != nil {
+			newChannel.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		upstream, err := net.Dial("tcp", net.JoinHostPort(target.Host, strconv.Itoa(int(target.Port))))
+		if err != nil {
+			newChannel.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		channel, channelRequests, err := newChannel.Accept()
+		if err != nil {
+			upstream.Close()
+			continue
+		}
+		go ssh.DiscardRequests(channelRequests)
+		go func() {
+			io.Copy(channel, upstream)
+			channel.Close()
+		}()
+		go func() {
+			io.Copy(upstream, channel)
+			upstream.Close()
+		}()
+	}
+}
+
+// testEchoServer stands in for the database server behind the jump host
+func testEchoServer(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(conn, conn)
+				conn.Close()
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func testTunnel(t *testing.T, sshAddress string, privateKey []byte) *SSHTunnel {
+	host, port, err := net.SplitHostPort(sshAddress)
+	require.NoError(t, err)
+	portNumber, err := strconv.Atoi(port)
+	require.NoError(t, err)
+	return &SSHTunnel{
+		Host:       host,
+		Port:       uint16(portNumber),
+		User:       "tunnel",
+		PrivateKey: privateKey,
+	}
+}
+
+func TestSSHTunnelDial(t *testing.T) {
+	hostKey, _ := testSigner(t)
+	clientKey, privateKey := testSigner(t)
+	sshAddress := testSSHServer(t, hostKey, clientKey.PublicKey())
+	dbAddress := testEchoServer(t)
+
+	tunnel := testTunnel(t, sshAddress, privateKey)
+	tunnel.KnownHosts = []byte(sshAddress + " " + string(ssh.MarshalAuthorizedKey(hostKey.PublicKey())))
+
+	conn, err := tunnel.Dial("tcp", dbAddress)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("SELECT 1"))
+	require.NoError(t, err)
+	reply := make([]byte, 8)
+	_, err = io.ReadFull(conn, reply)
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT 1", string(reply))
+}
+
+func TestSSHTunnelHostKeyVerification(t *testing.T) {
+	hostKey, _ := testSigner(t)
+	otherHostKey, _ := testSigner(t)
+	clientKey, privateKey := testSigner(t)
+	sshAddress := testSSHServer(t, hostKey, clientKey.PublicKey())
+	dbAddress := testEchoServer(t)
+
+	tunnel := testTunnel(t, sshAddress, privateKey)
+	_, err := tunnel.Dial("tcp", dbAddress)
+	assert.Error(t, err, "host key must be verified if known hosts are not defined")
+
+	tunnel.KnownHosts = []byte(sshAddress + " " + string(ssh.MarshalAuthorizedKey(otherHostKey.PublicKey())))
+	_, err = tunnel.Dial("tcp", dbAddress)
+	assert.Error(t, err, "unknown host key must be rejected")
+
+	tunnel.KnownHosts = nil
+	tunnel.SkipHostKeyVerify = true
+	conn, err := tunnel.Dial("tcp", dbAddress)
+	assert.NoError(t, err)
+	if conn != nil {
+		conn.Close()
+	}
+}
+
+func TestSSHTunnelInvalidPrivateKey(t *testing.T) {
+	tunnel := &SSHTunnel{Host: "bastion", User: "tunnel", PrivateKey: []byte("invalid"), SkipHostKeyVerify: true}
+	_, err := tunnel.clientConfig()
+	assert.Error(t, err)
+}
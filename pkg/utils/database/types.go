@@ -22,6 +22,14 @@ type Credentials struct {
 	Username         string
 	Password         string
 	TemplatedSecrets map[string]string
+	// IAMPrincipal is the cloud iam principal the user authenticates with, Password is empty then
+	IAMPrincipal string
+}
+
+// ReaderCredentials are the credentials of a temporary user which can only read the database
+type ReaderCredentials struct {
+	Username string `json:"username"`
+	Password string `json:"password,omitempty"`
 }
 
 // DatabaseAddress contains host and port of a database instance
@@ -36,12 +44,44 @@ type AdminCredentials struct {
 	Password string `yaml:"password"`
 }
 
+// Masking strategies which can be applied to a column or a table
+const (
+	MaskNull      = "null"
+	MaskHash      = "hash"
+	MaskFakeEmail = "fakeEmail"
+	MaskFixed     = "fixed"
+	MaskTruncate  = "truncate"
+)
+
+// MaskingRule defines how values of a column are anonymized,
+// Column is ignored by the truncate strategy which removes all rows of the table
+type MaskingRule struct {
+	Table    string
+	Column   string
+	Strategy string
+	Value    string
+}
+
+// MaskingResult contains the outcome of a single masking rule
+type MaskingResult struct {
+	Rule         MaskingRule
+	RowsAffected int64
+	Err          error
+}
+
 // Database is interface for CRUD operate of different types of databases
 type Database interface {
 	createDatabase(admin AdminCredentials) error
 	createUser(admin AdminCredentials) error
 	deleteDatabase(admin AdminCredentials) error
 	deleteUser(admin AdminCredentials) error
+	mask(admin AdminCredentials, rule MaskingRule, salt string) (int64, error)
+	createReader(admin AdminCredentials, reader ReaderCredentials) error
+	deleteReader(admin AdminCredentials, username string) error
+	readOwnerMarker(admin AdminCredentials, kind string) (string, error)
+	writeOwnerMarker(admin AdminCredentials, kind, marker string) error
+	isReadOnly(admin AdminCredentials) (bool, error)
+	checkExistence(admin AdminCredentials) error
 	CheckStatus() error
 	GetCredentials() Credentials
 	ParseAdminCredentials(data map[string][]byte) (AdminCredentials, error)
@@ -0,0 +1,432 @@
+/*
+ * Copyright 2021 kloeckner.i GmbH
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dbinstance
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/kloeckner-i/db-operator/pkg/utils/azure"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	azureManagementEndpoint = "https://management.azure.com"
+	azurePostgresProvider   = "Microsoft.DBforPostgreSQL"
+	azurePostgresAPIVersion = "2022-12-01"
+	azureMysqlProvider      = "Microsoft.DBforMySQL"
+	azureMysqlAPIVersion    = "2021-05-01"
+)
+
+// creations and updates of the server are tracked as pending operations until the server is ready again
+const (
+	azureOperationCreate         = "azure-create"
+	azureOperationUpdate         = "azure-update"
+	azureOperationUpdatePassword = "azure-update-password"
+	azureNotFoundCode            = "ResourceNotFound"
+)
+
+// azureCreateOnlyProperties can't be changed once the server is created
+var azureCreateOnlyProperties = []string{
+	"administratorLogin",
+	"availabilityZone",
+	"createMode",
+	"network",
+	"pointInTimeUTC",
+	"sourceServerResourceId",
+}
+
+// AzureFirewallRule allows connections from a range of ip addresses
+type AzureFirewallRule struct {
+	Name           string
+	StartIPAddress string
+	EndIPAddress   string
+}
+
+// Azure represents an azure database flexible server
+type Azure struct {
+	Name           string
+	SubscriptionID string
+	ResourceGroup  string
+	Engine         string
+	Config         string
+	User           string
+	Password       string
+	FirewallRules  []AzureFirewallRule
+	APIEndpoint    string
+	// PasswordChanged resets the administrator password to Password on update,
+	// it's only sent when it differs from the one last applied
+	PasswordChanged bool
+	// Operation is the pending creation or update of the server
+	Operation string
+	// finished is the operation which finished during this reconcile
+	finished string
+}
+
+type azureServer struct {
+	Name       string `json:"name"`
+	Properties struct {
+		State                    string `json:"state"`
+		FullyQualifiedDomainName string `json:"fullyQualifiedDomainName"`
+		Version                  string `json:"version"`
+	} `json:"properties"`
+}
+
+type azureFirewallRuleProperties struct {
+	StartIPAddress string `json:"startIpAddress"`
+	EndIPAddress   string `json:"endIpAddress"`
+}
+
+type azureFirewallRuleResource struct {
+	Name       string                      `json:"name,omitempty"`
+	Properties azureFirewallRuleProperties `json:"properties"`
+}
+
+type azureFirewallRuleList struct {
+	Value []azureFirewallRuleResource `json:"value"`
+}
+
+// AzureError is an error returned by the azure resource manager
+type AzureError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *AzureError) Error() string {
+	return fmt.Sprintf("azure api error %s: %s", e.Code, e.Message)
+}
+
+type azureErrorResponse struct {
+	Error AzureError `json:"error"`
+}
+
+func (ins *Azure) provider() (string, string, error) {
+	switch ins.Engine {
+	case "postgres":
+		return azurePostgresProvider, azurePostgresAPIVersion, nil
+	case "mysql":
+		return azureMysqlProvider, azureMysqlAPIVersion, nil
+	default:
+		return "", "", errors.New("not supported engine type")
+	}
+}
+
+func (ins *Azure) port() string {
+	if ins.Engine == "mysql" {
+		return "3306"
+	}
+	return "5432"
+}
+
+func (ins *Azure) httpClient(ctx context.Context) (*http.Client, error) {
+	creds, err := azure.GetCredentials()
+	if err != nil {
+		return nil, err
+	}
+	return creds.Client(ctx), nil
+}
+
+func (ins *Azure) serverURL(path string) (string, error) {
+	provider, apiVersion, err := ins.provider()
+	if err != nil {
+		return "", err
+	}
+
+	endpoint := azureManagementEndpoint
+	if ins.APIEndpoint != "" {
+		endpoint = strings.TrimSuffix(ins.APIEndpoint, "/")
+	}
+	subscriptionID := ins.SubscriptionID
+	if subscriptionID == "" {
+		subscriptionID = azure.DefaultSubscriptionID()
+	}
+
+	return fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/providers/%s/flexibleServers/%s%s?api-version=%s",
+		endpoint, subscriptionID, ins.ResourceGroup, provider, ins.Name, path, apiVersion), nil
+}
+
+// call sends a request for the server or one of its sub resources to the azure resource manager
+// and decodes the json response into result, long running operations are not awaited
+func (ins *Azure) call(method, path string, body, result interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	client, err := ins.httpClient(ctx)
+	if err != nil {
+		return err
+	}
+	url, err := ins.serverURL(path)
+	if err != nil {
+		return err
+	}
+
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		errResp := azureErrorResponse{}
+		if json.Unmarshal(data, &errResp) == nil && errResp.Error.Code != "" {
+			return &errResp.Error
+		}
+		return fmt.Errorf("azure %s %s failed with status %d", method, ins.Name, resp.StatusCode)
+	}
+
+	if result == nil || resp.StatusCode != http.StatusOK {
+		return nil
+	}
+	return json.Unmarshal(data, result)
+}
+
+func (ins *Azure) getServer() (*azureServer, error) {
+	server := &azureServer{}
+	if err := ins.call(http.MethodGet, "", nil, server); err != nil {
+		return nil, err
+	}
+	return server, nil
+}
+
+// verifyConfig parses the json config into the server resource
+func (ins *Azure) verifyConfig() (map[string]interface{}, map[string]interface{}, error) {
+	server := map[string]interface{}{}
+	err := json.Unmarshal([]byte(ins.Config), &server)
+	if err != nil {
+		logrus.Errorf("can not verify config - %s", err)
+		return nil, nil, err
+	}
+
+	properties, ok := server["properties"].(map[string]interface{})
+	if !ok {
+		if server["properties"] != nil {
+			return nil, nil, errors.New("properties of azure config must be an object")
+		}
+		properties = map[string]interface{}{}
+		server["properties"] = properties
+	}
+	return server, properties, nil
+}
+
+func (ins *Azure) createServer() error {
+	logrus.Debugf("azure server create %s", ins.Name)
+	server, properties, err := ins.verifyConfig()
+	if err != nil {
+		return err
+	}
+	properties["administratorLogin"] = ins.User
+	properties["administratorLoginPassword"] = ins.Password
+
+	if err := ins.call(http.MethodPut, "", server, nil); err != nil {
+		logrus.Errorf("azure server create error - %s", err)
+		return err
+	}
+
+	ins.Operation = azureOperationCreate
+	return &OperationInProgressError{Operation: ins.Operation}
+}
+
+func (ins *Azure) updateServer() error {
+	logrus.Debugf("azure server update %s", ins.Name)
+	server, properties, err := ins.verifyConfig()
+	if err != nil {
+		return err
+	}
+	delete(server, "location")
+	for _, name := range azureCreateOnlyProperties {
+		delete(properties, name)
+	}
+	operation := azureOperationUpdate
+	if ins.PasswordChanged {
+		properties["administratorLoginPassword"] = ins.Password
+		operation = azureOperationUpdatePassword
+	}
+
+	if err := ins.call(http.MethodPatch, "", server, nil); err != nil {
+		logrus.Errorf("azure server update error - %s", err)
+		return err
+	}
+
+	ins.Operation = operation
+	return &OperationInProgressError{Operation: ins.Operation}
+}
+
+// updateFirewallRules creates and updates the firewall rules of the instance
+// and deletes all other rules of the server
+func (ins *Azure) updateFirewallRules() error {
+	existing := azureFirewallRuleList{}
+	if err := ins.call(http.MethodGet, "/firewallRules", nil, &existing); err != nil {
+		return err
+	}
+
+	current := map[string]azureFirewallRuleProperties{}
+	for _, rule := range existing.Value {
+		current[rule.Name] = rule.Properties
+	}
+
+	for _, rule := range ins.FirewallRules {
+		properties := azureFirewallRuleProperties{StartIPAddress: rule.StartIPAddress, EndIPAddress: rule.EndIPAddress}
+		if found, ok := current[rule.Name]; ok {
+			delete(current, rule.Name)
+			if reflect.DeepEqual(found, properties) {
+				continue
+			}
+		}
+		logrus.Debugf("azure server %s set firewall rule %s", ins.Name, rule.Name)
+		err := ins.call(http.MethodPut, "/firewallRules/"+rule.Name, azureFirewallRuleResource{Properties: properties}, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	for name := range current {
+		logrus.Debugf("azure server %s delete firewall rule %s", ins.Name, name)
+		if err := ins.call(http.MethodDelete, "/firewallRules/"+name, nil, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkOperation returns OperationInProgressError until the created or updated server is ready
+func (ins *Azure) checkOperation() error {
+	if ins.Operation == "" {
+		return nil
+	}
+
+	state, err := ins.state()
+	if err != nil {
+		return err
+	}
+	if state != "RUNNABLE" {
+		return &OperationInProgressError{Operation: ins.Operation}
+	}
+
+	ins.finished = ins.Operation
+	ins.Operation = ""
+	return nil
+}
+
+func (ins *Azure) state() (string, error) {
+	server, err := ins.getServer()
+	if err != nil {
+		return "", err
+	}
+	logrus.Debugf("check azure server %s state: %s", ins.Name, server.Properties.State)
+	// the server is ready for updates as a runnable cloud sql instance
+	if server.Properties.State == "Ready" {
+		return "RUNNABLE", nil
+	}
+	return server.Properties.State, nil
+}
+
+// create starts the creation of the server, the firewall rules are set by the update once it's ready
+func (ins *Azure) create() error {
+	err := ins.createServer()
+	if err != nil {
+		if !errors.Is(err, ErrOperationInProgress) {
+			logrus.Errorf("azure server creation error - %s", err)
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (ins *Azure) update() error {
+	// a created or updated server already has the properties of the config,
+	// it's only updated again if the password changed and wasn't sent yet
+	if ins.finished != azureOperationCreate && ins.finished != azureOperationUpdatePassword &&
+		(ins.finished != azureOperationUpdate || ins.PasswordChanged) {
+		err := ins.updateServer()
+		if err != nil {
+			if !errors.Is(err, ErrOperationInProgress) {
+				logrus.Errorf("azure server update error - %s", err)
+			}
+			return err
+		}
+	}
+
+	err := ins.updateFirewallRules()
+	if err != nil {
+		logrus.Errorf("azure firewall rules update error - %s", err)
+		return err
+	}
+
+	return nil
+}
+
+func (ins *Azure) exist() error {
+	_, err := ins.getServer()
+	var azureErr *AzureError
+	if errors.As(err, &azureErr) && azureErr.Code == azureNotFoundCode {
+		logrus.Debugf("azure server get failed %s", err)
+		return err
+	}
+	if err != nil {
+		// the server may exist, it must not be created again
+		return fmt.Errorf("%w - %s", ErrExistenceUnknown, err)
+	}
+	return nil // server exist
+}
+
+func (ins *Azure) getInfoMap() (map[string]string, error) {
+	server, err := ins.getServer()
+	if err != nil {
+		return nil, err
+	}
+
+	data := map[string]string{
+		"DB_INSTANCE": server.Name,
+		"DB_CONN":     server.Properties.FullyQualifiedDomainName,
+		"DB_PORT":     ins.port(),
+		"DB_VERSION":  server.Properties.Version,
+	}
+
+	return data, nil
+}
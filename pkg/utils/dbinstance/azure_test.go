@@ -0,0 +1,247 @@
+/*
+ * Copyright 2021 kloeckner.i GmbH
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dbinstance
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const azureTestServerPath = "/subscriptions/sub/resourceGroups/databases/providers/Microsoft.DBforPostgreSQL/flexibleServers/test"
+
+// azureMock stands in for azure ad and the resource manager with a single flexible server,
+// a created or updated server stays updating until the test makes it ready
+type azureMock struct {
+	mu            sync.Mutex
+	server        map[string]interface{}
+	state         string
+	patches       []map[string]interface{}
+	firewallRules map[string]azureFirewallRuleProperties
+}
+
+func (m *azureMock) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if r.URL.Path == "/tenant/oauth2/v2.0/token" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "test-token", "token_type": "Bearer", "expires_in": 3600})
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer test-token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if r.URL.Query().Get("api-version") != azurePostgresAPIVersion {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	notFound := func() {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(azureErrorResponse{Error: AzureError{Code: "ResourceNotFound", Message: "not found"}})
+	}
+
+	switch {
+	case r.URL.Path == azureTestServerPath:
+		switch r.Method {
+		case http.MethodGet:
+			if m.server == nil {
+				notFound()
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"name": "test",
+				"properties": map[string]interface{}{
+					"state":                    m.state,
+					"fullyQualifiedDomainName": "test.postgres.database.azure.com",
+					"version":                  "14",
+				},
+			})
+		case http.MethodPut:
+			json.NewDecoder(r.Body).Decode(&m.server)
+			m.state = "Updating"
+			w.WriteHeader(http.StatusAccepted)
+		case http.MethodPatch:
+			patch := map[string]interface{}{}
+			json.NewDecoder(r.Body).Decode(&patch)
+			m.patches = append(m.patches, patch)
+			m.state = "Updating"
+			w.WriteHeader(http.StatusAccepted)
+		}
+	case r.URL.Path == azureTestServerPath+"/firewallRules" && r.Method == http.MethodGet:
+		list := azureFirewallRuleList{Value: []azureFirewallRuleResource{}}
+		for name, properties := range m.firewallRules {
+			list.Value = append(list.Value, azureFirewallRuleResource{Name: name, Properties: properties})
+		}
+		json.NewEncoder(w).Encode(list)
+	case strings.HasPrefix(r.URL.Path, azureTestServerPath+"/firewallRules/"):
+		name := strings.TrimPrefix(r.URL.Path, azureTestServerPath+"/firewallRules/")
+		switch r.Method {
+		case http.MethodPut:
+			rule := azureFirewallRuleResource{}
+			json.NewDecoder(r.Body).Decode(&rule)
+			m.firewallRules[name] = rule.Properties
+			w.WriteHeader(http.StatusAccepted)
+		case http.MethodDelete:
+			delete(m.firewallRules, name)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	default:
+		notFound()
+	}
+}
+
+func mockAzure(t *testing.T) (*Azure, *azureMock) {
+	mock := &azureMock{
+		firewallRules: map[string]azureFirewallRuleProperties{
+			"office":  {StartIPAddress: "10.0.0.1", EndIPAddress: "10.0.0.1"},
+			"cluster": {StartIPAddress: "10.1.0.0", EndIPAddress: "10.1.0.0"},
+		},
+	}
+	server := httptest.NewServer(mock)
+	t.Cleanup(server.Close)
+	// tokens are issued by the mock
+	t.Setenv("AZURE_AUTHORITY_HOST", server.URL)
+	t.Setenv("AZURE_TENANT_ID", "tenant")
+	t.Setenv("AZURE_CLIENT_ID", "client")
+	t.Setenv("AZURE_CLIENT_SECRET", "secret")
+
+	return &Azure{
+		Name:           "test",
+		SubscriptionID: "sub",
+		ResourceGroup:  "databases",
+		Engine:         "postgres",
+		Config:         `{"location": "westeurope", "sku": {"name": "Standard_B1ms", "tier": "Burstable"}, "properties": {"version": "14", "createMode": "Default"}}`,
+		User:           "admin",
+		Password:       "testPassw0rd",
+		FirewallRules: []AzureFirewallRule{
+			{Name: "cluster", StartIPAddress: "10.1.0.0", EndIPAddress: "10.1.255.255"},
+			{Name: "ci", StartIPAddress: "10.2.0.1", EndIPAddress: "10.2.0.1"},
+		},
+		APIEndpoint: server.URL,
+	}, mock
+}
+
+func TestAzureCreate(t *testing.T) {
+	azure, mock := mockAzure(t)
+
+	_, err := Create(azure)
+	assert.Equal(t, &OperationInProgressError{Operation: azureOperationCreate}, err)
+	assert.Equal(t, "westeurope", mock.server["location"])
+	properties := mock.server["properties"].(map[string]interface{})
+	assert.Equal(t, "admin", properties["administratorLogin"])
+	assert.Equal(t, "testPassw0rd", properties["administratorLoginPassword"])
+
+	_, err = Create(azure)
+	assert.Equal(t, &OperationInProgressError{Operation: azureOperationCreate}, err)
+
+	// the created server isn't updated with the same config, only the firewall rules are set
+	mock.state = "Ready"
+	_, err = Create(azure)
+	assert.Equal(t, ErrAlreadyExists, err)
+	info, err := Update(azure)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"DB_INSTANCE": "test",
+		"DB_CONN":     "test.postgres.database.azure.com",
+		"DB_PORT":     "5432",
+		"DB_VERSION":  "14",
+	}, info)
+	assert.Empty(t, mock.patches)
+
+	assert.Equal(t, map[string]azureFirewallRuleProperties{
+		"cluster": {StartIPAddress: "10.1.0.0", EndIPAddress: "10.1.255.255"},
+		"ci":      {StartIPAddress: "10.2.0.1", EndIPAddress: "10.2.0.1"},
+	}, mock.firewallRules, "rules are managed by the instance")
+}
+
+func TestAzureUpdate(t *testing.T) {
+	azure, mock := mockAzure(t)
+
+	_, err := Update(azure)
+	assert.Equal(t, ErrNotExists, err)
+
+	mock.server = map[string]interface{}{}
+	mock.state = "Ready"
+	_, err = Update(azure)
+	assert.Equal(t, &OperationInProgressError{Operation: azureOperationUpdate}, err)
+
+	patch := mock.patches[0]
+	assert.NotContains(t, patch, "location")
+	properties := patch["properties"].(map[string]interface{})
+	assert.NotContains(t, properties, "administratorLoginPassword", "the password didn't change")
+	assert.NotContains(t, properties, "createMode")
+	assert.NotContains(t, properties, "administratorLogin")
+
+	mock.state = "Ready"
+	_, err = Update(azure)
+	assert.NoError(t, err)
+	assert.Len(t, mock.patches, 1)
+
+	mock.state = "Stopped"
+	_, err = Update(azure)
+	assert.Equal(t, ErrInstanceNotReady, err)
+}
+
+func TestAzureUpdatePassword(t *testing.T) {
+	azure, mock := mockAzure(t)
+
+	mock.server = map[string]interface{}{}
+	mock.state = "Ready"
+	azure.PasswordChanged = true
+	_, err := Update(azure)
+	assert.Equal(t, &OperationInProgressError{Operation: azureOperationUpdatePassword}, err)
+	properties := mock.patches[0]["properties"].(map[string]interface{})
+	assert.Equal(t, "testPassw0rd", properties["administratorLoginPassword"])
+
+	mock.state = "Ready"
+	_, err = Update(azure)
+	assert.NoError(t, err)
+	assert.Len(t, mock.patches, 1, "the password isn't sent again")
+}
+
+func TestAzureInvalidConfig(t *testing.T) {
+	azure, _ := mockAzure(t)
+
+	azure.Config = ""
+	assert.Error(t, azure.createServer())
+
+	azure.Config = `{"properties": "version=14"}`
+	assert.Error(t, azure.createServer())
+
+	azure.Config = `{}`
+	azure.Engine = "mariadb"
+	assert.Error(t, azure.createServer())
+}
+
+func TestAzureError(t *testing.T) {
+	azure, _ := mockAzure(t)
+
+	err := azure.exist()
+	assert.Error(t, err)
+	assert.Equal(t, "ResourceNotFound", err.(*AzureError).Code)
+
+	t.Setenv("AZURE_CLIENT_SECRET", "")
+	assert.ErrorIs(t, azure.exist(), ErrExistenceUnknown, "the api can't be called without client secret")
+}
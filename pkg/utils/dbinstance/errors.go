@@ -16,13 +16,47 @@
 
 package dbinstance
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var (
 	// ErrAlreadyExists is thrown when db instance already exists
 	ErrAlreadyExists = errors.New("instance already exists")
 	// ErrNotExists is thrown when db instance does not exists
 	ErrNotExists = errors.New("instance does not exists")
+	// ErrExistenceUnknown is thrown when the backend can't tell if the instance exists, it's neither created nor updated then
+	ErrExistenceUnknown = errors.New("can not determine if instance exists")
 	// ErrInstanceNotReady is thrown when gsql instance is still not marked as Ready
 	ErrInstanceNotReady = errors.New("instance is not ready")
+	// ErrNoPrimary is thrown when none of the hosts of a generic instance accepts writes
+	ErrNoPrimary = errors.New("no primary found among hosts")
+	// ErrOperationInProgress is thrown when a change of the instance is still running in the backend
+	ErrOperationInProgress = errors.New("operation is still in progress")
+	// ErrFinalBackupFailed is thrown when the backup taken before the deletion of the instance failed
+	ErrFinalBackupFailed = errors.New("final backup failed")
+	// ErrDeleteNotSupported is thrown when the backend of the instance can't remove it
+	ErrDeleteNotSupported = errors.New("instance can not be deleted from its backend")
+	// ErrPromoteNotSupported is thrown when the backend of the instance has no read replicas to promote
+	ErrPromoteNotSupported = errors.New("instance can not be promoted by its backend")
+	// ErrBackupNotSupported is thrown when the backend of the instance has no backups of its own
+	ErrBackupNotSupported = errors.New("instance can not be backed up by its backend")
+	// ErrClientCertNotSupported is thrown when the backend of the instance doesn't issue client certificates
+	ErrClientCertNotSupported = errors.New("instance can not issue client certificates")
 )
+
+// OperationInProgressError is thrown when a change of the instance was started as operation of the backend,
+// the operation has to be passed to the instance on the next reconcile to poll it
+type OperationInProgressError struct {
+	Operation string
+}
+
+func (e *OperationInProgressError) Error() string {
+	return fmt.Sprintf("operation %s is still in progress", e.Operation)
+}
+
+// Is makes errors.Is match ErrOperationInProgress
+func (e *OperationInProgressError) Is(target error) bool {
+	return target == ErrOperationInProgress
+}
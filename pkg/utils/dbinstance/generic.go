@@ -26,7 +26,9 @@ import (
 
 // Generic represents database instance which can be connected by address and port
 type Generic struct {
-	Host         string
+	Host string
+	// Hosts of a primary-secondary setup, Host is set to the current primary when the instance is checked
+	Hosts        []string
 	Port         uint16
 	Engine       string
 	User         string
@@ -34,6 +36,12 @@ type Generic struct {
 	PublicIP     string
 	SSLEnabled   bool
 	SkipCAVerify bool
+	// SSLCerts are the CA bundle and the client certificate of ssl connections
+	SSLCerts *kcidb.SSLCerts
+	// Tunnel is the jump host the server is reached through
+	Tunnel *kcidb.SSHTunnel
+	// Executor runs the checks against the server, they are run in the operator if it's nil
+	Executor kcidb.Executor
 }
 
 func makeInterface(in *Generic) (kcidb.Database, error) {
@@ -47,6 +55,8 @@ func makeInterface(in *Generic) (kcidb.Database, error) {
 			Database:     "postgres",
 			SSLEnabled:   in.SSLEnabled,
 			SkipCAVerify: in.SkipCAVerify,
+			SSLCerts:     in.SSLCerts,
+			Tunnel:       in.Tunnel,
 		}
 		return db, nil
 	case "mysql":
@@ -58,6 +68,8 @@ func makeInterface(in *Generic) (kcidb.Database, error) {
 			Database:     "mysql",
 			SSLEnabled:   in.SSLEnabled,
 			SkipCAVerify: in.SkipCAVerify,
+			SSLCerts:     in.SSLCerts,
+			Tunnel:       in.Tunnel,
 		}
 		return db, nil
 	default:
@@ -65,18 +77,38 @@ func makeInterface(in *Generic) (kcidb.Database, error) {
 	}
 }
 
+func (ins *Generic) execute(operation string, db kcidb.Database) kcidb.Result {
+	req, err := kcidb.NewRequest(operation, db, kcidb.AdminCredentials{Username: ins.User, Password: ins.Password})
+	if err != nil {
+		return kcidb.ErrorResult(err)
+	}
+	if ins.Executor == nil {
+		return kcidb.Execute(req)
+	}
+	return ins.Executor.Execute(req)
+}
+
 func (ins *Generic) state() (string, error) {
 	logrus.Debug("generic db instance not support a state check")
 	return "NOT_SUPPORTED", nil
 }
 
 func (ins *Generic) exist() error {
+	if len(ins.Hosts) > 0 {
+		primary, err := ins.findPrimary()
+		if err != nil {
+			logrus.Error(err)
+			return err
+		}
+		ins.Host = primary
+	}
+
 	db, err := makeInterface(ins)
 	if err != nil {
 		logrus.Errorf("can not check if instance exists because of %s", err)
 		return err
 	}
-	err = db.CheckStatus()
+	err = ins.execute(kcidb.OpCheckStatus, db).Err()
 	if err != nil {
 		logrus.Error(err)
 		return err
@@ -102,3 +134,42 @@ func (ins *Generic) getInfoMap() (map[string]string, error) {
 
 	return data, nil
 }
+
+// findPrimary returns the first of the hosts which accepts writes,
+// kcidb.ErrRequestInProgress is returned if no primary is found while some hosts are still checked
+func (ins *Generic) findPrimary() (string, error) {
+	pending := false
+	for _, host := range ins.Hosts {
+		candidate := *ins
+		candidate.Host = host
+		db, err := makeInterface(&candidate)
+		if err != nil {
+			return "", err
+		}
+
+		result := ins.execute(kcidb.OpIsPrimary, db)
+		if result.Pending {
+			pending = true
+			continue
+		}
+		if err := result.Err(); err != nil {
+			logrus.Warnf("can not check if host %s is primary - %s", host, err)
+			continue
+		}
+		if result.Primary {
+			return host, nil
+		}
+	}
+	if pending {
+		return "", kcidb.ErrRequestInProgress
+	}
+	return "", ErrNoPrimary
+}
+
+// DetectPrimary returns the host of the current primary of a generic instance
+func DetectPrimary(ins *Generic) (string, error) {
+	if len(ins.Hosts) == 0 {
+		return ins.Host, nil
+	}
+	return ins.findPrimary()
+}
@@ -16,7 +16,12 @@
 
 package dbinstance
 
-import "github.com/kloeckner-i/db-operator/pkg/test"
+import (
+	"testing"
+
+	"github.com/kloeckner-i/db-operator/pkg/test"
+	"github.com/stretchr/testify/assert"
+)
 
 func testGenericMysqlInstance() *Generic {
 	return &Generic{
@@ -37,3 +42,27 @@ func testGenericPostgresInstance() *Generic {
 		Password: test.GetPostgresAdminPassword(),
 	}
 }
+
+func TestPostgresGenericInstanceDetectPrimary(t *testing.T) {
+	postgresInstance := testGenericPostgresInstance()
+	postgresInstance.Hosts = []string{"wronghost", postgresInstance.Host}
+	postgresInstance.Host = ""
+
+	primary, err := DetectPrimary(postgresInstance)
+	assert.NoError(t, err)
+	assert.Equal(t, test.GetPostgresHost(), primary)
+
+	postgresInstance.Hosts = []string{"wronghost"}
+	_, err = DetectPrimary(postgresInstance)
+	assert.ErrorIs(t, err, ErrNoPrimary)
+}
+
+func TestMysqlGenericInstanceDetectPrimary(t *testing.T) {
+	mysqlInstance := testGenericMysqlInstance()
+	mysqlInstance.Hosts = []string{mysqlInstance.Host}
+	mysqlInstance.Host = ""
+
+	_, err := Update(mysqlInstance)
+	assert.NoError(t, err)
+	assert.Equal(t, test.GetMysqlHost(), mysqlInstance.Host)
+}
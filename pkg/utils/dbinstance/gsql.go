@@ -18,18 +18,21 @@ package dbinstance
 
 import (
 	"context"
+	"crypto/x509"
 	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/kloeckner-i/db-operator/pkg/utils/gcloud"
-	"github.com/kloeckner-i/db-operator/pkg/utils/kci"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/oauth2"
 	"google.golang.org/api/option"
 	sqladmin "google.golang.org/api/sqladmin/v1beta4"
+	"k8s.io/utils/strings/slices"
 )
 
 // Gsql represents a google sql instance
@@ -40,6 +43,27 @@ type Gsql struct {
 	Password    string
 	ProjectID   string
 	APIEndpoint string
+	// Settings are merged into the config, their fields take precedence
+	Settings *sqladmin.DatabaseInstance
+	// Operation is the pending operation of the instance, it's set to the operation started by create, update or delete
+	Operation string
+	// BackupOperation is the pending on-demand backup run, it's tracked apart from the operations changing the instance
+	BackupOperation string
+	// FinalBackupBucket is the bucket the databases are exported to before the instance is deleted, nothing is exported if it's empty
+	FinalBackupBucket string
+	// MasterInstanceName is the Cloud SQL instance the instance is created as read replica of
+	MasterInstanceName string
+	// CloneSource is the Cloud SQL instance the instance is created as clone of at ClonePointInTime,
+	// the current state is cloned if ClonePointInTime is empty
+	CloneSource      string
+	ClonePointInTime string
+	// RestoreSource is the Cloud SQL instance whose backup run RestoreBackupRunID is restored into the instance
+	RestoreSource      string
+	RestoreBackupRunID int64
+	// finished is the type of the operation which finished during this reconcile
+	finished string
+	// exported is the export of the final backup which finished during this reconcile
+	exported string
 }
 
 // GsqlNew create a new Gsql object and return
@@ -93,9 +117,13 @@ func (ins *Gsql) getInstance() (*sqladmin.DatabaseInstance, error) {
 
 func (ins *Gsql) createInstance() error {
 	logrus.Debugf("gsql instance create %s", ins.Name)
-	request, err := ins.verifyConfig()
-	if err != nil {
-		return err
+	request := &sqladmin.DatabaseInstance{}
+	if ins.CloneSource == "" {
+		var err error
+		request, err = ins.verifyConfig()
+		if err != nil {
+			return err
+		}
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -106,6 +134,11 @@ func (ins *Gsql) createInstance() error {
 		return err
 	}
 
+	if ins.CloneSource != "" {
+		return ins.cloneInstance(ctx, sqladminService)
+	}
+	request.MasterInstanceName = ins.MasterInstanceName
+
 	// Project ID of the project to which the newly created Cloud SQL instances should belong.
 	resp, err := sqladminService.Instances.Insert(ins.ProjectID, request).Context(ctx).Do()
 	if err != nil {
@@ -113,16 +146,31 @@ func (ins *Gsql) createInstance() error {
 		return err
 	}
 	logrus.Debugf("instance insert api response: %#v", resp)
-	err = ins.waitUntilRunnable()
+
+	return ins.startOperation(resp)
+}
+
+// cloneInstance creates the instance as clone of the source instance
+func (ins *Gsql) cloneInstance(ctx context.Context, service *sqladmin.Service) error {
+	request := &sqladmin.InstancesCloneRequest{
+		CloneContext: &sqladmin.CloneContext{DestinationInstanceName: ins.Name, PointInTime: ins.ClonePointInTime},
+	}
+	resp, err := service.Instances.Clone(ins.ProjectID, ins.CloneSource, request).Context(ctx).Do()
 	if err != nil {
-		return fmt.Errorf("gsql instance created but still not runnable - %s", err)
+		logrus.Errorf("gsql instance clone error - %s", err)
+		return err
 	}
+	logrus.Debugf("instance clone api response: %#v", resp)
 
-	return err
+	return ins.startOperation(resp)
 }
 
 func (ins *Gsql) updateInstance() error {
-	logrus.Debugf("gsql instance create %s", ins.Name)
+	logrus.Debugf("gsql instance update %s", ins.Name)
+	if ins.CloneSource != "" && ins.Config == "" && ins.Settings == nil {
+		// clones keep the settings of their source
+		return nil
+	}
 	request, err := ins.verifyConfig()
 	if err != nil {
 		return err
@@ -136,6 +184,19 @@ func (ins *Gsql) updateInstance() error {
 		return err
 	}
 
+	current, err := sqladminService.Instances.Get(ins.ProjectID, ins.Name).Context(ctx).Do()
+	if err != nil {
+		return err
+	}
+	applied, err := isConfigApplied(request, current)
+	if err != nil {
+		return err
+	}
+	if applied {
+		logrus.Debugf("gsql instance %s is up to date, skipping patch", ins.Name)
+		return nil
+	}
+
 	// Project ID of the project to which the newly created Cloud SQL instances should belong.
 	resp, err := sqladminService.Instances.Patch(ins.ProjectID, ins.Name, request).Context(ctx).Do()
 	if err != nil {
@@ -144,15 +205,14 @@ func (ins *Gsql) updateInstance() error {
 	}
 	logrus.Debugf("instance patch api response: %#v", resp)
 
-	err = ins.waitUntilRunnable()
-	if err != nil {
-		return fmt.Errorf("gsql instance created but still not runnable - %s", err)
-	}
-
-	return err
+	return ins.startOperation(resp)
 }
 
 func (ins *Gsql) updateUser() error {
+	if ins.MasterInstanceName != "" {
+		// users of read replicas are replicated from the master
+		return nil
+	}
 	logrus.Debugf("gsql user update - instance: %s, user: %s", ins.Name, ins.User)
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -175,54 +235,156 @@ func (ins *Gsql) updateUser() error {
 	}
 	logrus.Debugf("user update api response: %#v", resp)
 
-	err = ins.waitUntilRunnable()
-	if err != nil {
-		return fmt.Errorf("gsql user updated but still not runnable - %s", err)
-	}
-
-	return nil
+	return ins.startOperation(resp)
 }
 
 func (ins *Gsql) verifyConfig() (*sqladmin.DatabaseInstance, error) {
 	// require non empty name and config
 	rb := &sqladmin.DatabaseInstance{}
-	err := json.Unmarshal([]byte(ins.Config), rb)
-	if err != nil {
-		logrus.Errorf("can not verify config - %s", err)
-		logrus.Debugf("%#v\n", []byte(ins.Config))
-		return nil, err
+	if ins.Config != "" || ins.Settings == nil {
+		err := json.Unmarshal([]byte(ins.Config), rb)
+		if err != nil {
+			logrus.Errorf("can not verify config - %s", err)
+			logrus.Debugf("%#v\n", []byte(ins.Config))
+			return nil, err
+		}
+	}
+	if ins.Settings != nil {
+		// only the fields which are set are marshaled, so they overwrite the fields of the config
+		settings, err := ins.Settings.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(settings, rb); err != nil {
+			return nil, err
+		}
 	}
 	rb.Name = ins.Name
 	return rb, nil
 }
 
-func (ins *Gsql) waitUntilRunnable() error {
-	const delay = 30
-	time.Sleep(delay * time.Second)
-
-	err := kci.Retry(10, 60*time.Second, func() error {
-		state, err := ins.state()
+// isConfigApplied returns true if the instance already has all fields of the config
+func isConfigApplied(config, instance *sqladmin.DatabaseInstance) (bool, error) {
+	var desired, actual interface{}
+	for _, v := range []struct {
+		from interface{}
+		to   *interface{}
+	}{{config, &desired}, {instance, &actual}} {
+		data, err := json.Marshal(v.from)
 		if err != nil {
-			return err
+			return false, err
 		}
-		if state != "RUNNABLE" {
-			return errors.New("gsql instance not ready yet")
+		if err := json.Unmarshal(data, v.to); err != nil {
+			return false, err
 		}
+	}
+	return isSubset(desired, actual), nil
+}
 
-		return nil
-	})
-	if err != nil {
-		instance, err := ins.getInstance()
-		if err != nil {
-			return err
+// isSubset compares decoded json, objects may have more fields and the order of list items doesn't matter,
+// missing fields equal zero values because the api omits them
+func isSubset(desired, actual interface{}) bool {
+	switch desired := desired.(type) {
+	case map[string]interface{}:
+		actualMap, ok := actual.(map[string]interface{})
+		if !ok && actual != nil {
+			return false
+		}
+		for key, value := range desired {
+			if !isSubset(value, actualMap[key]) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		actualList, ok := actual.([]interface{})
+		if !ok && actual != nil || len(desired) != len(actualList) {
+			return false
+		}
+		for _, item := range desired {
+			found := false
+			for _, actualItem := range actualList {
+				if isSubset(item, actualItem) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
 		}
+		return true
+	default:
+		if actual == nil {
+			return desired == nil || desired == false || desired == "" || desired == "0" || desired == float64(0)
+		}
+		return desired == actual
+	}
+}
 
-		return fmt.Errorf("gsql instance state not ready %s", instance.State)
+// startOperation records the operation started by a change of the instance,
+// operations which are already done are finished right away
+func (ins *Gsql) startOperation(op *sqladmin.Operation) error {
+	if op.Status == "DONE" {
+		return ins.finishOperation(op)
 	}
+	ins.Operation = op.Name
+	return &OperationInProgressError{Operation: op.Name}
+}
 
+func (ins *Gsql) finishOperation(op *sqladmin.Operation) error {
+	ins.Operation = ""
+	if err := operationError(op); err != nil {
+		if op.OperationType == "EXPORT" {
+			return fmt.Errorf("%w - %s", ErrFinalBackupFailed, err)
+		}
+		return err
+	}
+	ins.finished = op.OperationType
+	if op.ExportContext != nil {
+		ins.exported = exportName(op.ExportContext.Databases)
+	}
 	return nil
 }
 
+// operationError returns the errors of a finished operation
+func operationError(op *sqladmin.Operation) error {
+	if op.Error == nil || len(op.Error.Errors) == 0 {
+		return nil
+	}
+	messages := []string{}
+	for _, opErr := range op.Error.Errors {
+		messages = append(messages, fmt.Sprintf("%s: %s", opErr.Code, opErr.Message))
+	}
+	return fmt.Errorf("gsql operation %s failed - %s", op.Name, strings.Join(messages, ", "))
+}
+
+// checkOperation polls the pending operation of the instance
+func (ins *Gsql) checkOperation() error {
+	if ins.Operation == "" {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sqladminService, err := ins.getSqladminService(ctx)
+	if err != nil {
+		return err
+	}
+
+	op, err := sqladminService.Operations.Get(ins.ProjectID, ins.Operation).Context(ctx).Do()
+	if err != nil {
+		return err
+	}
+	logrus.Debugf("gsql instance %s operation %s %s: %s", ins.Name, op.Name, op.OperationType, op.Status)
+	if op.Status != "DONE" {
+		return &OperationInProgressError{Operation: op.Name}
+	}
+
+	return ins.finishOperation(op)
+}
+
 func (ins *Gsql) state() (string, error) {
 	instance, err := ins.getInstance()
 	if err != nil {
@@ -235,13 +397,17 @@ func (ins *Gsql) state() (string, error) {
 func (ins *Gsql) create() error {
 	err := ins.createInstance()
 	if err != nil {
-		logrus.Errorf("gsql instance creation error - %s", err)
+		if !errors.Is(err, ErrOperationInProgress) {
+			logrus.Errorf("gsql instance creation error - %s", err)
+		}
 		return err
 	}
 
 	err = ins.updateUser()
 	if err != nil {
-		logrus.Errorf("gsql user update error - %s", err)
+		if !errors.Is(err, ErrOperationInProgress) {
+			logrus.Errorf("gsql user update error - %s", err)
+		}
 		return err
 	}
 
@@ -249,21 +415,322 @@ func (ins *Gsql) create() error {
 }
 
 func (ins *Gsql) update() error {
-	err := ins.updateInstance()
+	// steps done by operations which finished since the last reconcile are skipped
+	switch ins.finished {
+	case "UPDATE_USER":
+		return nil
+	case "CREATE", "UPDATE", "RESTORE_VOLUME":
+	default:
+		err := ins.updateInstance()
+		if err != nil {
+			if !errors.Is(err, ErrOperationInProgress) {
+				logrus.Errorf("gsql instance update error - %s", err)
+			}
+			return err
+		}
+	}
+
+	err := ins.updateUser()
 	if err != nil {
-		logrus.Errorf("gsql instance update error - %s", err)
+		if !errors.Is(err, ErrOperationInProgress) {
+			logrus.Errorf("gsql user update error - %s", err)
+		}
 		return err
 	}
 
-	err = ins.updateUser()
+	return nil
+}
+
+// delete removes the instance after the final backup, the export of each database and the deletion run as operations
+func (ins *Gsql) delete() error {
+	if ins.finished == "DELETE" {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sqladminService, err := ins.getSqladminService(ctx)
+	if err != nil {
+		return err
+	}
+
+	instance, err := sqladminService.Instances.Get(ins.ProjectID, ins.Name).Context(ctx).Do()
+	if err != nil {
+		if isGoogleAPINotFound(err) {
+			logrus.Infof("gsql instance %s doesn't exist anymore", ins.Name)
+			return nil
+		}
+		return err
+	}
+
+	if ins.FinalBackupBucket != "" {
+		if err := ins.finalBackup(ctx, sqladminService, instance); err != nil {
+			return err
+		}
+	}
+
+	logrus.Infof("deleting gsql instance %s", ins.Name)
+	op, err := sqladminService.Instances.Delete(ins.ProjectID, ins.Name).Context(ctx).Do()
+	if err != nil {
+		if isGoogleAPINotFound(err) {
+			return nil
+		}
+		logrus.Errorf("gsql instance delete error - %s", err)
+		return err
+	}
+	return ins.startOperation(op)
+}
+
+// backup starts an on-demand backup run of the instance, a started run is polled until it's done
+func (ins *Gsql) backup() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sqladminService, err := ins.getSqladminService(ctx)
+	if err != nil {
+		return err
+	}
+
+	var op *sqladmin.Operation
+	if ins.BackupOperation != "" {
+		op, err = sqladminService.Operations.Get(ins.ProjectID, ins.BackupOperation).Context(ctx).Do()
+		if err != nil {
+			return err
+		}
+		logrus.Debugf("gsql instance %s backup run %s: %s", ins.Name, op.Name, op.Status)
+	} else {
+		logrus.Infof("starting backup run of gsql instance %s", ins.Name)
+		op, err = sqladminService.BackupRuns.Insert(ins.ProjectID, ins.Name, &sqladmin.BackupRun{Description: "on-demand backup by db-operator"}).Context(ctx).Do()
+		if err != nil {
+			logrus.Errorf("gsql backup run error - %s", err)
+			return err
+		}
+	}
+
+	if op.Status != "DONE" {
+		ins.BackupOperation = op.Name
+		return &OperationInProgressError{Operation: op.Name}
+	}
+	ins.BackupOperation = ""
+	return operationError(op)
+}
+
+// gsqlBackupRunsListed is the number of backup runs listed in the instance status
+const gsqlBackupRunsListed = 10
+
+// backupRuns lists the most recent backup runs of the instance
+func (ins *Gsql) backupRuns() ([]BackupRun, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sqladminService, err := ins.getSqladminService(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := sqladminService.BackupRuns.List(ins.ProjectID, ins.Name).MaxResults(gsqlBackupRunsListed).Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+	runs := []BackupRun{}
+	for _, run := range resp.Items {
+		runs = append(runs, BackupRun{
+			ID:           run.Id,
+			Type:         run.Type,
+			Status:       run.Status,
+			EnqueuedTime: run.EnqueuedTime,
+			EndTime:      run.EndTime,
+		})
+	}
+	return runs, nil
+}
+
+// restore overwrites the instance with the backup run of the restore source
+func (ins *Gsql) restore() error {
+	if ins.finished == "RESTORE_VOLUME" || ins.RestoreBackupRunID == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sqladminService, err := ins.getSqladminService(ctx)
+	if err != nil {
+		return err
+	}
+
+	request := &sqladmin.InstancesRestoreBackupRequest{
+		RestoreBackupContext: &sqladmin.RestoreBackupContext{
+			BackupRunId: ins.RestoreBackupRunID,
+			InstanceId:  ins.RestoreSource,
+			Project:     ins.ProjectID,
+		},
+	}
+	logrus.Infof("restoring backup run %d of gsql instance %s into %s", ins.RestoreBackupRunID, ins.RestoreSource, ins.Name)
+	op, err := sqladminService.Instances.RestoreBackup(ins.ProjectID, ins.Name, request).Context(ctx).Do()
+	if err != nil {
+		logrus.Errorf("gsql restore error - %s", err)
+		return err
+	}
+	return ins.startOperation(op)
+}
+
+// gsqlClientCertRenewal is the time before its expiration a client certificate is renewed
+const gsqlClientCertRenewal = 30 * 24 * time.Hour
+
+// GsqlClientCertDue returns true when the pem encoded client certificate can't be read or is about to expire,
+// the ssl certs api only needs to be asked then
+func GsqlClientCertDue(cert []byte, now time.Time) bool {
+	block, _ := pem.Decode(cert)
+	if block == nil {
+		return true
+	}
+	parsed, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return true
+	}
+	return parsed.NotAfter.Sub(now) <= gsqlClientCertRenewal
+}
+
+// clientCert issues a client certificate through the ssl certs api, the key is only returned on creation
+func (ins *Gsql) clientCert(commonName, fingerprint string) (*ClientCert, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sqladminService, err := ins.getSqladminService(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	certs, err := sqladminService.SslCerts.List(ins.ProjectID, ins.Name).Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+	for _, cert := range certs.Items {
+		if cert.CommonName != commonName {
+			continue
+		}
+		expiration, err := time.Parse(time.RFC3339, cert.ExpirationTime)
+		if cert.Sha1Fingerprint == fingerprint && err == nil && time.Until(expiration) > gsqlClientCertRenewal {
+			return nil, nil
+		}
+		// common names are unique, the old certificate is revoked before a new one is issued
+		logrus.Infof("revoking client certificate %s of gsql instance %s", cert.Sha1Fingerprint, ins.Name)
+		if _, err := sqladminService.SslCerts.Delete(ins.ProjectID, ins.Name, cert.Sha1Fingerprint).Context(ctx).Do(); err != nil {
+			return nil, err
+		}
+	}
+
+	logrus.Infof("issuing client certificate %s of gsql instance %s", commonName, ins.Name)
+	resp, err := sqladminService.SslCerts.Insert(ins.ProjectID, ins.Name, &sqladmin.SslCertsInsertRequest{CommonName: commonName}).Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+	if resp.ClientCert == nil || resp.ClientCert.CertInfo == nil || resp.ServerCaCert == nil {
+		return nil, fmt.Errorf("gsql instance %s returned no client certificate", ins.Name)
+	}
+	return &ClientCert{
+		Cert:        resp.ClientCert.CertInfo.Cert,
+		Key:         resp.ClientCert.CertPrivateKey,
+		CA:          resp.ServerCaCert.Cert,
+		Fingerprint: resp.ClientCert.CertInfo.Sha1Fingerprint,
+	}, nil
+}
+
+// promote turns the read replica into a standalone instance
+func (ins *Gsql) promote() error {
+	if ins.finished == "PROMOTE_REPLICA" {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sqladminService, err := ins.getSqladminService(ctx)
 	if err != nil {
-		logrus.Errorf("gsql user update error - %s", err)
 		return err
 	}
 
+	instance, err := sqladminService.Instances.Get(ins.ProjectID, ins.Name).Context(ctx).Do()
+	if err != nil {
+		return err
+	}
+	if instance.InstanceType != "READ_REPLICA_INSTANCE" {
+		logrus.Debugf("gsql instance %s is not a read replica", ins.Name)
+		return nil
+	}
+
+	logrus.Infof("promoting gsql read replica %s", ins.Name)
+	op, err := sqladminService.Instances.PromoteReplica(ins.ProjectID, ins.Name).Context(ctx).Do()
+	if err != nil {
+		logrus.Errorf("gsql replica promotion error - %s", err)
+		return err
+	}
+	return ins.startOperation(op)
+}
+
+// gsqlSystemDatabases are created by Cloud SQL and aren't part of the final backup
+var gsqlSystemDatabases = []string{"postgres", "cloudsqladmin"}
+
+// finalBackup exports the databases to the final backup bucket. An instance runs one export at a time,
+// so every call starts the export following the one which finished last, it returns nil when all databases are exported.
+func (ins *Gsql) finalBackup(ctx context.Context, service *sqladmin.Service, instance *sqladmin.DatabaseInstance) error {
+	// mysql exports all databases into a single dump, postgres dumps a single database
+	exports := [][]string{nil}
+	if strings.HasPrefix(instance.DatabaseVersion, "POSTGRES") {
+		databases, err := service.Databases.List(ins.ProjectID, ins.Name).Context(ctx).Do()
+		if err != nil {
+			return fmt.Errorf("%w - %s", ErrFinalBackupFailed, err)
+		}
+		names := []string{}
+		for _, db := range databases.Items {
+			if !slices.Contains(gsqlSystemDatabases, db.Name) {
+				names = append(names, db.Name)
+			}
+		}
+		sort.Strings(names)
+		exports = [][]string{}
+		for _, name := range names {
+			exports = append(exports, []string{name})
+		}
+	}
+
+	next := 0
+	if ins.finished == "EXPORT" {
+		for i, databases := range exports {
+			if exportName(databases) == ins.exported {
+				next = i + 1
+			}
+		}
+	}
+
+	for _, databases := range exports[next:] {
+		uri := fmt.Sprintf("gs://%s/%s/%s.sql.gz", ins.FinalBackupBucket, ins.Name, exportName(databases))
+		logrus.Infof("exporting final backup of gsql instance %s to %s", ins.Name, uri)
+		request := &sqladmin.InstancesExportRequest{
+			ExportContext: &sqladmin.ExportContext{FileType: "SQL", Databases: databases, Uri: uri},
+		}
+		op, err := service.Instances.Export(ins.ProjectID, ins.Name, request).Context(ctx).Do()
+		if err != nil {
+			logrus.Errorf("gsql instance export error - %s", err)
+			return fmt.Errorf("%w - %s", ErrFinalBackupFailed, err)
+		}
+		if err := ins.startOperation(op); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// exportName names the dump of the exported databases
+func exportName(databases []string) string {
+	if len(databases) == 0 {
+		return "all"
+	}
+	return strings.Join(databases, "-")
+}
+
 func (ins *Gsql) exist() error {
 	_, err := ins.getInstance()
 	if err != nil {
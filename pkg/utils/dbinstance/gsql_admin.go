@@ -0,0 +1,371 @@
+/*
+ * Copyright 2021 kloeckner.i GmbH
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dbinstance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/kloeckner-i/db-operator/pkg/utils/database"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/api/googleapi"
+	sqladmin "google.golang.org/api/sqladmin/v1beta4"
+)
+
+const (
+	// gsqlBuiltInUser authenticates with the password of the user
+	gsqlBuiltInUser = "BUILT_IN"
+	// gsqlIAMUser authenticates with the iam credentials of a service account
+	gsqlIAMUser = "CLOUD_IAM_SERVICE_ACCOUNT"
+	// gsqlUserHost allows mysql users to connect from any host, it's ignored by postgres
+	gsqlUserHost = "%"
+)
+
+// gsqlStep is a change of an admin api request, it returns the operation it started or nil if nothing had to be changed
+type gsqlStep struct {
+	name string
+	run  func() (*sqladmin.Operation, error)
+}
+
+// Execute implements database.Executor, databases and users are managed with the Cloud SQL admin api,
+// so the instance doesn't need to be reachable by the operator.
+// Owner markers can't be stored through the api, existing objects are only changed if the request is Owned.
+// Requests which start operations are pending until the operations are done, the last started operation
+// is returned as BackendOperation and continued by the next attempt of the request.
+func (ins *Gsql) Execute(req database.Request) database.Result {
+	db, err := req.Database()
+	if err != nil {
+		return database.ErrorResult(err)
+	}
+	cred := db.GetCredentials()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sqladminService, err := ins.getSqladminService(ctx)
+	if err != nil {
+		return database.ErrorResult(err)
+	}
+
+	switch req.Operation {
+	case database.OpCreate:
+		if err := adminAPISupports(req); err != nil {
+			return database.ErrorResult(err)
+		}
+		if req.Adopt {
+			return database.ErrorResult(ins.checkDatabase(ctx, sqladminService, cred))
+		}
+		if !req.Owned && req.BackendOperation == "" {
+			if err := ins.checkNotExisting(ctx, sqladminService, cred); err != nil {
+				return database.ErrorResult(err)
+			}
+		}
+		return ins.runSteps(ctx, sqladminService, req.BackendOperation, []gsqlStep{
+			{name: "database", run: func() (*sqladmin.Operation, error) { return ins.createDatabase(ctx, sqladminService, cred) }},
+			{name: "user", run: func() (*sqladmin.Operation, error) { return ins.createUser(ctx, sqladminService, cred) }},
+		})
+	case database.OpDelete:
+		if !req.Owned {
+			return database.ErrorResult(fmt.Errorf("database %s and user %s aren't known to be owned by the requester, they are not deleted", cred.Name, cred.Username))
+		}
+		return ins.runSteps(ctx, sqladminService, req.BackendOperation, []gsqlStep{
+			{name: "database", run: func() (*sqladmin.Operation, error) { return ins.deleteDatabase(ctx, sqladminService, cred) }},
+			{name: "user", run: func() (*sqladmin.Operation, error) { return ins.deleteUser(ctx, sqladminService, cred.Username) }},
+		})
+	case database.OpCheckStatus:
+		return database.ErrorResult(ins.checkDatabase(ctx, sqladminService, cred))
+	case database.OpIsPrimary:
+		// requests are sent to the instance by name, it's always the primary
+		return database.Result{Primary: true}
+	default:
+		return database.ErrorResult(fmt.Errorf("%s is not supported by the Cloud SQL admin api", req.Operation))
+	}
+}
+
+// runSteps runs the steps in order and continues after the step of the pending operation once it's done.
+// The pending operation is <step>/<operation name>, an empty operation name marks a step as done without operation.
+// The result is pending as long as an operation is running and keeps the progress if a step fails.
+func (ins *Gsql) runSteps(ctx context.Context, service *sqladmin.Service, pending string, steps []gsqlStep) database.Result {
+	start := 0
+	if pending != "" {
+		stepName, opName, _ := strings.Cut(pending, "/")
+		for i, step := range steps {
+			if step.name == stepName {
+				start = i + 1
+			}
+		}
+		if opName != "" {
+			op, err := service.Operations.Get(ins.ProjectID, opName).Context(ctx).Do()
+			if err != nil {
+				return withBackendOperation(database.ErrorResult(err), pending)
+			}
+			if op.Status != "DONE" {
+				return withBackendOperation(database.PendingResult(), pending)
+			}
+			if err := operationError(op); err != nil {
+				// the failed step is repeated by the next attempt
+				return withBackendOperation(database.ErrorResult(err), completedSteps(steps, start-1))
+			}
+		}
+	}
+
+	done := completedSteps(steps, start)
+	for i := start; i < len(steps); i++ {
+		step := steps[i]
+		op, err := step.run()
+		if errors.Is(err, database.ErrRequestInProgress) {
+			return withBackendOperation(database.PendingResult(), done)
+		}
+		if err != nil {
+			return withBackendOperation(database.ErrorResult(err), done)
+		}
+		if op != nil && op.Status != "DONE" {
+			logrus.Debugf("gsql instance %s operation %s %s: %s", ins.Name, op.Name, op.OperationType, op.Status)
+			return withBackendOperation(database.PendingResult(), step.name+"/"+op.Name)
+		}
+		if op != nil {
+			if err := operationError(op); err != nil {
+				return withBackendOperation(database.ErrorResult(err), done)
+			}
+		}
+		done = completedSteps(steps, i+1)
+	}
+	return database.Result{}
+}
+
+// completedSteps returns the progress marker of the first count steps
+func completedSteps(steps []gsqlStep, count int) string {
+	if count <= 0 {
+		return ""
+	}
+	return steps[count-1].name + "/"
+}
+
+func withBackendOperation(result database.Result, operation string) database.Result {
+	result.BackendOperation = operation
+	return result
+}
+
+// adminAPISupports returns an error if the request needs sql statements which can't be run through the api
+func adminAPISupports(req database.Request) error {
+	if req.Mysql != nil && req.Mysql.IAMPrincipal != "" {
+		return errors.New("iam users need privileges granted with sql statements, they can't be managed with the Cloud SQL admin api")
+	}
+	pg := req.Postgres
+	if pg == nil {
+		return nil
+	}
+	if pg.IAMPrincipal != "" {
+		return errors.New("iam users need privileges granted with sql statements, they can't be managed with the Cloud SQL admin api")
+	}
+	if len(pg.Extensions) > 0 || len(pg.Schemas) > 0 || pg.DropPublicSchema || pg.Monitoring || pg.Template != "" {
+		return errors.New("extensions, schemas, monitoring and templates of postgres databases can't be managed with the Cloud SQL admin api")
+	}
+	return nil
+}
+
+func isGoogleAPINotFound(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound
+}
+
+func (ins *Gsql) checkDatabase(ctx context.Context, service *sqladmin.Service, cred database.Credentials) error {
+	if _, err := service.Databases.Get(ins.ProjectID, ins.Name, cred.Name).Context(ctx).Do(); err != nil {
+		return fmt.Errorf("can not get database %s - %s", cred.Name, err)
+	}
+	user, err := ins.getUser(ctx, service, cred.Username)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return fmt.Errorf("user %s doesn't exist", cred.Username)
+	}
+	return nil
+}
+
+// checkNotExisting refuses to take over a database or user which wasn't created for the requester,
+// they may belong to someone else and would be deleted with the Database
+func (ins *Gsql) checkNotExisting(ctx context.Context, service *sqladmin.Service, cred database.Credentials) error {
+	_, err := service.Databases.Get(ins.ProjectID, ins.Name, cred.Name).Context(ctx).Do()
+	if err == nil {
+		return fmt.Errorf("database %s already exists and can't be verified to be owned through the Cloud SQL admin api, adopt it instead", cred.Name)
+	}
+	if !isGoogleAPINotFound(err) {
+		return err
+	}
+	user, err := ins.getUser(ctx, service, cred.Username)
+	if err != nil {
+		return err
+	}
+	if user != nil {
+		return fmt.Errorf("user %s already exists and can't be verified to be owned through the Cloud SQL admin api, adopt it instead", cred.Username)
+	}
+	return nil
+}
+
+func (ins *Gsql) getUser(ctx context.Context, service *sqladmin.Service, name string) (*sqladmin.User, error) {
+	users, err := service.Users.List(ins.ProjectID, ins.Name).Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+	for _, user := range users.Items {
+		if user.Name == name {
+			return user, nil
+		}
+	}
+	return nil, nil
+}
+
+func (ins *Gsql) createDatabase(ctx context.Context, service *sqladmin.Service, cred database.Credentials) (*sqladmin.Operation, error) {
+	_, err := service.Databases.Get(ins.ProjectID, ins.Name, cred.Name).Context(ctx).Do()
+	if err == nil {
+		logrus.Debugf("gsql database %s already exists on instance %s", cred.Name, ins.Name)
+		return nil, nil
+	}
+	if !isGoogleAPINotFound(err) {
+		return nil, err
+	}
+
+	op, err := service.Databases.Insert(ins.ProjectID, ins.Name, &sqladmin.Database{Name: cred.Name}).Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("can not create database %s - %s", cred.Name, err)
+	}
+	return op, nil
+}
+
+// createUser creates the user or updates the password of an existing one
+func (ins *Gsql) createUser(ctx context.Context, service *sqladmin.Service, cred database.Credentials) (*sqladmin.Operation, error) {
+	existing, err := ins.getUser(ctx, service, cred.Username)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &sqladmin.User{
+		Name:     cred.Username,
+		Host:     gsqlUserHost,
+		Password: cred.Password,
+		Type:     gsqlBuiltInUser,
+	}
+	var op *sqladmin.Operation
+	if existing == nil {
+		op, err = service.Users.Insert(ins.ProjectID, ins.Name, user).Context(ctx).Do()
+	} else {
+		op, err = service.Users.Update(ins.ProjectID, ins.Name, user).Host(gsqlUserHost).Name(cred.Username).Context(ctx).Do()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can not create user %s - %s", cred.Username, err)
+	}
+	return op, nil
+}
+
+func (ins *Gsql) deleteDatabase(ctx context.Context, service *sqladmin.Service, cred database.Credentials) (*sqladmin.Operation, error) {
+	op, err := service.Databases.Delete(ins.ProjectID, ins.Name, cred.Name).Context(ctx).Do()
+	if err != nil {
+		if isGoogleAPINotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("can not delete database %s - %s", cred.Name, err)
+	}
+	return op, nil
+}
+
+func (ins *Gsql) deleteUser(ctx context.Context, service *sqladmin.Service, name string) (*sqladmin.Operation, error) {
+	op, err := service.Users.Delete(ins.ProjectID, ins.Name).Host(gsqlUserHost).Name(name).Context(ctx).Do()
+	if err != nil {
+		if isGoogleAPINotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("can not delete user %s - %s", name, err)
+	}
+	return op, nil
+}
+
+// WithIAMUsers returns an executor which creates and deletes the iam users of requests through the admin api,
+// the requests are run by next which grants the users privileges on the database
+func (ins *Gsql) WithIAMUsers(next database.Executor) database.Executor {
+	return &gsqlIAMExecutor{ins: ins, next: next}
+}
+
+type gsqlIAMExecutor struct {
+	ins  *Gsql
+	next database.Executor
+}
+
+// Execute implements database.Executor, the iam user is created before and deleted after the request of next
+func (e *gsqlIAMExecutor) Execute(req database.Request) database.Result {
+	db, err := req.Database()
+	if err != nil {
+		return database.ErrorResult(err)
+	}
+	cred := db.GetCredentials()
+	if cred.IAMPrincipal == "" || (req.Operation != database.OpCreate && req.Operation != database.OpDelete) {
+		return e.next.Execute(req)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sqladminService, err := e.ins.getSqladminService(ctx)
+	if err != nil {
+		return database.ErrorResult(err)
+	}
+
+	// postgres users are created with the name they have on the server, mysql users with the email of the service account
+	name := cred.Username
+	if req.Mysql != nil {
+		name = cred.IAMPrincipal
+	}
+
+	// next gets the request without the operation of the admin api, it's repeated until it's done
+	sql := gsqlStep{name: "sql", run: func() (*sqladmin.Operation, error) {
+		next := req
+		next.BackendOperation = ""
+		return nil, e.next.Execute(next).Err()
+	}}
+	if req.Operation == database.OpDelete {
+		return e.ins.runSteps(ctx, sqladminService, req.BackendOperation, []gsqlStep{
+			sql,
+			{name: "iamUser", run: func() (*sqladmin.Operation, error) { return e.ins.deleteUser(ctx, sqladminService, name) }},
+		})
+	}
+	return e.ins.runSteps(ctx, sqladminService, req.BackendOperation, []gsqlStep{
+		{name: "iamUser", run: func() (*sqladmin.Operation, error) { return e.ins.createIAMUser(ctx, sqladminService, name) }},
+		sql,
+	})
+}
+
+func (ins *Gsql) createIAMUser(ctx context.Context, service *sqladmin.Service, name string) (*sqladmin.Operation, error) {
+	existing, err := ins.getUser(ctx, service, name)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		if existing.Type != gsqlIAMUser {
+			return nil, fmt.Errorf("user %s exists and is not an iam user", name)
+		}
+		return nil, nil
+	}
+
+	op, err := service.Users.Insert(ins.ProjectID, ins.Name, &sqladmin.User{Name: name, Type: gsqlIAMUser}).Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("can not create iam user %s - %s", name, err)
+	}
+	return op, nil
+}
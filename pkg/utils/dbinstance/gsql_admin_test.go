@@ -0,0 +1,178 @@
+/*
+ * Copyright 2021 kloeckner.i GmbH
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dbinstance
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kloeckner-i/db-operator/pkg/utils/database"
+	"github.com/stretchr/testify/assert"
+	sqladmin "google.golang.org/api/sqladmin/v1beta4"
+)
+
+// executeUntilDone repeats the request with the started operation like the requeued reconciles do
+func executeUntilDone(t *testing.T, executor database.Executor, req database.Request) database.Result {
+	for i := 0; i < 10; i++ {
+		result := executor.Execute(req)
+		if !result.Pending {
+			return result
+		}
+		assert.NotEmpty(t, result.BackendOperation)
+		req.BackendOperation = result.BackendOperation
+	}
+	t.Fatal("request didn't finish")
+	return database.Result{}
+}
+
+func TestGsqlExecute(t *testing.T) {
+	mock := newSqladminMock()
+	mock.finishOnPoll = true
+	server := httptest.NewServer(mock)
+	defer server.Close()
+
+	ins := myMockGsql()
+	ins.Name = "test-instance"
+	ins.APIEndpoint = server.URL + "/"
+
+	db := database.Postgres{Database: "test-db", User: "test-user", Password: "testPassw0rd"}
+	req, err := database.NewRequest(database.OpCheckStatus, db, database.AdminCredentials{})
+	assert.NoError(t, err)
+	assert.Error(t, ins.Execute(req).Err(), "database doesn't exist yet")
+
+	req.Operation = database.OpCreate
+	result := ins.Execute(req)
+	assert.ErrorIs(t, result.Err(), database.ErrRequestInProgress, "the operator doesn't wait for operations")
+	assert.Equal(t, "database/op-1", result.BackendOperation)
+	req.BackendOperation = result.BackendOperation
+	assert.NoError(t, executeUntilDone(t, ins, req).Err())
+	assert.True(t, mock.databases["test-db"])
+	assert.Equal(t, "BUILT_IN", mock.users["test-user"].Type)
+	assert.Equal(t, "testPassw0rd", mock.users["test-user"].Password)
+	req.BackendOperation = ""
+
+	// existing objects aren't taken over without proof of ownership
+	assert.Error(t, ins.Execute(req).Err())
+
+	// the password of an existing user is updated
+	req.Owned = true
+	req.Postgres.Password = "newPassw0rd"
+	assert.NoError(t, executeUntilDone(t, ins, req).Err())
+	assert.Equal(t, "newPassw0rd", mock.users["test-user"].Password)
+
+	req.Operation = database.OpCheckStatus
+	assert.NoError(t, ins.Execute(req).Err())
+
+	req.Operation = database.OpIsPrimary
+	assert.True(t, ins.Execute(req).Primary)
+
+	req.Operation = database.OpMask
+	assert.Error(t, ins.Execute(req).Err(), "masking needs sql statements")
+
+	req.Operation = database.OpCreate
+	req.Postgres.Extensions = []string{"pgcrypto"}
+	assert.Error(t, ins.Execute(req).Err(), "extensions need sql statements")
+	req.Postgres.Extensions = nil
+
+	req.Operation = database.OpDelete
+	req.Owned = false
+	assert.Error(t, ins.Execute(req).Err(), "objects of someone else are never deleted")
+	assert.True(t, mock.databases["test-db"])
+
+	req.Owned = true
+	assert.NoError(t, executeUntilDone(t, ins, req).Err())
+	assert.Empty(t, mock.databases)
+	assert.Empty(t, mock.users)
+	assert.NoError(t, ins.Execute(req).Err(), "deleted objects are ignored")
+}
+
+func TestGsqlRunSteps(t *testing.T) {
+	mock := newSqladminMock()
+	server := httptest.NewServer(mock)
+	defer server.Close()
+
+	ins := myMockGsql()
+	ins.Name = "test-instance"
+	ins.APIEndpoint = server.URL + "/"
+	ctx := context.Background()
+	service, err := ins.getSqladminService(ctx)
+	assert.NoError(t, err)
+
+	runs := []string{}
+	steps := []gsqlStep{
+		{name: "first", run: func() (*sqladmin.Operation, error) {
+			runs = append(runs, "first")
+			return &sqladmin.Operation{Name: "op-first", Status: "DONE"}, nil
+		}},
+		{name: "second", run: func() (*sqladmin.Operation, error) {
+			runs = append(runs, "second")
+			return nil, errors.New("second failed")
+		}},
+	}
+	result := ins.runSteps(ctx, service, "", steps)
+	assert.EqualError(t, result.Err(), "second failed")
+	assert.Equal(t, "first/", result.BackendOperation, "finished steps aren't repeated")
+
+	result = ins.runSteps(ctx, service, result.BackendOperation, steps)
+	assert.Error(t, result.Err())
+	assert.Equal(t, []string{"first", "second", "second"}, runs)
+}
+
+type recordingExecutor struct {
+	operations []string
+}
+
+func (e *recordingExecutor) Execute(req database.Request) database.Result {
+	e.operations = append(e.operations, req.Operation)
+	return database.Result{}
+}
+
+func TestGsqlIAMUsers(t *testing.T) {
+	mock := newSqladminMock()
+	mock.finishOnPoll = true
+	server := httptest.NewServer(mock)
+	defer server.Close()
+
+	ins := myMockGsql()
+	ins.Name = "test-instance"
+	ins.APIEndpoint = server.URL + "/"
+	sql := &recordingExecutor{}
+	executor := ins.WithIAMUsers(sql)
+
+	db := database.Mysql{Database: "test-db", User: "app-user", IAMPrincipal: "app-user@my-project.iam.gserviceaccount.com"}
+	req, err := database.NewRequest(database.OpCreate, db, database.AdminCredentials{})
+	assert.NoError(t, err)
+	assert.NoError(t, executeUntilDone(t, executor, req).Err())
+	assert.Equal(t, "CLOUD_IAM_SERVICE_ACCOUNT", mock.users["app-user@my-project.iam.gserviceaccount.com"].Type)
+	assert.Equal(t, []string{database.OpCreate}, sql.operations, "privileges are granted with sql once the user exists")
+
+	req.Operation = database.OpDelete
+	assert.NoError(t, executeUntilDone(t, executor, req).Err())
+	assert.Empty(t, mock.users)
+
+	mock.users["app-user@my-project.iam"] = &sqladmin.User{Name: "app-user@my-project.iam", Type: "BUILT_IN"}
+	req, err = database.NewRequest(database.OpCreate, database.Postgres{Database: "test-db", User: "app-user@my-project.iam", IAMPrincipal: "app-user@my-project.iam.gserviceaccount.com"}, database.AdminCredentials{})
+	assert.NoError(t, err)
+	assert.Error(t, executor.Execute(req).Err(), "password users aren't turned into iam users")
+
+	req.Postgres.IAMPrincipal = ""
+	req.Operation = database.OpCheckStatus
+	assert.NoError(t, executor.Execute(req).Err())
+	assert.Equal(t, []string{database.OpCreate, database.OpDelete, database.OpCheckStatus}, sql.operations)
+}
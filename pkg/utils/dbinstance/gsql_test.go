@@ -1,30 +1,35 @@
 package dbinstance
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
 	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
-	"bou.ke/monkey"
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+	sqladmin "google.golang.org/api/sqladmin/v1beta4"
 )
 
-func (ins *Gsql) mockWaitUntilRunnable() error {
-	logrus.Debugf("waiting gsql instance %s", ins.Name)
-
-	time.Sleep(10 * time.Second)
-
-	state, err := ins.state()
-	if err != nil {
-		return err
+// waitForOperation polls the pending operation of the instance like the requeued reconciles do
+func waitForOperation(ins *Gsql, err error) error {
+	for i := 0; i < 10 && errors.Is(err, ErrOperationInProgress); i++ {
+		time.Sleep(time.Second)
+		err = ins.checkOperation()
 	}
-	if state != "RUNNABLE" {
-		return errors.New("gsql instance not ready yet")
-	}
-
-	return nil
+	return err
 }
 
 func mockGsqlConfig() string {
@@ -82,17 +87,14 @@ func TestGsqlCreateInvalidInstance(t *testing.T) {
 func TestGsqlCreateInstance(t *testing.T) {
 	myGsql := myMockGsql()
 
-	patchWait := monkey.Patch((*Gsql).waitUntilRunnable, (*Gsql).mockWaitUntilRunnable)
-	defer patchWait.Unpatch()
-
-	err := myGsql.createInstance()
+	err := waitForOperation(myGsql, myGsql.createInstance())
 	assert.NoError(t, err)
 }
 
 func TestGsqlGetInstanceExist(t *testing.T) {
 	myGsql := myMockGsql()
 
-	err := myGsql.createInstance()
+	err := waitForOperation(myGsql, myGsql.createInstance())
 	assert.NoError(t, err)
 
 	rs, err := myGsql.getInstance()
@@ -103,32 +105,648 @@ func TestGsqlGetInstanceExist(t *testing.T) {
 func TestGsqlCreateExistingInstance(t *testing.T) {
 	myGsql := myMockGsql()
 
-	err := myGsql.createInstance()
+	err := waitForOperation(myGsql, myGsql.createInstance())
 	assert.NoError(t, err)
 
-	err = myGsql.createInstance()
+	err = waitForOperation(myGsql, myGsql.createInstance())
 	assert.Error(t, err)
 }
 
 func TestGsqlUpdateInstance(t *testing.T) {
 	myGsql := myMockGsql()
 
-	err := myGsql.createInstance()
+	err := waitForOperation(myGsql, myGsql.createInstance())
 	assert.NoError(t, err)
 
-	patchWait := monkey.Patch((*Gsql).waitUntilRunnable, (*Gsql).mockWaitUntilRunnable)
-	defer patchWait.Unpatch()
-
-	err = myGsql.updateInstance()
+	err = waitForOperation(myGsql, myGsql.updateInstance())
 	assert.NoError(t, err)
 }
 
 func TestGsqlUpdateUser(t *testing.T) {
 	myGsql := myMockGsql()
 
-	err := myGsql.createInstance()
+	err := waitForOperation(myGsql, myGsql.createInstance())
+	assert.NoError(t, err)
+
+	err = waitForOperation(myGsql, myGsql.updateUser())
 	assert.NoError(t, err)
+}
+
+// sqladminMock serves the cloud sql admin api for a single instance,
+// operations stay pending until they are finished by the test
+type sqladminMock struct {
+	mu         sync.Mutex
+	state      string
+	operations map[string]*sqladmin.Operation
+	patches    int
+	// finishOnPoll finishes operations when they are polled the first time
+	finishOnPoll bool
+	databases    map[string]bool
+	users        map[string]*sqladmin.User
+	exports      []string
+	// master is the master of the instance if it's a read replica
+	master string
+	// clones are the clone requests by source instance
+	clones     map[string]*sqladmin.CloneContext
+	backupRuns []*sqladmin.BackupRun
+	restored   *sqladmin.RestoreBackupContext
+	// sslCerts are the client certificates by fingerprint
+	sslCerts map[string]*sqladmin.SslCert
+	issued   int
+}
+
+func (m *sqladminMock) startOperation(w http.ResponseWriter, opType string) {
+	op := &sqladmin.Operation{
+		Name:          fmt.Sprintf("op-%d", len(m.operations)+1),
+		OperationType: opType,
+		Status:        "PENDING",
+	}
+	m.operations[op.Name] = op
+	json.NewEncoder(w).Encode(op)
+}
+
+func (m *sqladminMock) finishOperations() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, op := range m.operations {
+		op.Status = "DONE"
+	}
+	if m.state != "" {
+		m.state = "RUNNABLE"
+	}
+}
+
+func (m *sqladminMock) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	const instancePath = "/sql/v1beta4/projects/test-project/instances"
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/sql/v1beta4/projects/test-project/operations/"):
+		op, ok := m.operations[strings.TrimPrefix(r.URL.Path, "/sql/v1beta4/projects/test-project/operations/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if m.finishOnPoll {
+			op.Status = "DONE"
+		}
+		json.NewEncoder(w).Encode(op)
+	case strings.HasPrefix(r.URL.Path, instancePath+"/test-instance/databases"):
+		m.serveDatabases(w, r, strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, instancePath+"/test-instance/databases"), "/"))
+	case r.URL.Path == instancePath+"/test-instance/users":
+		m.serveUsers(w, r)
+	case r.URL.Path == instancePath+"/test-instance/export" && r.Method == http.MethodPost:
+		req := &sqladmin.InstancesExportRequest{}
+		json.NewDecoder(r.Body).Decode(req)
+		m.exports = append(m.exports, req.ExportContext.Uri)
+		op := &sqladmin.Operation{
+			Name:          fmt.Sprintf("op-%d", len(m.operations)+1),
+			OperationType: "EXPORT",
+			Status:        "PENDING",
+			ExportContext: req.ExportContext,
+		}
+		m.operations[op.Name] = op
+		json.NewEncoder(w).Encode(op)
+	case r.URL.Path == instancePath+"/test-instance" && r.Method == http.MethodDelete:
+		m.state = ""
+		m.startOperation(w, "DELETE")
+	case r.URL.Path == instancePath && r.Method == http.MethodPost:
+		instance := &sqladmin.DatabaseInstance{}
+		json.NewDecoder(r.Body).Decode(instance)
+		m.master = instance.MasterInstanceName
+		m.state = "PENDING_CREATE"
+		m.startOperation(w, "CREATE")
+	case strings.HasPrefix(r.URL.Path, instancePath+"/") && strings.HasSuffix(r.URL.Path, "/clone") && r.Method == http.MethodPost:
+		req := &sqladmin.InstancesCloneRequest{}
+		json.NewDecoder(r.Body).Decode(req)
+		m.clones[strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, instancePath+"/"), "/clone")] = req.CloneContext
+		m.state = "PENDING_CREATE"
+		m.startOperation(w, "CLONE")
+	case r.URL.Path == instancePath+"/test-instance/backupRuns" && r.Method == http.MethodGet:
+		json.NewEncoder(w).Encode(&sqladmin.BackupRunsListResponse{Items: m.backupRuns})
+	case r.URL.Path == instancePath+"/test-instance/backupRuns" && r.Method == http.MethodPost:
+		run := &sqladmin.BackupRun{
+			Id:           int64(len(m.backupRuns) + 1),
+			Type:         "ON_DEMAND",
+			Status:       "RUNNING",
+			EnqueuedTime: "2022-06-01T10:00:00Z",
+		}
+		m.backupRuns = append([]*sqladmin.BackupRun{run}, m.backupRuns...)
+		m.startOperation(w, "BACKUP_VOLUME")
+	case r.URL.Path == instancePath+"/test-instance/restoreBackup" && r.Method == http.MethodPost:
+		req := &sqladmin.InstancesRestoreBackupRequest{}
+		json.NewDecoder(r.Body).Decode(req)
+		m.restored = req.RestoreBackupContext
+		m.startOperation(w, "RESTORE_VOLUME")
+	case strings.HasPrefix(r.URL.Path, instancePath+"/test-instance/sslCerts"):
+		m.serveSslCerts(w, r, strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, instancePath+"/test-instance/sslCerts"), "/"))
+	case r.URL.Path == instancePath+"/test-instance/promoteReplica" && r.Method == http.MethodPost:
+		m.master = ""
+		m.startOperation(w, "PROMOTE_REPLICA")
+	case r.URL.Path == instancePath+"/test-instance" && r.Method == http.MethodPatch:
+		m.patches++
+		m.startOperation(w, "UPDATE")
+	case r.URL.Path == instancePath+"/test-instance" && r.Method == http.MethodGet:
+		if m.state == "" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		instanceType := "CLOUD_SQL_INSTANCE"
+		if m.master != "" {
+			instanceType = "READ_REPLICA_INSTANCE"
+		}
+		json.NewEncoder(w).Encode(&sqladmin.DatabaseInstance{
+			Name:               "test-instance",
+			ConnectionName:     "test-project:somewhere:test-instance",
+			DatabaseVersion:    "POSTGRES_12",
+			State:              m.state,
+			InstanceType:       instanceType,
+			MasterInstanceName: m.master,
+		})
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func (m *sqladminMock) serveDatabases(w http.ResponseWriter, r *http.Request, name string) {
+	switch r.Method {
+	case http.MethodGet:
+		if name == "" {
+			databases := &sqladmin.DatabasesListResponse{}
+			for db := range m.databases {
+				databases.Items = append(databases.Items, &sqladmin.Database{Name: db})
+			}
+			json.NewEncoder(w).Encode(databases)
+			return
+		}
+		if !m.databases[name] {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(&sqladmin.Database{Name: name})
+	case http.MethodPost:
+		db := &sqladmin.Database{}
+		json.NewDecoder(r.Body).Decode(db)
+		m.databases[db.Name] = true
+		m.startOperation(w, "CREATE_DATABASE")
+	case http.MethodDelete:
+		if !m.databases[name] {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(m.databases, name)
+		m.startOperation(w, "DELETE_DATABASE")
+	}
+}
+
+func (m *sqladminMock) serveUsers(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		users := &sqladmin.UsersListResponse{}
+		for _, user := range m.users {
+			users.Items = append(users.Items, user)
+		}
+		json.NewEncoder(w).Encode(users)
+	case http.MethodPost:
+		user := &sqladmin.User{}
+		json.NewDecoder(r.Body).Decode(user)
+		m.users[user.Name] = user
+		m.startOperation(w, "CREATE_USER")
+	case http.MethodPut:
+		user := &sqladmin.User{}
+		json.NewDecoder(r.Body).Decode(user)
+		if user.Name != "" {
+			m.users[user.Name] = user
+		}
+		m.startOperation(w, "UPDATE_USER")
+	case http.MethodDelete:
+		name := r.URL.Query().Get("name")
+		if _, ok := m.users[name]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(m.users, name)
+		m.startOperation(w, "DELETE_USER")
+	}
+}
+
+func (m *sqladminMock) serveSslCerts(w http.ResponseWriter, r *http.Request, fingerprint string) {
+	switch r.Method {
+	case http.MethodGet:
+		certs := &sqladmin.SslCertsListResponse{}
+		for _, cert := range m.sslCerts {
+			certs.Items = append(certs.Items, cert)
+		}
+		json.NewEncoder(w).Encode(certs)
+	case http.MethodPost:
+		req := &sqladmin.SslCertsInsertRequest{}
+		json.NewDecoder(r.Body).Decode(req)
+		m.issued++
+		cert := &sqladmin.SslCert{
+			CommonName:      req.CommonName,
+			Cert:            fmt.Sprintf("cert-%d", m.issued),
+			Sha1Fingerprint: fmt.Sprintf("fp-%d", m.issued),
+			ExpirationTime:  time.Now().AddDate(10, 0, 0).Format(time.RFC3339),
+		}
+		m.sslCerts[cert.Sha1Fingerprint] = cert
+		json.NewEncoder(w).Encode(&sqladmin.SslCertsInsertResponse{
+			ClientCert:   &sqladmin.SslCertDetail{CertInfo: cert, CertPrivateKey: fmt.Sprintf("key-%d", m.issued)},
+			ServerCaCert: &sqladmin.SslCert{Cert: "server-ca"},
+			Operation:    &sqladmin.Operation{Name: "ssl-op", Status: "DONE"},
+		})
+	case http.MethodDelete:
+		if _, ok := m.sslCerts[fingerprint]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(m.sslCerts, fingerprint)
+		json.NewEncoder(w).Encode(&sqladmin.Operation{Name: "ssl-op", Status: "DONE"})
+	}
+}
+
+func newSqladminMock() *sqladminMock {
+	return &sqladminMock{
+		operations: map[string]*sqladmin.Operation{},
+		databases:  map[string]bool{},
+		users:      map[string]*sqladmin.User{},
+		clones:     map[string]*sqladmin.CloneContext{},
+		sslCerts:   map[string]*sqladmin.SslCert{},
+	}
+}
+
+func TestGsqlOperationTracking(t *testing.T) {
+	mock := newSqladminMock()
+	server := httptest.NewServer(mock)
+	defer server.Close()
 
-	err = myGsql.updateUser()
+	// every reconcile builds a new instance with the operation stored in the status
+	newGsql := func(operation string) *Gsql {
+		ins := myMockGsql()
+		ins.Name = "test-instance"
+		ins.APIEndpoint = server.URL + "/"
+		ins.Operation = operation
+		return ins
+	}
+
+	ins := newGsql("")
+	_, err := Create(ins)
+	assert.ErrorIs(t, err, ErrOperationInProgress)
+	assert.Equal(t, "op-1", ins.Operation)
+
+	ins = newGsql("op-1")
+	_, err = Create(ins)
+	assert.ErrorIs(t, err, ErrOperationInProgress, "instance is still being created")
+	assert.Equal(t, "op-1", ins.Operation)
+
+	// the instance is created, the user is updated next
+	mock.finishOperations()
+	ins = newGsql("op-1")
+	_, err = Create(ins)
+	assert.ErrorIs(t, err, ErrAlreadyExists)
+	_, err = Update(ins)
+	assert.ErrorIs(t, err, ErrOperationInProgress)
+	assert.Equal(t, "op-2", ins.Operation)
+	assert.Equal(t, 0, mock.patches, "created instance doesn't need to be patched")
+
+	mock.finishOperations()
+	ins = newGsql("op-2")
+	_, err = Create(ins)
+	assert.ErrorIs(t, err, ErrAlreadyExists)
+	info, err := Update(ins)
 	assert.NoError(t, err)
+	assert.Equal(t, "test-project:somewhere:test-instance", info["DB_CONN"])
+	assert.Empty(t, ins.Operation)
+
+	// updating the instance patches it first
+	ins = newGsql("")
+	_, err = Update(ins)
+	assert.ErrorIs(t, err, ErrOperationInProgress)
+	assert.Equal(t, "op-3", ins.Operation)
+	assert.Equal(t, 1, mock.patches)
+
+	mock.operations["op-3"].Status = "DONE"
+	mock.operations["op-3"].Error = &sqladmin.OperationErrors{
+		Errors: []*sqladmin.OperationError{{Code: "INVALID_REQUEST", Message: "invalid tier"}},
+	}
+	_, err = Update(newGsql("op-3"))
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrOperationInProgress)
+}
+
+func TestGsqlDelete(t *testing.T) {
+	mock := newSqladminMock()
+	mock.state = "RUNNABLE"
+	mock.databases = map[string]bool{"postgres": true, "app": true, "billing": true}
+	server := httptest.NewServer(mock)
+	defer server.Close()
+
+	newGsql := func(operation string) *Gsql {
+		ins := myMockGsql()
+		ins.Name = "test-instance"
+		ins.APIEndpoint = server.URL + "/"
+		ins.Operation = operation
+		ins.FinalBackupBucket = "final-backups"
+		return ins
+	}
+
+	// the databases are exported one by one before the instance is deleted
+	ins := newGsql("")
+	assert.ErrorIs(t, Delete(ins), ErrOperationInProgress)
+	assert.Equal(t, []string{"gs://final-backups/test-instance/app.sql.gz"}, mock.exports)
+
+	assert.ErrorIs(t, Delete(newGsql(ins.Operation)), ErrOperationInProgress, "export is still running")
+	assert.Len(t, mock.exports, 1)
+
+	mock.finishOperations()
+	ins = newGsql(ins.Operation)
+	assert.ErrorIs(t, Delete(ins), ErrOperationInProgress)
+	assert.Equal(t, "gs://final-backups/test-instance/billing.sql.gz", mock.exports[1])
+
+	mock.finishOperations()
+	ins = newGsql(ins.Operation)
+	assert.ErrorIs(t, Delete(ins), ErrOperationInProgress)
+	assert.Len(t, mock.exports, 2)
+	assert.Empty(t, mock.state, "instance is deleted after the final backup")
+
+	mock.finishOperations()
+	assert.NoError(t, Delete(newGsql(ins.Operation)))
+	assert.NoError(t, Delete(newGsql("")), "deleted instance doesn't exist anymore")
+}
+
+func TestGsqlDeleteFailedFinalBackup(t *testing.T) {
+	mock := newSqladminMock()
+	mock.state = "RUNNABLE"
+	mock.databases = map[string]bool{"postgres": true, "app": true}
+	server := httptest.NewServer(mock)
+	defer server.Close()
+
+	ins := myMockGsql()
+	ins.Name = "test-instance"
+	ins.APIEndpoint = server.URL + "/"
+	ins.FinalBackupBucket = "final-backups"
+	assert.ErrorIs(t, Delete(ins), ErrOperationInProgress)
+
+	mock.finishOperations()
+	mock.operations[ins.Operation].Error = &sqladmin.OperationErrors{Errors: []*sqladmin.OperationError{{Code: "ERROR_RDBMS", Message: "bucket not writable"}}}
+	err := Delete(ins)
+	assert.ErrorIs(t, err, ErrFinalBackupFailed)
+	assert.Contains(t, err.Error(), "bucket not writable")
+	assert.Equal(t, "RUNNABLE", mock.state, "instance is kept without final backup")
+}
+
+func TestGsqlReplica(t *testing.T) {
+	mock := newSqladminMock()
+	server := httptest.NewServer(mock)
+	defer server.Close()
+
+	newGsql := func(operation string) *Gsql {
+		ins := myMockGsql()
+		ins.Name = "test-instance"
+		ins.APIEndpoint = server.URL + "/"
+		ins.Operation = operation
+		ins.MasterInstanceName = "master-instance"
+		return ins
+	}
+
+	ins := newGsql("")
+	_, err := Create(ins)
+	assert.ErrorIs(t, err, ErrOperationInProgress)
+	assert.Equal(t, "master-instance", mock.master)
+
+	// users of the replica are replicated from the master
+	mock.finishOperations()
+	ins = newGsql(ins.Operation)
+	_, err = Create(ins)
+	assert.ErrorIs(t, err, ErrAlreadyExists)
+	_, err = Update(ins)
+	assert.NoError(t, err)
+	assert.Empty(t, mock.users)
+
+	ins = newGsql("")
+	assert.ErrorIs(t, Promote(ins), ErrOperationInProgress)
+	assert.Empty(t, mock.master)
+
+	mock.finishOperations()
+	assert.NoError(t, Promote(newGsql(ins.Operation)))
+	assert.NoError(t, Promote(newGsql("")), "promoted instance isn't a replica anymore")
+	assert.Len(t, mock.operations, 2)
+}
+
+func TestGsqlClone(t *testing.T) {
+	mock := newSqladminMock()
+	server := httptest.NewServer(mock)
+	defer server.Close()
+
+	newGsql := func(operation string) *Gsql {
+		ins := myMockGsql()
+		ins.Name = "test-instance"
+		ins.APIEndpoint = server.URL + "/"
+		ins.Operation = operation
+		ins.Config = ""
+		ins.CloneSource = "source-instance"
+		ins.ClonePointInTime = "2022-05-01T10:00:00Z"
+		return ins
+	}
+
+	ins := newGsql("")
+	_, err := Create(ins)
+	assert.ErrorIs(t, err, ErrOperationInProgress)
+	assert.Equal(t, &sqladmin.CloneContext{DestinationInstanceName: "test-instance", PointInTime: "2022-05-01T10:00:00Z"}, mock.clones["source-instance"])
+
+	// the clone keeps the settings of its source
+	mock.finishOperations()
+	ins = newGsql(ins.Operation)
+	_, err = Create(ins)
+	assert.ErrorIs(t, err, ErrAlreadyExists)
+	_, err = Update(ins)
+	assert.ErrorIs(t, err, ErrOperationInProgress, "user is updated")
+	assert.Equal(t, 0, mock.patches)
+
+	assert.ErrorIs(t, Promote(newGsql(ins.Operation)), ErrOperationInProgress, "user update is still running")
+	mock.finishOperations()
+	assert.NoError(t, Promote(newGsql(ins.Operation)), "clone isn't a replica")
+}
+
+func TestGsqlBackupRuns(t *testing.T) {
+	mock := newSqladminMock()
+	mock.state = "RUNNABLE"
+	mock.backupRuns = []*sqladmin.BackupRun{{Id: 100, Type: "AUTOMATED", Status: "SUCCESSFUL", EnqueuedTime: "2022-05-31T03:00:00Z"}}
+	server := httptest.NewServer(mock)
+	defer server.Close()
+
+	newGsql := func(operation string) *Gsql {
+		ins := myMockGsql()
+		ins.Name = "test-instance"
+		ins.APIEndpoint = server.URL + "/"
+		ins.Operation = operation
+		return ins
+	}
+
+	ins := newGsql("")
+	assert.ErrorIs(t, Backup(ins), ErrOperationInProgress)
+	runs, err := BackupRuns(ins)
+	assert.NoError(t, err)
+	assert.Equal(t, []BackupRun{
+		{ID: 2, Type: "ON_DEMAND", Status: "RUNNING", EnqueuedTime: "2022-06-01T10:00:00Z"},
+		{ID: 100, Type: "AUTOMATED", Status: "SUCCESSFUL", EnqueuedTime: "2022-05-31T03:00:00Z"},
+	}, runs, "newest run is listed first")
+
+	assert.Empty(t, ins.Operation, "backup isn't an operation changing the instance")
+	assert.NotEmpty(t, ins.BackupOperation)
+
+	polled := newGsql("")
+	polled.BackupOperation = ins.BackupOperation
+	assert.ErrorIs(t, Backup(polled), ErrOperationInProgress, "backup is still running")
+	mock.finishOperations()
+	assert.NoError(t, Backup(polled))
+	assert.Empty(t, polled.BackupOperation)
+	assert.Empty(t, polled.finished, "finished backup doesn't skip steps of an update")
+	assert.Len(t, mock.backupRuns, 2, "finished backup isn't started again")
+}
+
+func TestGsqlRestore(t *testing.T) {
+	mock := newSqladminMock()
+	mock.state = "RUNNABLE"
+	server := httptest.NewServer(mock)
+	defer server.Close()
+
+	newGsql := func(operation string) *Gsql {
+		ins := myMockGsql()
+		ins.Name = "test-instance"
+		ins.APIEndpoint = server.URL + "/"
+		ins.Operation = operation
+		ins.RestoreSource = "source-instance"
+		ins.RestoreBackupRunID = 1654077600000
+		return ins
+	}
+
+	ins := newGsql("")
+	assert.ErrorIs(t, Restore(ins), ErrOperationInProgress)
+	assert.Equal(t, &sqladmin.RestoreBackupContext{BackupRunId: 1654077600000, InstanceId: "source-instance", Project: "test-project"}, mock.restored)
+
+	mock.finishOperations()
+	ins = newGsql(ins.Operation)
+	assert.NoError(t, Restore(ins))
+	// the users are updated after the restore without patching the instance
+	_, err := Update(ins)
+	assert.ErrorIs(t, err, ErrOperationInProgress)
+	assert.Equal(t, 0, mock.patches)
+	assert.Equal(t, "UPDATE_USER", mock.operations[ins.Operation].OperationType)
+}
+
+func TestGsqlClientCert(t *testing.T) {
+	mock := newSqladminMock()
+	mock.sslCerts["other"] = &sqladmin.SslCert{CommonName: "app", Sha1Fingerprint: "other"}
+	server := httptest.NewServer(mock)
+	defer server.Close()
+
+	ins := myMockGsql()
+	ins.Name = "test-instance"
+	ins.APIEndpoint = server.URL + "/"
+
+	cert, err := IssueClientCert(ins, "db-operator-test", "")
+	assert.NoError(t, err)
+	assert.Equal(t, &ClientCert{Cert: "cert-1", Key: "key-1", CA: "server-ca", Fingerprint: "fp-1"}, cert)
+
+	cert, err = IssueClientCert(ins, "db-operator-test", "fp-1")
+	assert.NoError(t, err)
+	assert.Nil(t, cert, "issued certificate is still valid")
+
+	// the certificate is replaced when its key is lost or it's about to expire
+	cert, err = IssueClientCert(ins, "db-operator-test", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "fp-2", cert.Fingerprint)
+	mock.sslCerts["fp-2"].ExpirationTime = time.Now().Add(24 * time.Hour).Format(time.RFC3339)
+	cert, err = IssueClientCert(ins, "db-operator-test", "fp-2")
+	assert.NoError(t, err)
+	assert.Equal(t, "fp-3", cert.Fingerprint)
+	assert.Len(t, mock.sslCerts, 2, "replaced certificates are revoked, others are kept")
+	assert.Contains(t, mock.sslCerts, "other")
+}
+
+func TestGsqlClientCertDue(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	now := time.Now()
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), NotBefore: now, NotAfter: now.Add(365 * 24 * time.Hour)}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+
+	assert.False(t, GsqlClientCertDue(cert, now))
+	assert.True(t, GsqlClientCertDue(cert, now.Add(340*24*time.Hour)), "certificate is about to expire")
+	assert.True(t, GsqlClientCertDue([]byte("cert-1"), now), "certificate can't be read")
+	assert.True(t, GsqlClientCertDue(nil, now))
+}
+
+func TestGsqlVerifyConfigSettings(t *testing.T) {
+	myGsql := myMockGsql()
+	myGsql.Settings = &sqladmin.DatabaseInstance{
+		Settings: &sqladmin.Settings{
+			Tier: "db-custom-1-3840",
+			BackupConfiguration: &sqladmin.BackupConfiguration{
+				Enabled:         true,
+				StartTime:       "03:00",
+				ForceSendFields: []string{"Enabled"},
+			},
+		},
+	}
+
+	request, err := myGsql.verifyConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, myGsql.Name, request.Name)
+	assert.Equal(t, "POSTGRES_12", request.DatabaseVersion, "fields of the config are kept")
+	assert.Equal(t, "ZONAL", request.Settings.AvailabilityType)
+	assert.Equal(t, "db-custom-1-3840", request.Settings.Tier, "settings take precedence")
+	assert.True(t, request.Settings.BackupConfiguration.Enabled)
+	assert.Equal(t, "03:00", request.Settings.BackupConfiguration.StartTime)
+
+	myGsql.Config = ""
+	request, err = myGsql.verifyConfig()
+	assert.NoError(t, err, "config is optional with settings")
+	assert.Empty(t, request.DatabaseVersion)
+}
+
+func TestIsConfigApplied(t *testing.T) {
+	config := &sqladmin.DatabaseInstance{
+		Name: "test-instance",
+		Settings: &sqladmin.Settings{
+			Tier: "db-f1-micro",
+			DatabaseFlags: []*sqladmin.DatabaseFlags{
+				{Name: "max_connections", Value: "100"},
+				{Name: "log_min_duration_statement", Value: "1000"},
+			},
+		},
+	}
+	instance := &sqladmin.DatabaseInstance{
+		Name:  "test-instance",
+		State: "RUNNABLE",
+		Settings: &sqladmin.Settings{
+			Tier:            "db-f1-micro",
+			SettingsVersion: 3,
+			DatabaseFlags: []*sqladmin.DatabaseFlags{
+				{Name: "log_min_duration_statement", Value: "1000"},
+				{Name: "max_connections", Value: "100"},
+			},
+		},
+	}
+
+	applied, err := isConfigApplied(config, instance)
+	assert.NoError(t, err)
+	assert.True(t, applied, "order of the flags doesn't matter")
+
+	config.Settings.Tier = "db-g1-small"
+	applied, _ = isConfigApplied(config, instance)
+	assert.False(t, applied)
+
+	config.Settings.Tier = "db-f1-micro"
+	config.Settings.DatabaseFlags = config.Settings.DatabaseFlags[:1]
+	applied, _ = isConfigApplied(config, instance)
+	assert.False(t, applied, "removed flags are patched")
+
+	config.Settings.DatabaseFlags = instance.Settings.DatabaseFlags
+	config.Settings.BackupConfiguration = &sqladmin.BackupConfiguration{ForceSendFields: []string{"Enabled"}}
+	applied, _ = isConfigApplied(config, instance)
+	assert.True(t, applied, "fields omitted by the api are zero values")
 }
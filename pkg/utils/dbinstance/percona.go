@@ -0,0 +1,112 @@
+/*
+ * Copyright 2021 kloeckner.i GmbH
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dbinstance
+
+import (
+	"errors"
+
+	kcidb "github.com/kloeckner-i/db-operator/pkg/utils/database"
+	"github.com/sirupsen/logrus"
+)
+
+// PerconaServer is a server of a percona cluster
+type PerconaServer struct {
+	Host     string
+	Port     uint16
+	ReadOnly bool
+}
+
+// PerconaCluster represents a cluster of mysql servers,
+// databases and users are managed through the first writable server
+type PerconaCluster struct {
+	Servers      []PerconaServer
+	User         string
+	Password     string
+	SSLEnabled   bool
+	SkipCAVerify bool
+	// SSLCerts are the CA bundle and the client certificate of ssl connections
+	SSLCerts *kcidb.SSLCerts
+	// Executor runs the checks against the servers, they are run in the operator if it's nil
+	Executor kcidb.Executor
+}
+
+func (pc *PerconaCluster) server(server PerconaServer) *Generic {
+	return &Generic{
+		Host:         server.Host,
+		Port:         server.Port,
+		Engine:       "mysql",
+		User:         pc.User,
+		Password:     pc.Password,
+		SSLEnabled:   pc.SSLEnabled,
+		SkipCAVerify: pc.SkipCAVerify,
+		SSLCerts:     pc.SSLCerts,
+		Executor:     pc.Executor,
+	}
+}
+
+func (pc *PerconaCluster) writableServer() (*Generic, error) {
+	for _, server := range pc.Servers {
+		if !server.ReadOnly {
+			return pc.server(server), nil
+		}
+	}
+	return nil, errors.New("percona cluster has no writable server")
+}
+
+func (pc *PerconaCluster) state() (string, error) {
+	logrus.Debug("percona cluster not support a state check")
+	return "NOT_SUPPORTED", nil
+}
+
+// exist checks the writable server, unreachable read-only servers are only reported
+// because the proxy stops sending queries to them
+func (pc *PerconaCluster) exist() error {
+	writable, err := pc.writableServer()
+	if err != nil {
+		return err
+	}
+	if err := writable.exist(); err != nil {
+		return err
+	}
+
+	for _, server := range pc.Servers {
+		if !server.ReadOnly {
+			continue
+		}
+		if err := pc.server(server).exist(); err != nil {
+			logrus.Warnf("percona cluster read-only server %s is not reachable - %s", server.Host, err)
+		}
+	}
+	return nil
+}
+
+func (pc *PerconaCluster) create() error {
+	return errors.New("creating percona cluster is not yet implimented")
+}
+
+func (pc *PerconaCluster) update() error {
+	logrus.Debug("updating percona cluster is not yet implimented")
+	return nil
+}
+
+func (pc *PerconaCluster) getInfoMap() (map[string]string, error) {
+	writable, err := pc.writableServer()
+	if err != nil {
+		return nil, err
+	}
+	return writable.getInfoMap()
+}
@@ -0,0 +1,385 @@
+/*
+ * Copyright 2021 kloeckner.i GmbH
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dbinstance
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kloeckner-i/db-operator/pkg/utils/aws"
+	"github.com/sirupsen/logrus"
+)
+
+const rdsAPIVersion = "2014-10-31"
+
+// rds has no operations of its own, creations and modifications are tracked
+// as pending operations until the instance is available again
+const (
+	rdsOperationCreate         = "rds-create"
+	rdsOperationModify         = "rds-modify"
+	rdsOperationModifyPassword = "rds-modify-password"
+)
+
+// rdsCreateOnlyParameters are accepted by CreateDBInstance but not by ModifyDBInstance
+var rdsCreateOnlyParameters = []string{
+	"AvailabilityZone",
+	"CharacterSetName",
+	"DBClusterIdentifier",
+	"DBName",
+	"Engine",
+	"KmsKeyId",
+	"MasterUsername",
+	"NcharCharacterSetName",
+	"StorageEncrypted",
+	"Tags",
+	"Timezone",
+}
+
+// Rds represents an aws rds db instance
+type Rds struct {
+	Name        string
+	Config      string
+	User        string
+	Password    string
+	Region      string
+	APIEndpoint string
+	IAMAuth     bool
+	// PasswordChanged resets the master password to Password on update,
+	// it's only sent when it differs from the one last applied
+	PasswordChanged bool
+	// Operation is the pending creation or modification of the instance
+	Operation string
+	// finished is the operation which finished during this reconcile
+	finished string
+}
+
+// RdsNew create a new Rds object and return
+func RdsNew(name, config, user, password, region, apiEndpoint string, iamAuth bool) *Rds {
+	return &Rds{
+		Name:        name,
+		Config:      config,
+		User:        user,
+		Password:    password,
+		Region:      region,
+		APIEndpoint: apiEndpoint,
+		IAMAuth:     iamAuth,
+	}
+}
+
+type rdsEndpoint struct {
+	Address string `xml:"Address"`
+	Port    int    `xml:"Port"`
+}
+
+type rdsDBInstance struct {
+	Identifier    string      `xml:"DBInstanceIdentifier"`
+	Status        string      `xml:"DBInstanceStatus"`
+	Engine        string      `xml:"Engine"`
+	EngineVersion string      `xml:"EngineVersion"`
+	Endpoint      rdsEndpoint `xml:"Endpoint"`
+	// PendingModifiedValues holds the modifications which aren't applied yet
+	PendingModifiedValues struct {
+		Values string `xml:",innerxml"`
+	} `xml:"PendingModifiedValues"`
+}
+
+type rdsDescribeResponse struct {
+	Instances []rdsDBInstance `xml:"DescribeDBInstancesResult>DBInstances>DBInstance"`
+}
+
+const rdsNotFoundCode = "DBInstanceNotFound"
+
+// RdsError is an error returned by the rds api
+type RdsError struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+func (e *RdsError) Error() string {
+	return fmt.Sprintf("rds api error %s: %s", e.Code, e.Message)
+}
+
+type rdsErrorResponse struct {
+	Error RdsError `xml:"Error"`
+}
+
+func (ins *Rds) apiURL() string {
+	if ins.APIEndpoint != "" {
+		return strings.TrimSuffix(ins.APIEndpoint, "/") + "/"
+	}
+	return fmt.Sprintf("https://rds.%s.amazonaws.com/", ins.Region)
+}
+
+// call sends a request to the rds query api and decodes the xml response into result
+func (ins *Rds) call(action string, params url.Values, result interface{}) error {
+	creds, err := aws.GetCredentials()
+	if err != nil {
+		return err
+	}
+
+	params.Set("Action", action)
+	params.Set("Version", rdsAPIVersion)
+	body := []byte(params.Encode())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ins.apiURL(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	aws.SignRequest(req, body, creds, ins.Region, "rds", time.Now())
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		errResp := rdsErrorResponse{}
+		if xml.Unmarshal(data, &errResp) == nil && errResp.Error.Code != "" {
+			return &errResp.Error
+		}
+		return fmt.Errorf("rds %s failed with status %d", action, resp.StatusCode)
+	}
+
+	if result == nil {
+		return nil
+	}
+	return xml.Unmarshal(data, result)
+}
+
+func (ins *Rds) getInstance() (*rdsDBInstance, error) {
+	params := url.Values{}
+	params.Set("DBInstanceIdentifier", ins.Name)
+
+	resp := rdsDescribeResponse{}
+	if err := ins.call("DescribeDBInstances", params, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Instances) == 0 {
+		return nil, &RdsError{Code: rdsNotFoundCode, Message: fmt.Sprintf("rds instance %s not found", ins.Name)}
+	}
+	return &resp.Instances[0], nil
+}
+
+// verifyConfig parses the json config into the parameters of the rds api,
+// the values must be scalars, lists are given with the member names of the api, e.g. "VpcSecurityGroupIds.VpcSecurityGroupId.1"
+func (ins *Rds) verifyConfig() (url.Values, error) {
+	config := map[string]interface{}{}
+	decoder := json.NewDecoder(strings.NewReader(ins.Config))
+	decoder.UseNumber()
+	if err := decoder.Decode(&config); err != nil {
+		logrus.Errorf("can not verify config - %s", err)
+		return nil, err
+	}
+
+	params := url.Values{}
+	for name, value := range config {
+		switch value := value.(type) {
+		case string:
+			params.Set(name, value)
+		case json.Number:
+			params.Set(name, value.String())
+		case bool:
+			params.Set(name, strconv.FormatBool(value))
+		default:
+			return nil, fmt.Errorf("parameter %s of rds config must be a string, number or boolean", name)
+		}
+	}
+	return params, nil
+}
+
+func (ins *Rds) createInstance() error {
+	logrus.Debugf("rds instance create %s", ins.Name)
+	params, err := ins.verifyConfig()
+	if err != nil {
+		return err
+	}
+
+	params.Set("DBInstanceIdentifier", ins.Name)
+	params.Set("MasterUsername", ins.User)
+	params.Set("MasterUserPassword", ins.Password)
+	if ins.IAMAuth {
+		params.Set("EnableIAMDatabaseAuthentication", "true")
+	}
+
+	if err := ins.call("CreateDBInstance", params, nil); err != nil {
+		logrus.Errorf("rds instance create error - %s", err)
+		return err
+	}
+
+	ins.Operation = rdsOperationCreate
+	return &OperationInProgressError{Operation: ins.Operation}
+}
+
+func (ins *Rds) updateInstance() error {
+	logrus.Debugf("rds instance update %s", ins.Name)
+	params, err := ins.verifyConfig()
+	if err != nil {
+		return err
+	}
+
+	for name := range params {
+		for _, createOnly := range rdsCreateOnlyParameters {
+			if name == createOnly || strings.HasPrefix(name, createOnly+".") {
+				params.Del(name)
+			}
+		}
+	}
+	if port := params.Get("Port"); port != "" {
+		params.Del("Port")
+		params.Set("DBPortNumber", port)
+	}
+
+	params.Set("DBInstanceIdentifier", ins.Name)
+	if ins.PasswordChanged {
+		params.Set("MasterUserPassword", ins.Password)
+	}
+	params.Set("ApplyImmediately", "true")
+	if ins.IAMAuth {
+		params.Set("EnableIAMDatabaseAuthentication", "true")
+	}
+
+	if err := ins.call("ModifyDBInstance", params, nil); err != nil {
+		logrus.Errorf("rds instance modify error - %s", err)
+		return err
+	}
+
+	ins.Operation = rdsOperationModify
+	if ins.PasswordChanged {
+		ins.Operation = rdsOperationModifyPassword
+	}
+	return &OperationInProgressError{Operation: ins.Operation}
+}
+
+// checkOperation returns OperationInProgressError until the created or modified instance is available
+func (ins *Rds) checkOperation() error {
+	if ins.Operation == "" {
+		return nil
+	}
+
+	instance, err := ins.getInstance()
+	if err != nil {
+		return err
+	}
+	logrus.Debugf("check rds instance %s status: %s", ins.Name, instance.Status)
+	if instance.Status != "available" {
+		return &OperationInProgressError{Operation: ins.Operation}
+	}
+	// rds keeps reporting available for a while after a modification,
+	// it's only applied once no values are pending anymore
+	if ins.Operation != rdsOperationCreate && strings.TrimSpace(instance.PendingModifiedValues.Values) != "" {
+		logrus.Debugf("rds instance %s has pending modifications", ins.Name)
+		return &OperationInProgressError{Operation: ins.Operation}
+	}
+
+	ins.finished = ins.Operation
+	ins.Operation = ""
+	return nil
+}
+
+func (ins *Rds) state() (string, error) {
+	instance, err := ins.getInstance()
+	if err != nil {
+		return "", err
+	}
+	logrus.Debugf("check rds instance %s status: %s", ins.Name, instance.Status)
+	// the instance is ready for updates as a runnable cloud sql instance
+	if instance.Status == "available" {
+		return "RUNNABLE", nil
+	}
+	return instance.Status, nil
+}
+
+func (ins *Rds) create() error {
+	err := ins.createInstance()
+	if err != nil {
+		if !errors.Is(err, ErrOperationInProgress) {
+			logrus.Errorf("rds instance creation error - %s", err)
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (ins *Rds) update() error {
+	// a created or modified instance already has the parameters of the config,
+	// it's only modified again if the password changed and wasn't sent yet
+	if ins.finished == rdsOperationCreate || ins.finished == rdsOperationModifyPassword ||
+		(ins.finished == rdsOperationModify && !ins.PasswordChanged) {
+		return nil
+	}
+
+	err := ins.updateInstance()
+	if err != nil {
+		if !errors.Is(err, ErrOperationInProgress) {
+			logrus.Errorf("rds instance update error - %s", err)
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (ins *Rds) exist() error {
+	_, err := ins.getInstance()
+	var rdsErr *RdsError
+	if errors.As(err, &rdsErr) && rdsErr.Code == rdsNotFoundCode {
+		logrus.Debugf("rds instance get failed %s", err)
+		return err
+	}
+	if err != nil {
+		// the instance may exist, it must not be created again
+		return fmt.Errorf("%w - %s", ErrExistenceUnknown, err)
+	}
+	return nil // instance exist
+}
+
+func (ins *Rds) getInfoMap() (map[string]string, error) {
+	instance, err := ins.getInstance()
+	if err != nil {
+		return nil, err
+	}
+
+	data := map[string]string{
+		"DB_INSTANCE": instance.Identifier,
+		"DB_CONN":     instance.Endpoint.Address,
+		"DB_PORT":     strconv.Itoa(instance.Endpoint.Port),
+		"DB_VERSION":  instance.EngineVersion,
+	}
+
+	return data, nil
+}
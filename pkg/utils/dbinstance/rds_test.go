@@ -0,0 +1,253 @@
+/*
+ * Copyright 2021 kloeckner.i GmbH
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dbinstance
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// rdsMock serves the rds query api for a single instance,
+// a created or modified instance stays creating or modifying until the test makes it available
+type rdsMock struct {
+	mu       sync.Mutex
+	status   string
+	pending  string
+	requests []url.Values
+}
+
+func (m *rdsMock) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !strings.Contains(r.Header.Get("Authorization"), "/eu-central-1/rds/aws4_request") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	r.ParseForm()
+	m.requests = append(m.requests, r.PostForm)
+
+	switch r.PostForm.Get("Action") {
+	case "DescribeDBInstances":
+		if m.status == "throttled" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `<ErrorResponse><Error><Type>Sender</Type><Code>Throttling</Code><Message>Rate exceeded</Message></Error></ErrorResponse>`)
+			return
+		}
+		if m.status == "" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `<ErrorResponse><Error><Type>Sender</Type><Code>DBInstanceNotFound</Code><Message>DBInstance not found</Message></Error></ErrorResponse>`)
+			return
+		}
+		fmt.Fprintf(w, `<DescribeDBInstancesResponse xmlns="http://rds.amazonaws.com/doc/2014-10-31/">
+  <DescribeDBInstancesResult>
+    <DBInstances>
+      <DBInstance>
+        <DBInstanceIdentifier>%s</DBInstanceIdentifier>
+        <DBInstanceStatus>%s</DBInstanceStatus>
+        <Engine>postgres</Engine>
+        <EngineVersion>14.5</EngineVersion>
+        <PendingModifiedValues>%s</PendingModifiedValues>
+        <Endpoint>
+          <Address>test.abcdefgh.eu-central-1.rds.amazonaws.com</Address>
+          <Port>5432</Port>
+        </Endpoint>
+      </DBInstance>
+    </DBInstances>
+  </DescribeDBInstancesResult>
+</DescribeDBInstancesResponse>`, r.PostForm.Get("DBInstanceIdentifier"), m.status, m.pending)
+	case "CreateDBInstance":
+		m.status = "creating"
+		fmt.Fprint(w, `<CreateDBInstanceResponse><CreateDBInstanceResult><DBInstance/></CreateDBInstanceResult></CreateDBInstanceResponse>`)
+	case "ModifyDBInstance":
+		m.status = "modifying"
+		fmt.Fprint(w, `<ModifyDBInstanceResponse><ModifyDBInstanceResult><DBInstance/></ModifyDBInstanceResult></ModifyDBInstanceResponse>`)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func (m *rdsMock) lastRequest() url.Values {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := len(m.requests) - 1; i >= 0; i-- {
+		if m.requests[i].Get("Action") != "DescribeDBInstances" {
+			return m.requests[i]
+		}
+	}
+	return nil
+}
+
+func modifications(m *rdsMock) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	count := 0
+	for _, req := range m.requests {
+		if req.Get("Action") == "ModifyDBInstance" {
+			count++
+		}
+	}
+	return count
+}
+
+func mockRds(t *testing.T) (*Rds, *rdsMock) {
+	// the mock accepts any signature
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	mock := &rdsMock{}
+	server := httptest.NewServer(mock)
+	t.Cleanup(server.Close)
+
+	return RdsNew("test", `{"DBInstanceClass": "db.t3.micro", "Engine": "postgres", "AllocatedStorage": 20, "Port": 5432, "PubliclyAccessible": false}`,
+		"admin", "testPassw0rd", "eu-central-1", server.URL, true), mock
+}
+
+func TestRdsCreate(t *testing.T) {
+	rds, mock := mockRds(t)
+
+	_, err := Create(rds)
+	assert.Equal(t, &OperationInProgressError{Operation: rdsOperationCreate}, err)
+	assert.Equal(t, rdsOperationCreate, rds.Operation)
+
+	req := mock.lastRequest()
+	assert.Equal(t, "CreateDBInstance", req.Get("Action"))
+	assert.Equal(t, "test", req.Get("DBInstanceIdentifier"))
+	assert.Equal(t, "admin", req.Get("MasterUsername"))
+	assert.Equal(t, "testPassw0rd", req.Get("MasterUserPassword"))
+	assert.Equal(t, "20", req.Get("AllocatedStorage"))
+	assert.Equal(t, "false", req.Get("PubliclyAccessible"))
+	assert.Equal(t, "true", req.Get("EnableIAMDatabaseAuthentication"))
+
+	_, err = Create(rds)
+	assert.Equal(t, &OperationInProgressError{Operation: rdsOperationCreate}, err)
+
+	// the created instance isn't modified with the same config
+	mock.status = "available"
+	_, err = Create(rds)
+	assert.Equal(t, ErrAlreadyExists, err)
+	assert.Empty(t, rds.Operation)
+	info, err := Update(rds)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"DB_INSTANCE": "test",
+		"DB_CONN":     "test.abcdefgh.eu-central-1.rds.amazonaws.com",
+		"DB_PORT":     "5432",
+		"DB_VERSION":  "14.5",
+	}, info)
+	assert.Equal(t, "CreateDBInstance", mock.lastRequest().Get("Action"))
+}
+
+func TestRdsCreateUnknownExistence(t *testing.T) {
+	rds, mock := mockRds(t)
+
+	mock.status = "throttled"
+	_, err := Create(rds)
+	assert.ErrorIs(t, err, ErrExistenceUnknown)
+	_, err = Update(rds)
+	assert.ErrorIs(t, err, ErrExistenceUnknown)
+	assert.Nil(t, mock.lastRequest(), "the instance must not be created")
+}
+
+func TestRdsUpdate(t *testing.T) {
+	rds, mock := mockRds(t)
+
+	_, err := Update(rds)
+	assert.Equal(t, ErrNotExists, err)
+
+	mock.status = "available"
+	_, err = Update(rds)
+	assert.Equal(t, &OperationInProgressError{Operation: rdsOperationModify}, err)
+
+	req := mock.lastRequest()
+	assert.Equal(t, "ModifyDBInstance", req.Get("Action"))
+	assert.Empty(t, req.Get("MasterUserPassword"), "the password didn't change")
+	assert.Equal(t, "true", req.Get("ApplyImmediately"))
+	assert.Equal(t, "5432", req.Get("DBPortNumber"))
+	assert.Empty(t, req.Get("Engine"), "engine can't be modified")
+	assert.Empty(t, req.Get("Port"))
+
+	mock.status = "available"
+	info, err := Update(rds)
+	assert.NoError(t, err)
+	assert.Equal(t, "test.abcdefgh.eu-central-1.rds.amazonaws.com", info["DB_CONN"])
+
+	mock.status = "backing-up"
+	_, err = Update(rds)
+	assert.Equal(t, ErrInstanceNotReady, err)
+}
+
+func TestRdsUpdatePassword(t *testing.T) {
+	rds, mock := mockRds(t)
+
+	mock.status = "available"
+	rds.PasswordChanged = true
+	_, err := Update(rds)
+	assert.Equal(t, &OperationInProgressError{Operation: rdsOperationModifyPassword}, err)
+	assert.Equal(t, "testPassw0rd", mock.lastRequest().Get("MasterUserPassword"))
+
+	mock.status = "available"
+	_, err = Update(rds)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, modifications(mock), "the password isn't sent again")
+}
+
+func TestRdsUpdatePending(t *testing.T) {
+	rds, mock := mockRds(t)
+
+	mock.status = "available"
+	_, err := Update(rds)
+	assert.Equal(t, &OperationInProgressError{Operation: rdsOperationModify}, err)
+
+	// the modification isn't applied yet while rds still reports the instance available
+	mock.status = "available"
+	mock.pending = "<DBInstanceClass>db.t3.micro</DBInstanceClass>"
+	_, err = Update(rds)
+	assert.Equal(t, &OperationInProgressError{Operation: rdsOperationModify}, err)
+
+	mock.pending = ""
+	_, err = Update(rds)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, modifications(mock))
+}
+
+func TestRdsInvalidConfig(t *testing.T) {
+	rds, _ := mockRds(t)
+
+	rds.Config = ""
+	assert.Error(t, rds.createInstance())
+
+	rds.Config = `{"VpcSecurityGroupIds": ["sg-1"]}`
+	assert.Error(t, rds.createInstance(), "lists must be given with the member names of the api")
+}
+
+func TestRdsError(t *testing.T) {
+	rds, _ := mockRds(t)
+
+	err := rds.exist()
+	assert.Error(t, err)
+	assert.Equal(t, "DBInstanceNotFound", err.(*RdsError).Code)
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	assert.ErrorIs(t, rds.exist(), ErrExistenceUnknown, "the api can't be called without access key")
+}
@@ -0,0 +1,88 @@
+/*
+ * Copyright 2021 kloeckner.i GmbH
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dbinstance
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+	sqladmin "google.golang.org/api/sqladmin/v1beta4"
+)
+
+// Replica is a read-only server replicating an instance
+type Replica interface {
+	replicaEndpoint() (string, string, error)
+}
+
+// CheckReplica returns host and port of the replica,
+// an error is returned when the replica can't serve reads
+func CheckReplica(replica Replica) (string, string, error) {
+	host, port, err := replica.replicaEndpoint()
+	if err != nil {
+		logrus.Debugf("replica check failed - %s", err)
+		return "", "", err
+	}
+	return host, port, nil
+}
+
+func (ins *Generic) replicaEndpoint() (string, string, error) {
+	err := ins.exist()
+	if err != nil {
+		return "", "", err
+	}
+	return ins.Host, strconv.FormatInt(int64(ins.Port), 10), nil
+}
+
+func (ins *Gsql) replicaEndpoint() (string, string, error) {
+	instance, err := ins.getInstance()
+	if err != nil {
+		return "", "", err
+	}
+
+	if instance.InstanceType != "READ_REPLICA_INSTANCE" {
+		return "", "", fmt.Errorf("gsql instance %s is not a read replica", ins.Name)
+	}
+
+	if instance.State != "RUNNABLE" {
+		return "", "", ErrInstanceNotReady
+	}
+
+	host := getGsqlReplicaIP(instance)
+	if host == "" {
+		return "", "", fmt.Errorf("gsql instance %s has no ip address", ins.Name)
+	}
+
+	return host, determineGsqlPort(instance), nil
+}
+
+// getGsqlReplicaIP prefers the private ip address, which is reachable from the cluster without authorized networks
+func getGsqlReplicaIP(instance *sqladmin.DatabaseInstance) string {
+	for _, ip := range instance.IpAddresses {
+		if ip.Type == "PRIVATE" {
+			return ip.IpAddress
+		}
+	}
+
+	for _, ip := range instance.IpAddresses {
+		if ip.Type == "PRIMARY" {
+			return ip.IpAddress
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,50 @@
+/*
+ * Copyright 2021 kloeckner.i GmbH
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dbinstance
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	sqladmin "google.golang.org/api/sqladmin/v1beta4"
+)
+
+func TestGetGsqlReplicaIP(t *testing.T) {
+	instance := &sqladmin.DatabaseInstance{
+		IpAddresses: []*sqladmin.IpMapping{
+			{Type: "PRIMARY", IpAddress: "34.0.0.1"},
+		},
+	}
+	assert.Equal(t, "34.0.0.1", getGsqlReplicaIP(instance))
+
+	instance.IpAddresses = append(instance.IpAddresses, &sqladmin.IpMapping{Type: "PRIVATE", IpAddress: "10.0.0.1"})
+	assert.Equal(t, "10.0.0.1", getGsqlReplicaIP(instance))
+
+	instance.IpAddresses = nil
+	assert.Equal(t, "", getGsqlReplicaIP(instance))
+}
+
+func TestGenericReplicaUnreachable(t *testing.T) {
+	replica := &Generic{
+		Host:   "127.0.0.1",
+		Port:   1,
+		Engine: "postgres",
+		User:   "test",
+	}
+	_, _, err := CheckReplica(replica)
+	assert.Error(t, err)
+}
@@ -17,15 +17,25 @@
 package dbinstance
 
 import (
+	"errors"
+
+	kcidb "github.com/kloeckner-i/db-operator/pkg/utils/database"
 	"github.com/sirupsen/logrus"
 )
 
 // Create instance if not exists
 func Create(ins DbInstance) (map[string]string, error) {
+	if err := checkOperation(ins); err != nil {
+		return nil, err
+	}
+
 	err := ins.exist()
 	if err == nil {
 		return nil, ErrAlreadyExists
 	}
+	if errors.Is(err, kcidb.ErrRequestInProgress) || errors.Is(err, ErrExistenceUnknown) {
+		return nil, err
+	}
 
 	logrus.Debug("instance doesn't exist, create instance")
 	err = ins.create()
@@ -44,7 +54,14 @@ func Create(ins DbInstance) (map[string]string, error) {
 
 // Update instance if instance exists
 func Update(ins DbInstance) (map[string]string, error) {
+	if err := checkOperation(ins); err != nil {
+		return nil, err
+	}
+
 	err := ins.exist()
+	if errors.Is(err, kcidb.ErrRequestInProgress) || errors.Is(err, ErrExistenceUnknown) {
+		return nil, err
+	}
 	if err != nil {
 		return nil, ErrNotExists
 	}
@@ -71,3 +88,77 @@ func Update(ins DbInstance) (map[string]string, error) {
 
 	return data, nil
 }
+
+// Delete removes the instance from the backend, it returns nil once the instance doesn't exist anymore
+func Delete(ins DbInstance) error {
+	d, ok := ins.(deleter)
+	if !ok {
+		return ErrDeleteNotSupported
+	}
+	if err := checkOperation(ins); err != nil {
+		return err
+	}
+	return d.delete()
+}
+
+// Promote turns a read replica into a standalone instance, it returns nil once the instance isn't a replica anymore
+func Promote(ins DbInstance) error {
+	p, ok := ins.(promoter)
+	if !ok {
+		return ErrPromoteNotSupported
+	}
+	if err := checkOperation(ins); err != nil {
+		return err
+	}
+	return p.promote()
+}
+
+// Backup starts a backup of the instance by its backend, it returns nil once the backup is done.
+// The backup is tracked apart from the pending operation of the instance.
+func Backup(ins DbInstance) error {
+	b, ok := ins.(backuper)
+	if !ok {
+		return ErrBackupNotSupported
+	}
+	return b.backup()
+}
+
+// BackupRuns returns the most recent backups of the instance, the newest first
+func BackupRuns(ins DbInstance) ([]BackupRun, error) {
+	b, ok := ins.(backuper)
+	if !ok {
+		return nil, ErrBackupNotSupported
+	}
+	return b.backupRuns()
+}
+
+// Restore overwrites the existing instance with a backup, it returns nil once the backup is restored
+func Restore(ins DbInstance) error {
+	b, ok := ins.(backuper)
+	if !ok {
+		return ErrBackupNotSupported
+	}
+	if err := checkOperation(ins); err != nil {
+		return err
+	}
+	return b.restore()
+}
+
+// IssueClientCert issues a client certificate for the common name, nil is returned while the certificate
+// with the fingerprint is still valid. Certificates issued before for the common name are revoked.
+func IssueClientCert(ins DbInstance, commonName, fingerprint string) (*ClientCert, error) {
+	issuer, ok := ins.(certIssuer)
+	if !ok {
+		return nil, ErrClientCertNotSupported
+	}
+	return issuer.clientCert(commonName, fingerprint)
+}
+
+// checkOperation returns ErrOperationInProgress while the pending operation of the instance is running
+func checkOperation(ins DbInstance) error {
+	tracker, ok := ins.(operationTracker)
+	if !ok {
+		return nil
+	}
+	return tracker.checkOperation()
+}
@@ -24,3 +24,50 @@ type DbInstance interface {
 	state() (string, error)
 	getInfoMap() (map[string]string, error)
 }
+
+// operationTracker is implemented by instances which change the server by long running operations of the backend,
+// the pending operation is polled before the instance is created or updated again
+type operationTracker interface {
+	checkOperation() error
+}
+
+// deleter is implemented by instances which can be removed from the backend
+type deleter interface {
+	delete() error
+}
+
+// promoter is implemented by instances which can be promoted from read replica to standalone instance
+type promoter interface {
+	promote() error
+}
+
+// backuper is implemented by instances whose backend makes backups of the server
+type backuper interface {
+	backup() error
+	backupRuns() ([]BackupRun, error)
+	restore() error
+}
+
+// BackupRun is a backup of the server made by the backend of the instance
+type BackupRun struct {
+	ID     int64
+	Type   string
+	Status string
+	// EnqueuedTime and EndTime are RFC 3339 timestamps
+	EnqueuedTime string
+	EndTime      string
+}
+
+// certIssuer is implemented by instances whose backend issues client certificates
+type certIssuer interface {
+	clientCert(commonName, fingerprint string) (*ClientCert, error)
+}
+
+// ClientCert is a client certificate issued by the backend of the instance in PEM format
+type ClientCert struct {
+	Cert string
+	Key  string
+	// CA is the CA bundle of the server certificate
+	CA          string
+	Fingerprint string
+}
@@ -0,0 +1,174 @@
+/*
+ * Copyright 2021 kloeckner.i GmbH
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package naming
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// DefaultTemplate generates names like <namespace>-<name>, the naming used before templates were configurable
+const DefaultTemplate = "{{ .Prefix }}{{ .Namespace }}-{{ .Name }}{{ .Suffix }}"
+
+const (
+	// https://www.postgresql.org/docs/current/sql-syntax-lexical.html#SQL-SYNTAX-IDENTIFIERS
+	postgresNameLengthLimit = 63
+	// https://dev.mysql.com/doc/refman/5.7/en/identifier-length.html
+	mysqlDBNameLengthLimit = 63
+	// https://dev.mysql.com/doc/refman/5.7/en/replication-features-user-names.html
+	mysqlUserLengthLimit = 32
+)
+
+var (
+	// names are quoted in queries, but quotes and backslashes would break them
+	postgresNamePattern = regexp.MustCompile(`^[^"'\\\x00]+$`)
+	// https://dev.mysql.com/doc/refman/5.7/en/identifiers.html
+	mysqlNamePattern     = regexp.MustCompile(`^[0-9a-zA-Z$_]+$`)
+	mysqlUnsupportedChar = regexp.MustCompile(`[^0-9a-zA-Z$_]`)
+)
+
+// Rules defines how database and user names are generated on the server
+type Rules struct {
+	// Template for database names, DefaultTemplate if empty
+	Template string `yaml:"template"`
+	// UserTemplate for user names, Template is used if empty
+	UserTemplate string `yaml:"userTemplate"`
+	Prefix       string `yaml:"prefix"`
+	Suffix       string `yaml:"suffix"`
+}
+
+// Fields can be used in naming templates
+type Fields struct {
+	Namespace string
+	Name      string
+	Prefix    string
+	Suffix    string
+}
+
+// DatabaseName returns the name of the database on the server.
+// The override is used as it is, generated names are sanitized for mysql.
+func (r Rules) DatabaseName(namespace, name, override, engine string) (string, error) {
+	if override != "" {
+		return override, Validate(engine, false, override)
+	}
+	return r.generate(firstNotEmpty(r.Template, DefaultTemplate), namespace, name, engine, false)
+}
+
+// UserName returns the name of the user on the server.
+// The override is used as it is, generated names are sanitized for mysql.
+func (r Rules) UserName(namespace, name, override, engine string) (string, error) {
+	if override != "" {
+		return override, Validate(engine, true, override)
+	}
+	return r.generate(firstNotEmpty(r.UserTemplate, r.Template, DefaultTemplate), namespace, name, engine, true)
+}
+
+func (r Rules) generate(tmpl, namespace, name, engine string, user bool) (string, error) {
+	t, err := template.New("name").Parse(tmpl)
+	if err != nil {
+		return "", fmt.Errorf("invalid naming template - %s", err)
+	}
+
+	var buf bytes.Buffer
+	err = t.Execute(&buf, Fields{Namespace: namespace, Name: name, Prefix: r.Prefix, Suffix: r.Suffix})
+	if err != nil {
+		return "", fmt.Errorf("invalid naming template - %s", err)
+	}
+	generated := buf.String()
+
+	if engine == "mysql" {
+		if user {
+			generated = Sanitize(generated, mysqlUserLengthLimit)
+		} else {
+			generated = Sanitize(generated, mysqlDBNameLengthLimit)
+		}
+	}
+
+	return generated, Validate(engine, user, generated)
+}
+
+// Validate checks length and charset of a database or user name for the engine
+func Validate(engine string, user bool, name string) error {
+	kind := "database"
+	if user {
+		kind = "user"
+	}
+	if name == "" {
+		return fmt.Errorf("%s name must not be empty", kind)
+	}
+
+	switch engine {
+	case "postgres":
+		if len(name) > postgresNameLengthLimit {
+			return fmt.Errorf("postgres %s name %s is longer than %d characters", kind, name, postgresNameLengthLimit)
+		}
+		if !postgresNamePattern.MatchString(name) {
+			return fmt.Errorf("postgres %s name %s must not contain quotes or backslashes", kind, name)
+		}
+	case "mysql":
+		limit := mysqlDBNameLengthLimit
+		if user {
+			limit = mysqlUserLengthLimit
+		}
+		if len(name) > limit {
+			return fmt.Errorf("mysql %s name %s is longer than %d characters", kind, name, limit)
+		}
+		if !mysqlNamePattern.MatchString(name) {
+			return fmt.Errorf("mysql %s name %s can only contain letters, digits, $ and _", kind, name)
+		}
+	default:
+		return fmt.Errorf("not supported engine type %s", engine)
+	}
+	return nil
+}
+
+// Sanitize sanitizes and truncates a string to a fixed length using a hash function.
+// useful for restricting the length and content of user supplied database identifiers.
+func Sanitize(s string, limit int) string {
+	// use lowercase exclusively for identifiers.
+	// https://dev.mysql.com/doc/refman/5.7/en/identifier-case-sensitivity.html
+	s = strings.ToLower(s)
+
+	// Strip out any unsupported characters.
+	// https://dev.mysql.com/doc/refman/5.7/en/identifiers.html
+	s = mysqlUnsupportedChar.ReplaceAllString(s, "_")
+
+	if len(s) <= limit {
+		return s
+	}
+
+	hash := fmt.Sprintf("%x", sha256.Sum256([]byte(s)))
+
+	if limit <= 9 {
+		return hash[:limit]
+	}
+
+	return fmt.Sprintf("%s_%s", s[:limit-9], hash[:8])
+}
+
+func firstNotEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,87 @@
+/*
+ * Copyright 2021 kloeckner.i GmbH
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package naming
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultNaming(t *testing.T) {
+	rules := Rules{}
+
+	name, err := rules.DatabaseName("TestNS", "TestDB", "", "postgres")
+	assert.NoError(t, err)
+	assert.Equal(t, "TestNS-TestDB", name)
+
+	name, err = rules.UserName("TestNS", "TestDB", "", "postgres")
+	assert.NoError(t, err)
+	assert.Equal(t, "TestNS-TestDB", name)
+
+	name, err = rules.DatabaseName("TestNS", "TestDB", "", "mysql")
+	assert.NoError(t, err)
+	assert.Equal(t, "testns_testdb", name)
+}
+
+func TestTemplateNaming(t *testing.T) {
+	rules := Rules{
+		Template:     "{{ .Prefix }}{{ .Name }}{{ .Suffix }}",
+		UserTemplate: "{{ .Prefix }}{{ .Namespace }}_{{ .Name }}",
+		Prefix:       "cluster1_",
+		Suffix:       "_db",
+	}
+
+	name, err := rules.DatabaseName("ns", "app", "", "postgres")
+	assert.NoError(t, err)
+	assert.Equal(t, "cluster1_app_db", name)
+
+	name, err = rules.UserName("ns", "app", "", "postgres")
+	assert.NoError(t, err)
+	assert.Equal(t, "cluster1_ns_app", name)
+
+	name, err = rules.UserName("very-long-namespace-name", "very-long-database-name", "", "mysql")
+	assert.NoError(t, err)
+	assert.Len(t, name, mysqlUserLengthLimit)
+
+	_, err = Rules{Template: "{{ .Unknown }}"}.DatabaseName("ns", "app", "", "postgres")
+	assert.Error(t, err)
+}
+
+func TestOverrideNaming(t *testing.T) {
+	rules := Rules{Prefix: "ignored_"}
+
+	name, err := rules.DatabaseName("ns", "app", "legacy_app", "mysql")
+	assert.NoError(t, err)
+	assert.Equal(t, "legacy_app", name)
+
+	_, err = rules.DatabaseName("ns", "app", "legacy-app", "mysql")
+	assert.Error(t, err)
+
+	_, err = rules.UserName("ns", "app", "user\"", "postgres")
+	assert.Error(t, err)
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, Validate("postgres", false, "ns-app"))
+	assert.Error(t, Validate("postgres", false, ""))
+	assert.Error(t, Validate("postgres", false, "a234567890123456789012345678901234567890123456789012345678901234"))
+	assert.NoError(t, Validate("mysql", true, "a2345678901234567890123456789012"))
+	assert.Error(t, Validate("mysql", true, "a23456789012345678901234567890123"))
+	assert.Error(t, Validate("mysql", false, "db.name"))
+	assert.Error(t, Validate("oracle", false, "name"))
+}
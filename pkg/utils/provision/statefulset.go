@@ -0,0 +1,262 @@
+/*
+ * Copyright 2021 kloeckner.i GmbH
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package provision
+
+import (
+	"errors"
+	"strconv"
+
+	kciv1beta1 "github.com/kloeckner-i/db-operator/api/v1beta1"
+	"github.com/kloeckner-i/db-operator/pkg/config"
+	"github.com/kloeckner-i/db-operator/pkg/utils/kci"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const (
+	dataVolumeName     = "data"
+	defaultStorageSize = "1Gi"
+)
+
+// ServerName returns the name of the statefulset and the service of the database server of dbin
+func ServerName(dbin *kciv1beta1.DbInstance) string {
+	return "dbin-" + dbin.Name
+}
+
+// Namespace returns the namespace of the database server, it's deployed next to the admin secret
+func Namespace(dbin *kciv1beta1.DbInstance) string {
+	return dbin.Spec.AdminUserSecret.Namespace
+}
+
+// Host returns the address of the database server inside the cluster
+func Host(dbin *kciv1beta1.DbInstance) string {
+	return ServerName(dbin) + "." + Namespace(dbin) + ".svc"
+}
+
+// Port returns the port of the database server, the default port of the engine if it's not defined
+func Port(dbin *kciv1beta1.DbInstance) uint16 {
+	if dbin.Spec.Generic != nil && dbin.Spec.Generic.Port != 0 {
+		return dbin.Spec.Generic.Port
+	}
+	if dbin.Spec.Engine == "mysql" {
+		return 3306
+	}
+	return 5432
+}
+
+// Labels returns the labels of all objects of the database server of dbin
+func Labels(dbin *kciv1beta1.DbInstance) map[string]string {
+	return kci.LabelBuilder(map[string]string{
+		"app":        "db-server",
+		"dbinstance": dbin.Name,
+	})
+}
+
+// AdminSecret builds kubernetes secret object
+// containing a generated admin password of the database server
+func AdminSecret(dbin *kciv1beta1.DbInstance) *v1.Secret {
+	user := "postgres"
+	if dbin.Spec.Engine == "mysql" {
+		user = "root"
+	}
+	data := map[string][]byte{
+		"user":     []byte(user),
+		"password": []byte(kci.GeneratePass()),
+	}
+	secret := kci.SecretBuilder(dbin.Spec.AdminUserSecret.Name, Namespace(dbin), data, []metav1.OwnerReference{})
+	secret.ObjectMeta.Labels = Labels(dbin)
+	return secret
+}
+
+// IsGeneratedSecret returns true if the admin secret was generated for the database server of dbin
+func IsGeneratedSecret(dbin *kciv1beta1.DbInstance, secret *v1.Secret) bool {
+	return secret.Labels["dbinstance"] == dbin.Name && secret.Labels["created-by"] == "db-operator"
+}
+
+// Service builds kubernetes service object
+// which exposes the database server inside the cluster
+func Service(dbin *kciv1beta1.DbInstance) *v1.Service {
+	return &v1.Service{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Service",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      ServerName(dbin),
+			Namespace: Namespace(dbin),
+			Labels:    Labels(dbin),
+		},
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{
+				{
+					Name:       dbin.Spec.Engine,
+					Port:       int32(Port(dbin)),
+					TargetPort: intstr.FromString("sqlport"),
+					Protocol:   v1.ProtocolTCP,
+				},
+			},
+			Selector: Labels(dbin),
+		},
+	}
+}
+
+// StatefulSet builds kubernetes statefulset object
+// which runs a single database server with a persistent volume
+func StatefulSet(conf *config.Config, dbin *kciv1beta1.DbInstance) (*appsv1.StatefulSet, error) {
+	if dbin.Spec.Generic == nil || dbin.Spec.Generic.Provision == nil {
+		return nil, errors.New("provision is not defined")
+	}
+	provision := dbin.Spec.Generic.Provision
+
+	container, err := serverContainer(conf, dbin)
+	if err != nil {
+		return nil, err
+	}
+
+	storageSize := provision.StorageSize
+	if storageSize.IsZero() {
+		storageSize = resource.MustParse(defaultStorageSize)
+	}
+
+	claim := v1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   dataVolumeName,
+			Labels: Labels(dbin),
+		},
+		Spec: v1.PersistentVolumeClaimSpec{
+			AccessModes: []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce},
+			Resources: v1.ResourceRequirements{
+				Requests: v1.ResourceList{v1.ResourceStorage: storageSize},
+			},
+		},
+	}
+	if provision.StorageClassName != "" {
+		claim.Spec.StorageClassName = &provision.StorageClassName
+	}
+
+	replicas := int32(1)
+
+	return &appsv1.StatefulSet{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "StatefulSet",
+			APIVersion: "apps/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      ServerName(dbin),
+			Namespace: Namespace(dbin),
+			Labels:    Labels(dbin),
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas:    &replicas,
+			ServiceName: ServerName(dbin),
+			Selector: &metav1.LabelSelector{
+				MatchLabels: Labels(dbin),
+			},
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: Labels(dbin),
+				},
+				Spec: v1.PodSpec{
+					Containers:   []v1.Container{container},
+					NodeSelector: conf.Instances.Generic.Provision.NodeSelector,
+				},
+			},
+			VolumeClaimTemplates: []v1.PersistentVolumeClaim{claim},
+		},
+	}, nil
+}
+
+func serverContainer(conf *config.Config, dbin *kciv1beta1.DbInstance) (v1.Container, error) {
+	port := strconv.Itoa(int(Port(dbin)))
+	secretName := dbin.Spec.AdminUserSecret.Name
+
+	var image, dataPath string
+	var env []v1.EnvVar
+	var probe []string
+	switch dbin.Spec.Engine {
+	case "postgres":
+		image = conf.Instances.Generic.Provision.Postgres.Image
+		dataPath = "/var/lib/postgresql/data"
+		env = []v1.EnvVar{
+			secretEnvVar("POSTGRES_USER", secretName, "user"),
+			secretEnvVar("POSTGRES_PASSWORD", secretName, "password"),
+			// the root of a volume can't be used as data directory because of lost+found
+			{Name: "PGDATA", Value: dataPath + "/pgdata"},
+			{Name: "PGPORT", Value: port},
+		}
+		probe = []string{"pg_isready", "-h", "127.0.0.1", "-p", port}
+	case "mysql":
+		image = conf.Instances.Generic.Provision.Mysql.Image
+		dataPath = "/var/lib/mysql"
+		env = []v1.EnvVar{
+			secretEnvVar("MYSQL_ROOT_PASSWORD", secretName, "password"),
+			{Name: "MYSQL_TCP_PORT", Value: port},
+		}
+		probe = []string{"mysqladmin", "ping", "-h", "127.0.0.1", "-P", port}
+	default:
+		return v1.Container{}, errors.New("not supported engine type")
+	}
+
+	if image == "" {
+		return v1.Container{}, errors.New("image of " + dbin.Spec.Engine + " server is not configured")
+	}
+
+	return v1.Container{
+		Name:            dbin.Spec.Engine,
+		Image:           image,
+		ImagePullPolicy: v1.PullIfNotPresent,
+		Env:             env,
+		Ports: []v1.ContainerPort{
+			{
+				Name:          "sqlport",
+				ContainerPort: int32(Port(dbin)),
+				Protocol:      v1.ProtocolTCP,
+			},
+		},
+		ReadinessProbe: &v1.Probe{
+			ProbeHandler: v1.ProbeHandler{
+				Exec: &v1.ExecAction{Command: probe},
+			},
+		},
+		VolumeMounts: []v1.VolumeMount{
+			{
+				Name:      dataVolumeName,
+				MountPath: dataPath,
+			},
+		},
+	}, nil
+}
+
+// IsReady returns true if the database server accepts connections
+func IsReady(sts *appsv1.StatefulSet) bool {
+	return sts.Status.ReadyReplicas > 0
+}
+
+func secretEnvVar(name, secretName, key string) v1.EnvVar {
+	return v1.EnvVar{
+		Name: name,
+		ValueFrom: &v1.EnvVarSource{
+			SecretKeyRef: &v1.SecretKeySelector{
+				LocalObjectReference: v1.LocalObjectReference{Name: secretName},
+				Key:                  key,
+			},
+		},
+	}
+}
@@ -0,0 +1,104 @@
+/*
+ * Copyright 2021 kloeckner.i GmbH
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package provision
+
+import (
+	"testing"
+
+	kciv1beta1 "github.com/kloeckner-i/db-operator/api/v1beta1"
+	"github.com/kloeckner-i/db-operator/pkg/config"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func testInstance(engine string) *kciv1beta1.DbInstance {
+	dbin := &kciv1beta1.DbInstance{}
+	dbin.Name = "dev"
+	dbin.Spec.Engine = engine
+	dbin.Spec.AdminUserSecret = kciv1beta1.NamespacedName{Namespace: "databases", Name: "dev-admin"}
+	dbin.Spec.Generic = &kciv1beta1.GenericInstance{Provision: &kciv1beta1.GenericProvision{}}
+	return dbin
+}
+
+func testConfig() *config.Config {
+	conf := &config.Config{}
+	conf.Instances.Generic.Provision.Postgres.Image = "postgres:14"
+	conf.Instances.Generic.Provision.Mysql.Image = "mysql:8.0"
+	return conf
+}
+
+func TestStatefulSetPostgres(t *testing.T) {
+	dbin := testInstance("postgres")
+
+	sts, err := StatefulSet(testConfig(), dbin)
+	assert.NoError(t, err)
+	assert.Equal(t, "dbin-dev", sts.Name)
+	assert.Equal(t, "databases", sts.Namespace)
+	assert.Equal(t, "dbin-dev.databases.svc", Host(dbin))
+
+	container := sts.Spec.Template.Spec.Containers[0]
+	assert.Equal(t, "postgres:14", container.Image)
+	assert.Equal(t, int32(5432), container.Ports[0].ContainerPort)
+	assert.Equal(t, "dev-admin", container.Env[1].ValueFrom.SecretKeyRef.Name)
+	assert.Equal(t, "password", container.Env[1].ValueFrom.SecretKeyRef.Key)
+
+	claim := sts.Spec.VolumeClaimTemplates[0]
+	assert.Equal(t, resource.MustParse("1Gi"), claim.Spec.Resources.Requests[v1.ResourceStorage])
+	assert.Nil(t, claim.Spec.StorageClassName)
+	assert.Equal(t, Labels(dbin), claim.Labels)
+}
+
+func TestStatefulSetMysql(t *testing.T) {
+	dbin := testInstance("mysql")
+	dbin.Spec.Generic.Port = 3307
+	dbin.Spec.Generic.Provision.StorageSize = resource.MustParse("5Gi")
+	dbin.Spec.Generic.Provision.StorageClassName = "fast"
+
+	sts, err := StatefulSet(testConfig(), dbin)
+	assert.NoError(t, err)
+
+	container := sts.Spec.Template.Spec.Containers[0]
+	assert.Equal(t, "mysql:8.0", container.Image)
+	assert.Equal(t, int32(3307), container.Ports[0].ContainerPort)
+	assert.Contains(t, container.ReadinessProbe.Exec.Command, "3307")
+
+	claim := sts.Spec.VolumeClaimTemplates[0]
+	assert.Equal(t, resource.MustParse("5Gi"), claim.Spec.Resources.Requests[v1.ResourceStorage])
+	assert.Equal(t, "fast", *claim.Spec.StorageClassName)
+
+	svc := Service(dbin)
+	assert.Equal(t, int32(3307), svc.Spec.Ports[0].Port)
+}
+
+func TestStatefulSetImageNotConfigured(t *testing.T) {
+	_, err := StatefulSet(&config.Config{}, testInstance("postgres"))
+	assert.Error(t, err)
+}
+
+func TestAdminSecret(t *testing.T) {
+	dbin := testInstance("mysql")
+	secret := AdminSecret(dbin)
+	assert.Equal(t, "dev-admin", secret.Name)
+	assert.Equal(t, "databases", secret.Namespace)
+	assert.Equal(t, "root", string(secret.Data["user"]))
+	assert.NotEmpty(t, secret.Data["password"])
+	assert.True(t, IsGeneratedSecret(dbin, secret))
+
+	secret.Labels = nil
+	assert.False(t, IsGeneratedSecret(dbin, secret))
+}
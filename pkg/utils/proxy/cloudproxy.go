@@ -39,10 +39,17 @@ type CloudProxy struct {
 	Labels                 map[string]string
 	Conf                   *config.Config
 	MonitoringEnabled      bool
+	// IAMAuth logs in with the service account of AccessSecretName instead of the password sent by the client
+	IAMAuth bool
+	// AccessSecretChecksum is set on the pods, so they're restarted when the credentials change
+	AccessSecretChecksum string
 }
 
 const instanceAccessSecretVolumeName string = "gcloud-secret"
 
+// AccessSecretChecksumAnnotation is the pod annotation of the checksum of the credentials mounted by a cloud proxy
+const AccessSecretChecksumAnnotation string = "checksum/access-secret"
+
 func (cp *CloudProxy) buildService(ownership []metav1.OwnerReference) (*v1.Service, error) {
 	return &v1.Service{
 		TypeMeta: metav1.TypeMeta{
@@ -117,13 +124,17 @@ func (cp *CloudProxy) deploymentSpec() (v1apps.DeploymentSpec, error) {
 
 	terminationGracePeriodSeconds := int64(120) // force kill pod after this time
 
-	var annotations map[string]string
+	annotations := map[string]string{}
 
 	if cp.MonitoringEnabled {
-		annotations = map[string]string{
-			"prometheus.io/scrape": "true",
-			"prometheus.io/port":   strconv.Itoa(cp.Conf.Instances.Google.ProxyConfig.MetricsPort),
-		}
+		annotations["prometheus.io/scrape"] = "true"
+		annotations["prometheus.io/port"] = strconv.Itoa(cp.Conf.Instances.Google.ProxyConfig.MetricsPort)
+	}
+	if cp.AccessSecretChecksum != "" {
+		annotations[AccessSecretChecksumAnnotation] = cp.AccessSecretChecksum
+	}
+	if len(annotations) == 0 {
+		annotations = nil
 	}
 
 	return v1apps.DeploymentSpec{
@@ -155,12 +166,16 @@ func (cp *CloudProxy) container() (v1.Container, error) {
 	AllowPrivilegeEscalation := false
 	listenArg := fmt.Sprintf("--listen=0.0.0.0:%d", cp.Port)
 	instanceArg := fmt.Sprintf("--instance=%s", cp.InstanceConnectionName)
+	args := []string{"--credential-file=/srv/gcloud/credentials.json", listenArg, instanceArg}
+	if cp.IAMAuth {
+		args = append(args, "--enable-iam-login")
+	}
 
 	return v1.Container{
 		Name:    "db-auth-gateway",
 		Image:   cp.Conf.Instances.Google.ProxyConfig.Image,
 		Command: []string{"/usr/local/bin/db-auth-gateway"},
-		Args:    []string{"--credential-file=/srv/gcloud/credentials.json", listenArg, instanceArg},
+		Args:    args,
 		SecurityContext: &v1.SecurityContext{
 			RunAsUser:                &RunAsUser,
 			AllowPrivilegeEscalation: &AllowPrivilegeEscalation,
@@ -17,6 +17,10 @@
 package proxy
 
 import (
+	"crypto/sha256"
+	"fmt"
+	"sort"
+
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -45,3 +49,77 @@ func podAntiAffinity(labelSelector map[string]string) *v1.PodAntiAffinity {
 		},
 	}
 }
+
+func secretEnvVar(name, secretName, key string) v1.EnvVar {
+	return v1.EnvVar{
+		Name: name,
+		ValueFrom: &v1.EnvVarSource{
+			SecretKeyRef: &v1.SecretKeySelector{
+				LocalObjectReference: v1.LocalObjectReference{Name: secretName},
+				Key:                  key,
+			},
+		},
+	}
+}
+
+const (
+	proxyConfigVolumeName  = "proxy-config"
+	proxyConfigPath        = "/etc/proxy"
+	proxyRuntimeVolumeName = "proxy-runtime"
+	proxyRuntimePath       = "/var/run/proxy"
+)
+
+// proxysqlStartScript writes the proxysql user with the password from the environment on start,
+// so the password is never part of the configmap
+const proxysqlStartScript = `printf 'mysql_users=\n(\n\t{ username="%s", password="%s", default_hostgroup=0, transaction_persistent=1 }\n)\n' "$DB_USER" "$DB_PASSWORD" > ` + proxyRuntimePath + `/users.cnf
+exec proxysql -f -c ` + proxyConfigPath + `/proxysql.cnf`
+
+// proxyVolumes mounts the rendered configuration and a writable directory for files created on start
+func proxyVolumes(configMapName string) []v1.Volume {
+	return []v1.Volume{
+		{
+			Name: proxyConfigVolumeName,
+			VolumeSource: v1.VolumeSource{
+				ConfigMap: &v1.ConfigMapVolumeSource{
+					LocalObjectReference: v1.LocalObjectReference{Name: configMapName},
+				},
+			},
+		},
+		{
+			Name: proxyRuntimeVolumeName,
+			VolumeSource: v1.VolumeSource{
+				EmptyDir: &v1.EmptyDirVolumeSource{},
+			},
+		},
+	}
+}
+
+func proxyVolumeMounts() []v1.VolumeMount {
+	return []v1.VolumeMount{
+		{
+			Name:      proxyConfigVolumeName,
+			MountPath: proxyConfigPath,
+			ReadOnly:  true,
+		},
+		{
+			Name:      proxyRuntimeVolumeName,
+			MountPath: proxyRuntimePath,
+		},
+	}
+}
+
+// configChecksum is used as pod annotation, so pods are restarted when the configuration changes
+func configChecksum(data map[string]string) string {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	hash := sha256.New()
+	for _, key := range keys {
+		hash.Write([]byte(key))
+		hash.Write([]byte(data[key]))
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil))
+}
@@ -0,0 +1,372 @@
+/*
+ * Copyright 2021 kloeckner.i GmbH
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"text/template"
+
+	"github.com/kloeckner-i/db-operator/pkg/config"
+	"github.com/kloeckner-i/db-operator/pkg/utils/sshtunnel"
+	promv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	v1apps "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// Pool modes supported by PgBouncer
+const (
+	PoolModeSession     = "session"
+	PoolModeTransaction = "transaction"
+	PoolModeStatement   = "statement"
+)
+
+const (
+	defaultPoolMode = PoolModeTransaction
+	defaultPoolSize = 20
+)
+
+// Pooler is a connection pooler for a database on a generic instance,
+// PgBouncer for postgres and ProxySQL for mysql
+type Pooler struct {
+	NamePrefix string
+	Namespace  string
+	Engine     string
+	// ServerHost and ServerPort are the address of the database server
+	ServerHost string
+	ServerPort int32
+	ServerSSL  bool
+	Database   string
+	// CredentialsSecretName is the secret of the Database containing user and password
+	CredentialsSecretName string
+	PoolMode              string
+	PoolSize              int32
+	Labels                map[string]string
+	Conf                  *config.Config
+	// Tunnel forwards the database server through a jump host,
+	// the pooler connects to the forwarded port on localhost then
+	Tunnel *sshtunnel.Sidecar
+}
+
+// poolerTunnelPort is the port the database server is forwarded to,
+// it differs from the port of the pooler which listens in the same pod
+const poolerTunnelPort = 15432
+
+const pgbouncerConfigTemplate = `[databases]
+"{{ .Database }}" = host={{ .ServerHost }} port={{ .ServerPort }} dbname='{{ .Database }}'
+
+[pgbouncer]
+listen_addr = 0.0.0.0
+listen_port = {{ .Port }}
+auth_type = md5
+auth_file = {{ .RuntimePath }}/userlist.txt
+pool_mode = {{ .PoolMode }}
+default_pool_size = {{ .PoolSize }}
+server_tls_sslmode = {{ if .ServerSSL }}require{{ else }}disable{{ end }}
+ignore_startup_parameters = extra_float_digits
+`
+
+const proxysqlConfigTemplate = `datadir="{{ .RuntimePath }}"
+
+admin_variables=
+{
+	mysql_ifaces="127.0.0.1:6032"
+}
+
+mysql_variables=
+{
+	interfaces="0.0.0.0:{{ .Port }}"
+	monitor_enabled=false
+}
+
+mysql_servers=
+(
+	{ address="{{ .ServerHost }}", port={{ .ServerPort }}, hostgroup=0, max_connections={{ .PoolSize }}, use_ssl={{ if .ServerSSL }}1{{ else }}0{{ end }} }
+)
+
+@include "{{ .RuntimePath }}/users.cnf"
+`
+
+// the file with the password of the user is written on start, so the password is never part of the configmap
+const pgbouncerStartScript = `printf '"%s" "%s"\n' "$DB_USER" "$DB_PASSWORD" > ` + proxyRuntimePath + `/userlist.txt
+exec pgbouncer ` + proxyConfigPath + `/pgbouncer.ini`
+
+func (p *Pooler) port() int32 {
+	if p.Engine == "mysql" {
+		return 3306
+	}
+	return 5432
+}
+
+// serverAddress returns the address the pooler connects to the database server at
+func (p *Pooler) serverAddress() (string, int32) {
+	if p.Tunnel != nil {
+		return sshtunnel.LocalHost, poolerTunnelPort
+	}
+	return p.ServerHost, p.ServerPort
+}
+
+func (p *Pooler) poolMode() string {
+	if p.PoolMode == "" {
+		return defaultPoolMode
+	}
+	return p.PoolMode
+}
+
+func (p *Pooler) poolSize() int32 {
+	if p.PoolSize <= 0 {
+		return defaultPoolSize
+	}
+	return p.PoolSize
+}
+
+func (p *Pooler) image() string {
+	if p.Engine == "mysql" {
+		return p.Conf.Instances.Generic.Pooler.Mysql.Image
+	}
+	return p.Conf.Instances.Generic.Pooler.Postgres.Image
+}
+
+func (p *Pooler) configFileName() string {
+	if p.Engine == "mysql" {
+		return "proxysql.cnf"
+	}
+	return "pgbouncer.ini"
+}
+
+func (p *Pooler) configData() (map[string]string, error) {
+	var tmpl string
+	switch p.Engine {
+	case "postgres":
+		switch p.poolMode() {
+		case PoolModeSession, PoolModeTransaction, PoolModeStatement:
+		default:
+			return nil, fmt.Errorf("unknown pool mode %s", p.PoolMode)
+		}
+		tmpl = pgbouncerConfigTemplate
+	case "mysql":
+		tmpl = proxysqlConfigTemplate
+	default:
+		return nil, errors.New("not supported engine type")
+	}
+
+	t, err := template.New(p.configFileName()).Parse(tmpl)
+	if err != nil {
+		return nil, err
+	}
+
+	serverHost, serverPort := p.serverAddress()
+
+	var buf bytes.Buffer
+	err = t.Execute(&buf, struct {
+		Database    string
+		ServerHost  string
+		ServerPort  int32
+		ServerSSL   bool
+		Port        int32
+		PoolMode    string
+		PoolSize    int32
+		RuntimePath string
+	}{
+		Database:    p.Database,
+		ServerHost:  serverHost,
+		ServerPort:  serverPort,
+		ServerSSL:   p.ServerSSL,
+		Port:        p.port(),
+		PoolMode:    p.poolMode(),
+		PoolSize:    p.poolSize(),
+		RuntimePath: proxyRuntimePath,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]string{p.configFileName(): buf.String()}, nil
+}
+
+func (p *Pooler) buildConfigMap(ownership []metav1.OwnerReference) (*v1.ConfigMap, error) {
+	data, err := p.configData()
+	if err != nil {
+		return nil, err
+	}
+
+	return &v1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "ConfigMap",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            p.NamePrefix + "-pooler-config",
+			Namespace:       p.Namespace,
+			Labels:          p.Labels,
+			OwnerReferences: ownership,
+		},
+		Data: data,
+	}, nil
+}
+
+func (p *Pooler) buildService(ownership []metav1.OwnerReference) (*v1.Service, error) {
+	return &v1.Service{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Service",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            p.NamePrefix + "-svc",
+			Namespace:       p.Namespace,
+			Labels:          p.Labels,
+			OwnerReferences: ownership,
+		},
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{
+				{
+					Name:       p.Engine,
+					Port:       p.port(),
+					TargetPort: intstr.FromString("sqlport"),
+					Protocol:   v1.ProtocolTCP,
+				},
+			},
+			Selector: p.Labels,
+		},
+	}, nil
+}
+
+func (p *Pooler) buildDeployment(ownership []metav1.OwnerReference) (*v1apps.Deployment, error) {
+	spec, err := p.deploymentSpec()
+	if err != nil {
+		return nil, err
+	}
+
+	return &v1apps.Deployment{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Deployment",
+			APIVersion: "apps/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            p.NamePrefix + "-pooler",
+			Namespace:       p.Namespace,
+			Labels:          p.Labels,
+			OwnerReferences: ownership,
+		},
+		Spec: spec,
+	}, nil
+}
+
+func (p *Pooler) deploymentSpec() (v1apps.DeploymentSpec, error) {
+	var replicas int32 = 2
+
+	container, err := p.container()
+	if err != nil {
+		return v1apps.DeploymentSpec{}, err
+	}
+
+	data, err := p.configData()
+	if err != nil {
+		return v1apps.DeploymentSpec{}, err
+	}
+	// pods are restarted when the configuration changes
+	annotations := map[string]string{
+		"checksum/config": configChecksum(data),
+	}
+
+	containers := []v1.Container{container}
+	volumes := proxyVolumes(p.NamePrefix + "-pooler-config")
+	if p.Tunnel != nil {
+		sidecar := *p.Tunnel
+		sidecar.LocalPort = strconv.Itoa(poolerTunnelPort)
+		tunnel, err := sidecar.Container()
+		if err != nil {
+			return v1apps.DeploymentSpec{}, err
+		}
+		containers = append(containers, tunnel)
+		volumes = append(volumes, sidecar.Volume())
+	}
+
+	return v1apps.DeploymentSpec{
+		Replicas: &replicas,
+		Selector: &metav1.LabelSelector{
+			MatchLabels: p.Labels,
+		},
+		Template: v1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{
+				Annotations: annotations,
+				Labels:      p.Labels,
+			},
+			Spec: v1.PodSpec{
+				Containers:    containers,
+				NodeSelector:  p.Conf.Instances.Generic.Pooler.NodeSelector,
+				RestartPolicy: v1.RestartPolicyAlways,
+				Volumes:       volumes,
+				Affinity: &v1.Affinity{
+					PodAntiAffinity: podAntiAffinity(p.Labels),
+				},
+			},
+		},
+	}, nil
+}
+
+func (p *Pooler) container() (v1.Container, error) {
+	image := p.image()
+	if image == "" {
+		return v1.Container{}, fmt.Errorf("pooler image for %s is not configured", p.Engine)
+	}
+
+	script := pgbouncerStartScript
+	userKey, passwordKey := "POSTGRES_USER", "POSTGRES_PASSWORD"
+	if p.Engine == "mysql" {
+		script = proxysqlStartScript
+		userKey, passwordKey = "USER", "PASSWORD"
+	}
+
+	AllowPrivilegeEscalation := false
+
+	return v1.Container{
+		Name:    "pooler",
+		Image:   image,
+		Command: []string{"/bin/sh", "-c", script},
+		Env: []v1.EnvVar{
+			secretEnvVar("DB_USER", p.CredentialsSecretName, userKey),
+			secretEnvVar("DB_PASSWORD", p.CredentialsSecretName, passwordKey),
+		},
+		SecurityContext: &v1.SecurityContext{
+			AllowPrivilegeEscalation: &AllowPrivilegeEscalation,
+		},
+		ImagePullPolicy: v1.PullIfNotPresent,
+		Ports: []v1.ContainerPort{
+			{
+				Name:          "sqlport",
+				ContainerPort: p.port(),
+				Protocol:      v1.ProtocolTCP,
+			},
+		},
+		ReadinessProbe: &v1.Probe{
+			ProbeHandler: v1.ProbeHandler{
+				TCPSocket: &v1.TCPSocketAction{Port: intstr.FromString("sqlport")},
+			},
+		},
+		VolumeMounts: proxyVolumeMounts(),
+	}, nil
+}
+
+// buildServiceMonitor returns nil, poolers don't expose prometheus metrics
+func (p *Pooler) buildServiceMonitor(_ []metav1.OwnerReference) (*promv1.ServiceMonitor, error) {
+	return nil, nil
+}
@@ -0,0 +1,346 @@
+/*
+ * Copyright 2021 kloeckner.i GmbH
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"text/template"
+
+	"github.com/kloeckner-i/db-operator/pkg/config"
+	promv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	v1apps "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// hostgroups of proxysql, writes go to the writer hostgroup and reads to the reader hostgroup
+const (
+	proxysqlWriterHostgroup = 0
+	proxysqlReaderHostgroup = 1
+
+	proxysqlDefaultMetricsPort = 6070
+)
+
+// BackendServer is a database server behind the proxy,
+// MaxConnection limits the connections to the server, 0 uses the proxysql default
+type BackendServer struct {
+	Host          string
+	Port          uint16
+	MaxConnection uint16
+	ReadOnly      bool
+}
+
+// ProxySQL for databases on a cluster of mysql servers
+// routes writes to the writable servers and spreads reads across the read-only ones
+type ProxySQL struct {
+	NamePrefix string
+	Namespace  string
+	Servers    []BackendServer
+	ServerSSL  bool
+	// CredentialsSecretName is the secret of the Database containing user and password
+	CredentialsSecretName string
+	Labels                map[string]string
+	Conf                  *config.Config
+	MonitoringEnabled     bool
+}
+
+const proxysqlClusterConfigTemplate = `datadir="{{ .RuntimePath }}"
+
+admin_variables=
+{
+	mysql_ifaces="127.0.0.1:6032"
+	restapi_enabled=true
+	restapi_port={{ .MetricsPort }}
+}
+
+mysql_variables=
+{
+	interfaces="0.0.0.0:3306"
+	monitor_enabled=false
+}
+
+mysql_servers=
+(
+{{- range $i, $server := .Servers }}{{ if $i }},{{ end }}
+	{ address="{{ $server.Host }}", port={{ $server.Port }}, hostgroup={{ $server.Hostgroup }}{{ if $server.MaxConnection }}, max_connections={{ $server.MaxConnection }}{{ end }}, use_ssl={{ if $.ServerSSL }}1{{ else }}0{{ end }} }
+{{- end }}
+)
+
+mysql_query_rules=
+(
+	{ rule_id=1, active=1, match_digest="^SELECT.*FOR UPDATE", destination_hostgroup={{ .WriterHostgroup }}, apply=1 },
+	{ rule_id=2, active=1, match_digest="^SELECT", destination_hostgroup={{ .ReaderHostgroup }}, apply=1 }
+)
+
+@include "{{ .RuntimePath }}/users.cnf"
+`
+
+type proxysqlServer struct {
+	BackendServer
+	Hostgroup int
+}
+
+func (p *ProxySQL) metricsPort() int {
+	if p.Conf.Instances.Percona.ProxyConfig.MetricsPort == 0 {
+		return proxysqlDefaultMetricsPort
+	}
+	return p.Conf.Instances.Percona.ProxyConfig.MetricsPort
+}
+
+// hostgroupServers assigns writable servers to the writer hostgroup and read-only servers to the reader hostgroup,
+// writable servers serve reads as well when there is no read-only server
+func (p *ProxySQL) hostgroupServers() ([]proxysqlServer, error) {
+	servers := []proxysqlServer{}
+	readers := []proxysqlServer{}
+	for _, server := range p.Servers {
+		if server.ReadOnly {
+			readers = append(readers, proxysqlServer{BackendServer: server, Hostgroup: proxysqlReaderHostgroup})
+		} else {
+			servers = append(servers, proxysqlServer{BackendServer: server, Hostgroup: proxysqlWriterHostgroup})
+		}
+	}
+	if len(servers) == 0 {
+		return nil, errors.New("no writable server defined")
+	}
+
+	if len(readers) == 0 {
+		for _, server := range servers {
+			readers = append(readers, proxysqlServer{BackendServer: server.BackendServer, Hostgroup: proxysqlReaderHostgroup})
+		}
+	}
+	return append(servers, readers...), nil
+}
+
+func (p *ProxySQL) configData() (map[string]string, error) {
+	servers, err := p.hostgroupServers()
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := template.New("proxysql.cnf").Parse(proxysqlClusterConfigTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	err = t.Execute(&buf, struct {
+		Servers         []proxysqlServer
+		ServerSSL       bool
+		MetricsPort     int
+		WriterHostgroup int
+		ReaderHostgroup int
+		RuntimePath     string
+	}{
+		Servers:         servers,
+		ServerSSL:       p.ServerSSL,
+		MetricsPort:     p.metricsPort(),
+		WriterHostgroup: proxysqlWriterHostgroup,
+		ReaderHostgroup: proxysqlReaderHostgroup,
+		RuntimePath:     proxyRuntimePath,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]string{"proxysql.cnf": buf.String()}, nil
+}
+
+func (p *ProxySQL) buildConfigMap(ownership []metav1.OwnerReference) (*v1.ConfigMap, error) {
+	data, err := p.configData()
+	if err != nil {
+		return nil, err
+	}
+
+	return &v1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "ConfigMap",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            p.NamePrefix + "-proxysql-config",
+			Namespace:       p.Namespace,
+			Labels:          p.Labels,
+			OwnerReferences: ownership,
+		},
+		Data: data,
+	}, nil
+}
+
+func (p *ProxySQL) buildService(ownership []metav1.OwnerReference) (*v1.Service, error) {
+	return &v1.Service{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Service",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            p.NamePrefix + "-svc",
+			Namespace:       p.Namespace,
+			Labels:          p.Labels,
+			OwnerReferences: ownership,
+		},
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{
+				{
+					Name:       "mysql",
+					Port:       3306,
+					TargetPort: intstr.FromString("sqlport"),
+					Protocol:   v1.ProtocolTCP,
+				},
+				{
+					Name:       "metrics",
+					Port:       int32(p.metricsPort()),
+					TargetPort: intstr.FromString("metrics"),
+					Protocol:   v1.ProtocolTCP,
+				},
+			},
+			Selector: p.Labels,
+		},
+	}, nil
+}
+
+func (p *ProxySQL) buildDeployment(ownership []metav1.OwnerReference) (*v1apps.Deployment, error) {
+	spec, err := p.deploymentSpec()
+	if err != nil {
+		return nil, err
+	}
+
+	return &v1apps.Deployment{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Deployment",
+			APIVersion: "apps/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            p.NamePrefix + "-proxysql",
+			Namespace:       p.Namespace,
+			Labels:          p.Labels,
+			OwnerReferences: ownership,
+		},
+		Spec: spec,
+	}, nil
+}
+
+func (p *ProxySQL) deploymentSpec() (v1apps.DeploymentSpec, error) {
+	var replicas int32 = 2
+
+	container, err := p.container()
+	if err != nil {
+		return v1apps.DeploymentSpec{}, err
+	}
+
+	data, err := p.configData()
+	if err != nil {
+		return v1apps.DeploymentSpec{}, err
+	}
+	annotations := map[string]string{
+		"checksum/config": configChecksum(data),
+	}
+	if p.MonitoringEnabled {
+		annotations["prometheus.io/scrape"] = "true"
+		annotations["prometheus.io/port"] = strconv.Itoa(p.metricsPort())
+	}
+
+	return v1apps.DeploymentSpec{
+		Replicas: &replicas,
+		Selector: &metav1.LabelSelector{
+			MatchLabels: p.Labels,
+		},
+		Template: v1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{
+				Annotations: annotations,
+				Labels:      p.Labels,
+			},
+			Spec: v1.PodSpec{
+				Containers:    []v1.Container{container},
+				NodeSelector:  p.Conf.Instances.Percona.ProxyConfig.NodeSelector,
+				RestartPolicy: v1.RestartPolicyAlways,
+				Volumes:       proxyVolumes(p.NamePrefix + "-proxysql-config"),
+				Affinity: &v1.Affinity{
+					PodAntiAffinity: podAntiAffinity(p.Labels),
+				},
+			},
+		},
+	}, nil
+}
+
+func (p *ProxySQL) container() (v1.Container, error) {
+	image := p.Conf.Instances.Percona.ProxyConfig.Image
+	if image == "" {
+		return v1.Container{}, errors.New("proxysql image is not configured")
+	}
+
+	AllowPrivilegeEscalation := false
+
+	return v1.Container{
+		Name:    "proxysql",
+		Image:   image,
+		Command: []string{"/bin/sh", "-c", proxysqlStartScript},
+		Env: []v1.EnvVar{
+			secretEnvVar("DB_USER", p.CredentialsSecretName, "USER"),
+			secretEnvVar("DB_PASSWORD", p.CredentialsSecretName, "PASSWORD"),
+		},
+		SecurityContext: &v1.SecurityContext{
+			AllowPrivilegeEscalation: &AllowPrivilegeEscalation,
+		},
+		ImagePullPolicy: v1.PullIfNotPresent,
+		Ports: []v1.ContainerPort{
+			{
+				Name:          "sqlport",
+				ContainerPort: 3306,
+				Protocol:      v1.ProtocolTCP,
+			},
+			{
+				Name:          "metrics",
+				ContainerPort: int32(p.metricsPort()),
+				Protocol:      v1.ProtocolTCP,
+			},
+		},
+		ReadinessProbe: &v1.Probe{
+			ProbeHandler: v1.ProbeHandler{
+				TCPSocket: &v1.TCPSocketAction{Port: intstr.FromString("sqlport")},
+			},
+		},
+		VolumeMounts: proxyVolumeMounts(),
+	}, nil
+}
+
+func (p *ProxySQL) buildServiceMonitor(ownership []metav1.OwnerReference) (*promv1.ServiceMonitor, error) {
+	Endpoint := promv1.Endpoint{
+		Port: "metrics",
+		Path: "/metrics",
+	}
+
+	return &promv1.ServiceMonitor{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            p.NamePrefix + "-sm",
+			Namespace:       p.Namespace,
+			Labels:          p.Labels,
+			OwnerReferences: ownership,
+		},
+		Spec: promv1.ServiceMonitorSpec{
+			Endpoints: []promv1.Endpoint{Endpoint},
+			NamespaceSelector: promv1.NamespaceSelector{
+				MatchNames: []string{p.Namespace},
+			},
+			Selector: metav1.LabelSelector{
+				MatchLabels: p.Labels,
+			},
+		},
+	}, nil
+}
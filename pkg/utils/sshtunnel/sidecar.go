@@ -0,0 +1,140 @@
+/*
+ * Copyright 2021 kloeckner.i GmbH
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package sshtunnel
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/kloeckner-i/db-operator/pkg/utils/kci"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// LocalHost is the address the forwarded port of the database server is reached at inside the pod
+	LocalHost = "127.0.0.1"
+	// KnownHostsKey is the optional key of the secret containing the host keys of the jump host
+	KnownHostsKey = "known_hosts"
+
+	volumeName = "ssh-tunnel"
+	mountPath  = "/srv/k8s/ssh-tunnel/"
+
+	script = `set -e
+HOST_KEY_OPTS="-o StrictHostKeyChecking=yes -o UserKnownHostsFile=` + mountPath + KnownHostsKey + `"
+if [ ! -s ` + mountPath + KnownHostsKey + ` ] && [ "${SKIP_HOST_KEY_VERIFY}" = "true" ]; then
+  HOST_KEY_OPTS="-o StrictHostKeyChecking=no -o UserKnownHostsFile=/dev/null"
+fi
+exec ssh -i ` + mountPath + v1.SSHAuthPrivateKey + ` -p "${SSH_PORT}" ${HOST_KEY_OPTS} \
+  -o ExitOnForwardFailure=yes -o ServerAliveInterval=30 ${SSH_FLAGS} \
+  -L "` + LocalHost + `:${LOCAL_PORT}:${DB_HOST}:${DB_PORT}" "${SSH_USER}@${SSH_HOST}" ${SSH_COMMAND}`
+	// the tunnel of a job waits for the first connection within 60 seconds,
+	// afterwards ssh exits with the last forwarded connection and the job can complete
+	onceCommand = "sleep 60"
+)
+
+// SecretName returns the name of the secret holding the ssh key next to the pods of a database.
+// Secrets can't be referenced across namespaces, so the key is copied into the namespace of the database.
+func SecretName(databaseName string) string {
+	return databaseName + "-ssh-tunnel"
+}
+
+// Secret builds kubernetes secret object
+// containing the private key and the known hosts of the key secret of the instance
+func Secret(name, namespace string, keySecret *v1.Secret, ownership []metav1.OwnerReference) *v1.Secret {
+	data := map[string][]byte{
+		v1.SSHAuthPrivateKey: keySecret.Data[v1.SSHAuthPrivateKey],
+	}
+	if knownHosts, ok := keySecret.Data[KnownHostsKey]; ok {
+		data[KnownHostsKey] = knownHosts
+	}
+	return kci.SecretBuilder(name, namespace, data, ownership)
+}
+
+// Sidecar is a container forwarding the port of a database server through a jump host
+type Sidecar struct {
+	Image string
+	// Host, Port and User of the ssh server on the jump host
+	Host              string
+	Port              uint16
+	User              string
+	SkipHostKeyVerify bool
+	// SecretName is the secret in the namespace of the pod built by Secret
+	SecretName string
+	// ServerHost and ServerPort are the address of the database server as seen from the jump host
+	ServerHost string
+	ServerPort string
+	// LocalPort is the port on LocalHost the database server is forwarded to
+	LocalPort string
+	// Once closes the tunnel with the last forwarded connection, it's used by jobs
+	Once bool
+}
+
+// Container builds the container running the tunnel
+func (s Sidecar) Container() (v1.Container, error) {
+	if s.Image == "" {
+		return v1.Container{}, errors.New("image of ssh tunnel is not configured")
+	}
+
+	port := s.Port
+	if port == 0 {
+		port = 22
+	}
+	// without a remote command ssh only forwards the port until it's stopped
+	flags, command := "-N", ""
+	if s.Once {
+		flags, command = "", onceCommand
+	}
+
+	return v1.Container{
+		Name:            "ssh-tunnel",
+		Image:           s.Image,
+		ImagePullPolicy: v1.PullIfNotPresent,
+		Command:         []string{"/bin/sh", "-c", script},
+		Env: []v1.EnvVar{
+			{Name: "SSH_HOST", Value: s.Host},
+			{Name: "SSH_PORT", Value: strconv.Itoa(int(port))},
+			{Name: "SSH_USER", Value: s.User},
+			{Name: "SSH_FLAGS", Value: flags},
+			{Name: "SSH_COMMAND", Value: command},
+			{Name: "SKIP_HOST_KEY_VERIFY", Value: strconv.FormatBool(s.SkipHostKeyVerify)},
+			{Name: "DB_HOST", Value: s.ServerHost},
+			{Name: "DB_PORT", Value: s.ServerPort},
+			{Name: "LOCAL_PORT", Value: s.LocalPort},
+		},
+		VolumeMounts: []v1.VolumeMount{
+			{
+				Name:      volumeName,
+				MountPath: mountPath,
+			},
+		},
+	}, nil
+}
+
+// Volume builds the volume of the secret mounted by the container
+func (s Sidecar) Volume() v1.Volume {
+	// ssh refuses private keys which are readable by others
+	mode := int32(0o400)
+	return v1.Volume{
+		Name: volumeName,
+		VolumeSource: v1.VolumeSource{
+			Secret: &v1.SecretVolumeSource{
+				SecretName:  s.SecretName,
+				DefaultMode: &mode,
+			},
+		},
+	}
+}